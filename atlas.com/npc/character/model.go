@@ -0,0 +1,111 @@
+package character
+
+import (
+	_map "github.com/Chronicle20/atlas-constants/map"
+)
+
+// Model represents the attributes of a character
+type Model struct {
+	id           uint32
+	name         string
+	gender       byte
+	level        byte
+	experience   uint32
+	jobId        uint16
+	meso         uint32
+	fame         int16
+	mapId        _map.Id
+	strength     uint16
+	dexterity    uint16
+	intelligence uint16
+	luck         uint16
+	hp           uint16
+	maxHp        uint16
+	mp           uint16
+	maxMp        uint16
+}
+
+// Id returns the character ID
+func (m Model) Id() uint32 {
+	return m.id
+}
+
+// Name returns the character name
+func (m Model) Name() string {
+	return m.name
+}
+
+// Gender returns the character gender
+func (m Model) Gender() byte {
+	return m.gender
+}
+
+// Level returns the character level
+func (m Model) Level() byte {
+	return m.level
+}
+
+// Experience returns the experience towards the next level
+func (m Model) Experience() uint32 {
+	return m.experience
+}
+
+// JobId returns the character job ID
+func (m Model) JobId() uint16 {
+	return m.jobId
+}
+
+// Meso returns the mesos held by the character
+func (m Model) Meso() uint32 {
+	return m.meso
+}
+
+// Fame returns the character fame
+func (m Model) Fame() int16 {
+	return m.fame
+}
+
+// MapId returns the ID of the map the character is in
+func (m Model) MapId() _map.Id {
+	return m.mapId
+}
+
+// Strength returns the character strength
+func (m Model) Strength() uint16 {
+	return m.strength
+}
+
+// Dexterity returns the character dexterity
+func (m Model) Dexterity() uint16 {
+	return m.dexterity
+}
+
+// Intelligence returns the character intelligence
+func (m Model) Intelligence() uint16 {
+	return m.intelligence
+}
+
+// Luck returns the character luck
+func (m Model) Luck() uint16 {
+	return m.luck
+}
+
+// Hp returns the character hit points
+func (m Model) Hp() uint16 {
+	return m.hp
+}
+
+// MaxHp returns the character maximum hit points
+func (m Model) MaxHp() uint16 {
+	return m.maxHp
+}
+
+// Mp returns the character magic points
+func (m Model) Mp() uint16 {
+	return m.mp
+}
+
+// MaxMp returns the character maximum magic points
+func (m Model) MaxMp() uint16 {
+	return m.maxMp
+}
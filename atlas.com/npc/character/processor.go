@@ -0,0 +1,38 @@
+package character
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+)
+
+// Processor is the interface for retrieving characters
+type Processor interface {
+	// GetById retrieves the attributes of a character
+	GetById(characterId uint32) (Model, error)
+}
+
+// ProcessorImpl is the implementation of the Processor interface
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+}
+
+// NewProcessor creates a new character processor
+func NewProcessor(l logrus.FieldLogger, ctx context.Context) *ProcessorImpl {
+	return &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+	}
+}
+
+// GetById retrieves the attributes of a character
+func (p *ProcessorImpl) GetById(characterId uint32) (Model, error) {
+	rm, err := requestById(characterId)(p.l, p.ctx)
+	if err != nil {
+		p.l.WithError(err).WithFields(logrus.Fields{
+			"character_id": characterId,
+		}).Error("Failed to retrieve character")
+		return Model{}, err
+	}
+	return Extract(rm)
+}
@@ -0,0 +1,15 @@
+package character
+
+import (
+	"atlas-npc-conversations/rest"
+	"fmt"
+	"github.com/Chronicle20/atlas-rest/requests"
+)
+
+func getBaseRequest() string {
+	return requests.RootUrl("QUERY_AGGREGATOR")
+}
+
+func requestById(id uint32) requests.Request[RestModel] {
+	return rest.MakeGetRequest[RestModel](fmt.Sprintf(getBaseRequest()+"characters/%d", id))
+}
@@ -0,0 +1,75 @@
+package character
+
+import (
+	"fmt"
+	_map "github.com/Chronicle20/atlas-constants/map"
+	"strconv"
+)
+
+const (
+	Resource = "characters"
+)
+
+// RestModel represents the REST model for characters
+type RestModel struct {
+	Id           uint32  `json:"-"`
+	Name         string  `json:"name"`
+	Gender       byte    `json:"gender"`
+	Level        byte    `json:"level"`
+	Experience   uint32  `json:"experience"`
+	JobId        uint16  `json:"jobId"`
+	Meso         uint32  `json:"meso"`
+	Fame         int16   `json:"fame"`
+	MapId        _map.Id `json:"mapId"`
+	Strength     uint16  `json:"strength"`
+	Dexterity    uint16  `json:"dexterity"`
+	Intelligence uint16  `json:"intelligence"`
+	Luck         uint16  `json:"luck"`
+	Hp           uint16  `json:"hp"`
+	MaxHp        uint16  `json:"maxHp"`
+	Mp           uint16  `json:"mp"`
+	MaxMp        uint16  `json:"maxMp"`
+}
+
+// GetName returns the resource name
+func (r RestModel) GetName() string {
+	return Resource
+}
+
+// GetID returns the resource ID
+func (r RestModel) GetID() string {
+	return strconv.FormatUint(uint64(r.Id), 10)
+}
+
+// SetID sets the resource ID
+func (r *RestModel) SetID(idStr string) error {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid character ID: %w", err)
+	}
+	r.Id = uint32(id)
+	return nil
+}
+
+// Extract converts a REST model to a domain model
+func Extract(rm RestModel) (Model, error) {
+	return Model{
+		id:           rm.Id,
+		name:         rm.Name,
+		gender:       rm.Gender,
+		level:        rm.Level,
+		experience:   rm.Experience,
+		jobId:        rm.JobId,
+		meso:         rm.Meso,
+		fame:         rm.Fame,
+		mapId:        rm.MapId,
+		strength:     rm.Strength,
+		dexterity:    rm.Dexterity,
+		intelligence: rm.Intelligence,
+		luck:         rm.Luck,
+		hp:           rm.Hp,
+		maxHp:        rm.MaxHp,
+		mp:           rm.Mp,
+		maxMp:        rm.MaxMp,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/localization"
 	"bytes"
 	"encoding/json"
 	"testing"
@@ -143,14 +144,14 @@ func TestCompleteConversationModel_APIContract(t *testing.T) {
 				Id:        "greeting",
 				StateType: "listSelection",
 				ListSelection: &RestListSelectionModel{
-					Title: "Welcome! How can I help you?",
+					Title: localization.RestText{Default: "Welcome! How can I help you?"},
 					Choices: []RestChoiceModel{
 						{
-							Text:      "I need quest items",
+							Text:      localization.RestText{Default: "I need quest items"},
 							NextState: "check_items",
 						},
 						{
-							Text:      "Tell me about the quest",
+							Text:      localization.RestText{Default: "Tell me about the quest"},
 							NextState: "quest_info",
 						},
 					},
@@ -198,10 +199,10 @@ func TestCompleteConversationModel_APIContract(t *testing.T) {
 				StateType: "dialogue",
 				Dialogue: &RestDialogueModel{
 					DialogueType: "npc",
-					Text:         "Great! You have all the required items.",
+					Text:         localization.RestText{Default: "Great! You have all the required items."},
 					Choices: []RestChoiceModel{
 						{
-							Text:      "#LLet's claim the reward!",
+							Text:      localization.RestText{Default: "#LLet's claim the reward!"},
 							NextState: "reward",
 						},
 					},
@@ -447,4 +448,207 @@ func TestBackwardCompatibility_NumericStringItemId(t *testing.T) {
 			assert.Equal(t, itemId, domainCondition.ItemId())
 		})
 	}
-}
\ No newline at end of file
+}
+
+// TestDialogueTransitions_RoundTrip validates explicit dialogue transitions survive JSON serialization and extraction
+func TestDialogueTransitions_RoundTrip(t *testing.T) {
+	restDialogue := RestDialogueModel{
+		DialogueType: "sendYesNo",
+		Text:         localization.RestText{Default: "Would you like to continue?"},
+		OnYes:        "accepted",
+		OnNo:         "declined",
+		OnExit:       "closed",
+	}
+
+	jsonData, err := json.Marshal(restDialogue)
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"onYes":"accepted"`)
+	assert.NotContains(t, string(jsonData), `"nextState"`)
+	assert.NotContains(t, string(jsonData), `"choices"`)
+
+	var unmarshaled RestDialogueModel
+	require.NoError(t, json.Unmarshal(jsonData, &unmarshaled))
+
+	dialogue, err := ExtractDialogue(unmarshaled)
+	require.NoError(t, err)
+	assert.Equal(t, "accepted", dialogue.OnYes())
+	assert.Equal(t, "declined", dialogue.OnNo())
+	assert.Equal(t, "closed", dialogue.OnExit())
+
+	transformed, err := TransformDialogue(*dialogue)
+	require.NoError(t, err)
+	assert.Equal(t, restDialogue.OnYes, transformed.OnYes)
+	assert.Equal(t, restDialogue.OnNo, transformed.OnNo)
+	assert.Equal(t, restDialogue.OnExit, transformed.OnExit)
+	assert.Empty(t, transformed.Choices)
+
+	next, err := ExtractDialogue(RestDialogueModel{DialogueType: "sendNext", Text: localization.RestText{Default: "Hello"}, NextState: "second"})
+	require.NoError(t, err)
+	assert.Equal(t, "second", next.NextState())
+}
+
+// TestInputDialogue_RoundTrip validates getNumber and getText configuration survives extraction and transformation
+func TestInputDialogue_RoundTrip(t *testing.T) {
+	restNumber := RestDialogueModel{
+		DialogueType: "getNumber",
+		Text:         localization.RestText{Default: "How many would you like?"},
+		Choices:      []RestChoiceModel{},
+		NextState:    "confirm",
+		NumberInput:  &RestNumberInputModel{ContextKey: "quantity", DefaultValue: 1, MinValue: 1, MaxValue: 100},
+	}
+	number, err := ExtractDialogue(restNumber)
+	require.NoError(t, err)
+	transformedNumber, err := TransformDialogue(*number)
+	require.NoError(t, err)
+	assert.Equal(t, restNumber, transformedNumber)
+
+	restText := RestDialogueModel{
+		DialogueType: "getText",
+		Text:         localization.RestText{Default: "What is your guild name?"},
+		Choices:      []RestChoiceModel{},
+		NextState:    "create",
+		TextInput:    &RestTextInputModel{ContextKey: "guildName", MinLength: 3, MaxLength: 12},
+	}
+	text, err := ExtractDialogue(restText)
+	require.NoError(t, err)
+	transformedText, err := TransformDialogue(*text)
+	require.NoError(t, err)
+	assert.Equal(t, restText, transformedText)
+
+	jsonData, err := json.Marshal(transformedText)
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"textInput":{"contextKey":"guildName"`)
+	assert.NotContains(t, string(jsonData), `"numberInput"`)
+}
+
+// TestStyleSelectionState_RoundTrip validates style selection states survive extraction and transformation
+func TestStyleSelectionState_RoundTrip(t *testing.T) {
+	restState := RestStateModel{
+		Id:        "chooseHair",
+		StateType: "styleSelection",
+		StyleSelection: &RestStyleSelectionModel{
+			Text:        localization.RestText{Default: "Which style would you like?"},
+			StylesFrom:  "availableHair",
+			ContextKey:  "selectedHair",
+			NextState:   "applyHair",
+			CancelState: "cancelled",
+		},
+	}
+
+	state, err := ExtractState(restState)
+	require.NoError(t, err)
+	assert.Equal(t, StyleSelectionType, state.Type())
+	require.NotNil(t, state.StyleSelection())
+
+	transformed, err := TransformState(state)
+	require.NoError(t, err)
+	require.NotNil(t, transformed.StyleSelection)
+	assert.Equal(t, *restState.StyleSelection, *transformed.StyleSelection)
+
+	jsonData, err := json.Marshal(transformed)
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"type":"styleSelection"`)
+	assert.NotContains(t, string(jsonData), `"styles"`)
+}
+
+// TestChoiceTemplate_RoundTrip validates generated choice templates survive extraction and transformation
+func TestChoiceTemplate_RoundTrip(t *testing.T) {
+	restListSelection := RestListSelectionModel{
+		Title:   localization.RestText{Default: "Where would you like to go?"},
+		Choices: []RestChoiceModel{},
+		ChoiceTemplate: &RestChoiceTemplateModel{
+			From:       "context.destinations",
+			Text:       localization.RestText{Default: "${mapName(option.value)}"},
+			ContextKey: "destination",
+			NextState:  "travel",
+			Conditions: []RestConditionModel{{Type: "meso", Operator: ">=", Value: "1000"}},
+		},
+	}
+
+	listSelection, err := ExtractListSelection(restListSelection)
+	require.NoError(t, err)
+	transformed, err := TransformListSelection(*listSelection)
+	require.NoError(t, err)
+	assert.Equal(t, restListSelection, transformed)
+}
+
+func TestChoiceConditions_RoundTrip(t *testing.T) {
+	restListSelection := RestListSelectionModel{
+		Title: localization.RestText{Default: "What would you like to do?"},
+		Choices: []RestChoiceModel{
+			{
+				Text:      localization.RestText{Default: "Advance to third job"},
+				NextState: "third",
+				Context:   map[string]string{},
+				Conditions: []RestConditionModel{
+					{Type: "jobId", Operator: "=", Value: "110"},
+					{Type: "any", Conditions: []RestConditionModel{
+						{Type: "level", Operator: ">=", Value: "70"},
+						{Type: "item", Operator: ">=", Value: "1", ItemId: "4031059"},
+					}},
+				},
+			},
+			{Text: localization.RestText{Default: "Exit"}, Context: map[string]string{}},
+		},
+	}
+
+	listSelection, err := ExtractListSelection(restListSelection)
+	require.NoError(t, err)
+	require.Len(t, listSelection.Choices()[0].Conditions(), 2)
+	transformed, err := TransformListSelection(*listSelection)
+	require.NoError(t, err)
+	assert.Equal(t, restListSelection, transformed)
+}
+
+func TestOptionSets_RoundTrip(t *testing.T) {
+	restModel := RestModel{
+		Id:         uuid.New(),
+		NpcId:      2040016,
+		StartState: "choose",
+		States: []RestStateModel{
+			{
+				Id:        "choose",
+				StateType: "listSelection",
+				ListSelection: &RestListSelectionModel{
+					Title:   localization.RestText{Default: "What would you like to refine?"},
+					Choices: []RestChoiceModel{},
+					ChoiceTemplate: &RestChoiceTemplateModel{
+						From:       "optionSet.refining",
+						Text:       localization.RestText{Default: "${itemIcon(option.value)} ${option.name}"},
+						ContextKey: "recipe",
+						NextState:  "refine",
+						Conditions: []RestConditionModel{},
+					},
+				},
+			},
+			{
+				Id:        "refine",
+				StateType: "craftAction",
+				CraftAction: &RestCraftActionModel{
+					Materials:             []uint32{},
+					Quantities:            []uint32{},
+					OptionSetId:           "refining",
+					OptionContextKey:      "recipe",
+					SuccessState:          "choose",
+					FailureState:          "choose",
+					MissingMaterialsState: "choose",
+				},
+			},
+		},
+		OptionSets: []RestOptionSetModel{
+			{
+				Id: "refining",
+				Options: []RestOptionModel{
+					{Id: 4011000, Name: "Bronze Plate", Materials: []uint32{4010000}, Quantities: []uint32{10}, Meso: 300},
+				},
+			},
+		},
+	}
+
+	model, err := Extract(restModel)
+	require.NoError(t, err)
+	require.Len(t, model.OptionSets(), 1)
+	transformed, err := Transform(model)
+	require.NoError(t, err)
+	assert.Equal(t, restModel, transformed)
+}
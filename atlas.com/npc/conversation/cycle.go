@@ -0,0 +1,128 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxActionSteps is the number of states which may be processed in a single turn before the conversation is ended
+const MaxActionSteps = 100
+
+var (
+	// ErrActionStepBudgetExceeded is returned when a turn processes more than MaxActionSteps states
+	ErrActionStepBudgetExceeded = errors.New("action step budget exceeded")
+	// ErrActionCycle is returned when a turn returns to a state it already processed with the same context
+	ErrActionCycle = errors.New("action cycle detected")
+)
+
+// actionStepGuard tracks the states processed while driving a single turn of a conversation
+type actionStepGuard struct {
+	steps   int
+	visited map[string]bool
+}
+
+// newActionStepGuard creates a guard for a single turn
+func newActionStepGuard() *actionStepGuard {
+	return &actionStepGuard{visited: make(map[string]bool)}
+}
+
+// Visit records that the state of the context is about to be processed. An error is returned when the step budget is
+// exhausted, or when the state was already processed this turn with an identical context, as nothing can then change
+// the path the conversation takes.
+func (g *actionStepGuard) Visit(ctx ConversationContext) error {
+	g.steps++
+	if g.steps > MaxActionSteps {
+		return fmt.Errorf("%w: more than [%d] states processed at state [%s]", ErrActionStepBudgetExceeded, MaxActionSteps, ctx.CurrentState())
+	}
+
+	key := contextFingerprint(ctx)
+	if g.visited[key] {
+		return fmt.Errorf("%w: state [%s] revisited with an unchanged context", ErrActionCycle, ctx.CurrentState())
+	}
+	g.visited[key] = true
+	return nil
+}
+
+// contextFingerprint identifies the current state together with the context values
+func contextFingerprint(ctx ConversationContext) string {
+	keys := make([]string, 0, len(ctx.Context()))
+	for k := range ctx.Context() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(ctx.CurrentState())
+	for _, k := range keys {
+		sb.WriteString("\x00")
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(ctx.Context()[k])
+	}
+	return sb.String()
+}
+
+// isActionState returns true for states which are processed without waiting for the player
+func isActionState(state StateModel) bool {
+	return state.Type() == GenericActionType || state.Type() == CraftActionType
+}
+
+// actionSuccessors returns the states an action state may transition to. An empty ID ends the conversation.
+func actionSuccessors(state StateModel) []string {
+	successors := make([]string, 0)
+	if genericAction := state.GenericAction(); genericAction != nil {
+		for _, outcome := range genericAction.Outcomes() {
+			successors = append(successors, outcome.NextState())
+			if len(outcome.Conditions()) == 0 {
+				// Later outcomes are never evaluated
+				return successors
+			}
+		}
+		// No outcome may match, which ends the conversation
+		return append(successors, "")
+	}
+	if craftAction := state.CraftAction(); craftAction != nil {
+		return append(successors, craftAction.SuccessState(), craftAction.FailureState(), craftAction.MissingMaterialsState())
+	}
+	return successors
+}
+
+// NonTerminatingActionStates returns the IDs of action states from which the conversation can never reach a state
+// waiting for the player, nor end. Reaching any of them spins through action states forever.
+func NonTerminatingActionStates(m Model) []string {
+	actions := make(map[string]StateModel)
+	for _, state := range m.States() {
+		if isActionState(state) {
+			actions[state.Id()] = state
+		}
+	}
+
+	// Repeatedly mark action states with a transition leaving the set of action states, or to one already marked
+	terminates := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for id, state := range actions {
+			if terminates[id] {
+				continue
+			}
+			for _, successor := range actionSuccessors(state) {
+				if _, ok := actions[successor]; !ok || terminates[successor] {
+					terminates[id] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	results := make([]string, 0)
+	for id := range actions {
+		if !terminates[id] {
+			results = append(results, id)
+		}
+	}
+	sort.Strings(results)
+	return results
+}
@@ -0,0 +1,201 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/validator"
+	npc2 "atlas-npc-conversations/kafka/message/npc"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Chronicle20/atlas-kafka/producer"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a generic action state with the given outcomes
+func createTestActionState(t *testing.T, id string, outcomes ...OutcomeModel) StateModel {
+	builder := NewGenericActionBuilder()
+	for _, outcome := range outcomes {
+		builder.AddOutcome(outcome)
+	}
+	genericAction, err := builder.Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId(id).SetGenericAction(genericAction).Build()
+	require.NoError(t, err)
+	return state
+}
+
+// Helper function to create an outcome to the next state, optionally guarded by a level condition
+func createTestOutcome(t *testing.T, nextState string, conditional bool) OutcomeModel {
+	builder := NewOutcomeBuilder().SetNextState(nextState)
+	if conditional {
+		condition, err := NewConditionBuilder().SetType("level").SetOperator(">=").SetValue("10").Build()
+		require.NoError(t, err)
+		builder.AddCondition(condition)
+	}
+	outcome, err := builder.Build()
+	require.NoError(t, err)
+	return outcome
+}
+
+// Helper function to create a conversation from the given states
+func createTestCycleConversation(t *testing.T, states ...StateModel) Model {
+	builder := NewBuilder().SetNpcId(9010000).SetStartState(states[0].Id())
+	for _, state := range states {
+		builder.AddState(state)
+	}
+	m, err := builder.Build()
+	require.NoError(t, err)
+	return m
+}
+
+func TestNonTerminatingActionStates(t *testing.T) {
+	dialogue, err := NewDialogueBuilder().SetDialogueType(SendOk).SetText("Done").Build()
+	require.NoError(t, err)
+	done, err := NewStateBuilder().SetId("done").SetDialogue(dialogue).Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		states   []StateModel
+		expected []string
+	}{
+		{
+			name: "unconditional cycle",
+			states: []StateModel{
+				createTestActionState(t, "a", createTestOutcome(t, "b", false)),
+				createTestActionState(t, "b", createTestOutcome(t, "a", false)),
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "cycle with conditional exit",
+			states: []StateModel{
+				createTestActionState(t, "a", createTestOutcome(t, "done", true), createTestOutcome(t, "b", false)),
+				createTestActionState(t, "b", createTestOutcome(t, "a", false)),
+				done,
+			},
+			expected: []string{},
+		},
+		{
+			name: "cycle without fallback may end the conversation",
+			states: []StateModel{
+				createTestActionState(t, "a", createTestOutcome(t, "b", true)),
+				createTestActionState(t, "b", createTestOutcome(t, "a", false)),
+			},
+			expected: []string{},
+		},
+		{
+			name: "outcomes after an unconditional outcome are ignored",
+			states: []StateModel{
+				createTestActionState(t, "a", createTestOutcome(t, "a", false), createTestOutcome(t, "done", false)),
+				done,
+			},
+			expected: []string{"a"},
+		},
+		{
+			name: "action leading into a cycle",
+			states: []StateModel{
+				createTestActionState(t, "start", createTestOutcome(t, "loop", false)),
+				createTestActionState(t, "loop", createTestOutcome(t, "loop", false)),
+			},
+			expected: []string{"loop", "start"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := createTestCycleConversation(t, tt.states...)
+			assert.Equal(t, tt.expected, NonTerminatingActionStates(m))
+
+			loops := 0
+			for _, err := range Validate(m) {
+				if err.Code == validator.CodeNonTerminatingLoop {
+					loops++
+				}
+			}
+			assert.Equal(t, len(tt.expected), loops)
+		})
+	}
+}
+
+func TestActionStepGuard_Cycle(t *testing.T) {
+	guard := newActionStepGuard()
+	ctx := createTestConversationContext(12345, 9001, "a")
+
+	require.NoError(t, guard.Visit(ctx))
+	ctx.currentState = "b"
+	require.NoError(t, guard.Visit(ctx))
+
+	// Revisiting with a changed context may take a different path
+	ctx.currentState = "a"
+	ctx.context = map[string]string{"counter": "1"}
+	require.NoError(t, guard.Visit(ctx))
+
+	err := guard.Visit(ctx)
+	assert.True(t, errors.Is(err, ErrActionCycle))
+}
+
+func TestActionStepGuard_Budget(t *testing.T) {
+	guard := newActionStepGuard()
+	ctx := createTestConversationContext(12345, 9001, "a")
+
+	for i := 0; i < MaxActionSteps; i++ {
+		ctx.context = map[string]string{"counter": strconv.Itoa(i)}
+		require.NoError(t, guard.Visit(ctx))
+	}
+	ctx.context = map[string]string{"counter": "final"}
+	err := guard.Visit(ctx)
+	assert.True(t, errors.Is(err, ErrActionStepBudgetExceeded))
+}
+
+func TestProcessor_DriveCycle_EmitsErrorEvent(t *testing.T) {
+	defer func() { sessionStore = nil }()
+	sessionStore = initRegistry()
+
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+
+	conversation := createTestCycleConversation(t,
+		createTestActionState(t, "a", createTestOutcome(t, "b", false)),
+		createTestActionState(t, "b", createTestOutcome(t, "a", false)),
+	)
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("a").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+	produced := make(map[string][]kafka.Message)
+	processor := createTestProcessor(t, new(MockOperationExecutor), new(MockEvaluator), tm)
+	processor.producer = func(token string) producer.MessageProducer {
+		return func(provider model.Provider[[]kafka.Message]) error {
+			messages, err := provider()
+			if err != nil {
+				return err
+			}
+			produced[token] = append(produced[token], messages...)
+			return nil
+		}
+	}
+
+	err = processor.drive(characterId, npcId)
+	assert.True(t, errors.Is(err, ErrActionCycle))
+
+	_, err = GetRegistry().GetPreviousContext(tm, characterId)
+	assert.True(t, errors.Is(err, ErrContextNotFound), "the context should be cleared")
+
+	messages := produced[npc2.EnvEventTopicConversationStatus]
+	require.Len(t, messages, 1)
+	assert.JSONEq(t, `{"worldId":1,"channelId":1,"characterId":12345,"npcId":9010000,"type":"ERROR","body":{"conversationId":"`+conversation.Id().String()+`","stateId":"a","reason":"action cycle detected: state [a] revisited with an unchanged context"}}`, string(messages[0].Value))
+}
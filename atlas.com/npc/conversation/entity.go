@@ -13,6 +13,7 @@ type Entity struct {
 	TenantID  uuid.UUID      `gorm:"column:tenant_id;type:uuid;not null"`
 	NpcID     uint32         `gorm:"column:npc_id;not null"`
 	Data      string         `gorm:"column:data;type:jsonb;not null"`
+	Version   uint32         `gorm:"column:version;not null;default:1"`
 	CreatedAt time.Time      `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
 	UpdatedAt time.Time      `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP"`
 	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
@@ -36,6 +37,9 @@ func Make(e Entity) (Model, error) {
 	if err != nil {
 		return Model{}, err
 	}
+	m.version = e.Version
+	m.createdAt = e.CreatedAt
+	m.updatedAt = e.UpdatedAt
 	return m, nil
 }
 
@@ -63,6 +67,7 @@ func ToEntity(m Model, tenantId uuid.UUID) (Entity, error) {
 		TenantID:  tenantId,
 		NpcID:     m.NpcId(),
 		Data:      string(jsonData),
+		Version:   max(m.Version(), 1),
 		CreatedAt: m.CreatedAt(),
 		UpdatedAt: m.UpdatedAt(),
 	}, nil
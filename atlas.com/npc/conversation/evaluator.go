@@ -1,19 +1,21 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/character"
 	"atlas-npc-conversations/validation"
 	"context"
 	"fmt"
 	"github.com/Chronicle20/atlas-tenant"
 	"github.com/sirupsen/logrus"
-	"strconv"
-	"strings"
 )
 
 // Evaluator is the interface for evaluating conditions in conversations
 type Evaluator interface {
 	// EvaluateCondition evaluates a condition for a character
 	EvaluateCondition(characterId uint32, condition ConditionModel) (bool, error)
+
+	// EvaluateConditions evaluates a set of conditions as a conjunction for a character using a single validation request
+	EvaluateConditions(characterId uint32, conditions []ConditionModel) (bool, error)
 }
 
 // EvaluatorImpl is the implementation of the Evaluator interface
@@ -21,6 +23,7 @@ type EvaluatorImpl struct {
 	l           logrus.FieldLogger
 	ctx         context.Context
 	validationP validation.Processor
+	characterP  character.Processor
 	t           tenant.Model
 }
 
@@ -30,13 +33,22 @@ func NewEvaluator(l logrus.FieldLogger, ctx context.Context, t tenant.Model) Eva
 		l:           l,
 		ctx:         ctx,
 		validationP: validation.NewProcessor(l, ctx),
+		characterP:  character.NewProcessor(l, ctx),
 		t:           t,
 	}
 }
 
 // EvaluateCondition evaluates a condition for a character
 func (e *EvaluatorImpl) EvaluateCondition(characterId uint32, condition ConditionModel) (bool, error) {
-	e.l.Debugf("Evaluating condition [%s] for character [%d]", condition.Type(), characterId)
+	return e.EvaluateConditions(characterId, []ConditionModel{condition})
+}
+
+// EvaluateConditions evaluates a set of conditions as a conjunction for a character using a single validation request
+func (e *EvaluatorImpl) EvaluateConditions(characterId uint32, conditions []ConditionModel) (bool, error) {
+	if len(conditions) == 0 {
+		return true, nil
+	}
+	e.l.Debugf("Evaluating [%d] conditions for character [%d]", len(conditions), characterId)
 
 	// Get the conversation context
 	ctx, err := GetRegistry().GetPreviousContext(e.t, characterId)
@@ -45,54 +57,121 @@ func (e *EvaluatorImpl) EvaluateCondition(characterId uint32, condition Conditio
 		return false, err
 	}
 
-	// Get the value from the condition
-	valueStr := condition.Value()
-	var value int
+	// Flatten every leaf condition so the whole tree is validated in one round-trip
+	inputs := make([]validation.ConditionInput, 0, len(conditions))
+	combined := false
+	for _, condition := range conditions {
+		if condition.IsCombinator() {
+			combined = true
+		}
+		inputs, err = e.appendConditionInputs(ctx, inputs, condition)
+		if err != nil {
+			return false, err
+		}
+	}
 
-	// Check if the value is a context reference
-	if strings.HasPrefix(valueStr, "context.") {
-		// Extract the context key
-		contextKey := strings.TrimPrefix(valueStr, "context.")
+	// Validate the character state using the validation processor
+	result, err := e.validationP.ValidateCharacterState(characterId, inputs)
+	if err != nil {
+		e.l.WithError(err).Errorf("Failed to validate character state for conditions [%+v]", conditions)
+		return false, err
+	}
 
-		// Look up the value in the context map
-		contextValue, exists := ctx.Context()[contextKey]
-		if !exists {
-			e.l.Errorf("Context key [%s] not found in conversation context", contextKey)
-			return false, fmt.Errorf("context key [%s] not found", contextKey)
+	results := result.Results()
+	if len(results) != len(inputs) {
+		if !combined {
+			// Without combinators the overall result is the conjunction we need
+			e.l.Debugf("Conditions evaluated to [%t] for character [%d].", result.Passed(), characterId)
+			return result.Passed(), nil
 		}
+		return false, fmt.Errorf("validation returned [%d] results for [%d] conditions", len(results), len(inputs))
+	}
 
-		// Convert the context value to an integer
-		var err error
-		value, err = strconv.Atoi(contextValue)
-		if err != nil {
-			e.l.WithError(err).Errorf("Failed to convert context value [%s] to integer", contextValue)
-			return false, fmt.Errorf("context value [%s] is not a valid integer", contextValue)
+	passed := true
+	idx := 0
+	for _, condition := range conditions {
+		if !combineConditionResults(condition, results, &idx) {
+			passed = false
 		}
-	} else {
-		// Try to convert the value directly to an integer
+	}
+
+	e.l.Debugf("Conditions evaluated to [%t] for character [%d].", passed, characterId)
+	return passed, nil
+}
+
+// appendConditionInputs appends the validation inputs for every leaf of the condition tree, in depth-first order
+func (e *EvaluatorImpl) appendConditionInputs(ctx ConversationContext, inputs []validation.ConditionInput, condition ConditionModel) ([]validation.ConditionInput, error) {
+	if condition.IsCombinator() {
 		var err error
-		value, err = strconv.Atoi(valueStr)
-		if err != nil {
-			e.l.WithError(err).Errorf("Failed to convert value [%s] to integer", valueStr)
-			return false, fmt.Errorf("value [%s] is not a valid integer", valueStr)
+		for _, nested := range condition.Conditions() {
+			inputs, err = e.appendConditionInputs(ctx, inputs, nested)
+			if err != nil {
+				return nil, err
+			}
 		}
+		return inputs, nil
+	}
+
+	value, err := e.resolveConditionValue(ctx, condition.Value(), condition.Option())
+	if err != nil {
+		return nil, err
 	}
 
-	// Create a validation condition input
-	validationCondition := validation.ConditionInput{
+	return append(inputs, validation.ConditionInput{
 		Type:     condition.Type(),
 		Operator: condition.Operator(),
 		Value:    value,
 		ItemId:   condition.ItemId(),
+	}), nil
+}
+
+// resolveConditionValue evaluates a condition value expression to an integer, resolving references to the
+// conversation context, the attributes of the character and the option of a generated choice
+func (e *EvaluatorImpl) resolveConditionValue(ctx ConversationContext, valueStr string, option map[string]string) (int, error) {
+	fetchContext := func() (map[string]string, error) {
+		return ctx.Context(), nil
+	}
+	var fetchCharacter func() (character.Model, error)
+	if e.characterP != nil {
+		fetchCharacter = func() (character.Model, error) {
+			return e.characterP.GetById(ctx.CharacterId())
+		}
 	}
 
-	// Validate the character state using the validation processor
-	result, err := e.validationP.ValidateCharacterState(characterId, []validation.ConditionInput{validationCondition})
+	value, err := evaluateInteger(valueStr, withOption(newExpressionResolver(fetchContext, fetchCharacter), option))
 	if err != nil {
-		e.l.WithError(err).Errorf("Failed to validate character state for condition [%+v]", condition)
-		return false, err
+		e.l.WithError(err).Errorf("Failed to evaluate condition value [%s]", valueStr)
+		return 0, fmt.Errorf("value [%s] is not a valid integer: %w", valueStr, err)
+	}
+	return value, nil
+}
+
+// combineConditionResults applies the condition tree to the flattened leaf results. Every leaf is visited so idx stays aligned.
+func combineConditionResults(condition ConditionModel, results []validation.ConditionResult, idx *int) bool {
+	if !condition.IsCombinator() {
+		passed := results[*idx].Passed
+		*idx++
+		return passed
 	}
 
-	e.l.Debugf("Condition [%s] evaluated to [%t] for character [%d]. Operator [%s], Value [%d].", condition.Type(), result.Passed(), characterId, condition.Operator(), value)
-	return result.Passed(), nil
+	switch condition.Type() {
+	case AnyConditionType:
+		passed := false
+		for _, nested := range condition.Conditions() {
+			if combineConditionResults(nested, results, idx) {
+				passed = true
+			}
+		}
+		return passed
+	case NotConditionType:
+		return !combineConditionResults(condition.Conditions()[0], results, idx)
+	default:
+		passed := true
+		for _, nested := range condition.Conditions() {
+			if !combineConditionResults(nested, results, idx) {
+				passed = false
+			}
+		}
+		return passed
+	}
 }
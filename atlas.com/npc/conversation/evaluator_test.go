@@ -0,0 +1,147 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/validation"
+	"atlas-npc-conversations/validation/mock"
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestEvaluator creates an evaluator whose validation results are driven by the passed map of condition type to outcome
+func createTestEvaluator(outcomes map[string]bool, calls *int, inputs *[]validation.ConditionInput) *EvaluatorImpl {
+	validationP := &mock.ProcessorMock{
+		ValidateCharacterStateFunc: func(characterId uint32, conditions []validation.ConditionInput) (validation.ValidationResult, error) {
+			*calls++
+			*inputs = conditions
+			result := validation.NewValidationResult(characterId)
+			for _, c := range conditions {
+				result.AddConditionResult(validation.ConditionResult{Passed: outcomes[c.Type], Type: validation.ConditionType(c.Type)})
+			}
+			return result, nil
+		},
+	}
+	return &EvaluatorImpl{
+		l:           logrus.New(),
+		ctx:         context.Background(),
+		validationP: validationP,
+		t:           createTestTenant(),
+	}
+}
+
+func leafCondition(t *testing.T, conditionType string) ConditionModel {
+	c, err := NewConditionBuilder().SetType(conditionType).SetOperator(">=").SetValue("1").Build()
+	assert.NoError(t, err)
+	return c
+}
+
+func TestEvaluateConditions_Combinators(t *testing.T) {
+	characterId := uint32(23456)
+	GetRegistry().SetContext(createTestTenant(), characterId, ConversationContext{characterId: characterId, context: map[string]string{}})
+	defer GetRegistry().ClearContext(createTestTenant(), characterId)
+
+	outcomes := map[string]bool{"level": true, "meso": false, "fame": true}
+
+	tests := []struct {
+		name       string
+		conditions func(t *testing.T) []ConditionModel
+		inputs     int
+		expected   bool
+	}{
+		{
+			name: "Conjunction fails when any condition fails",
+			conditions: func(t *testing.T) []ConditionModel {
+				return []ConditionModel{leafCondition(t, "level"), leafCondition(t, "meso")}
+			},
+			inputs:   2,
+			expected: false,
+		},
+		{
+			name: "Conjunction passes when all conditions pass",
+			conditions: func(t *testing.T) []ConditionModel {
+				return []ConditionModel{leafCondition(t, "level"), leafCondition(t, "fame")}
+			},
+			inputs:   2,
+			expected: true,
+		},
+		{
+			name: "Any passes when one nested condition passes",
+			conditions: func(t *testing.T) []ConditionModel {
+				c, err := NewConditionBuilder().SetType(AnyConditionType).AddCondition(leafCondition(t, "meso")).AddCondition(leafCondition(t, "fame")).Build()
+				assert.NoError(t, err)
+				return []ConditionModel{c, leafCondition(t, "level")}
+			},
+			inputs:   3,
+			expected: true,
+		},
+		{
+			name: "Not inverts the nested condition",
+			conditions: func(t *testing.T) []ConditionModel {
+				c, err := NewConditionBuilder().SetType(NotConditionType).AddCondition(leafCondition(t, "meso")).Build()
+				assert.NoError(t, err)
+				return []ConditionModel{c}
+			},
+			inputs:   1,
+			expected: true,
+		},
+		{
+			name: "All nested in not fails when every nested condition passes",
+			conditions: func(t *testing.T) []ConditionModel {
+				all, err := NewConditionBuilder().SetType(AllConditionType).AddCondition(leafCondition(t, "level")).AddCondition(leafCondition(t, "fame")).Build()
+				assert.NoError(t, err)
+				c, err := NewConditionBuilder().SetType(NotConditionType).AddCondition(all).Build()
+				assert.NoError(t, err)
+				return []ConditionModel{c}
+			},
+			inputs:   2,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var inputs []validation.ConditionInput
+			e := createTestEvaluator(outcomes, &calls, &inputs)
+
+			passed, err := e.EvaluateConditions(characterId, tt.conditions(t))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, passed)
+			assert.Equal(t, 1, calls, "conditions should be validated in a single request")
+			assert.Len(t, inputs, tt.inputs)
+		})
+	}
+}
+
+func TestConditionBuilder_CombinatorValidation(t *testing.T) {
+	_, err := NewConditionBuilder().SetType(AnyConditionType).Build()
+	assert.Error(t, err)
+
+	_, err = NewConditionBuilder().SetType(NotConditionType).AddCondition(leafCondition(t, "level")).AddCondition(leafCondition(t, "meso")).Build()
+	assert.Error(t, err)
+
+	c, err := NewConditionBuilder().SetType(AllConditionType).AddCondition(leafCondition(t, "level")).Build()
+	assert.NoError(t, err)
+	assert.True(t, c.IsCombinator())
+	assert.Len(t, c.Conditions(), 1)
+}
+
+func TestExtractTransformCondition_RoundTrip(t *testing.T) {
+	not, err := NewConditionBuilder().SetType(NotConditionType).AddCondition(leafCondition(t, "meso")).Build()
+	assert.NoError(t, err)
+	anyCondition, err := NewConditionBuilder().SetType(AnyConditionType).AddCondition(leafCondition(t, "level")).AddCondition(not).Build()
+	assert.NoError(t, err)
+
+	rm := TransformCondition(anyCondition)
+	assert.Equal(t, AnyConditionType, rm.Type)
+	assert.Empty(t, rm.Operator)
+	assert.Len(t, rm.Conditions, 2)
+	assert.Len(t, rm.Conditions[1].Conditions, 1)
+
+	extracted, err := ExtractCondition(rm)
+	assert.NoError(t, err)
+	assert.Equal(t, anyCondition, extracted)
+}
@@ -0,0 +1,629 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxSourceLength is the longest expression accepted
+	MaxSourceLength = 1024
+	// MaxDepth is the deepest nesting of operators, calls and parentheses accepted
+	MaxDepth = 32
+	// MaxStringLength is the longest string an expression may produce
+	MaxStringLength = 4096
+)
+
+// Reference is a namespaced name an expression looks up when evaluated, such as context.quantity
+type Reference struct {
+	namespace string
+	name      string
+}
+
+// Namespace returns the part of the reference before the first dot
+func (r Reference) Namespace() string {
+	return r.namespace
+}
+
+// Name returns the part of the reference after the first dot
+func (r Reference) Name() string {
+	return r.name
+}
+
+// String returns the reference as written
+func (r Reference) String() string {
+	return r.namespace + "." + r.name
+}
+
+// Resolver looks up the value of a reference
+type Resolver func(ref Reference) (Value, error)
+
+// Expression is a parsed expression
+type Expression struct {
+	source     string
+	root       node
+	references []Reference
+}
+
+// Parse parses the source of an expression
+func Parse(source string) (Expression, error) {
+	return ParseWith(source, nil)
+}
+
+// ParseWith parses the source of an expression which may also call the extra functions. Built-in functions cannot be
+// replaced.
+func ParseWith(source string, extra map[string]Function) (Expression, error) {
+	if len(source) > MaxSourceLength {
+		return Expression{}, fmt.Errorf("expression is longer than [%d] characters", MaxSourceLength)
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	p := &parser{tokens: tokens, extra: extra}
+	root, err := p.parseOr()
+	if err != nil {
+		return Expression{}, err
+	}
+	if p.peek().kind != endToken {
+		return Expression{}, fmt.Errorf("unexpected [%s] at position [%d]", p.peek().text, p.peek().pos)
+	}
+	return Expression{source: source, root: root, references: p.references}, nil
+}
+
+// Source returns the expression as written
+func (e Expression) Source() string {
+	return e.source
+}
+
+// References returns every reference the expression looks up, in the order they are written
+func (e Expression) References() []Reference {
+	return e.references
+}
+
+// Evaluate evaluates the expression, looking up references with the resolver
+func (e Expression) Evaluate(r Resolver) (Value, error) {
+	if e.root == nil {
+		return Value{}, errors.New("expression is empty")
+	}
+	return e.root.eval(r)
+}
+
+// Evaluate parses and evaluates the source of an expression
+func Evaluate(source string, r Resolver) (Value, error) {
+	e, err := Parse(source)
+	if err != nil {
+		return Value{}, err
+	}
+	return e.Evaluate(r)
+}
+
+type tokenKind int
+
+const (
+	endToken tokenKind = iota
+	numberToken
+	stringToken
+	identToken
+	operatorToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits the source into tokens
+func lex(source string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: numberToken, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: identToken, text: string(runes[start:i]), pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != c; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position [%d]", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: stringToken, text: sb.String(), pos: start})
+		default:
+			op := string(c)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/%()<>!,", op) && len(op) == 1 {
+				return nil, fmt.Errorf("unexpected character [%s] at position [%d]", op, i)
+			}
+			tokens = append(tokens, token{kind: operatorToken, text: op, pos: i})
+			i += len([]rune(op))
+		}
+	}
+	return append(tokens, token{kind: endToken, text: "end of expression", pos: len(runes)}), nil
+}
+
+// parser is a recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens     []token
+	extra      map[string]Function
+	pos        int
+	depth      int
+	references []Reference
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != endToken {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators
+func (p *parser) accept(operators ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != operatorToken {
+		return "", false
+	}
+	for _, op := range operators {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(operator string) error {
+	if _, ok := p.accept(operator); !ok {
+		return fmt.Errorf("expected [%s] but found [%s] at position [%d]", operator, p.peek().text, p.peek().pos)
+	}
+	return nil
+}
+
+// enter guards against deeply nested expressions
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return fmt.Errorf("expression is nested deeper than [%d]", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseOr() (node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{or: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return comparisonNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmeticNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmeticNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	op, ok := p.accept("-", "!")
+	if !ok {
+		return p.parsePrimary()
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return unaryNode{op: op, operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case numberToken:
+		i, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("integer [%s] at position [%d] is out of range", t.text, t.pos)
+		}
+		return literalNode{value: Int(i)}, nil
+	case stringToken:
+		return literalNode{value: String(t.text)}, nil
+	case identToken:
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		switch t.text {
+		case "true":
+			return literalNode{value: Bool(true)}, nil
+		case "false":
+			return literalNode{value: Bool(false)}, nil
+		}
+		namespace, name, ok := strings.Cut(t.text, ".")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("unknown identifier [%s] at position [%d]", t.text, t.pos)
+		}
+		ref := Reference{namespace: namespace, name: name}
+		p.references = append(p.references, ref)
+		return referenceNode{ref: ref}, nil
+	case operatorToken:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected [%s] at position [%d]", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	f, ok := functions[name.text]
+	if !ok {
+		f, ok = p.extra[name.text]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown function [%s] at position [%d]", name.text, name.pos)
+	}
+
+	args := make([]node, 0)
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return nil, fmt.Errorf("function [%s] at position [%d] does not accept [%d] arguments", name.text, name.pos, len(args))
+	}
+	return callNode{name: name.text, f: f, args: args}, nil
+}
+
+// node is a node of a parsed expression
+type node interface {
+	eval(r Resolver) (Value, error)
+}
+
+type literalNode struct {
+	value Value
+}
+
+func (n literalNode) eval(_ Resolver) (Value, error) {
+	return n.value, nil
+}
+
+type referenceNode struct {
+	ref Reference
+}
+
+func (n referenceNode) eval(r Resolver) (Value, error) {
+	if r == nil {
+		return Value{}, fmt.Errorf("reference [%s] cannot be resolved", n.ref)
+	}
+	return r(n.ref)
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n unaryNode) eval(r Resolver) (Value, error) {
+	v, err := n.operand.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+	if n.op == "!" {
+		b, err := v.AsBool()
+		if err != nil {
+			return Value{}, err
+		}
+		return Bool(!b), nil
+	}
+	i, err := v.AsInt()
+	if err != nil {
+		return Value{}, err
+	}
+	return Int(-i), nil
+}
+
+type logicalNode struct {
+	or    bool
+	left  node
+	right node
+}
+
+func (n logicalNode) eval(r Resolver) (Value, error) {
+	lv, err := n.left.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+	left, err := lv.AsBool()
+	if err != nil {
+		return Value{}, err
+	}
+	// Short-circuit, as the right operand cannot change the result
+	if left == n.or {
+		return Bool(left), nil
+	}
+	rv, err := n.right.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := rv.AsBool()
+	if err != nil {
+		return Value{}, err
+	}
+	return Bool(right), nil
+}
+
+type arithmeticNode struct {
+	op    string
+	left  node
+	right node
+}
+
+func (n arithmeticNode) eval(r Resolver) (Value, error) {
+	lv, err := n.left.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+	rv, err := n.right.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+
+	// Adding to a string concatenates
+	if n.op == "+" && (lv.Kind() == StringKind || rv.Kind() == StringKind) {
+		return newString(lv.String() + rv.String())
+	}
+
+	left, err := lv.AsInt()
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := rv.AsInt()
+	if err != nil {
+		return Value{}, err
+	}
+	switch n.op {
+	case "+":
+		return Int(left + right), nil
+	case "-":
+		return Int(left - right), nil
+	case "*":
+		return Int(left * right), nil
+	case "/":
+		if right == 0 {
+			return Value{}, errors.New("division by zero")
+		}
+		return Int(left / right), nil
+	default:
+		if right == 0 {
+			return Value{}, errors.New("division by zero")
+		}
+		return Int(left % right), nil
+	}
+}
+
+type comparisonNode struct {
+	op    string
+	left  node
+	right node
+}
+
+func (n comparisonNode) eval(r Resolver) (Value, error) {
+	lv, err := n.left.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+	rv, err := n.right.eval(r)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var cmp int
+	switch {
+	case lv.Kind() == BoolKind || rv.Kind() == BoolKind:
+		if lv.Kind() != rv.Kind() || (n.op != "==" && n.op != "!=") {
+			return Value{}, fmt.Errorf("cannot compare [%s] %s [%s]", lv, n.op, rv)
+		}
+		if lv.b != rv.b {
+			cmp = 1
+		}
+	case lv.Kind() == StringKind && rv.Kind() == StringKind:
+		cmp = strings.Compare(lv.s, rv.s)
+	default:
+		left, err := lv.AsInt()
+		if err != nil {
+			return Value{}, err
+		}
+		right, err := rv.AsInt()
+		if err != nil {
+			return Value{}, err
+		}
+		switch {
+		case left < right:
+			cmp = -1
+		case left > right:
+			cmp = 1
+		}
+	}
+
+	switch n.op {
+	case "==":
+		return Bool(cmp == 0), nil
+	case "!=":
+		return Bool(cmp != 0), nil
+	case "<":
+		return Bool(cmp < 0), nil
+	case "<=":
+		return Bool(cmp <= 0), nil
+	case ">":
+		return Bool(cmp > 0), nil
+	default:
+		return Bool(cmp >= 0), nil
+	}
+}
+
+type callNode struct {
+	name string
+	f    Function
+	args []node
+}
+
+func (n callNode) eval(r Resolver) (Value, error) {
+	args := make([]Value, 0, len(n.args))
+	for _, arg := range n.args {
+		v, err := arg.eval(r)
+		if err != nil {
+			return Value{}, err
+		}
+		args = append(args, v)
+	}
+	v, err := n.f.call(args)
+	if err != nil {
+		return Value{}, fmt.Errorf("function [%s]: %w", n.name, err)
+	}
+	return v, nil
+}
+
+// newString creates a string value, refusing strings longer than MaxStringLength
+func newString(s string) (Value, error) {
+	if len(s) > MaxStringLength {
+		return Value{}, fmt.Errorf("string is longer than [%d] characters", MaxStringLength)
+	}
+	return String(s), nil
+}
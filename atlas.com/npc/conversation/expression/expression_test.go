@@ -0,0 +1,119 @@
+package expression
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a resolver over fixed values
+func createTestResolver(values map[string]Value) Resolver {
+	return func(ref Reference) (Value, error) {
+		if v, ok := values[ref.String()]; ok {
+			return v, nil
+		}
+		return Value{}, errors.New("not found")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	r := createTestResolver(map[string]Value{
+		"context.quantity": Infer("5"),
+		"context.name":     Infer("Maple"),
+		"character.level":  Int(30),
+	})
+
+	tests := []struct {
+		source   string
+		expected Value
+	}{
+		{source: "100", expected: Int(100)},
+		{source: "context.quantity * 1000", expected: Int(5000)},
+		{source: "min(context.quantity, 3)", expected: Int(3)},
+		{source: "max(1, 7, 4)", expected: Int(7)},
+		{source: "(1 + 2) * -3", expected: Int(-9)},
+		{source: "7 / 2 + 7 % 2", expected: Int(4)},
+		{source: "abs(-4)", expected: Int(4)},
+		{source: "'Hello ' + context.name + '!'", expected: String("Hello Maple!")},
+		{source: "concat(context.name, ' x', context.quantity)", expected: String("Maple x5")},
+		{source: "upper(context.name)", expected: String("MAPLE")},
+		{source: "len(\"four\")", expected: Int(4)},
+		{source: "int('12') + 1", expected: Int(13)},
+		{source: "character.level >= 30 && context.quantity < 10", expected: Bool(true)},
+		{source: "!(context.name == 'Maple') || false", expected: Bool(false)},
+		{source: "if(character.level > 50, 'veteran', 'novice')", expected: String("novice")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			v, err := Evaluate(tt.source, r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"quantity",
+		"context.",
+		"unknown(1)",
+		"abs(1, 2)",
+		"'unterminated",
+		"1 = 1",
+		"1 & 2",
+		strings.Repeat("(", MaxDepth+1) + "1" + strings.Repeat(")", MaxDepth+1),
+		strings.Repeat("1+", MaxSourceLength),
+	}
+
+	for _, source := range tests {
+		_, err := Parse(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	r := createTestResolver(map[string]Value{"context.name": Infer("Maple")})
+
+	tests := []string{
+		"1 / 0",
+		"1 % 0",
+		"context.name * 2",
+		"context.missing",
+		"!1",
+		"true < false",
+		"1 && true",
+	}
+
+	for _, source := range tests {
+		_, err := Evaluate(source, r)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestExpression_References(t *testing.T) {
+	e, err := Parse("min(context.amount, character.level * 10)")
+	require.NoError(t, err)
+	require.Len(t, e.References(), 2)
+	assert.Equal(t, "context", e.References()[0].Namespace())
+	assert.Equal(t, "amount", e.References()[0].Name())
+	assert.Equal(t, "character.level", e.References()[1].String())
+
+	_, err = e.Evaluate(nil)
+	assert.Error(t, err, "references cannot be resolved without a resolver")
+}
+
+func TestEvaluate_StringLimit(t *testing.T) {
+	r := createTestResolver(map[string]Value{"context.text": String(strings.Repeat("a", MaxStringLength))})
+
+	_, err := Evaluate("context.text + 'a'", r)
+	assert.Error(t, err)
+	_, err = Evaluate("concat(context.text, context.text)", r)
+	assert.Error(t, err)
+}
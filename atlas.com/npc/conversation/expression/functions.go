@@ -0,0 +1,111 @@
+package expression
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Function is a function callable from an expression
+type Function struct {
+	minArgs int
+	maxArgs int
+	call    func(args []Value) (Value, error)
+}
+
+// NewFunction creates a function accepting between minArgs and maxArgs arguments. A negative maxArgs accepts any
+// number of arguments.
+func NewFunction(minArgs int, maxArgs int, call func(args []Value) (Value, error)) Function {
+	return Function{minArgs: minArgs, maxArgs: maxArgs, call: call}
+}
+
+// functions lists the built-in functions. Functions have no side effects and cannot reach outside the expression.
+var functions = map[string]Function{
+	"min": {minArgs: 1, maxArgs: -1, call: func(args []Value) (Value, error) {
+		return foldInts(args, func(a, b int) int {
+			if b < a {
+				return b
+			}
+			return a
+		})
+	}},
+	"max": {minArgs: 1, maxArgs: -1, call: func(args []Value) (Value, error) {
+		return foldInts(args, func(a, b int) int {
+			if b > a {
+				return b
+			}
+			return a
+		})
+	}},
+	"abs": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		i, err := args[0].AsInt()
+		if err != nil {
+			return Value{}, err
+		}
+		if i < 0 {
+			i = -i
+		}
+		return Int(i), nil
+	}},
+	"int": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		i, err := args[0].AsInt()
+		if err != nil {
+			return Value{}, err
+		}
+		return Int(i), nil
+	}},
+	"str": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		return String(args[0].String()), nil
+	}},
+	"len": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		return Int(utf8.RuneCountInString(args[0].String())), nil
+	}},
+	"upper": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		return String(strings.ToUpper(args[0].String())), nil
+	}},
+	"lower": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		return String(strings.ToLower(args[0].String())), nil
+	}},
+	"trim": {minArgs: 1, maxArgs: 1, call: func(args []Value) (Value, error) {
+		return String(strings.TrimSpace(args[0].String())), nil
+	}},
+	"concat": {minArgs: 0, maxArgs: -1, call: func(args []Value) (Value, error) {
+		var sb strings.Builder
+		for _, arg := range args {
+			sb.WriteString(arg.String())
+			if sb.Len() > MaxStringLength {
+				break
+			}
+		}
+		return newString(sb.String())
+	}},
+	"if": {minArgs: 3, maxArgs: 3, call: func(args []Value) (Value, error) {
+		b, err := args[0].AsBool()
+		if err != nil {
+			return Value{}, err
+		}
+		if b {
+			return args[1], nil
+		}
+		return args[2], nil
+	}},
+}
+
+// foldInts combines integer arguments pairwise
+func foldInts(args []Value, f func(a, b int) int) (Value, error) {
+	if len(args) == 0 {
+		return Value{}, errors.New("at least one argument is required")
+	}
+	result, err := args[0].AsInt()
+	if err != nil {
+		return Value{}, err
+	}
+	for _, arg := range args[1:] {
+		i, err := arg.AsInt()
+		if err != nil {
+			return Value{}, err
+		}
+		result = f(result, i)
+	}
+	return Int(result), nil
+}
@@ -0,0 +1,155 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// PlaceholderOpen starts an expression embedded in a template
+	PlaceholderOpen = "${"
+	// PlaceholderClose ends an expression embedded in a template
+	PlaceholderClose = "}"
+	// PlaceholderEscape is written in a template to produce a literal PlaceholderOpen
+	PlaceholderEscape = "$" + PlaceholderOpen
+)
+
+// templatePart is either literal text or an embedded expression, written over the given number of bytes
+type templatePart struct {
+	text       string
+	expression *Expression
+	written    int
+}
+
+// Template is text with embedded ${expression} placeholders
+type Template struct {
+	source string
+	parts  []templatePart
+}
+
+// ParseTemplate parses text with embedded ${expression} placeholders. The expressions may also call the extra
+// functions.
+func ParseTemplate(source string, extra map[string]Function) (Template, error) {
+	parts := make([]templatePart, 0)
+	var text strings.Builder
+	for i := 0; i < len(source); {
+		if strings.HasPrefix(source[i:], PlaceholderEscape) {
+			text.WriteString(PlaceholderOpen)
+			i += len(PlaceholderEscape)
+			continue
+		}
+		if !strings.HasPrefix(source[i:], PlaceholderOpen) {
+			text.WriteByte(source[i])
+			i++
+			continue
+		}
+
+		start := i + len(PlaceholderOpen)
+		end, err := placeholderEnd(source, start)
+		if err != nil {
+			return Template{}, fmt.Errorf("placeholder at position [%d]: %w", i, err)
+		}
+		e, err := ParseWith(source[start:end], extra)
+		if err != nil {
+			return Template{}, fmt.Errorf("placeholder at position [%d]: %w", i, err)
+		}
+		if text.Len() > 0 {
+			parts = append(parts, templatePart{text: text.String()})
+			text.Reset()
+		}
+		parts = append(parts, templatePart{expression: &e, written: end + len(PlaceholderClose) - i})
+		i = end + len(PlaceholderClose)
+	}
+	if text.Len() > 0 {
+		parts = append(parts, templatePart{text: text.String()})
+	}
+	return Template{source: source, parts: parts}, nil
+}
+
+// placeholderEnd returns the position of the PlaceholderClose ending the placeholder which starts at the position.
+// Quoted strings in the expression may contain PlaceholderClose.
+func placeholderEnd(source string, start int) (int, error) {
+	var quote byte
+	for i := start; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(source[i:], PlaceholderClose):
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("missing [%s]", PlaceholderClose)
+}
+
+// Source returns the template as written
+func (t Template) Source() string {
+	return t.source
+}
+
+// References returns every reference the placeholders look up, in the order they are written
+func (t Template) References() []Reference {
+	refs := make([]Reference, 0)
+	for _, part := range t.parts {
+		if part.expression != nil {
+			refs = append(refs, part.expression.References()...)
+		}
+	}
+	return refs
+}
+
+// Expressions returns the expressions of the placeholders, in the order they are written
+func (t Template) Expressions() []Expression {
+	expressions := make([]Expression, 0)
+	for _, part := range t.parts {
+		if part.expression != nil {
+			expressions = append(expressions, *part.expression)
+		}
+	}
+	return expressions
+}
+
+// Render evaluates the placeholders, looking up references with the resolver, and returns the resulting text
+func (t Template) Render(r Resolver) (string, error) {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		if part.expression == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		v, err := part.expression.Evaluate(r)
+		if err != nil {
+			return "", fmt.Errorf("placeholder [%s]: %w", part.expression.Source(), err)
+		}
+		sb.WriteString(v.String())
+	}
+	return sb.String(), nil
+}
+
+// Render parses and renders a template
+func Render(source string, extra map[string]Function, r Resolver) (string, error) {
+	t, err := ParseTemplate(source, extra)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(r)
+}
+
+// Fill returns the template with every placeholder replaced by the byte repeated over the length of the placeholder,
+// so the text around the placeholders can be checked at its written positions without evaluating them
+func (t Template) Fill(b byte) string {
+	var sb strings.Builder
+	for _, part := range t.parts {
+		if part.expression == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		sb.WriteString(strings.Repeat(string(b), part.written))
+	}
+	return sb.String()
+}
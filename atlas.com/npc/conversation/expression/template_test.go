@@ -0,0 +1,83 @@
+package expression
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	r := createTestResolver(map[string]Value{
+		"context.quantity": Infer("5"),
+		"context.name":     Infer("Maple"),
+	})
+	extra := map[string]Function{
+		"shout": NewFunction(1, 1, func(args []Value) (Value, error) {
+			return String(strings.ToUpper(args[0].String()) + "!"), nil
+		}),
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "No placeholders", expected: "No placeholders"},
+		{source: "You need ${context.quantity} more.", expected: "You need 5 more."},
+		{source: "${context.name}${context.quantity * 2}", expected: "Maple10"},
+		{source: "Hey ${shout(context.name)}", expected: "Hey MAPLE!"},
+		{source: "Braces ${'}'} and ${\"{\"} in strings", expected: "Braces } and { in strings"},
+		{source: "Literal $${context.name}", expected: "Literal ${context.name}"},
+		{source: "Cost: $5 {each}", expected: "Cost: $5 {each}"},
+		{source: "#b${if(context.quantity > 1, 'items', 'item')}#k", expected: "#bitems#k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			tpl, err := ParseTemplate(tt.source, extra)
+			require.NoError(t, err)
+			text, err := tpl.Render(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, text)
+		})
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	tests := []string{
+		"Unterminated ${context.name",
+		"Empty ${}",
+		"Bad ${1 +}",
+		"Unknown ${shout('x')}",
+		"Quote ${'}",
+	}
+
+	for _, source := range tests {
+		_, err := ParseTemplate(source, nil)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestTemplate_References(t *testing.T) {
+	tpl, err := ParseTemplate("Hello ${character.name}, you chose ${context.choice} and ${1 + 2}", nil)
+	require.NoError(t, err)
+	require.Len(t, tpl.References(), 2)
+	assert.Equal(t, "character.name", tpl.References()[0].String())
+	assert.Equal(t, "context.choice", tpl.References()[1].String())
+	require.Len(t, tpl.Expressions(), 3)
+	assert.Equal(t, "1 + 2", tpl.Expressions()[2].Source())
+
+	plain, err := ParseTemplate("Plain text", nil)
+	require.NoError(t, err)
+	assert.Empty(t, plain.Expressions())
+}
+
+func TestTemplate_RenderError(t *testing.T) {
+	r := func(ref Reference) (Value, error) {
+		return Value{}, errors.New("unavailable")
+	}
+	_, err := Render("Hello ${context.name}", nil, r)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kind is the type of a value
+type Kind int
+
+const (
+	IntKind Kind = iota
+	StringKind
+	BoolKind
+)
+
+// String returns the name of the kind
+func (k Kind) String() string {
+	switch k {
+	case IntKind:
+		return "integer"
+	case StringKind:
+		return "string"
+	default:
+		return "boolean"
+	}
+}
+
+// Value is the result of evaluating an expression
+type Value struct {
+	kind Kind
+	i    int
+	s    string
+	b    bool
+}
+
+// Int creates an integer value
+func Int(i int) Value {
+	return Value{kind: IntKind, i: i}
+}
+
+// String creates a string value
+func String(s string) Value {
+	return Value{kind: StringKind, s: s}
+}
+
+// Bool creates a boolean value
+func Bool(b bool) Value {
+	return Value{kind: BoolKind, b: b}
+}
+
+// Infer creates an integer value if the text is an integer, and a string value otherwise. Conversation context values
+// are stored as text, so lookups are inferred.
+func Infer(s string) Value {
+	if i, err := strconv.Atoi(s); err == nil {
+		return Int(i)
+	}
+	return String(s)
+}
+
+// Kind returns the kind of the value
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// AsInt returns the value as an integer. Strings holding an integer are converted.
+func (v Value) AsInt() (int, error) {
+	switch v.kind {
+	case IntKind:
+		return v.i, nil
+	case StringKind:
+		i, err := strconv.Atoi(v.s)
+		if err != nil {
+			return 0, fmt.Errorf("value [%s] is not a valid integer", v.s)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("value [%t] is not a valid integer", v.b)
+	}
+}
+
+// AsBool returns the value as a boolean
+func (v Value) AsBool() (bool, error) {
+	if v.kind != BoolKind {
+		return false, fmt.Errorf("value [%s] is not a boolean", v.String())
+	}
+	return v.b, nil
+}
+
+// String returns the text of the value
+func (v Value) String() string {
+	switch v.kind {
+	case IntKind:
+		return strconv.Itoa(v.i)
+	case StringKind:
+		return v.s
+	default:
+		return strconv.FormatBool(v.b)
+	}
+}
@@ -0,0 +1,240 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/character"
+	"atlas-npc-conversations/conversation/expression"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// ContextNamespace is the namespace of expression references to the conversation context, such as context.quantity
+	ContextNamespace = "context"
+	// CharacterNamespace is the namespace of expression references to character attributes, such as character.level
+	CharacterNamespace = "character"
+	// OptionNamespace is the namespace of expression references to the option a choice template generated a choice
+	// for, option.value and option.name
+	OptionNamespace = "option"
+	// ExpressionPrefix marks a string param whose value is an expression rather than literal text
+	ExpressionPrefix = "="
+)
+
+// characterAttributes maps the attributes which may be referenced in the character namespace to their values
+var characterAttributes = map[string]func(c character.Model) expression.Value{
+	"id":           func(c character.Model) expression.Value { return expression.Int(int(c.Id())) },
+	"name":         func(c character.Model) expression.Value { return expression.String(c.Name()) },
+	"gender":       func(c character.Model) expression.Value { return expression.Int(int(c.Gender())) },
+	"level":        func(c character.Model) expression.Value { return expression.Int(int(c.Level())) },
+	"experience":   func(c character.Model) expression.Value { return expression.Int(int(c.Experience())) },
+	"jobId":        func(c character.Model) expression.Value { return expression.Int(int(c.JobId())) },
+	"meso":         func(c character.Model) expression.Value { return expression.Int(int(c.Meso())) },
+	"fame":         func(c character.Model) expression.Value { return expression.Int(int(c.Fame())) },
+	"mapId":        func(c character.Model) expression.Value { return expression.Int(int(c.MapId())) },
+	"strength":     func(c character.Model) expression.Value { return expression.Int(int(c.Strength())) },
+	"dexterity":    func(c character.Model) expression.Value { return expression.Int(int(c.Dexterity())) },
+	"intelligence": func(c character.Model) expression.Value { return expression.Int(int(c.Intelligence())) },
+	"luck":         func(c character.Model) expression.Value { return expression.Int(int(c.Luck())) },
+	"hp":           func(c character.Model) expression.Value { return expression.Int(int(c.Hp())) },
+	"maxHp":        func(c character.Model) expression.Value { return expression.Int(int(c.MaxHp())) },
+	"mp":           func(c character.Model) expression.Value { return expression.Int(int(c.Mp())) },
+	"maxMp":        func(c character.Model) expression.Value { return expression.Int(int(c.MaxMp())) },
+}
+
+// ParseExpression parses an expression and checks every reference names the conversation context or a known
+// character attribute
+func ParseExpression(source string) (expression.Expression, error) {
+	e, err := expression.Parse(source)
+	if err != nil {
+		return expression.Expression{}, err
+	}
+	for _, ref := range e.References() {
+		if err := checkReference(ref); err != nil {
+			return expression.Expression{}, err
+		}
+	}
+	return e, nil
+}
+
+// checkReference checks the reference names the conversation context, a known character attribute or the value or
+// name of a choice template option
+func checkReference(ref expression.Reference) error {
+	switch ref.Namespace() {
+	case ContextNamespace:
+		return nil
+	case CharacterNamespace:
+		if _, ok := characterAttributes[ref.Name()]; !ok {
+			return fmt.Errorf("unknown character attribute [%s]", ref.Name())
+		}
+		return nil
+	case OptionNamespace:
+		if ref.Name() != OptionValue && ref.Name() != OptionName {
+			return fmt.Errorf("unknown option attribute [%s]", ref.Name())
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown reference [%s]", ref)
+	}
+}
+
+// checkOptionReferences refuses references to the option namespace, which only choice templates may use
+func checkOptionReferences(refs []expression.Reference) error {
+	for _, ref := range refs {
+		if ref.Namespace() == OptionNamespace {
+			return fmt.Errorf("[%s] may only be referenced by choice templates", ref)
+		}
+	}
+	return nil
+}
+
+// checkIntegerExpression parses an expression which must produce an integer. Expressions without references are
+// evaluated, so constant values of the wrong type are caught before they are used.
+func checkIntegerExpression(source string) error {
+	e, err := ParseExpression(source)
+	if err != nil {
+		return err
+	}
+	if len(e.References()) > 0 {
+		return nil
+	}
+	v, err := e.Evaluate(nil)
+	if err != nil {
+		return err
+	}
+	_, err = v.AsInt()
+	return err
+}
+
+// checkParamValue checks the value given for a param. Integer params are expressions, string params are literal text
+// unless they are an expression or a context reference. References are refused for params which may not use them.
+func checkParamValue(p ParamDescriptor, value string) error {
+	source := value
+	if p.Type() == StringParam {
+		if trimmed, ok := strings.CutPrefix(value, ExpressionPrefix); ok {
+			source = trimmed
+		} else if !isContextReference(value) {
+			return nil
+		}
+	}
+
+	e, err := ParseExpression(source)
+	if err != nil {
+		return err
+	}
+	if len(e.References()) > 0 {
+		if err := checkOptionReferences(e.References()); err != nil {
+			return err
+		}
+		if !p.ContextAllowed() {
+			return errors.New("the param may not reference the context or the character")
+		}
+		return nil
+	}
+	if p.Type() == IntegerParam {
+		v, err := e.Evaluate(nil)
+		if err != nil {
+			return err
+		}
+		_, err = v.AsInt()
+		return err
+	}
+	return nil
+}
+
+// evaluateInteger evaluates an expression which must produce an integer
+func evaluateInteger(source string, r expression.Resolver) (int, error) {
+	e, err := ParseExpression(source)
+	if err != nil {
+		return 0, err
+	}
+	v, err := e.Evaluate(r)
+	if err != nil {
+		return 0, err
+	}
+	return v.AsInt()
+}
+
+// evaluateString evaluates a string value, which is literal text unless it is an expression or a context reference
+func evaluateString(value string, r expression.Resolver) (string, error) {
+	source, ok := strings.CutPrefix(value, ExpressionPrefix)
+	if !ok {
+		if !isContextReference(value) {
+			return value, nil
+		}
+		source = value
+	}
+	e, err := ParseExpression(source)
+	if err != nil {
+		return "", err
+	}
+	v, err := e.Evaluate(r)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// newExpressionResolver creates a resolver for the context and character namespaces. The context and the character
+// are only fetched when first referenced, and at most once.
+func newExpressionResolver(fetchContext func() (map[string]string, error), fetchCharacter func() (character.Model, error)) expression.Resolver {
+	var ctx map[string]string
+	var c *character.Model
+	return func(ref expression.Reference) (expression.Value, error) {
+		switch ref.Namespace() {
+		case ContextNamespace:
+			if ctx == nil {
+				fetched, err := fetchContext()
+				if err != nil {
+					return expression.Value{}, err
+				}
+				ctx = fetched
+			}
+			value, exists := ctx[ref.Name()]
+			if !exists {
+				return expression.Value{}, fmt.Errorf("context key [%s] not found", ref.Name())
+			}
+			return expression.Infer(value), nil
+		case CharacterNamespace:
+			attribute, ok := characterAttributes[ref.Name()]
+			if !ok {
+				return expression.Value{}, fmt.Errorf("unknown character attribute [%s]", ref.Name())
+			}
+			if c == nil {
+				if fetchCharacter == nil {
+					return expression.Value{}, errors.New("character attributes are unavailable")
+				}
+				fetched, err := fetchCharacter()
+				if err != nil {
+					return expression.Value{}, err
+				}
+				c = &fetched
+			}
+			return attribute(*c), nil
+		case OptionNamespace:
+			return expression.Value{}, fmt.Errorf("[%s] may only be referenced by choice templates", ref)
+		default:
+			return expression.Value{}, fmt.Errorf("unknown reference [%s]", ref)
+		}
+	}
+}
+
+// withOption creates a resolver for the option namespace over the option a choice was generated for, deferring every
+// other reference to the resolver. Without an option the resolver is returned as is.
+func withOption(r expression.Resolver, option map[string]string) expression.Resolver {
+	if option == nil {
+		return r
+	}
+	return func(ref expression.Reference) (expression.Value, error) {
+		if ref.Namespace() != OptionNamespace {
+			if r == nil {
+				return expression.Value{}, fmt.Errorf("unknown reference [%s]", ref)
+			}
+			return r(ref)
+		}
+		value, exists := option[ref.Name()]
+		if !exists {
+			return expression.Value{}, fmt.Errorf("unknown option attribute [%s]", ref.Name())
+		}
+		return expression.Infer(value), nil
+	}
+}
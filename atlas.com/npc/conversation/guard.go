@@ -0,0 +1,86 @@
+package conversation
+
+import "reflect"
+
+// compileGuards returns, by state ID, the conditions the saga of each generic action state's operations validates
+// before executing any of them, compiled from the outcomes leading to the state. The outcome's own evaluation picks
+// the path, then the saga checks the conditions again and acts atomically, so the character cannot drop a required
+// item in between. Only the leaf conditions every such outcome requires are guarded, so the saga never rejects a path
+// which reached the state legitimately. Conditions under any or not combinators are left to the outcome's evaluation.
+//
+// A state is only guarded when every transition to it is an outcome of a generic action. A state also reached another
+// way, such as from a dialogue, a craft or as the start state, is left unguarded, as the conversation does not record
+// which path reached it and the conditions of one path must not reject another.
+func compileGuards(startState string, states []StateModel) map[string][]ConditionModel {
+	incoming := make(map[string]int)
+	for _, state := range states {
+		for _, transition := range stateTransitions(state) {
+			incoming[transition.Target()]++
+		}
+	}
+
+	paths := make(map[string][][]ConditionModel)
+	for _, state := range states {
+		genericAction := state.GenericAction()
+		if genericAction == nil || genericAction.OnSuccess() != "" {
+			continue
+		}
+		for _, outcome := range genericAction.Outcomes() {
+			paths[outcome.NextState()] = append(paths[outcome.NextState()], requiredConditions(outcome.Conditions()))
+			if len(outcome.Conditions()) == 0 {
+				// Later outcomes are never evaluated
+				break
+			}
+		}
+	}
+
+	guards := make(map[string][]ConditionModel)
+	for _, state := range states {
+		if state.GenericAction() == nil || state.Id() == startState {
+			continue
+		}
+		guarded := paths[state.Id()]
+		if len(guarded) == 0 || len(guarded) != incoming[state.Id()] {
+			continue
+		}
+
+		guard := make([]ConditionModel, 0)
+		for _, condition := range guarded[0] {
+			required := !containsCondition(guard, condition)
+			for _, other := range guarded[1:] {
+				required = required && containsCondition(other, condition)
+			}
+			if required {
+				guard = append(guard, condition)
+			}
+		}
+		if len(guard) > 0 {
+			guards[state.Id()] = guard
+		}
+	}
+	return guards
+}
+
+// requiredConditions returns the leaf conditions which must all pass for the conditions to pass, flattening all
+// combinators
+func requiredConditions(conditions []ConditionModel) []ConditionModel {
+	required := make([]ConditionModel, 0, len(conditions))
+	for _, condition := range conditions {
+		if !condition.IsCombinator() {
+			required = append(required, condition)
+		} else if condition.Type() == AllConditionType {
+			required = append(required, requiredConditions(condition.Conditions())...)
+		}
+	}
+	return required
+}
+
+// containsCondition returns true if the conditions hold an identical condition
+func containsCondition(conditions []ConditionModel, condition ConditionModel) bool {
+	for _, c := range conditions {
+		if reflect.DeepEqual(c, condition) {
+			return true
+		}
+	}
+	return false
+}
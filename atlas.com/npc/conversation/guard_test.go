@@ -0,0 +1,155 @@
+package conversation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a condition on the character
+func createTestCondition(t *testing.T, conditionType string, value string, itemId string) ConditionModel {
+	builder := NewConditionBuilder().SetType(conditionType).SetOperator(">=").SetValue(value)
+	if itemId != "" {
+		builder.SetItemId(itemId)
+	}
+	condition, err := builder.Build()
+	require.NoError(t, err)
+	return condition
+}
+
+// Helper function to create a dialogue state moving to the next state, or ending the conversation
+func createTestDialogueState(t *testing.T, id string, nextState string) StateModel {
+	builder := NewDialogueBuilder().SetDialogueType(SendOk).SetText(id)
+	if nextState != "" {
+		builder.SetDialogueType(SendNext).SetNextState(nextState)
+	}
+	dialogue, err := builder.Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId(id).SetDialogue(dialogue).Build()
+	require.NoError(t, err)
+	return state
+}
+
+// Helper function to create the state exchanging items, whose saga is guarded by the outcomes leading to it
+func createTestExchangeState(t *testing.T) StateModel {
+	destroy, err := NewOperationBuilder().SetType("destroy_item").AddParamValue("itemId", "4001126").AddParamValue("quantity", "10").Build()
+	require.NoError(t, err)
+	award, err := NewOperationBuilder().SetType("award_item").AddParamValue("itemId", "2000000").AddParamValue("quantity", "1").Build()
+	require.NoError(t, err)
+	builder := NewGenericActionBuilder().AddOperation(destroy).AddOperation(award)
+	builder.AddOutcome(createTestOutcome(t, "done", false))
+	genericAction, err := builder.Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId("exchange").SetGenericAction(genericAction).Build()
+	require.NoError(t, err)
+	return state
+}
+
+// Helper function to create a craft state moving to the exchange once crafted
+func createTestCraftToExchangeState(t *testing.T) StateModel {
+	craftAction, err := NewCraftActionBuilder().
+		SetItemId("4001126").
+		SetMaterials([]uint32{4000000}).
+		SetQuantities([]uint32{10}).
+		SetSuccessState("exchange").
+		SetMissingMaterialsState("lacking").
+		Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId("craft").SetCraftAction(craftAction).Build()
+	require.NoError(t, err)
+	return state
+}
+
+func TestModel_Guard(t *testing.T) {
+	items := createTestCondition(t, "item", "10", "4001126")
+	level := createTestCondition(t, "level", "10", "")
+	mesos := createTestCondition(t, "meso", "1000", "")
+	guarded := func(conditions ...ConditionModel) OutcomeModel {
+		builder := NewOutcomeBuilder().SetNextState("exchange")
+		for _, condition := range conditions {
+			builder.AddCondition(condition)
+		}
+		outcome, err := builder.Build()
+		require.NoError(t, err)
+		return outcome
+	}
+	combined, err := NewOutcomeBuilder().
+		SetNextState("exchange").
+		AddAllCondition(items, level).
+		AddAnyCondition(mesos, createTestCondition(t, "fame", "10", "")).
+		AddNotCondition(createTestCondition(t, "jobId", "100", "")).
+		Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		states   []StateModel
+		expected []ConditionModel
+	}{
+		{
+			name: "outcome guards the operations",
+			states: []StateModel{
+				createTestActionState(t, "check", guarded(items, level), createTestOutcome(t, "lacking", false)),
+				createTestExchangeState(t),
+			},
+			expected: []ConditionModel{items, level},
+		},
+		{
+			name: "conditions required by every outcome",
+			states: []StateModel{
+				createTestDialogueState(t, "start", "check"),
+				createTestActionState(t, "check", guarded(items, level), guarded(items, mesos), createTestOutcome(t, "lacking", false)),
+				createTestExchangeState(t),
+			},
+			expected: []ConditionModel{items},
+		},
+		{
+			name: "all combinators are flattened while any and not are left out",
+			states: []StateModel{
+				createTestActionState(t, "check", combined, createTestOutcome(t, "lacking", false)),
+				createTestExchangeState(t),
+			},
+			expected: []ConditionModel{items, level},
+		},
+		{
+			name: "unconditional outcome",
+			states: []StateModel{
+				createTestActionState(t, "check", createTestOutcome(t, "exchange", false)),
+				createTestExchangeState(t),
+			},
+		},
+		{
+			// The conversation does not record which path reached a state, so a state with mixed entries is unguarded
+			name: "mixed entry from a dialogue is unguarded",
+			states: []StateModel{
+				createTestActionState(t, "check", guarded(items), createTestOutcome(t, "skip", false)),
+				createTestDialogueState(t, "skip", "exchange"),
+				createTestExchangeState(t),
+			},
+		},
+		{
+			name: "mixed entry from a craft is unguarded",
+			states: []StateModel{
+				createTestActionState(t, "check", guarded(items), createTestOutcome(t, "craft", false)),
+				createTestCraftToExchangeState(t),
+				createTestExchangeState(t),
+			},
+		},
+		{
+			name: "start state",
+			states: []StateModel{
+				createTestExchangeState(t),
+				createTestActionState(t, "check", guarded(items), createTestOutcome(t, "lacking", false)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := append(tt.states, createTestDialogueState(t, "lacking", ""), createTestDialogueState(t, "done", ""))
+			m := createTestCycleConversation(t, states...)
+			assert.Equal(t, tt.expected, m.Guard("exchange"))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/expression"
+	"atlas-npc-conversations/localization"
+	"fmt"
+	"sort"
+)
+
+// LocaleContextKey is the context key holding the locale chosen by the character. Text is shown in this locale when
+// it is translated, ahead of the tenant's locale.
+const LocaleContextKey = "locale"
+
+// textRenderer renders text shown to the character
+type textRenderer func(t localization.Text) (string, error)
+
+// newTextRenderer creates a renderer translating text into the first of the locales it is translated into, then
+// rendering the translation as a template with the resolver
+func newTextRenderer(locales []string, lookup localization.Lookup, r expression.Resolver) textRenderer {
+	return func(t localization.Text) (string, error) {
+		source, err := t.Resolve(locales, lookup)
+		if err != nil {
+			return "", err
+		}
+		return renderTemplate(source, r)
+	}
+}
+
+// choiceRenderer renders the text of a choice shown to the character
+type choiceRenderer func(c ChoiceModel) (string, error)
+
+// newChoiceRenderer creates a renderer for choice text, which resolves the option namespace to the option the choice
+// was generated for
+func newChoiceRenderer(locales []string, lookup localization.Lookup, r expression.Resolver) choiceRenderer {
+	return func(c ChoiceModel) (string, error) {
+		return newTextRenderer(locales, lookup, withOption(r, c.Option()))(c.Text())
+	}
+}
+
+// conversationText is localized text of a conversation, and the JSON pointer to it in the conversation document
+type conversationText struct {
+	pointer string
+	text    localization.Text
+}
+
+// localizedTexts returns the localized text of every state of the conversation, in document order. Text which is not
+// localized is shown as written in every locale, so it is not returned.
+func localizedTexts(m Model) []conversationText {
+	texts := make([]conversationText, 0)
+	add := func(pointer string, t localization.Text) {
+		if t.Localized() {
+			texts = append(texts, conversationText{pointer: pointer, text: t})
+		}
+	}
+	addChoices := func(pointer string, choices []ChoiceModel) {
+		for i, choice := range choices {
+			add(fmt.Sprintf("%s/choices/%d/text", pointer, i), choice.Text())
+		}
+	}
+	for i, state := range m.States() {
+		pointer := fmt.Sprintf("/states/%d", i)
+		if dialogue := state.Dialogue(); dialogue != nil {
+			add(pointer+"/dialogue/text", dialogue.Text())
+			addChoices(pointer+"/dialogue", dialogue.Choices())
+		}
+		if listSelection := state.ListSelection(); listSelection != nil {
+			add(pointer+"/listSelection/title", listSelection.Title())
+			addChoices(pointer+"/listSelection", listSelection.Choices())
+			if choiceTemplate := listSelection.ChoiceTemplate(); choiceTemplate != nil {
+				add(pointer+"/listSelection/choiceTemplate/text", choiceTemplate.Text())
+			}
+		}
+		if styleSelection := state.StyleSelection(); styleSelection != nil {
+			add(pointer+"/styleSelection/text", styleSelection.Text())
+		}
+	}
+	return texts
+}
+
+// UntranslatedText is localized text of a conversation with no translation for a locale
+type UntranslatedText struct {
+	Locale  string
+	Key     string
+	Pointer string
+}
+
+// Untranslated returns the localized text of the conversation which has no translation for each of the locales, in
+// locale then document order. Text falls back to its default in these locales.
+func Untranslated(m Model, locales []string, lookup localization.Lookup) []UntranslatedText {
+	untranslated := make([]UntranslatedText, 0)
+	texts := localizedTexts(m)
+	for _, locale := range locales {
+		for _, ct := range texts {
+			if _, ok := ct.text.Translation(locale, lookup); !ok {
+				untranslated = append(untranslated, UntranslatedText{Locale: locale, Key: ct.text.Key(), Pointer: ct.pointer})
+			}
+		}
+	}
+	return untranslated
+}
+
+// TranslationLocales returns the locales a conversation is expected to be translated into: the default locale, the
+// locales of the string table and the locales the conversation's text is translated into, sorted
+func TranslationLocales(m Model, tableLocales []string) []string {
+	set := map[string]bool{localization.GetDefaultLocale(): true}
+	for _, locale := range tableLocales {
+		set[locale] = true
+	}
+	for _, ct := range localizedTexts(m) {
+		for locale := range ct.text.Locales() {
+			set[locale] = true
+		}
+	}
+	locales := make([]string, 0, len(set))
+	for locale := range set {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
@@ -0,0 +1,115 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/localization"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a lookup over a string table of translations by key and locale
+func createTestLookup(table map[string]map[string]string) localization.Lookup {
+	return func(key string, locale string) (string, bool) {
+		s, ok := table[key][locale]
+		return s, ok
+	}
+}
+
+// Helper function to create a conversation with localized text
+func createTestLocalizedConversation(t *testing.T) Model {
+	restModel := RestModel{
+		NpcId:      9010000,
+		StartState: "greet",
+		States: []RestStateModel{
+			{
+				Id:        "greet",
+				StateType: "dialogue",
+				Dialogue: &RestDialogueModel{
+					DialogueType: "sendSimple",
+					Text:         localization.RestText{Default: "Hello", Locales: map[string]string{"ko-KR": "안녕하세요"}, Key: "greet.text"},
+					Choices: []RestChoiceModel{
+						{Text: localization.RestText{Default: "Travel", Key: "greet.travel"}, NextState: "travel"},
+						{Text: localization.RestText{Default: "Exit"}},
+					},
+				},
+			},
+			{
+				Id:        "travel",
+				StateType: "listSelection",
+				ListSelection: &RestListSelectionModel{
+					Title: localization.RestText{Default: "Where to?", Locales: map[string]string{"ja-JP": "どこへ？"}},
+					ChoiceTemplate: &RestChoiceTemplateModel{
+						From:       "context.towns",
+						Text:       localization.RestText{Default: "Go to ${option.value}", Key: "travel.town"},
+						ContextKey: "town",
+						NextState:  "greet",
+					},
+				},
+			},
+		},
+	}
+	m, err := Extract(restModel)
+	require.NoError(t, err)
+	return m
+}
+
+func TestTextRenderer(t *testing.T) {
+	fetchContext := func() (map[string]string, error) {
+		return map[string]string{"name": "Maple"}, nil
+	}
+	lookup := createTestLookup(map[string]map[string]string{
+		"welcome": {"ko-KR": "${context.name}님, 환영합니다"},
+	})
+	text := localization.NewLocalizedText("Welcome, ${context.name}", nil, "welcome")
+
+	rendered, err := newTextRenderer([]string{"ko-KR", "en-US"}, lookup, newExpressionResolver(fetchContext, nil))(text)
+	require.NoError(t, err)
+	assert.Equal(t, "Maple님, 환영합니다", rendered)
+
+	rendered, err = newTextRenderer([]string{"ja-JP", "en-US"}, lookup, newExpressionResolver(fetchContext, nil))(text)
+	require.NoError(t, err)
+	assert.Equal(t, "Welcome, Maple", rendered, "untranslated text falls back to the default")
+
+	_, err = newTextRenderer([]string{"en-US"}, lookup, nil)(localization.NewLocalizedText("", nil, "missing"))
+	assert.Error(t, err)
+}
+
+func TestChoiceTemplate_LocalizedGenerate(t *testing.T) {
+	m := createTestLocalizedConversation(t)
+	state, err := m.FindState("travel")
+	require.NoError(t, err)
+
+	choices, err := state.ListSelection().ResolveChoices(map[string]string{"towns": "Henesys,Ellinia"}, nil)
+	require.NoError(t, err)
+	require.Len(t, choices, 2)
+
+	lookup := createTestLookup(map[string]map[string]string{
+		"travel.town": {"ko-KR": "${option.value}(으)로 이동"},
+	})
+	render := newChoiceRenderer([]string{"ko-KR"}, lookup, nil)
+	text, err := render(choices[1])
+	require.NoError(t, err)
+	assert.Equal(t, "Ellinia(으)로 이동", text)
+	text, err = newChoiceRenderer([]string{"en-US"}, lookup, nil)(choices[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Go to Henesys", text)
+}
+
+func TestUntranslated(t *testing.T) {
+	m := createTestLocalizedConversation(t)
+	lookup := createTestLookup(map[string]map[string]string{
+		"greet.travel": {"ko": "여행"},
+		"travel.town":  {"ko-KR": "${option.value}(으)로 이동", "ja-JP": "${option.value}へ"},
+	})
+
+	locales := TranslationLocales(m, []string{"ko-KR"})
+	assert.Equal(t, []string{"en-US", "ja-JP", "ko-KR"}, locales)
+
+	untranslated := Untranslated(m, []string{"ja-JP", "ko-KR"}, lookup)
+	assert.Equal(t, []UntranslatedText{
+		{Locale: "ja-JP", Key: "greet.text", Pointer: "/states/0/dialogue/text"},
+		{Locale: "ja-JP", Key: "greet.travel", Pointer: "/states/0/dialogue/choices/0/text"},
+		{Locale: "ko-KR", Pointer: "/states/1/listSelection/title"},
+	}, untranslated)
+}
@@ -13,11 +13,14 @@ type ProcessorMock struct {
 	StartFunc func(field field.Model, npcId uint32, characterId uint32) error
 
 	// ContinueFunc is a function field for the Continue method
-	ContinueFunc func(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32) error
+	ContinueFunc func(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32, text string) error
 
 	// EndFunc is a function field for the End method
 	EndFunc func(characterId uint32) error
 
+	// ResumeSagaFunc is a function field for the ResumeSaga method
+	ResumeSagaFunc func(transactionId uuid.UUID, succeeded bool, reason string) error
+
 	// CreateFunc is a function field for the Create method
 	CreateFunc func(model conversation.Model) (conversation.Model, error)
 
@@ -50,9 +53,9 @@ func (m *ProcessorMock) Start(field field.Model, npcId uint32, characterId uint3
 }
 
 // Continue is a mock implementation of the conversation.Processor.Continue method
-func (m *ProcessorMock) Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32) error {
+func (m *ProcessorMock) Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32, text string) error {
 	if m.ContinueFunc != nil {
-		return m.ContinueFunc(npcId, characterId, action, lastMessageType, selection)
+		return m.ContinueFunc(npcId, characterId, action, lastMessageType, selection, text)
 	}
 	// Default implementation returns nil (success)
 	return nil
@@ -67,6 +70,15 @@ func (m *ProcessorMock) End(characterId uint32) error {
 	return nil
 }
 
+// ResumeSaga is a mock implementation of the conversation.Processor.ResumeSaga method
+func (m *ProcessorMock) ResumeSaga(transactionId uuid.UUID, succeeded bool, reason string) error {
+	if m.ResumeSagaFunc != nil {
+		return m.ResumeSagaFunc(transactionId, succeeded, reason)
+	}
+	// Default implementation returns nil (success)
+	return nil
+}
+
 // ByIdProvider is a mock implementation of the conversation.Processor.ByIdProvider method
 func (m *ProcessorMock) ByIdProvider(id uuid.UUID) model.Provider[conversation.Model] {
 	if m.ByIdProviderFunc != nil {
@@ -1,20 +1,28 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/localization"
 	"errors"
+	"fmt"
 	"github.com/Chronicle20/atlas-constants/field"
 	"github.com/google/uuid"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Model represents a conversation tree for an NPC
 type Model struct {
-	id         uuid.UUID
-	npcId      uint32
-	startState string
-	states     []StateModel
-	createdAt  time.Time
-	updatedAt  time.Time
+	id          uuid.UUID
+	npcId       uint32
+	startState  string
+	states      []StateModel
+	optionSets  []OptionSetModel
+	idleTimeout uint32
+	version     uint32
+	createdAt   time.Time
+	updatedAt   time.Time
+	guards      map[string][]ConditionModel
 }
 
 // GetId returns the conversation ID
@@ -37,6 +45,37 @@ func (m Model) States() []StateModel {
 	return m.states
 }
 
+// OptionSets returns the option sets declared by the conversation
+func (m Model) OptionSets() []OptionSetModel {
+	return m.optionSets
+}
+
+// FindOptionSet finds an option set by ID
+func (m Model) FindOptionSet(optionSetId string) (OptionSetModel, error) {
+	return findOptionSet(m.optionSets, optionSetId)
+}
+
+// findOptionSet finds an option set by ID
+func findOptionSet(optionSets []OptionSetModel, optionSetId string) (OptionSetModel, error) {
+	for _, optionSet := range optionSets {
+		if optionSet.Id() == optionSetId {
+			return optionSet, nil
+		}
+	}
+	return OptionSetModel{}, fmt.Errorf("option set [%s] not found", optionSetId)
+}
+
+// IdleTimeout returns the seconds a character may leave the conversation unanswered before it is ended, or zero to
+// use the service's idle timeout
+func (m Model) IdleTimeout() uint32 {
+	return m.idleTimeout
+}
+
+// Version returns the revision of the conversation, incremented each time it is updated
+func (m Model) Version() uint32 {
+	return m.version
+}
+
 // GetCreatedAt returns the creation timestamp
 func (m Model) CreatedAt() time.Time {
 	return m.createdAt
@@ -47,6 +86,12 @@ func (m Model) UpdatedAt() time.Time {
 	return m.updatedAt
 }
 
+// Guard returns the conditions the saga of the state's operations validates before executing any of them, compiled
+// from the outcomes leading to the state when the conversation was built
+func (m Model) Guard(stateId string) []ConditionModel {
+	return m.guards[stateId]
+}
+
 // FindState finds a state by ID
 func (m Model) FindState(stateId string) (StateModel, error) {
 	for _, state := range m.states {
@@ -59,12 +104,14 @@ func (m Model) FindState(stateId string) (StateModel, error) {
 
 // Builder is a builder for Model
 type Builder struct {
-	id         uuid.UUID
-	npcId      uint32
-	startState string
-	states     []StateModel
-	createdAt  time.Time
-	updatedAt  time.Time
+	id          uuid.UUID
+	npcId       uint32
+	startState  string
+	states      []StateModel
+	optionSets  []OptionSetModel
+	idleTimeout uint32
+	createdAt   time.Time
+	updatedAt   time.Time
 }
 
 // NewBuilder creates a new Builder
@@ -107,6 +154,24 @@ func (b *Builder) AddState(state StateModel) *Builder {
 	return b
 }
 
+// SetOptionSets sets the option sets declared by the conversation
+func (b *Builder) SetOptionSets(optionSets []OptionSetModel) *Builder {
+	b.optionSets = optionSets
+	return b
+}
+
+// AddOptionSet adds an option set
+func (b *Builder) AddOptionSet(optionSet OptionSetModel) *Builder {
+	b.optionSets = append(b.optionSets, optionSet)
+	return b
+}
+
+// SetIdleTimeout sets the seconds a character may leave the conversation unanswered before it is ended
+func (b *Builder) SetIdleTimeout(idleTimeout uint32) *Builder {
+	b.idleTimeout = idleTimeout
+	return b
+}
+
 // SetCreatedAt sets the creation timestamp
 func (b *Builder) SetCreatedAt(createdAt time.Time) *Builder {
 	b.createdAt = createdAt
@@ -130,35 +195,68 @@ func (b *Builder) Build() (Model, error) {
 	if len(b.states) == 0 {
 		return Model{}, errors.New("at least one state is required")
 	}
+	if err := validateOptionSetReferences(b.states, b.optionSets); err != nil {
+		return Model{}, err
+	}
 
 	return Model{
-		id:         b.id,
-		npcId:      b.npcId,
-		startState: b.startState,
-		states:     b.states,
-		createdAt:  b.createdAt,
-		updatedAt:  b.updatedAt,
+		id:          b.id,
+		npcId:       b.npcId,
+		startState:  b.startState,
+		states:      b.states,
+		optionSets:  b.optionSets,
+		idleTimeout: b.idleTimeout,
+		createdAt:   b.createdAt,
+		updatedAt:   b.updatedAt,
+		guards:      compileGuards(b.startState, b.states),
 	}, nil
 }
 
+// validateOptionSetReferences ensures option set IDs are unique and every option set referenced by a state is declared
+func validateOptionSetReferences(states []StateModel, optionSets []OptionSetModel) error {
+	declared := make(map[string]bool)
+	for _, optionSet := range optionSets {
+		if declared[optionSet.Id()] {
+			return fmt.Errorf("option set [%s] is declared more than once", optionSet.Id())
+		}
+		declared[optionSet.Id()] = true
+	}
+
+	for _, state := range states {
+		referenced := ""
+		if craftAction := state.CraftAction(); craftAction != nil {
+			referenced = craftAction.OptionSetId()
+		}
+		if listSelection := state.ListSelection(); listSelection != nil && listSelection.ChoiceTemplate() != nil {
+			referenced = listSelection.ChoiceTemplate().OptionSetId()
+		}
+		if referenced != "" && !declared[referenced] {
+			return fmt.Errorf("state [%s] references undeclared option set [%s]", state.Id(), referenced)
+		}
+	}
+	return nil
+}
+
 // StateType represents the type of a conversation state
 type StateType string
 
 const (
-	DialogueStateType StateType = "dialogue"
-	GenericActionType StateType = "genericAction"
-	CraftActionType   StateType = "craftAction"
-	ListSelectionType StateType = "listSelection"
+	DialogueStateType  StateType = "dialogue"
+	GenericActionType  StateType = "genericAction"
+	CraftActionType    StateType = "craftAction"
+	ListSelectionType  StateType = "listSelection"
+	StyleSelectionType StateType = "styleSelection"
 )
 
 // StateModel represents a state in a conversation
 type StateModel struct {
-	id            string
-	stateType     StateType
-	dialogue      *DialogueModel
-	genericAction *GenericActionModel
-	craftAction   *CraftActionModel
-	listSelection *ListSelectionModel
+	id             string
+	stateType      StateType
+	dialogue       *DialogueModel
+	genericAction  *GenericActionModel
+	craftAction    *CraftActionModel
+	listSelection  *ListSelectionModel
+	styleSelection *StyleSelectionModel
 }
 
 // Id returns the state ID
@@ -191,14 +289,20 @@ func (s StateModel) ListSelection() *ListSelectionModel {
 	return s.listSelection
 }
 
+// StyleSelection returns the style selection model (if type is styleSelection)
+func (s StateModel) StyleSelection() *StyleSelectionModel {
+	return s.styleSelection
+}
+
 // StateBuilder is a builder for StateModel
 type StateBuilder struct {
-	id            string
-	stateType     StateType
-	dialogue      *DialogueModel
-	genericAction *GenericActionModel
-	craftAction   *CraftActionModel
-	listSelection *ListSelectionModel
+	id             string
+	stateType      StateType
+	dialogue       *DialogueModel
+	genericAction  *GenericActionModel
+	craftAction    *CraftActionModel
+	listSelection  *ListSelectionModel
+	styleSelection *StyleSelectionModel
 }
 
 // NewStateBuilder creates a new StateBuilder
@@ -219,6 +323,7 @@ func (b *StateBuilder) SetDialogue(dialogue *DialogueModel) *StateBuilder {
 	b.genericAction = nil
 	b.craftAction = nil
 	b.listSelection = nil
+	b.styleSelection = nil
 	return b
 }
 
@@ -229,6 +334,7 @@ func (b *StateBuilder) SetGenericAction(genericAction *GenericActionModel) *Stat
 	b.genericAction = genericAction
 	b.craftAction = nil
 	b.listSelection = nil
+	b.styleSelection = nil
 	return b
 }
 
@@ -239,6 +345,7 @@ func (b *StateBuilder) SetCraftAction(craftAction *CraftActionModel) *StateBuild
 	b.genericAction = nil
 	b.craftAction = craftAction
 	b.listSelection = nil
+	b.styleSelection = nil
 	return b
 }
 
@@ -249,6 +356,18 @@ func (b *StateBuilder) SetListSelection(listSelection *ListSelectionModel) *Stat
 	b.genericAction = nil
 	b.craftAction = nil
 	b.listSelection = listSelection
+	b.styleSelection = nil
+	return b
+}
+
+// SetStyleSelection sets the style selection model
+func (b *StateBuilder) SetStyleSelection(styleSelection *StyleSelectionModel) *StateBuilder {
+	b.stateType = StyleSelectionType
+	b.dialogue = nil
+	b.genericAction = nil
+	b.craftAction = nil
+	b.listSelection = nil
+	b.styleSelection = styleSelection
 	return b
 }
 
@@ -275,17 +394,22 @@ func (b *StateBuilder) Build() (StateModel, error) {
 		if b.listSelection == nil {
 			return StateModel{}, errors.New("listSelection is required for listSelection state")
 		}
+	case StyleSelectionType:
+		if b.styleSelection == nil {
+			return StateModel{}, errors.New("styleSelection is required for styleSelection state")
+		}
 	default:
 		return StateModel{}, errors.New("invalid state type")
 	}
 
 	return StateModel{
-		id:            b.id,
-		stateType:     b.stateType,
-		dialogue:      b.dialogue,
-		genericAction: b.genericAction,
-		craftAction:   b.craftAction,
-		listSelection: b.listSelection,
+		id:             b.id,
+		stateType:      b.stateType,
+		dialogue:       b.dialogue,
+		genericAction:  b.genericAction,
+		craftAction:    b.craftAction,
+		listSelection:  b.listSelection,
+		styleSelection: b.styleSelection,
 	}, nil
 }
 
@@ -297,13 +421,24 @@ const (
 	SendYesNo  DialogueType = "sendYesNo"
 	SendSimple DialogueType = "sendSimple"
 	SendNext   DialogueType = "sendNext"
+
+	SendNextPrev      DialogueType = "sendNextPrev"
+	SendAcceptDecline DialogueType = "sendAcceptDecline"
+	GetNumber         DialogueType = "getNumber"
+	GetText           DialogueType = "getText"
 )
 
 // DialogueModel represents a dialogue state
 type DialogueModel struct {
 	dialogueType DialogueType
-	text         string
+	text         localization.Text
 	choices      []ChoiceModel
+	nextState    string
+	onYes        string
+	onNo         string
+	onExit       string
+	numberInput  *NumberInputModel
+	textInput    *TextInputModel
 }
 
 // DialogueType returns the dialogue type
@@ -312,7 +447,7 @@ func (d DialogueModel) DialogueType() DialogueType {
 }
 
 // Text returns the dialogue text
-func (d DialogueModel) Text() string {
+func (d DialogueModel) Text() localization.Text {
 	return d.text
 }
 
@@ -321,6 +456,103 @@ func (d DialogueModel) Choices() []ChoiceModel {
 	return d.choices
 }
 
+// NextState returns the state to transition to when a sendNext, sendNextPrev or sendOk dialogue is acknowledged, or an input dialogue is answered
+func (d DialogueModel) NextState() string {
+	return d.nextState
+}
+
+// OnYes returns the state to transition to when a sendYesNo or sendAcceptDecline dialogue is accepted
+func (d DialogueModel) OnYes() string {
+	return d.onYes
+}
+
+// OnNo returns the state to transition to when a sendYesNo or sendAcceptDecline dialogue is declined
+func (d DialogueModel) OnNo() string {
+	return d.onNo
+}
+
+// OnExit returns the state to transition to when the dialogue is closed
+func (d DialogueModel) OnExit() string {
+	return d.onExit
+}
+
+// NumberInput returns the number input configuration (if type is getNumber)
+func (d DialogueModel) NumberInput() *NumberInputModel {
+	return d.numberInput
+}
+
+// TextInput returns the text input configuration (if type is getText)
+func (d DialogueModel) TextInput() *TextInputModel {
+	return d.textInput
+}
+
+// AwaitsInput returns true if the dialogue has any transition which the player's response can follow
+func (d DialogueModel) AwaitsInput() bool {
+	if d.dialogueType == GetNumber || d.dialogueType == GetText {
+		return true
+	}
+	return len(d.choices) > 0 || d.nextState != "" || d.onYes != "" || d.onNo != "" || d.onExit != ""
+}
+
+// TransitionFromResponse resolves the next state and context for the player's response to the dialogue.
+// Answers to input dialogues are stored under the configured context key. An answer outside of the configured
+// bounds returns the current state ID so the question is asked again.
+func (d DialogueModel) TransitionFromResponse(stateId string, action byte, selection int32, text string) (string, map[string]string) {
+	if d.dialogueType == SendSimple {
+		if action != 1 && d.onExit != "" {
+			return d.onExit, nil
+		}
+		choice, _ := choiceFromSelection(d.choices, action, selection)
+		return choice.NextState(), choice.Context()
+	}
+
+	if action != 1 {
+		if d.dialogueType == GetNumber || d.dialogueType == GetText {
+			return d.onExit, nil
+		}
+		return d.TransitionFromAction(action)
+	}
+
+	if d.dialogueType == GetNumber && d.numberInput != nil {
+		if !d.numberInput.Accepts(selection) {
+			return stateId, nil
+		}
+		return d.nextState, map[string]string{d.numberInput.ContextKey(): strconv.Itoa(int(selection))}
+	}
+	if d.dialogueType == GetText && d.textInput != nil {
+		if !d.textInput.Accepts(text) {
+			return stateId, nil
+		}
+		return d.nextState, map[string]string{d.textInput.ContextKey(): text}
+	}
+	return d.TransitionFromAction(action)
+}
+
+// TransitionFromAction resolves the next state and choice context for the player's response to the dialogue.
+// Explicit transitions take precedence over choices matched by their button text.
+func (d DialogueModel) TransitionFromAction(action byte) (string, map[string]string) {
+	explicit := ""
+	if action == 255 {
+		explicit = d.onExit
+	} else if d.dialogueType == SendYesNo || d.dialogueType == SendAcceptDecline {
+		if action == 0 {
+			explicit = d.onNo
+		} else {
+			explicit = d.onYes
+		}
+	} else if d.dialogueType == SendNext || d.dialogueType == SendOk {
+		explicit = d.nextState
+	} else if d.dialogueType == SendNextPrev && action != 0 {
+		explicit = d.nextState
+	}
+	if explicit != "" {
+		return explicit, nil
+	}
+
+	choice, _ := d.ChoiceFromAction(action)
+	return choice.NextState(), choice.Context()
+}
+
 func (d DialogueModel) ChoiceFromAction(action byte) (ChoiceModel, bool) {
 	choiceText := ""
 	if d.dialogueType == SendNext {
@@ -343,10 +575,26 @@ func (d DialogueModel) ChoiceFromAction(action byte) (ChoiceModel, bool) {
 		} else {
 			choiceText = "Yes"
 		}
+	} else if d.dialogueType == SendNextPrev {
+		if action == 255 {
+			choiceText = "Exit"
+		} else if action == 0 {
+			choiceText = "Previous"
+		} else {
+			choiceText = "Next"
+		}
+	} else if d.dialogueType == SendAcceptDecline {
+		if action == 255 {
+			choiceText = "Exit"
+		} else if action == 0 {
+			choiceText = "Decline"
+		} else {
+			choiceText = "Accept"
+		}
 	}
 
 	for _, choice := range d.choices {
-		if choice.Text() == choiceText {
+		if choice.Text().Default() == choiceText {
 			return choice, true
 		}
 	}
@@ -356,8 +604,14 @@ func (d DialogueModel) ChoiceFromAction(action byte) (ChoiceModel, bool) {
 // DialogueBuilder is a builder for DialogueModel
 type DialogueBuilder struct {
 	dialogueType DialogueType
-	text         string
+	text         localization.Text
 	choices      []ChoiceModel
+	nextState    string
+	onYes        string
+	onNo         string
+	onExit       string
+	numberInput  *NumberInputModel
+	textInput    *TextInputModel
 }
 
 // NewDialogueBuilder creates a new DialogueBuilder
@@ -375,6 +629,12 @@ func (b *DialogueBuilder) SetDialogueType(dialogueType DialogueType) *DialogueBu
 
 // SetText sets the dialogue text
 func (b *DialogueBuilder) SetText(text string) *DialogueBuilder {
+	b.text = localization.NewText(text)
+	return b
+}
+
+// SetLocalizedText sets the dialogue text, translated by locale or looked up in the tenant's string table
+func (b *DialogueBuilder) SetLocalizedText(text localization.Text) *DialogueBuilder {
 	b.text = text
 	return b
 }
@@ -391,51 +651,312 @@ func (b *DialogueBuilder) AddChoice(choice ChoiceModel) *DialogueBuilder {
 	return b
 }
 
+// SetNextState sets the state to transition to when a sendNext, sendNextPrev or sendOk dialogue is acknowledged, or an input dialogue is answered
+func (b *DialogueBuilder) SetNextState(nextState string) *DialogueBuilder {
+	b.nextState = nextState
+	return b
+}
+
+// SetOnYes sets the state to transition to when a sendYesNo or sendAcceptDecline dialogue is accepted
+func (b *DialogueBuilder) SetOnYes(onYes string) *DialogueBuilder {
+	b.onYes = onYes
+	return b
+}
+
+// SetOnNo sets the state to transition to when a sendYesNo or sendAcceptDecline dialogue is declined
+func (b *DialogueBuilder) SetOnNo(onNo string) *DialogueBuilder {
+	b.onNo = onNo
+	return b
+}
+
+// SetOnExit sets the state to transition to when the dialogue is closed
+func (b *DialogueBuilder) SetOnExit(onExit string) *DialogueBuilder {
+	b.onExit = onExit
+	return b
+}
+
+// SetNumberInput sets the number input configuration for a getNumber dialogue
+func (b *DialogueBuilder) SetNumberInput(numberInput *NumberInputModel) *DialogueBuilder {
+	b.numberInput = numberInput
+	return b
+}
+
+// SetTextInput sets the text input configuration for a getText dialogue
+func (b *DialogueBuilder) SetTextInput(textInput *TextInputModel) *DialogueBuilder {
+	b.textInput = textInput
+	return b
+}
+
 // Build builds the DialogueModel
 func (b *DialogueBuilder) Build() (*DialogueModel, error) {
 	if b.dialogueType == "" {
 		return nil, errors.New("dialogueType is required")
 	}
-	if b.text == "" {
+	if b.text.Empty() {
 		return nil, errors.New("text is required")
 	}
 
-	// Validate choices based on dialogue type
+	// Validate choices based on dialogue type. Button driven dialogues may use explicit transitions instead of choices.
 	switch b.dialogueType {
 	case SendOk:
-		if len(b.choices) != 2 {
+		if len(b.choices) != 0 && len(b.choices) != 2 {
 			return nil, errors.New("sendOk requires exactly 2 choices")
 		}
 	case SendNext:
-		if len(b.choices) != 2 {
+		if len(b.choices) != 0 && len(b.choices) != 2 {
 			return nil, errors.New("sendNext requires exactly 2 choices")
 		}
 	case SendYesNo:
-		if len(b.choices) != 3 {
+		if len(b.choices) != 0 && len(b.choices) != 3 {
 			return nil, errors.New("sendYesNo requires exactly 3 choices")
 		}
 	case SendSimple:
 		if len(b.choices) == 0 {
 			return nil, errors.New("sendSimple requires at least 1 choice")
 		}
+	case SendNextPrev:
+		if len(b.choices) != 0 && len(b.choices) != 3 {
+			return nil, errors.New("sendNextPrev requires exactly 3 choices")
+		}
+	case SendAcceptDecline:
+		if len(b.choices) != 0 && len(b.choices) != 3 {
+			return nil, errors.New("sendAcceptDecline requires exactly 3 choices")
+		}
+	case GetNumber:
+		if len(b.choices) != 0 {
+			return nil, errors.New("getNumber does not support choices")
+		}
+		if b.numberInput == nil {
+			return nil, errors.New("getNumber requires numberInput")
+		}
+	case GetText:
+		if len(b.choices) != 0 {
+			return nil, errors.New("getText does not support choices")
+		}
+		if b.textInput == nil {
+			return nil, errors.New("getText requires textInput")
+		}
+	}
+
+	// Validate explicit transitions and inputs apply to the dialogue type
+	if b.nextState != "" && b.dialogueType != SendOk && b.dialogueType != SendNext && b.dialogueType != SendNextPrev && b.dialogueType != GetNumber && b.dialogueType != GetText {
+		return nil, fmt.Errorf("nextState is not supported for %s", b.dialogueType)
+	}
+	if (b.onYes != "" || b.onNo != "") && b.dialogueType != SendYesNo && b.dialogueType != SendAcceptDecline {
+		return nil, fmt.Errorf("onYes and onNo are not supported for %s", b.dialogueType)
+	}
+	if b.numberInput != nil && b.dialogueType != GetNumber {
+		return nil, fmt.Errorf("numberInput is not supported for %s", b.dialogueType)
+	}
+	if b.textInput != nil && b.dialogueType != GetText {
+		return nil, fmt.Errorf("textInput is not supported for %s", b.dialogueType)
 	}
 
 	return &DialogueModel{
 		dialogueType: b.dialogueType,
 		text:         b.text,
 		choices:      b.choices,
+		nextState:    b.nextState,
+		onYes:        b.onYes,
+		onNo:         b.onNo,
+		onExit:       b.onExit,
+		numberInput:  b.numberInput,
+		textInput:    b.textInput,
+	}, nil
+}
+
+// NumberInputModel represents the configuration of a getNumber dialogue
+type NumberInputModel struct {
+	contextKey   string
+	defaultValue int32
+	minValue     int32
+	maxValue     int32
+}
+
+// ContextKey returns the context key the answer is stored under
+func (n NumberInputModel) ContextKey() string {
+	return n.contextKey
+}
+
+// DefaultValue returns the value initially shown to the player
+func (n NumberInputModel) DefaultValue() int32 {
+	return n.defaultValue
+}
+
+// MinValue returns the minimum accepted value
+func (n NumberInputModel) MinValue() int32 {
+	return n.minValue
+}
+
+// MaxValue returns the maximum accepted value
+func (n NumberInputModel) MaxValue() int32 {
+	return n.maxValue
+}
+
+// Accepts returns true if the value is within the configured bounds
+func (n NumberInputModel) Accepts(value int32) bool {
+	return value >= n.minValue && value <= n.maxValue
+}
+
+// NumberInputBuilder is a builder for NumberInputModel
+type NumberInputBuilder struct {
+	contextKey   string
+	defaultValue int32
+	minValue     int32
+	maxValue     int32
+}
+
+// NewNumberInputBuilder creates a new NumberInputBuilder
+func NewNumberInputBuilder() *NumberInputBuilder {
+	return &NumberInputBuilder{}
+}
+
+// SetContextKey sets the context key the answer is stored under
+func (b *NumberInputBuilder) SetContextKey(contextKey string) *NumberInputBuilder {
+	b.contextKey = contextKey
+	return b
+}
+
+// SetDefaultValue sets the value initially shown to the player
+func (b *NumberInputBuilder) SetDefaultValue(defaultValue int32) *NumberInputBuilder {
+	b.defaultValue = defaultValue
+	return b
+}
+
+// SetMinValue sets the minimum accepted value
+func (b *NumberInputBuilder) SetMinValue(minValue int32) *NumberInputBuilder {
+	b.minValue = minValue
+	return b
+}
+
+// SetMaxValue sets the maximum accepted value
+func (b *NumberInputBuilder) SetMaxValue(maxValue int32) *NumberInputBuilder {
+	b.maxValue = maxValue
+	return b
+}
+
+// Build builds the NumberInputModel
+func (b *NumberInputBuilder) Build() (*NumberInputModel, error) {
+	if b.contextKey == "" {
+		return nil, errors.New("contextKey is required")
+	}
+	if b.minValue > b.maxValue {
+		return nil, errors.New("minValue must not exceed maxValue")
+	}
+	if b.defaultValue < b.minValue || b.defaultValue > b.maxValue {
+		return nil, errors.New("defaultValue must be between minValue and maxValue")
+	}
+
+	return &NumberInputModel{
+		contextKey:   b.contextKey,
+		defaultValue: b.defaultValue,
+		minValue:     b.minValue,
+		maxValue:     b.maxValue,
+	}, nil
+}
+
+// TextInputModel represents the configuration of a getText dialogue
+type TextInputModel struct {
+	contextKey   string
+	defaultValue string
+	minLength    uint16
+	maxLength    uint16
+}
+
+// ContextKey returns the context key the answer is stored under
+func (t TextInputModel) ContextKey() string {
+	return t.contextKey
+}
+
+// DefaultValue returns the text initially shown to the player
+func (t TextInputModel) DefaultValue() string {
+	return t.defaultValue
+}
+
+// MinLength returns the minimum accepted text length
+func (t TextInputModel) MinLength() uint16 {
+	return t.minLength
+}
+
+// MaxLength returns the maximum accepted text length
+func (t TextInputModel) MaxLength() uint16 {
+	return t.maxLength
+}
+
+// Accepts returns true if the text length is within the configured bounds
+func (t TextInputModel) Accepts(text string) bool {
+	length := len([]rune(text))
+	return length >= int(t.minLength) && length <= int(t.maxLength)
+}
+
+// TextInputBuilder is a builder for TextInputModel
+type TextInputBuilder struct {
+	contextKey   string
+	defaultValue string
+	minLength    uint16
+	maxLength    uint16
+}
+
+// NewTextInputBuilder creates a new TextInputBuilder
+func NewTextInputBuilder() *TextInputBuilder {
+	return &TextInputBuilder{}
+}
+
+// SetContextKey sets the context key the answer is stored under
+func (b *TextInputBuilder) SetContextKey(contextKey string) *TextInputBuilder {
+	b.contextKey = contextKey
+	return b
+}
+
+// SetDefaultValue sets the text initially shown to the player
+func (b *TextInputBuilder) SetDefaultValue(defaultValue string) *TextInputBuilder {
+	b.defaultValue = defaultValue
+	return b
+}
+
+// SetMinLength sets the minimum accepted text length
+func (b *TextInputBuilder) SetMinLength(minLength uint16) *TextInputBuilder {
+	b.minLength = minLength
+	return b
+}
+
+// SetMaxLength sets the maximum accepted text length
+func (b *TextInputBuilder) SetMaxLength(maxLength uint16) *TextInputBuilder {
+	b.maxLength = maxLength
+	return b
+}
+
+// Build builds the TextInputModel
+func (b *TextInputBuilder) Build() (*TextInputModel, error) {
+	if b.contextKey == "" {
+		return nil, errors.New("contextKey is required")
+	}
+	if b.maxLength == 0 {
+		return nil, errors.New("maxLength is required")
+	}
+	if b.minLength > b.maxLength {
+		return nil, errors.New("minLength must not exceed maxLength")
+	}
+
+	return &TextInputModel{
+		contextKey:   b.contextKey,
+		defaultValue: b.defaultValue,
+		minLength:    b.minLength,
+		maxLength:    b.maxLength,
 	}, nil
 }
 
 // ChoiceModel represents a choice in a dialogue
 type ChoiceModel struct {
-	text      string
-	nextState string
-	context   map[string]string
+	text       localization.Text
+	nextState  string
+	context    map[string]string
+	conditions []ConditionModel
+	option     map[string]string
 }
 
 // Text returns the choice text
-func (c ChoiceModel) Text() string {
+func (c ChoiceModel) Text() localization.Text {
 	return c.text
 }
 
@@ -449,11 +970,41 @@ func (c ChoiceModel) Context() map[string]string {
 	return c.context
 }
 
+// Conditions returns the conditions which must all pass for the choice to be shown
+func (c ChoiceModel) Conditions() []ConditionModel {
+	return c.conditions
+}
+
+// Option returns the value and name of the option the choice was generated for, keyed by OptionValue and OptionName,
+// or nil if the choice was not generated by a choice template
+func (c ChoiceModel) Option() map[string]string {
+	return c.option
+}
+
+// choiceFromSelection returns the choice at the selected index, or the Exit choice when the player closes the menu.
+// Menu items are numbered by the choice's original index, so hidden choices do not shift the selection.
+func choiceFromSelection(choices []ChoiceModel, action byte, selection int32) (ChoiceModel, error) {
+	if action == 0 || action == 255 {
+		for _, choice := range choices {
+			if choice.Text().Default() == "Exit" {
+				return choice, nil
+			}
+		}
+		return ChoiceModel{}, errors.New("invalid selection")
+	}
+
+	if selection < 0 || selection >= int32(len(choices)) {
+		return ChoiceModel{}, errors.New("invalid selection")
+	}
+	return choices[selection], nil
+}
+
 // ChoiceBuilder is a builder for ChoiceModel
 type ChoiceBuilder struct {
-	text      string
-	nextState string
-	context   map[string]string
+	text       localization.Text
+	nextState  string
+	context    map[string]string
+	conditions []ConditionModel
 }
 
 // NewChoiceBuilder creates a new ChoiceBuilder
@@ -465,6 +1016,12 @@ func NewChoiceBuilder() *ChoiceBuilder {
 
 // SetText sets the choice text
 func (b *ChoiceBuilder) SetText(text string) *ChoiceBuilder {
+	b.text = localization.NewText(text)
+	return b
+}
+
+// SetLocalizedText sets the choice text, translated by locale or looked up in the tenant's string table
+func (b *ChoiceBuilder) SetLocalizedText(text localization.Text) *ChoiceBuilder {
 	b.text = text
 	return b
 }
@@ -487,23 +1044,56 @@ func (b *ChoiceBuilder) AddContextValue(key, value string) *ChoiceBuilder {
 	return b
 }
 
+// SetConditions sets the conditions which must all pass for the choice to be shown
+func (b *ChoiceBuilder) SetConditions(conditions []ConditionModel) *ChoiceBuilder {
+	b.conditions = conditions
+	return b
+}
+
+// AddCondition adds a condition which must pass for the choice to be shown
+func (b *ChoiceBuilder) AddCondition(condition ConditionModel) *ChoiceBuilder {
+	b.conditions = append(b.conditions, condition)
+	return b
+}
+
 // Build builds the ChoiceModel
 func (b *ChoiceBuilder) Build() (ChoiceModel, error) {
-	if b.text == "" {
+	if b.text.Empty() {
 		return ChoiceModel{}, errors.New("text is required")
 	}
+	for _, condition := range b.conditions {
+		if err := validateConditionTree(condition); err != nil {
+			return ChoiceModel{}, err
+		}
+	}
 
 	return ChoiceModel{
-		text:      b.text,
-		nextState: b.nextState,
-		context:   b.context,
+		text:       b.text,
+		nextState:  b.nextState,
+		context:    b.context,
+		conditions: b.conditions,
 	}, nil
 }
 
+// LocalOperationOrder is when the local operations of a generic action are executed relative to its saga
+type LocalOperationOrder string
+
+const (
+	// LocalOperationsFirst executes local operations before the saga is created, the default
+	LocalOperationsFirst LocalOperationOrder = "first"
+	// LocalOperationsLast executes local operations after the saga is created, or once it completes when the
+	// conversation awaits it
+	LocalOperationsLast LocalOperationOrder = "last"
+)
+
 // GenericActionModel represents a generic action state
 type GenericActionModel struct {
-	operations []OperationModel
-	outcomes   []OutcomeModel
+	operations      []OperationModel
+	outcomes        []OutcomeModel
+	onSuccess       string
+	onFailure       string
+	fireAndForget   bool
+	localOperations LocalOperationOrder
 }
 
 // Operations returns the operations
@@ -516,10 +1106,44 @@ func (g GenericActionModel) Outcomes() []OutcomeModel {
 	return g.outcomes
 }
 
+// OnSuccess returns the state moved to once the saga of the operations completes, or empty to evaluate the outcomes
+func (g GenericActionModel) OnSuccess() string {
+	return g.onSuccess
+}
+
+// OnFailure returns the state moved to when the saga of the operations fails, or empty to end the conversation
+func (g GenericActionModel) OnFailure() string {
+	return g.onFailure
+}
+
+// FireAndForget returns true if each operation is executed on its own, in the order written, rather than the remote
+// operations being executed as a single saga
+func (g GenericActionModel) FireAndForget() bool {
+	return g.fireAndForget
+}
+
+// LocalOperations returns when the local operations are executed relative to the saga of the remote operations
+func (g GenericActionModel) LocalOperations() LocalOperationOrder {
+	if g.localOperations == "" {
+		return LocalOperationsFirst
+	}
+	return g.localOperations
+}
+
+// AwaitsSaga returns true if the conversation waits for the saga of the operations to complete or fail before it
+// continues, rather than continuing as soon as the saga is created
+func (g GenericActionModel) AwaitsSaga() bool {
+	return g.onSuccess != "" || g.onFailure != ""
+}
+
 // GenericActionBuilder is a builder for GenericActionModel
 type GenericActionBuilder struct {
-	operations []OperationModel
-	outcomes   []OutcomeModel
+	operations      []OperationModel
+	outcomes        []OutcomeModel
+	onSuccess       string
+	onFailure       string
+	fireAndForget   bool
+	localOperations LocalOperationOrder
 }
 
 // NewGenericActionBuilder creates a new GenericActionBuilder
@@ -554,15 +1178,58 @@ func (b *GenericActionBuilder) AddOutcome(outcome OutcomeModel) *GenericActionBu
 	return b
 }
 
+// SetOnSuccess sets the state moved to once the saga of the operations completes
+func (b *GenericActionBuilder) SetOnSuccess(onSuccess string) *GenericActionBuilder {
+	b.onSuccess = onSuccess
+	return b
+}
+
+// SetOnFailure sets the state moved to when the saga of the operations fails
+func (b *GenericActionBuilder) SetOnFailure(onFailure string) *GenericActionBuilder {
+	b.onFailure = onFailure
+	return b
+}
+
+// SetFireAndForget sets whether each operation is executed on its own rather than as part of a single saga
+func (b *GenericActionBuilder) SetFireAndForget(fireAndForget bool) *GenericActionBuilder {
+	b.fireAndForget = fireAndForget
+	return b
+}
+
+// SetLocalOperations sets when the local operations are executed relative to the saga of the remote operations
+func (b *GenericActionBuilder) SetLocalOperations(localOperations LocalOperationOrder) *GenericActionBuilder {
+	b.localOperations = localOperations
+	return b
+}
+
 // Build builds the GenericActionModel
 func (b *GenericActionBuilder) Build() (*GenericActionModel, error) {
 	if len(b.operations) == 0 && len(b.outcomes) == 0 {
 		return nil, errors.New("at least one operation or outcome is required")
 	}
 
+	if (b.onSuccess != "" || b.onFailure != "") && len(b.operations) == 0 {
+		return nil, errors.New("onSuccess and onFailure require at least one operation")
+	}
+	if b.fireAndForget && (b.onSuccess != "" || b.onFailure != "") {
+		return nil, errors.New("fireAndForget operations cannot be awaited with onSuccess or onFailure")
+	}
+	switch b.localOperations {
+	case "", LocalOperationsFirst, LocalOperationsLast:
+	default:
+		return nil, fmt.Errorf("localOperations must be [%s] or [%s]", LocalOperationsFirst, LocalOperationsLast)
+	}
+	if b.fireAndForget && b.localOperations != "" {
+		return nil, errors.New("localOperations does not apply to fireAndForget operations, which are executed in order")
+	}
+
 	return &GenericActionModel{
-		operations: b.operations,
-		outcomes:   b.outcomes,
+		operations:      b.operations,
+		outcomes:        b.outcomes,
+		onSuccess:       b.onSuccess,
+		onFailure:       b.onFailure,
+		fireAndForget:   b.fireAndForget,
+		localOperations: b.localOperations,
 	}, nil
 }
 
@@ -625,12 +1292,21 @@ func (b *OperationBuilder) Build() (OperationModel, error) {
 	}, nil
 }
 
+// Condition combinator types. A combinator condition carries nested conditions instead of an operator and value.
+const (
+	AllConditionType = "all"
+	AnyConditionType = "any"
+	NotConditionType = "not"
+)
+
 // ConditionModel represents a condition in the conversation domain
 type ConditionModel struct {
 	conditionType string
 	operator      string
 	value         string
 	itemId        string
+	conditions    []ConditionModel
+	option        map[string]string
 }
 
 // Type returns the condition type
@@ -652,12 +1328,32 @@ func (c ConditionModel) ItemId() string {
 	return c.itemId
 }
 
+// Option returns the option of the generated choice the condition belongs to, or nil if it does not belong to one
+func (c ConditionModel) Option() map[string]string {
+	return c.option
+}
+
+// Conditions returns the nested conditions of a combinator condition
+func (c ConditionModel) Conditions() []ConditionModel {
+	return c.conditions
+}
+
+// IsCombinator returns true if the condition combines nested conditions (all, any or not)
+func (c ConditionModel) IsCombinator() bool {
+	return isConditionCombinator(c.conditionType)
+}
+
+func isConditionCombinator(conditionType string) bool {
+	return conditionType == AllConditionType || conditionType == AnyConditionType || conditionType == NotConditionType
+}
+
 // ConditionBuilder is a builder for ConditionModel
 type ConditionBuilder struct {
 	conditionType string
 	operator      string
 	value         string
 	itemId        string
+	conditions    []ConditionModel
 }
 
 // NewConditionBuilder creates a new ConditionBuilder
@@ -688,11 +1384,33 @@ func (b *ConditionBuilder) SetItemId(itemId string) *ConditionBuilder {
 	return b
 }
 
+// SetConditions sets the nested conditions of a combinator condition
+func (b *ConditionBuilder) SetConditions(conditions []ConditionModel) *ConditionBuilder {
+	b.conditions = conditions
+	return b
+}
+
+// AddCondition adds a nested condition to a combinator condition
+func (b *ConditionBuilder) AddCondition(condition ConditionModel) *ConditionBuilder {
+	b.conditions = append(b.conditions, condition)
+	return b
+}
+
 // Build builds the ConditionModel
 func (b *ConditionBuilder) Build() (ConditionModel, error) {
 	if b.conditionType == "" {
 		return ConditionModel{}, errors.New("condition type is required")
 	}
+	if isConditionCombinator(b.conditionType) {
+		c := ConditionModel{
+			conditionType: b.conditionType,
+			conditions:    b.conditions,
+		}
+		if err := validateConditionTree(c); err != nil {
+			return ConditionModel{}, err
+		}
+		return c, nil
+	}
 	if b.operator == "" {
 		return ConditionModel{}, errors.New("operator is required")
 	}
@@ -714,7 +1432,7 @@ type OutcomeModel struct {
 	nextState  string
 }
 
-// Conditions returns the outcome condition
+// Conditions returns the outcome conditions, all of which must pass for the outcome to be selected
 func (o OutcomeModel) Conditions() []ConditionModel {
 	return o.conditions
 }
@@ -724,7 +1442,6 @@ func (o OutcomeModel) NextState() string {
 	return o.nextState
 }
 
-
 // OutcomeBuilder is a builder for OutcomeModel
 type OutcomeBuilder struct {
 	conditions []ConditionModel
@@ -759,18 +1476,40 @@ func (b *OutcomeBuilder) AddConditionFromInput(condType string, operator string,
 	return b
 }
 
+// AddAllCondition adds a condition which passes when every one of the given conditions passes
+func (b *OutcomeBuilder) AddAllCondition(conditions ...ConditionModel) *OutcomeBuilder {
+	b.conditions = append(b.conditions, ConditionModel{conditionType: AllConditionType, conditions: conditions})
+	return b
+}
+
+// AddAnyCondition adds a condition which passes when at least one of the given conditions passes
+func (b *OutcomeBuilder) AddAnyCondition(conditions ...ConditionModel) *OutcomeBuilder {
+	b.conditions = append(b.conditions, ConditionModel{conditionType: AnyConditionType, conditions: conditions})
+	return b
+}
+
+// AddNotCondition adds a condition which passes when the given condition fails
+func (b *OutcomeBuilder) AddNotCondition(condition ConditionModel) *OutcomeBuilder {
+	b.conditions = append(b.conditions, ConditionModel{conditionType: NotConditionType, conditions: []ConditionModel{condition}})
+	return b
+}
+
 // SetNextState sets the next state ID
 func (b *OutcomeBuilder) SetNextState(nextState string) *OutcomeBuilder {
 	b.nextState = nextState
 	return b
 }
 
-
 // Build builds the OutcomeModel
 func (b *OutcomeBuilder) Build() (OutcomeModel, error) {
 	if b.nextState == "" {
 		return OutcomeModel{}, errors.New("nextState is required")
 	}
+	for _, condition := range b.conditions {
+		if err := validateConditionTree(condition); err != nil {
+			return OutcomeModel{}, err
+		}
+	}
 
 	return OutcomeModel{
 		conditions: b.conditions,
@@ -778,14 +1517,37 @@ func (b *OutcomeBuilder) Build() (OutcomeModel, error) {
 	}, nil
 }
 
+// validateConditionTree verifies combinator conditions carry the expected number of nested conditions
+func validateConditionTree(c ConditionModel) error {
+	if !c.IsCombinator() {
+		return nil
+	}
+	if len(c.Conditions()) == 0 {
+		return fmt.Errorf("%s condition requires at least one nested condition", c.Type())
+	}
+	if c.Type() == NotConditionType && len(c.Conditions()) != 1 {
+		return errors.New("not condition requires exactly one nested condition")
+	}
+	for _, nested := range c.Conditions() {
+		if err := validateConditionTree(nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CraftActionModel represents a craft action state
 type CraftActionModel struct {
 	itemId                string
 	materials             []uint32
 	quantities            []uint32
 	mesoCost              uint32
+	optionSetId           string
+	optionContextKey      string
 	stimulatorId          uint32
 	stimulatorFailChance  float64
+	successState          string
+	failureState          string
 	missingMaterialsState string
 }
 
@@ -809,6 +1571,25 @@ func (c CraftActionModel) MesoCost() uint32 {
 	return c.mesoCost
 }
 
+// OptionSetId returns the option set the recipe is taken from (optional)
+func (c CraftActionModel) OptionSetId() string {
+	return c.optionSetId
+}
+
+// OptionContextKey returns the context key holding the ID of the chosen option
+func (c CraftActionModel) OptionContextKey() string {
+	return c.optionContextKey
+}
+
+// ForOption returns the craft action with its item, materials and meso cost taken from the option
+func (c CraftActionModel) ForOption(option OptionModel) CraftActionModel {
+	c.itemId = strconv.FormatUint(uint64(option.Id()), 10)
+	c.materials = option.Materials()
+	c.quantities = option.Quantities()
+	c.mesoCost = option.Meso()
+	return c
+}
+
 // StimulatorId returns the stimulator item ID
 func (c CraftActionModel) StimulatorId() uint32 {
 	return c.stimulatorId
@@ -819,6 +1600,15 @@ func (c CraftActionModel) StimulatorFailChance() float64 {
 	return c.stimulatorFailChance
 }
 
+// SuccessState returns the success state ID
+func (c CraftActionModel) SuccessState() string {
+	return c.successState
+}
+
+// FailureState returns the failure state ID
+func (c CraftActionModel) FailureState() string {
+	return c.failureState
+}
 
 // MissingMaterialsState returns the missing materials state ID
 func (c CraftActionModel) MissingMaterialsState() string {
@@ -831,8 +1621,12 @@ type CraftActionBuilder struct {
 	materials             []uint32
 	quantities            []uint32
 	mesoCost              uint32
+	optionSetId           string
+	optionContextKey      string
 	stimulatorId          uint32
 	stimulatorFailChance  float64
+	successState          string
+	failureState          string
 	missingMaterialsState string
 }
 
@@ -880,6 +1674,18 @@ func (b *CraftActionBuilder) SetMesoCost(mesoCost uint32) *CraftActionBuilder {
 	return b
 }
 
+// SetOptionSetId sets the option set the recipe is taken from
+func (b *CraftActionBuilder) SetOptionSetId(optionSetId string) *CraftActionBuilder {
+	b.optionSetId = optionSetId
+	return b
+}
+
+// SetOptionContextKey sets the context key holding the ID of the chosen option
+func (b *CraftActionBuilder) SetOptionContextKey(optionContextKey string) *CraftActionBuilder {
+	b.optionContextKey = optionContextKey
+	return b
+}
+
 // SetStimulatorId sets the stimulator item ID
 func (b *CraftActionBuilder) SetStimulatorId(stimulatorId uint32) *CraftActionBuilder {
 	b.stimulatorId = stimulatorId
@@ -892,6 +1698,17 @@ func (b *CraftActionBuilder) SetStimulatorFailChance(stimulatorFailChance float6
 	return b
 }
 
+// SetSuccessState sets the success state ID
+func (b *CraftActionBuilder) SetSuccessState(successState string) *CraftActionBuilder {
+	b.successState = successState
+	return b
+}
+
+// SetFailureState sets the failure state ID
+func (b *CraftActionBuilder) SetFailureState(failureState string) *CraftActionBuilder {
+	b.failureState = failureState
+	return b
+}
 
 // SetMissingMaterialsState sets the missing materials state ID
 func (b *CraftActionBuilder) SetMissingMaterialsState(missingMaterialsState string) *CraftActionBuilder {
@@ -901,15 +1718,29 @@ func (b *CraftActionBuilder) SetMissingMaterialsState(missingMaterialsState stri
 
 // Build builds the CraftActionModel
 func (b *CraftActionBuilder) Build() (*CraftActionModel, error) {
-	if b.itemId == "" {
-		return nil, errors.New("itemId is required")
-	}
-	if len(b.materials) == 0 {
-		return nil, errors.New("at least one material is required")
+	if b.optionSetId != "" {
+		// The recipe is taken from the chosen option at runtime
+		if b.optionContextKey == "" {
+			return nil, errors.New("optionContextKey is required when optionSetId is set")
+		}
+	} else {
+		if b.itemId == "" {
+			return nil, errors.New("itemId is required")
+		}
+		if len(b.materials) == 0 {
+			return nil, errors.New("at least one material is required")
+		}
 	}
 	if len(b.quantities) != len(b.materials) {
 		return nil, errors.New("quantities must match materials")
 	}
+	if b.stimulatorFailChance < 0 || b.stimulatorFailChance > 1 {
+		return nil, errors.New("stimulatorFailChance must be between 0 and 1")
+	}
+	// Without a successState the conversation ends once the craft succeeds, as it did before craft outcomes existed
+	if b.stimulatorId != 0 && b.stimulatorFailChance > 0 && b.failureState == "" {
+		return nil, errors.New("failureState is required when the stimulator may fail")
+	}
 	if b.missingMaterialsState == "" {
 		return nil, errors.New("missingMaterialsState is required")
 	}
@@ -919,20 +1750,25 @@ func (b *CraftActionBuilder) Build() (*CraftActionModel, error) {
 		materials:             b.materials,
 		quantities:            b.quantities,
 		mesoCost:              b.mesoCost,
+		optionSetId:           b.optionSetId,
+		optionContextKey:      b.optionContextKey,
 		stimulatorId:          b.stimulatorId,
 		stimulatorFailChance:  b.stimulatorFailChance,
+		successState:          b.successState,
+		failureState:          b.failureState,
 		missingMaterialsState: b.missingMaterialsState,
 	}, nil
 }
 
 // ListSelectionModel represents a list selection state
 type ListSelectionModel struct {
-	title   string
-	choices []ChoiceModel
+	title          localization.Text
+	choices        []ChoiceModel
+	choiceTemplate *ChoiceTemplateModel
 }
 
 // Title returns the list selection title
-func (l ListSelectionModel) Title() string {
+func (l ListSelectionModel) Title() localization.Text {
 	return l.title
 }
 
@@ -940,26 +1776,36 @@ func (l ListSelectionModel) Choices() []ChoiceModel {
 	return l.choices
 }
 
-func (l ListSelectionModel) ChoiceFromSelection(action byte, selection int32) (ChoiceModel, error) {
-	if action == 0 {
-		for _, choice := range l.choices {
-			if choice.Text() == "Exit" {
-				return choice, nil
-			}
-		}
-		return ChoiceModel{}, errors.New("invalid selection")
+// ChoiceTemplate returns the template used to generate choices at runtime (optional)
+func (l ListSelectionModel) ChoiceTemplate() *ChoiceTemplateModel {
+	return l.choiceTemplate
+}
+
+// ResolveChoices returns the static choices followed by any choices generated from the choice template
+func (l ListSelectionModel) ResolveChoices(context map[string]string, optionSets []OptionSetModel) ([]ChoiceModel, error) {
+	if l.choiceTemplate == nil {
+		return l.choices, nil
 	}
 
-	if selection < 0 || selection >= int32(len(l.choices)) {
-		return ChoiceModel{}, errors.New("invalid selection")
+	generated, err := l.choiceTemplate.Generate(context, optionSets)
+	if err != nil {
+		return nil, err
 	}
-	return l.choices[selection], nil
+
+	choices := make([]ChoiceModel, 0, len(l.choices)+len(generated))
+	choices = append(choices, l.choices...)
+	return append(choices, generated...), nil
+}
+
+func (l ListSelectionModel) ChoiceFromSelection(action byte, selection int32) (ChoiceModel, error) {
+	return choiceFromSelection(l.choices, action, selection)
 }
 
 // ListSelectionBuilder is a builder for ListSelectionModel
 type ListSelectionBuilder struct {
-	title   string
-	choices []ChoiceModel
+	title          localization.Text
+	choices        []ChoiceModel
+	choiceTemplate *ChoiceTemplateModel
 }
 
 // NewListSelectionBuilder creates a new ListSelectionBuilder
@@ -969,6 +1815,12 @@ func NewListSelectionBuilder() *ListSelectionBuilder {
 
 // SetTitle sets the list selection title
 func (b *ListSelectionBuilder) SetTitle(title string) *ListSelectionBuilder {
+	b.title = localization.NewText(title)
+	return b
+}
+
+// SetLocalizedTitle sets the list selection title, translated by locale or looked up in the tenant's string table
+func (b *ListSelectionBuilder) SetLocalizedTitle(title localization.Text) *ListSelectionBuilder {
 	b.title = title
 	return b
 }
@@ -978,15 +1830,401 @@ func (b *ListSelectionBuilder) AddChoice(choice ChoiceModel) *ListSelectionBuild
 	return b
 }
 
+// SetChoiceTemplate sets the template used to generate choices at runtime
+func (b *ListSelectionBuilder) SetChoiceTemplate(choiceTemplate *ChoiceTemplateModel) *ListSelectionBuilder {
+	b.choiceTemplate = choiceTemplate
+	return b
+}
+
 // Build builds the ListSelectionModel
 func (b *ListSelectionBuilder) Build() (*ListSelectionModel, error) {
-	if b.title == "" {
+	if b.title.Empty() {
 		return nil, errors.New("title is required")
 	}
 
 	return &ListSelectionModel{
-		title:   b.title,
-		choices: b.choices,
+		title:          b.title,
+		choices:        b.choices,
+		choiceTemplate: b.choiceTemplate,
+	}, nil
+}
+
+const (
+	// OptionValue is the attribute of the option namespace holding the value a choice was generated for
+	OptionValue = "value"
+	// OptionName is the attribute of the option namespace holding the name of the option a choice was generated for
+	OptionName = "name"
+	// OptionValueReference is written as the item ID of a choice template condition to check the item of each value
+	OptionValueReference = OptionNamespace + "." + OptionValue
+)
+
+const (
+	contextSourcePrefix   = "context."
+	optionSetSourcePrefix = "optionSet."
+)
+
+// ChoiceTemplateModel generates list selection choices at runtime, one per value of a context array or option of an
+// option set
+type ChoiceTemplateModel struct {
+	from       string
+	text       localization.Text
+	contextKey string
+	nextState  string
+	conditions []ConditionModel
+}
+
+// From returns the source of the option values, either a context reference (context.{key}) holding a comma separated
+// list or an option set reference (optionSet.{id})
+func (c ChoiceTemplateModel) From() string {
+	return c.from
+}
+
+// OptionSetId returns the ID of the option set the choices are generated from, or empty for context sources
+func (c ChoiceTemplateModel) OptionSetId() string {
+	if !strings.HasPrefix(c.from, optionSetSourcePrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(c.from, optionSetSourcePrefix)
+}
+
+// Text returns the choice text template
+func (c ChoiceTemplateModel) Text() localization.Text {
+	return c.text
+}
+
+// ContextKey returns the context key the selected value is stored under
+func (c ChoiceTemplateModel) ContextKey() string {
+	return c.contextKey
+}
+
+// NextState returns the state to transition to once a generated choice is selected
+func (c ChoiceTemplateModel) NextState() string {
+	return c.nextState
+}
+
+// Conditions returns the visibility conditions applied to each generated choice
+func (c ChoiceTemplateModel) Conditions() []ConditionModel {
+	return c.conditions
+}
+
+// Values resolves the option values from the conversation context
+func (c ChoiceTemplateModel) Values(context map[string]string) ([]string, error) {
+	key := strings.TrimPrefix(c.from, contextSourcePrefix)
+	value, exists := context[key]
+	if !exists {
+		return nil, fmt.Errorf("context key [%s] not found", key)
+	}
+
+	values := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			values = append(values, part)
+		}
+	}
+	return values, nil
+}
+
+// Generate creates a choice for each option value. Its text and visibility conditions reference the value and name of
+// the option through the option namespace, which is resolved when they are rendered and evaluated, so the option is
+// never parsed as part of them. Choices generated from an option set use the option ID as the value and the option
+// name as the name.
+func (c ChoiceTemplateModel) Generate(context map[string]string, optionSets []OptionSetModel) ([]ChoiceModel, error) {
+	var values, names []string
+	if optionSetId := c.OptionSetId(); optionSetId != "" {
+		optionSet, err := findOptionSet(optionSets, optionSetId)
+		if err != nil {
+			return nil, err
+		}
+		for _, option := range optionSet.Options() {
+			values = append(values, strconv.FormatUint(uint64(option.Id()), 10))
+			names = append(names, option.Name())
+		}
+	} else {
+		var err error
+		values, err = c.Values(context)
+		if err != nil {
+			return nil, err
+		}
+		names = values
+	}
+
+	choices := make([]ChoiceModel, 0, len(values))
+	for i, value := range values {
+		option := map[string]string{OptionValue: value, OptionName: names[i]}
+		conditions := make([]ConditionModel, 0, len(c.conditions))
+		for _, condition := range c.conditions {
+			conditions = append(conditions, bindConditionOption(condition, option))
+		}
+
+		choices = append(choices, ChoiceModel{
+			text:       c.text,
+			nextState:  c.nextState,
+			context:    map[string]string{c.contextKey: value},
+			conditions: conditions,
+			option:     option,
+		})
+	}
+	return choices, nil
+}
+
+// bindConditionOption binds the option throughout a condition tree. An item ID written as OptionValueReference is the
+// option value.
+func bindConditionOption(condition ConditionModel, option map[string]string) ConditionModel {
+	result := ConditionModel{
+		conditionType: condition.conditionType,
+		operator:      condition.operator,
+		value:         condition.value,
+		itemId:        condition.itemId,
+		option:        option,
+	}
+	if result.itemId == OptionValueReference {
+		result.itemId = option[OptionValue]
+	}
+	for _, nested := range condition.conditions {
+		result.conditions = append(result.conditions, bindConditionOption(nested, option))
+	}
+	return result
+}
+
+// ChoiceTemplateBuilder is a builder for ChoiceTemplateModel
+type ChoiceTemplateBuilder struct {
+	from       string
+	text       localization.Text
+	contextKey string
+	nextState  string
+	conditions []ConditionModel
+}
+
+// NewChoiceTemplateBuilder creates a new ChoiceTemplateBuilder
+func NewChoiceTemplateBuilder() *ChoiceTemplateBuilder {
+	return &ChoiceTemplateBuilder{}
+}
+
+// SetFrom sets the source of the option values
+func (b *ChoiceTemplateBuilder) SetFrom(from string) *ChoiceTemplateBuilder {
+	b.from = from
+	return b
+}
+
+// SetText sets the choice text template
+func (b *ChoiceTemplateBuilder) SetText(text string) *ChoiceTemplateBuilder {
+	b.text = localization.NewText(text)
+	return b
+}
+
+// SetLocalizedText sets the choice text template, translated by locale or looked up in the tenant's string table
+func (b *ChoiceTemplateBuilder) SetLocalizedText(text localization.Text) *ChoiceTemplateBuilder {
+	b.text = text
+	return b
+}
+
+// SetContextKey sets the context key the selected value is stored under
+func (b *ChoiceTemplateBuilder) SetContextKey(contextKey string) *ChoiceTemplateBuilder {
+	b.contextKey = contextKey
+	return b
+}
+
+// SetNextState sets the state to transition to once a generated choice is selected
+func (b *ChoiceTemplateBuilder) SetNextState(nextState string) *ChoiceTemplateBuilder {
+	b.nextState = nextState
+	return b
+}
+
+// AddCondition adds a visibility condition applied to each generated choice
+func (b *ChoiceTemplateBuilder) AddCondition(condition ConditionModel) *ChoiceTemplateBuilder {
+	b.conditions = append(b.conditions, condition)
+	return b
+}
+
+// Build builds the ChoiceTemplateModel
+func (b *ChoiceTemplateBuilder) Build() (*ChoiceTemplateModel, error) {
+	validContext := strings.HasPrefix(b.from, contextSourcePrefix) && b.from != contextSourcePrefix
+	validOptionSet := strings.HasPrefix(b.from, optionSetSourcePrefix) && b.from != optionSetSourcePrefix
+	if !validContext && !validOptionSet {
+		return nil, errors.New("from must reference a context key (context.{key}) or an option set (optionSet.{id})")
+	}
+	if b.text.Empty() {
+		return nil, errors.New("text is required")
+	}
+	if b.contextKey == "" {
+		return nil, errors.New("contextKey is required")
+	}
+	if b.nextState == "" {
+		return nil, errors.New("nextState is required")
+	}
+	for _, condition := range b.conditions {
+		if err := validateConditionTree(condition); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ChoiceTemplateModel{
+		from:       b.from,
+		text:       b.text,
+		contextKey: b.contextKey,
+		nextState:  b.nextState,
+		conditions: b.conditions,
+	}, nil
+}
+
+// StyleSelectionModel represents a style selection state, used by hair, face and skin NPCs
+type StyleSelectionModel struct {
+	text        localization.Text
+	styles      []uint32
+	stylesFrom  string
+	contextKey  string
+	nextState   string
+	cancelState string
+}
+
+// Text returns the text shown alongside the styles
+func (s StyleSelectionModel) Text() localization.Text {
+	return s.text
+}
+
+// Styles returns the literal style IDs offered
+func (s StyleSelectionModel) Styles() []uint32 {
+	return s.styles
+}
+
+// StylesFrom returns the context key holding a comma separated list of style IDs offered, used when no literal styles are defined
+func (s StyleSelectionModel) StylesFrom() string {
+	return s.stylesFrom
+}
+
+// ContextKey returns the context key the chosen style ID is stored under
+func (s StyleSelectionModel) ContextKey() string {
+	return s.contextKey
+}
+
+// NextState returns the state to transition to once a style is chosen
+func (s StyleSelectionModel) NextState() string {
+	return s.nextState
+}
+
+// CancelState returns the state to transition to when the player cancels
+func (s StyleSelectionModel) CancelState() string {
+	return s.cancelState
+}
+
+// ResolveStyles returns the style IDs offered, reading them from the conversation context when no literal styles are defined
+func (s StyleSelectionModel) ResolveStyles(context map[string]string) ([]uint32, error) {
+	if len(s.styles) > 0 {
+		return s.styles, nil
+	}
+
+	value, exists := context[s.stylesFrom]
+	if !exists {
+		return nil, fmt.Errorf("context key [%s] not found", s.stylesFrom)
+	}
+
+	styles := make([]uint32, 0)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		styleId, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("context value [%s] is not a valid style ID", part)
+		}
+		styles = append(styles, uint32(styleId))
+	}
+	if len(styles) == 0 {
+		return nil, fmt.Errorf("context key [%s] holds no styles", s.stylesFrom)
+	}
+	return styles, nil
+}
+
+// StyleSelectionBuilder is a builder for StyleSelectionModel
+type StyleSelectionBuilder struct {
+	text        localization.Text
+	styles      []uint32
+	stylesFrom  string
+	contextKey  string
+	nextState   string
+	cancelState string
+}
+
+// NewStyleSelectionBuilder creates a new StyleSelectionBuilder
+func NewStyleSelectionBuilder() *StyleSelectionBuilder {
+	return &StyleSelectionBuilder{}
+}
+
+// SetText sets the text shown alongside the styles
+func (b *StyleSelectionBuilder) SetText(text string) *StyleSelectionBuilder {
+	b.text = localization.NewText(text)
+	return b
+}
+
+// SetLocalizedText sets the text shown alongside the styles, translated by locale or looked up in the tenant's string table
+func (b *StyleSelectionBuilder) SetLocalizedText(text localization.Text) *StyleSelectionBuilder {
+	b.text = text
+	return b
+}
+
+// SetStyles sets the literal style IDs offered
+func (b *StyleSelectionBuilder) SetStyles(styles []uint32) *StyleSelectionBuilder {
+	b.styles = styles
+	return b
+}
+
+// AddStyle adds a literal style ID to offer
+func (b *StyleSelectionBuilder) AddStyle(styleId uint32) *StyleSelectionBuilder {
+	b.styles = append(b.styles, styleId)
+	return b
+}
+
+// SetStylesFrom sets the context key holding a comma separated list of style IDs offered
+func (b *StyleSelectionBuilder) SetStylesFrom(stylesFrom string) *StyleSelectionBuilder {
+	b.stylesFrom = stylesFrom
+	return b
+}
+
+// SetContextKey sets the context key the chosen style ID is stored under
+func (b *StyleSelectionBuilder) SetContextKey(contextKey string) *StyleSelectionBuilder {
+	b.contextKey = contextKey
+	return b
+}
+
+// SetNextState sets the state to transition to once a style is chosen
+func (b *StyleSelectionBuilder) SetNextState(nextState string) *StyleSelectionBuilder {
+	b.nextState = nextState
+	return b
+}
+
+// SetCancelState sets the state to transition to when the player cancels
+func (b *StyleSelectionBuilder) SetCancelState(cancelState string) *StyleSelectionBuilder {
+	b.cancelState = cancelState
+	return b
+}
+
+// Build builds the StyleSelectionModel
+func (b *StyleSelectionBuilder) Build() (*StyleSelectionModel, error) {
+	if b.text.Empty() {
+		return nil, errors.New("text is required")
+	}
+	if len(b.styles) == 0 && b.stylesFrom == "" {
+		return nil, errors.New("styles or stylesFrom is required")
+	}
+	if len(b.styles) > 0 && b.stylesFrom != "" {
+		return nil, errors.New("styles and stylesFrom are mutually exclusive")
+	}
+	if b.contextKey == "" {
+		return nil, errors.New("contextKey is required")
+	}
+	if b.nextState == "" {
+		return nil, errors.New("nextState is required")
+	}
+
+	return &StyleSelectionModel{
+		text:        b.text,
+		styles:      b.styles,
+		stylesFrom:  b.stylesFrom,
+		contextKey:  b.contextKey,
+		nextState:   b.nextState,
+		cancelState: b.cancelState,
 	}, nil
 }
 
@@ -1006,6 +2244,16 @@ func (o OptionSetModel) Options() []OptionModel {
 	return o.options
 }
 
+// FindOption finds an option by ID
+func (o OptionSetModel) FindOption(optionId uint32) (OptionModel, error) {
+	for _, option := range o.options {
+		if option.Id() == optionId {
+			return option, nil
+		}
+	}
+	return OptionModel{}, fmt.Errorf("option [%d] not found in option set [%s]", optionId, o.id)
+}
+
 // OptionSetBuilder is a builder for OptionSetModel
 type OptionSetBuilder struct {
 	id      string
@@ -1174,6 +2422,10 @@ type ConversationContext struct {
 	currentState string
 	conversation Model
 	context      map[string]string
+	history      []HistoryEntry
+	lastActivity time.Time
+	revision     uint64
+	awaitingSaga uuid.UUID
 }
 
 // Field returns the field
@@ -1206,6 +2458,79 @@ func (c ConversationContext) Context() map[string]string {
 	return c.context
 }
 
+// History returns the visited dialogue states, most recent last
+func (c ConversationContext) History() []HistoryEntry {
+	return c.history
+}
+
+// LastActivity returns when the conversation last advanced
+func (c ConversationContext) LastActivity() time.Time {
+	return c.lastActivity
+}
+
+// Revision returns the revision of the stored context this context was read at, or zero if it was not read from the
+// session store
+func (c ConversationContext) Revision() uint64 {
+	return c.revision
+}
+
+// AwaitingSaga returns the transaction ID of the saga the conversation is parked on, or uuid.Nil if the conversation
+// is not waiting for a saga
+func (c ConversationContext) AwaitingSaga() uuid.UUID {
+	return c.awaitingSaga
+}
+
+// Previous returns a context positioned at the most recently visited dialogue state, with the context values
+// present when that state was shown. Returns false if there is no history to return to.
+func (c ConversationContext) Previous() (ConversationContext, bool) {
+	if len(c.history) == 0 {
+		return ConversationContext{}, false
+	}
+	entry := c.history[len(c.history)-1]
+
+	ctx, err := NewConversationContextBuilder().
+		SetField(c.field).
+		SetCharacterId(c.characterId).
+		SetNpcId(c.npcId).
+		SetCurrentState(entry.StateId()).
+		SetConversation(c.conversation).
+		SetContext(copyContext(entry.Context())).
+		SetHistory(c.history[:len(c.history)-1]).
+		SetRevision(c.revision).
+		Build()
+	if err != nil {
+		return ConversationContext{}, false
+	}
+	return ctx, true
+}
+
+// MaxHistoryDepth is the number of visited dialogue states retained for back-navigation
+const MaxHistoryDepth = 20
+
+// HistoryEntry records a visited dialogue state and the context values present when it was shown
+type HistoryEntry struct {
+	stateId string
+	context map[string]string
+}
+
+// StateId returns the visited state ID
+func (h HistoryEntry) StateId() string {
+	return h.stateId
+}
+
+// Context returns the context values present when the state was shown
+func (h HistoryEntry) Context() map[string]string {
+	return h.context
+}
+
+func copyContext(context map[string]string) map[string]string {
+	result := make(map[string]string, len(context))
+	for k, v := range context {
+		result[k] = v
+	}
+	return result
+}
+
 // ConversationContextBuilder is a builder for ConversationContext
 type ConversationContextBuilder struct {
 	field        field.Model
@@ -1214,6 +2539,10 @@ type ConversationContextBuilder struct {
 	currentState string
 	conversation Model
 	context      map[string]string
+	history      []HistoryEntry
+	lastActivity time.Time
+	revision     uint64
+	awaitingSaga uuid.UUID
 }
 
 // NewConversationContextBuilder creates a new ConversationContextBuilder
@@ -1265,6 +2594,43 @@ func (b *ConversationContextBuilder) AddContextValue(key, value string) *Convers
 	return b
 }
 
+// SetHistory sets the visited dialogue states
+func (b *ConversationContextBuilder) SetHistory(history []HistoryEntry) *ConversationContextBuilder {
+	b.history = history
+	return b
+}
+
+// SetLastActivity sets when the conversation last advanced. Contexts built without it are stamped with the time they
+// are built.
+func (b *ConversationContextBuilder) SetLastActivity(lastActivity time.Time) *ConversationContextBuilder {
+	b.lastActivity = lastActivity
+	return b
+}
+
+// SetRevision sets the revision of the stored context the context replaces
+func (b *ConversationContextBuilder) SetRevision(revision uint64) *ConversationContextBuilder {
+	b.revision = revision
+	return b
+}
+
+// SetAwaitingSaga parks the conversation on the saga with the transaction ID until it completes or fails
+func (b *ConversationContextBuilder) SetAwaitingSaga(transactionId uuid.UUID) *ConversationContextBuilder {
+	b.awaitingSaga = transactionId
+	return b
+}
+
+// PushHistory records a visited dialogue state and a snapshot of its context, discarding the oldest entry once MaxHistoryDepth is reached
+func (b *ConversationContextBuilder) PushHistory(stateId string, context map[string]string) *ConversationContextBuilder {
+	history := make([]HistoryEntry, 0, len(b.history)+1)
+	history = append(history, b.history...)
+	history = append(history, HistoryEntry{stateId: stateId, context: copyContext(context)})
+	if len(history) > MaxHistoryDepth {
+		history = history[len(history)-MaxHistoryDepth:]
+	}
+	b.history = history
+	return b
+}
+
 // Build builds the ConversationContext
 func (b *ConversationContextBuilder) Build() (ConversationContext, error) {
 	if b.characterId == 0 {
@@ -1276,6 +2642,10 @@ func (b *ConversationContextBuilder) Build() (ConversationContext, error) {
 	if b.currentState == "" {
 		return ConversationContext{}, errors.New("currentState is required")
 	}
+	lastActivity := b.lastActivity
+	if lastActivity.IsZero() {
+		lastActivity = time.Now()
+	}
 
 	return ConversationContext{
 		characterId:  b.characterId,
@@ -1284,5 +2654,9 @@ func (b *ConversationContextBuilder) Build() (ConversationContext, error) {
 		currentState: b.currentState,
 		conversation: b.conversation,
 		context:      b.context,
+		history:      b.history,
+		lastActivity: lastActivity,
+		revision:     b.revision,
+		awaitingSaga: b.awaitingSaga,
 	}, nil
 }
@@ -0,0 +1,174 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/expression"
+	"fmt"
+	"strconv"
+)
+
+// ParamType is the type a param value is converted to before it is used by an operation
+type ParamType string
+
+const (
+	IntegerParam ParamType = "integer"
+	StringParam  ParamType = "string"
+)
+
+// ParamDescriptor describes a param accepted by an operation
+type ParamDescriptor struct {
+	name           string
+	paramType      ParamType
+	required       bool
+	defaultValue   string
+	contextAllowed bool
+}
+
+// Name returns the param name
+func (p ParamDescriptor) Name() string {
+	return p.name
+}
+
+// Type returns the type the param value is converted to
+func (p ParamDescriptor) Type() ParamType {
+	return p.paramType
+}
+
+// Required returns true if the param must be given
+func (p ParamDescriptor) Required() bool {
+	return p.required
+}
+
+// DefaultValue returns the value used when an optional param is not given
+func (p ParamDescriptor) DefaultValue() string {
+	return p.defaultValue
+}
+
+// ContextAllowed returns true if the param value may reference the conversation context or the character
+func (p ParamDescriptor) ContextAllowed() bool {
+	return p.contextAllowed
+}
+
+// RequiredParam describes a required param which may reference the conversation context or the character
+func RequiredParam(name string, paramType ParamType) ParamDescriptor {
+	return ParamDescriptor{name: name, paramType: paramType, required: true, contextAllowed: true}
+}
+
+// OptionalParam describes an optional param which may reference the conversation context or the character
+func OptionalParam(name string, paramType ParamType, defaultValue string) ParamDescriptor {
+	return ParamDescriptor{name: name, paramType: paramType, defaultValue: defaultValue, contextAllowed: true}
+}
+
+// ConstantParam describes an optional param whose value may not reference the conversation context or the character
+func ConstantParam(name string, paramType ParamType, defaultValue string) ParamDescriptor {
+	return ParamDescriptor{name: name, paramType: paramType, defaultValue: defaultValue}
+}
+
+// OperationDescriptor describes an operation type and the params it accepts
+type OperationDescriptor struct {
+	name        string
+	description string
+	params      []ParamDescriptor
+}
+
+// NewOperationDescriptor describes an operation type and the params it accepts
+func NewOperationDescriptor(name string, description string, params ...ParamDescriptor) OperationDescriptor {
+	return OperationDescriptor{name: name, description: description, params: params}
+}
+
+// Name returns the operation type
+func (d OperationDescriptor) Name() string {
+	return d.name
+}
+
+// Description returns a short description of what the operation does
+func (d OperationDescriptor) Description() string {
+	return d.description
+}
+
+// Params returns the params accepted by the operation
+func (d OperationDescriptor) Params() []ParamDescriptor {
+	return d.params
+}
+
+// FindParam returns the descriptor of the named param
+func (d OperationDescriptor) FindParam(name string) (ParamDescriptor, bool) {
+	for _, p := range d.params {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return ParamDescriptor{}, false
+}
+
+// ResolveParams checks the params of an operation against the descriptor, applying defaults and evaluating values
+// with the resolver. Integer params are expressions. String params are literal text, unless prefixed with
+// ExpressionPrefix or a bare context reference.
+func (d OperationDescriptor) ResolveParams(params map[string]string, r expression.Resolver) (OperationParams, error) {
+	resolved := OperationParams{values: make(map[string]string), ints: make(map[string]int)}
+	for _, p := range d.params {
+		value, exists := params[p.name]
+		if !exists {
+			if p.required {
+				return OperationParams{}, fmt.Errorf("missing %s parameter for %s operation", p.name, d.name)
+			}
+			value = p.defaultValue
+		}
+		pr := r
+		if !p.contextAllowed {
+			// Nothing may be looked up, so a reference fails to resolve
+			pr = nil
+		}
+
+		if p.paramType == IntegerParam {
+			intValue, err := evaluateInteger(value, pr)
+			if err != nil {
+				return OperationParams{}, fmt.Errorf("value [%s] for parameter [%s] is not a valid integer: %w", value, p.name, err)
+			}
+			resolved.ints[p.name] = intValue
+			resolved.values[p.name] = strconv.Itoa(intValue)
+			continue
+		}
+
+		stringValue, err := evaluateString(value, pr)
+		if err != nil {
+			return OperationParams{}, fmt.Errorf("value [%s] for parameter [%s] cannot be evaluated: %w", value, p.name, err)
+		}
+		resolved.values[p.name] = stringValue
+	}
+	return resolved, nil
+}
+
+// OperationParams holds the resolved params of an operation
+type OperationParams struct {
+	values map[string]string
+	ints   map[string]int
+}
+
+// String returns the resolved value of the param
+func (p OperationParams) String(name string) string {
+	return p.values[name]
+}
+
+// Int returns the resolved value of an integer param
+func (p OperationParams) Int(name string) int {
+	return p.ints[name]
+}
+
+// OperationDescriptors returns the descriptors of every registered operation type
+func OperationDescriptors() []OperationDescriptor {
+	handlers := GetOperationHandlerRegistry().Handlers()
+	descriptors := make([]OperationDescriptor, 0, len(handlers))
+	for _, h := range handlers {
+		descriptors = append(descriptors, h.Descriptor())
+	}
+	return descriptors
+}
+
+// FindOperationDescriptor returns the descriptor of the operation type
+func FindOperationDescriptor(operationType string) (OperationDescriptor, bool) {
+	h, ok := GetOperationHandlerRegistry().Get(operationType)
+	if !ok {
+		return OperationDescriptor{}, false
+	}
+	return h.Descriptor(), true
+}
@@ -1,18 +1,16 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/character"
+	"atlas-npc-conversations/conversation/expression"
 	"atlas-npc-conversations/saga"
+	"atlas-npc-conversations/validation"
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Chronicle20/atlas-constants/field"
-	"github.com/Chronicle20/atlas-constants/job"
-	_map "github.com/Chronicle20/atlas-constants/map"
 	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	"strconv"
-	"strings"
-	"time"
 )
 
 // OperationExecutor is the interface for executing operations in conversations
@@ -22,79 +20,83 @@ type OperationExecutor interface {
 
 	// ExecuteOperations executes multiple operations for a character
 	ExecuteOperations(field field.Model, characterId uint32, operations []OperationModel) error
+
+	// ExecuteSaga executes multiple operations for a character like ExecuteOperations, returning the transaction ID of
+	// the saga created for the remote operations, or uuid.Nil if every operation was executed locally
+	ExecuteSaga(field field.Model, characterId uint32, operations []OperationModel) (uuid.UUID, error)
+
+	// ExecuteGuardedSaga executes multiple operations for a character like ExecuteSaga, with the saga first validating
+	// the guard conditions so none of the remote operations execute unless the character still satisfies them. The
+	// saga is created with the transaction ID, or a new one when it is uuid.Nil.
+	ExecuteGuardedSaga(field field.Model, characterId uint32, transactionId uuid.UUID, guard []ConditionModel, operations []OperationModel) (uuid.UUID, error)
 }
 
 // OperationExecutorImpl is the implementation of the OperationExecutor interface
 type OperationExecutorImpl struct {
-	l     logrus.FieldLogger
-	ctx   context.Context
-	t     tenant.Model
-	sagaP saga.Processor
+	l          logrus.FieldLogger
+	ctx        context.Context
+	t          tenant.Model
+	sagaP      saga.Processor
+	characterP character.Processor
 }
 
 // NewOperationExecutor creates a new operation executor
 func NewOperationExecutor(l logrus.FieldLogger, ctx context.Context) OperationExecutor {
 	t := tenant.MustFromContext(ctx)
 	return &OperationExecutorImpl{
-		l:     l,
-		ctx:   ctx,
-		t:     t,
-		sagaP: saga.NewProcessor(l, ctx),
+		l:          l,
+		ctx:        ctx,
+		t:          t,
+		sagaP:      saga.NewProcessor(l, ctx),
+		characterP: character.NewProcessor(l, ctx),
 	}
 }
 
-// evaluateContextValue evaluates a context value, handling references to the conversation context
-func (e *OperationExecutorImpl) evaluateContextValue(characterId uint32, paramName string, value string) (string, error) {
-	// Check if the value is a context reference
-	if strings.HasPrefix(value, "context.") {
-		// Get the conversation context
-		ctx, err := GetRegistry().GetPreviousContext(e.t, characterId)
-		if err != nil {
-			e.l.WithError(err).Errorf("Failed to get conversation context for character [%d]", characterId)
-			return "", err
-		}
-
-		// Extract the context key
-		contextKey := strings.TrimPrefix(value, "context.")
-
-		// Look up the value in the context map
-		contextValue, exists := ctx.Context()[contextKey]
-		if !exists {
-			e.l.Errorf("Context key [%s] not found in conversation context", contextKey)
-			return "", fmt.Errorf("context key [%s] not found", contextKey)
-		}
-
-		return contextValue, nil
+// findOperationHandler returns the handler registered for the type of the operation
+func findOperationHandler(operation OperationModel) (OperationHandler, error) {
+	h, ok := GetOperationHandlerRegistry().Get(operation.Type())
+	if !ok {
+		return nil, fmt.Errorf("unknown operation type: %s", operation.Type())
 	}
+	return h, nil
+}
 
-	// If it's not a context reference, return the value as is
-	return value, nil
+// resolveParams resolves the params of an operation against the descriptor of its handler, evaluating references to
+// the conversation context and the attributes of the character
+func (e *OperationExecutorImpl) resolveParams(characterId uint32, h OperationHandler, operation OperationModel) (OperationParams, error) {
+	return h.Descriptor().ResolveParams(operation.Params(), e.expressionResolver(characterId))
 }
 
-// evaluateContextValueAsInt evaluates a context value as an integer
-func (e *OperationExecutorImpl) evaluateContextValueAsInt(characterId uint32, paramName string, value string) (int, error) {
-	// First evaluate the context value as a string
-	strValue, err := e.evaluateContextValue(characterId, paramName, value)
-	if err != nil {
-		return 0, err
+// expressionResolver creates a resolver for the conversation context and the attributes of the character
+func (e *OperationExecutorImpl) expressionResolver(characterId uint32) expression.Resolver {
+	fetchContext := func() (map[string]string, error) {
+		ctx, err := GetRegistry().GetPreviousContext(e.t, characterId)
+		if err != nil {
+			e.l.WithError(err).Errorf("Failed to get conversation context for character [%d]", characterId)
+			return nil, err
+		}
+		return ctx.Context(), nil
 	}
-
-	// Convert the string value to an integer
-	intValue, err := strconv.Atoi(strValue)
-	if err != nil {
-		e.l.WithError(err).Errorf("Failed to convert value [%s] to integer for parameter [%s]", strValue, paramName)
-		return 0, fmt.Errorf("value [%s] for parameter [%s] is not a valid integer", strValue, paramName)
+	var fetchCharacter func() (character.Model, error)
+	if e.characterP != nil {
+		fetchCharacter = func() (character.Model, error) {
+			return e.characterP.GetById(characterId)
+		}
 	}
-
-	return intValue, nil
+	return newExpressionResolver(fetchContext, fetchCharacter)
 }
 
 // ExecuteOperation executes a single operation for a character
 func (e *OperationExecutorImpl) ExecuteOperation(field field.Model, characterId uint32, operation OperationModel) error {
 	e.l.Debugf("Executing operation [%s] for character [%d]", operation.Type(), characterId)
 
+	h, err := findOperationHandler(operation)
+	if err != nil {
+		return err
+	}
+
 	// Check if this is a local operation or needs to be sent to the saga orchestrator
-	if isLocalOperationType(operation.Type()) {
+	if isLocalOperationHandler(h) {
 		return e.executeLocalOperation(field, characterId, operation)
 	}
 
@@ -111,106 +113,99 @@ func (e *OperationExecutorImpl) ExecuteOperation(field field.Model, characterId
 		e.l.WithError(err).Errorf("Failed to create saga for operation [%s] - saga orchestrator communication failed", operation.Type())
 		return fmt.Errorf("saga orchestrator communication failed: %w", err)
 	}
-	
+
 	return nil
 }
 
 // ExecuteOperations executes multiple operations for a character
 func (e *OperationExecutorImpl) ExecuteOperations(field field.Model, characterId uint32, operations []OperationModel) error {
+	_, err := e.ExecuteSaga(field, characterId, operations)
+	return err
+}
+
+// ExecuteSaga executes multiple operations for a character, returning the transaction ID of the saga created for the
+// remote operations
+func (e *OperationExecutorImpl) ExecuteSaga(field field.Model, characterId uint32, operations []OperationModel) (uuid.UUID, error) {
+	return e.ExecuteGuardedSaga(field, characterId, uuid.Nil, nil, operations)
+}
+
+// ExecuteGuardedSaga executes multiple operations for a character, returning the transaction ID of the saga created
+// for the remote operations. The saga starts with a step validating the guard conditions, and is created with the
+// transaction ID unless it is uuid.Nil.
+func (e *OperationExecutorImpl) ExecuteGuardedSaga(field field.Model, characterId uint32, transactionId uuid.UUID, guard []ConditionModel, operations []OperationModel) (uuid.UUID, error) {
 	e.l.Debugf("Executing %d operations for character [%d]", len(operations), characterId)
 
 	// Group operations by type (local vs. remote)
-	localOperations := make([]OperationModel, 0)
-	remoteOperations := make([]OperationModel, 0)
-
-	for _, operation := range operations {
-		if isLocalOperationType(operation.Type()) {
-			localOperations = append(localOperations, operation)
-		} else {
-			remoteOperations = append(remoteOperations, operation)
-		}
+	localOperations, remoteOperations, err := partitionOperations(operations)
+	if err != nil {
+		return uuid.Nil, err
 	}
 
 	// Execute local operations
 	for _, operation := range localOperations {
 		err := e.executeLocalOperation(field, characterId, operation)
 		if err != nil {
-			return err
+			return uuid.Nil, err
 		}
 	}
 
 	// If there are no remote operations, we're done
 	if len(remoteOperations) == 0 {
-		return nil
+		return uuid.Nil, nil
 	}
 
 	// Create a saga for the remote operations
-	s, err := e.createSagaForOperations(field, characterId, remoteOperations)
+	s, err := e.createSagaForOperations(field, characterId, transactionId, guard, remoteOperations)
 	if err != nil {
 		e.l.WithError(err).Errorf("Failed to create saga for remote operations")
-		return err
+		return uuid.Nil, err
 	}
 
 	// Execute the saga with enhanced error handling
 	err = e.sagaP.Create(s)
 	if err != nil {
 		e.l.WithError(err).Errorf("Failed to create saga for remote operations - saga orchestrator communication failed")
-		return fmt.Errorf("saga orchestrator communication failed for remote operations: %w", err)
+		return uuid.Nil, fmt.Errorf("saga orchestrator communication failed for remote operations: %w", err)
 	}
-	
-	return nil
-}
 
-// isLocalOperationType checks if an operation can be executed locally
-func isLocalOperationType(operationType string) bool {
-	// Local operations start with "local:" prefix
-	return strings.HasPrefix(operationType, "local:")
+	return s.TransactionId, nil
 }
 
-// executeLocalOperation executes a local operation
-func (e *OperationExecutorImpl) executeLocalOperation(field field.Model, characterId uint32, operation OperationModel) error {
-	// Remove the "local:" prefix
-	operationType := strings.TrimPrefix(operation.Type(), "local:")
-
-	// Execute the operation based on its type
-	switch operationType {
-	case "log":
-		// Format: local:log
-		// Context: message (string)
-		messageValue, exists := operation.Params()["message"]
-		if !exists {
-			return errors.New("missing message parameter for log operation")
-		}
-
-		// Evaluate the message value
-		message, err := e.evaluateContextValue(characterId, "message", messageValue)
+// partitionOperations splits operations into those executed within the service and those executed by the saga
+// orchestrator, keeping their order
+func partitionOperations(operations []OperationModel) ([]OperationModel, []OperationModel, error) {
+	localOperations := make([]OperationModel, 0)
+	remoteOperations := make([]OperationModel, 0)
+	for _, operation := range operations {
+		h, err := findOperationHandler(operation)
 		if err != nil {
-			return err
-		}
-
-		e.l.Infof("NPC Log for character [%d]: %s", characterId, message)
-		return nil
-
-	case "debug":
-		// Format: local:debug
-		// Context: message (string)
-		messageValue, exists := operation.Params()["message"]
-		if !exists {
-			return errors.New("missing message parameter for debug operation")
+			return nil, nil, err
 		}
-
-		// Evaluate the message value
-		message, err := e.evaluateContextValue(characterId, "message", messageValue)
-		if err != nil {
-			return err
+		if isLocalOperationHandler(h) {
+			localOperations = append(localOperations, operation)
+		} else {
+			remoteOperations = append(remoteOperations, operation)
 		}
+	}
+	return localOperations, remoteOperations, nil
+}
 
-		e.l.Debugf("NPC Debug for character [%d]: %s", characterId, message)
-		return nil
+// executeLocalOperation executes a local operation
+func (e *OperationExecutorImpl) executeLocalOperation(field field.Model, characterId uint32, operation OperationModel) error {
+	h, err := findOperationHandler(operation)
+	if err != nil {
+		return err
+	}
+	lh, ok := h.(LocalOperationHandler)
+	if !ok {
+		return fmt.Errorf("operation type [%s] is not executed locally", operation.Type())
+	}
 
-	default:
-		return fmt.Errorf("unknown local operation type: %s", operationType)
+	params, err := e.resolveParams(characterId, h, operation)
+	if err != nil {
+		return err
 	}
+	return lh.Execute(e.l, field, characterId, params)
 }
 
 // createSagaForOperation creates a saga for a single operation
@@ -221,391 +216,93 @@ func (e *OperationExecutorImpl) createSagaForOperation(field field.Model, charac
 		SetInitiatedBy(fmt.Sprintf("npc-conversation-%s", operation.Type()))
 
 	// Add a step for the operation
-	stepId, status, action, payload, err := e.createStepForOperation(field, characterId, operation)
+	stepId, status, action, payload, compensation, err := e.createStepForOperation(field, characterId, operation)
 	if err != nil {
 		return saga.Saga{}, err
 	}
-	builder.AddStep(stepId, status, action, payload)
+	builder.AddCompensatedStep(stepId, status, action, payload, compensation)
 
 	// Build the saga
 	return builder.Build(), nil
 }
 
-// createSagaForOperations creates a saga for multiple operations
-func (e *OperationExecutorImpl) createSagaForOperations(field field.Model, characterId uint32, operations []OperationModel) (saga.Saga, error) {
+// createSagaForOperations creates a saga for multiple operations, led by a step validating the guard conditions if any
+func (e *OperationExecutorImpl) createSagaForOperations(field field.Model, characterId uint32, transactionId uuid.UUID, guard []ConditionModel, operations []OperationModel) (saga.Saga, error) {
 	// Create a new saga builder
 	builder := saga.NewBuilder().
 		SetSagaType(saga.InventoryTransaction).
 		SetInitiatedBy("npc-conversation-batch")
+	if transactionId != uuid.Nil {
+		builder.SetTransactionId(transactionId)
+	}
 
-	// Add steps for each operation
-	for _, operation := range operations {
-		stepId, status, action, payload, err := e.createStepForOperation(field, characterId, operation)
+	// Validate the guard conditions within the saga, so the orchestrator checks and acts atomically
+	if len(guard) > 0 {
+		payload, err := e.createValidationPayload(characterId, guard)
 		if err != nil {
 			return saga.Saga{}, err
 		}
-		builder.AddStep(stepId, status, action, payload)
+		builder.AddStep(fmt.Sprintf("%s-%d", saga.ValidateCharacterState, characterId), saga.Pending, saga.ValidateCharacterState, payload)
 	}
 
-	// Build the saga
-	return builder.Build(), nil
-}
-
-// createStepForOperation creates a saga step for an operation
-func (e *OperationExecutorImpl) createStepForOperation(f field.Model, characterId uint32, operation OperationModel) (string, saga.Status, saga.Action, any, error) {
-	// Generate a step ID
-	stepId := fmt.Sprintf("%s-%d", operation.Type(), characterId)
-
-	// Create a step based on the operation type
-	switch operation.Type() {
-	case "award_item":
-		// Format: award_item
-		// Context: itemId (uint32), quantity (uint32)
-		itemIdValue, exists := operation.Params()["itemId"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing itemId parameter for award_item operation")
-		}
-
-		// Evaluate the itemId value
-		itemIdInt, err := e.evaluateContextValueAsInt(characterId, "itemId", itemIdValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		quantityValue, exists := operation.Params()["quantity"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing quantity parameter for award_item operation")
-		}
-
-		// Evaluate the quantity value
-		quantityInt, err := e.evaluateContextValueAsInt(characterId, "quantity", quantityValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		payload := saga.AwardItemActionPayload{
-			CharacterId: characterId,
-			Item: saga.ItemPayload{
-				TemplateId: uint32(itemIdInt),
-				Quantity:   uint32(quantityInt),
-			},
-		}
-
-		return stepId, saga.Pending, saga.AwardInventory, payload, nil
-
-	case "award_mesos":
-		// Format: award_mesos
-		// Context: amount (int32), actorId (uint32), actorType (string)
-		amountValue, exists := operation.Params()["amount"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing amount parameter for award_mesos operation")
-		}
-
-		// Evaluate the amount value
-		amountInt, err := e.evaluateContextValueAsInt(characterId, "amount", amountValue)
+	// Add steps for each operation, suffixing the step ID with its position so repeated operation types stay unique
+	for i, operation := range operations {
+		stepId, status, action, payload, compensation, err := e.createStepForOperation(field, characterId, operation)
 		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		// Actor ID is optional
-		var actorIdInt int = 0
-		actorIdValue, exists := operation.Params()["actorId"]
-		if exists {
-			actorIdInt, err = e.evaluateContextValueAsInt(characterId, "actorId", actorIdValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		// Actor type is optional with default "NPC"
-		actorType := "NPC"
-		actorTypeValue, exists := operation.Params()["actorType"]
-		if exists {
-			actorType, err = e.evaluateContextValue(characterId, "actorType", actorTypeValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.AwardMesosPayload{
-			CharacterId: characterId,
-			WorldId:     f.WorldId(),
-			ChannelId:   f.ChannelId(),
-			ActorId:     uint32(actorIdInt),
-			ActorType:   actorType,
-			Amount:      int32(amountInt),
-		}
-
-		return stepId, saga.Pending, saga.AwardMesos, payload, nil
-
-	case "award_exp":
-		// Format: award_exp
-		// Context: amount (uint32), type (string), attr1 (uint32)
-		amountValue, exists := operation.Params()["amount"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing amount parameter for award_exp operation")
-		}
-
-		// Evaluate the amount value
-		amountInt, err := e.evaluateContextValueAsInt(characterId, "amount", amountValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		// Type is optional with default "WHITE"
-		expType := "WHITE"
-		expTypeValue, exists := operation.Params()["type"]
-		if exists {
-			expType, err = e.evaluateContextValue(characterId, "type", expTypeValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		// Attr1 is optional with default 0
-		var attr1Int int = 0
-		attr1Value, exists := operation.Params()["attr1"]
-		if exists {
-			attr1Int, err = e.evaluateContextValueAsInt(characterId, "attr1", attr1Value)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.AwardExperiencePayload{
-			CharacterId: characterId,
-			WorldId:     f.WorldId(),
-			ChannelId:   f.ChannelId(),
-			Distributions: []saga.ExperienceDistributions{
-				{
-					ExperienceType: expType,
-					Amount:         uint32(amountInt),
-					Attr1:          uint32(attr1Int),
-				},
-			},
-		}
-
-		return stepId, saga.Pending, saga.AwardExperience, payload, nil
-
-	case "award_level":
-		// Format: award_level
-		// Context: amount (byte)
-		amountValue, exists := operation.Params()["amount"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing amount parameter for award_level operation")
-		}
-
-		// Evaluate the amount value
-		amountInt, err := e.evaluateContextValueAsInt(characterId, "amount", amountValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		payload := saga.AwardLevelPayload{
-			CharacterId: characterId,
-			WorldId:     f.WorldId(),
-			ChannelId:   f.ChannelId(),
-			Amount:      byte(amountInt),
-		}
-
-		return stepId, saga.Pending, saga.AwardLevel, payload, nil
-
-	case "warp_to_map":
-		// Format: warp_to_map
-		// Context: mapId (uint32), portalId (uint32)
-		var mapIdInt int = 0
-		mapIdValue, exists := operation.Params()["mapId"]
-		if exists {
-			var err error
-			mapIdInt, err = e.evaluateContextValueAsInt(characterId, "mapId", mapIdValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		var portalIdInt int = 0
-		portalIdValue, exists := operation.Params()["portalId"]
-		if exists {
-			var err error
-			portalIdInt, err = e.evaluateContextValueAsInt(characterId, "portalId", portalIdValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.WarpToPortalPayload{
-			CharacterId: characterId,
-			FieldId:     field.NewBuilder(f.WorldId(), f.ChannelId(), _map.Id(mapIdInt)).Build().Id(),
-			PortalId:    uint32(portalIdInt),
-		}
-
-		return stepId, saga.Pending, saga.WarpToPortal, payload, nil
-
-	case "warp_to_random_portal":
-		// Format: warp_to_random_portal
-		// Context: mapId (uint32)
-		var mapIdInt int = 0
-		mapIdValue, exists := operation.Params()["mapId"]
-		if exists {
-			var err error
-			mapIdInt, err = e.evaluateContextValueAsInt(characterId, "mapId", mapIdValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.WarpToRandomPortalPayload{
-			CharacterId: characterId,
-			FieldId:     field.NewBuilder(f.WorldId(), f.ChannelId(), _map.Id(mapIdInt)).Build().Id(),
-		}
-
-		return stepId, saga.Pending, saga.WarpToRandomPortal, payload, nil
-
-	case "change_job":
-		// Format: change_job
-		// Context: jobId (uint16)
-		jobIdValue, exists := operation.Params()["jobId"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing jobId parameter for change_job operation")
-		}
-
-		// Evaluate the jobId value
-		jobIdInt, err := e.evaluateContextValueAsInt(characterId, "jobId", jobIdValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		payload := saga.ChangeJobPayload{
-			CharacterId: characterId,
-			WorldId:     f.WorldId(),
-			ChannelId:   f.ChannelId(),
-			JobId:       job.Id(uint16(jobIdInt)),
-		}
-
-		return stepId, saga.Pending, saga.ChangeJob, payload, nil
-
-	case "create_skill":
-		// Format: create_skill
-		// Context: skillId (uint32), level (byte), masterLevel (byte), expiration (time.Time)
-		skillIdValue, exists := operation.Params()["skillId"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing skillId parameter for create_skill operation")
-		}
-
-		// Evaluate the skillId value
-		skillIdInt, err := e.evaluateContextValueAsInt(characterId, "skillId", skillIdValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		// Level is optional with default 1
-		var levelInt int = 1
-		levelValue, exists := operation.Params()["level"]
-		if exists {
-			levelInt, err = e.evaluateContextValueAsInt(characterId, "level", levelValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		// Master level is optional with default 1
-		var masterLevelInt int = 1
-		masterLevelValue, exists := operation.Params()["masterLevel"]
-		if exists {
-			masterLevelInt, err = e.evaluateContextValueAsInt(characterId, "masterLevel", masterLevelValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.CreateSkillPayload{
-			CharacterId: characterId,
-			SkillId:     uint32(skillIdInt),
-			Level:       byte(levelInt),
-			MasterLevel: byte(masterLevelInt),
-			Expiration:  time.Now().Add(365 * 24 * time.Hour), // Default to 1 year from now
-		}
-
-		return stepId, saga.Pending, saga.CreateSkill, payload, nil
-
-	case "update_skill":
-		// Format: update_skill
-		// Context: skillId (uint32), level (byte), masterLevel (byte), expiration (time.Time)
-		skillIdValue, exists := operation.Params()["skillId"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing skillId parameter for update_skill operation")
-		}
-
-		// Evaluate the skillId value
-		skillIdInt, err := e.evaluateContextValueAsInt(characterId, "skillId", skillIdValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		// Level is optional with default 1
-		var levelInt int = 1
-		levelValue, exists := operation.Params()["level"]
-		if exists {
-			levelInt, err = e.evaluateContextValueAsInt(characterId, "level", levelValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		// Master level is optional with default 1
-		var masterLevelInt int = 1
-		masterLevelValue, exists := operation.Params()["masterLevel"]
-		if exists {
-			masterLevelInt, err = e.evaluateContextValueAsInt(characterId, "masterLevel", masterLevelValue)
-			if err != nil {
-				return "", "", "", nil, err
-			}
-		}
-
-		payload := saga.UpdateSkillPayload{
-			CharacterId: characterId,
-			SkillId:     uint32(skillIdInt),
-			Level:       byte(levelInt),
-			MasterLevel: byte(masterLevelInt),
-			Expiration:  time.Now().Add(365 * 24 * time.Hour), // Default to 1 year from now
+			return saga.Saga{}, err
 		}
+		builder.AddCompensatedStep(fmt.Sprintf("%s-%d", stepId, i), status, action, payload, compensation)
+	}
 
-		return stepId, saga.Pending, saga.UpdateSkill, payload, nil
+	// Build the saga
+	return builder.Build(), nil
+}
 
-	case "destroy_item":
-		// Format: destroy_item
-		// Context: itemId (uint32), quantity (uint32)
-		itemIdValue, exists := operation.Params()["itemId"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing itemId parameter for destroy_item operation")
+// createValidationPayload creates the payload of a saga step validating the conditions, evaluating their values
+// against the conversation context and the attributes of the character
+func (e *OperationExecutorImpl) createValidationPayload(characterId uint32, conditions []ConditionModel) (saga.ValidateCharacterStatePayload, error) {
+	inputs := make([]validation.ConditionInput, 0, len(conditions))
+	for _, condition := range conditions {
+		if condition.IsCombinator() {
+			return saga.ValidateCharacterStatePayload{}, fmt.Errorf("condition [%s] cannot be validated by a saga step", condition.Type())
 		}
-
-		// Evaluate the itemId value
-		itemIdInt, err := e.evaluateContextValueAsInt(characterId, "itemId", itemIdValue)
+		value, err := evaluateInteger(condition.Value(), e.expressionResolver(characterId))
 		if err != nil {
-			return "", "", "", nil, err
-		}
-
-		quantityValue, exists := operation.Params()["quantity"]
-		if !exists {
-			return "", "", "", nil, errors.New("missing quantity parameter for destroy_item operation")
-		}
+			return saga.ValidateCharacterStatePayload{}, fmt.Errorf("value [%s] is not a valid integer: %w", condition.Value(), err)
+		}
+		inputs = append(inputs, validation.ConditionInput{
+			Type:     condition.Type(),
+			Operator: condition.Operator(),
+			Value:    value,
+			ItemId:   condition.ItemId(),
+		})
+	}
+	return saga.ValidateCharacterStatePayload{CharacterId: characterId, Conditions: inputs}, nil
+}
 
-		// Evaluate the quantity value
-		quantityInt, err := e.evaluateContextValueAsInt(characterId, "quantity", quantityValue)
-		if err != nil {
-			return "", "", "", nil, err
-		}
+// createStepForOperation creates a saga step for an operation, with the compensation undoing it if it can be undone
+func (e *OperationExecutorImpl) createStepForOperation(f field.Model, characterId uint32, operation OperationModel) (string, saga.Status, saga.Action, any, *saga.Compensation, error) {
+	// Generate a step ID
+	stepId := fmt.Sprintf("%s-%d", operation.Type(), characterId)
 
-		payload := saga.DestroyAssetPayload{
-			CharacterId: characterId,
-			TemplateId:  uint32(itemIdInt),
-			Quantity:    uint32(quantityInt),
-		}
+	h, err := findOperationHandler(operation)
+	if err != nil {
+		return "", "", "", nil, nil, err
+	}
+	sh, ok := h.(StepOperationHandler)
+	if !ok {
+		return "", "", "", nil, nil, fmt.Errorf("operation type [%s] does not produce a saga step", operation.Type())
+	}
 
-		return stepId, saga.Pending, saga.DestroyAsset, payload, nil
+	// Resolve the params declared by the operation descriptor
+	params, err := e.resolveParams(characterId, h, operation)
+	if err != nil {
+		return "", "", "", nil, nil, err
+	}
 
-	default:
-		return "", "", "", nil, fmt.Errorf("unknown operation type: %s", operation.Type())
+	payload, err := sh.CreatePayload(f, characterId, params)
+	if err != nil {
+		return "", "", "", nil, nil, err
 	}
+	return stepId, saga.Pending, sh.Action(), payload, sh.CreateCompensation(payload), nil
 }
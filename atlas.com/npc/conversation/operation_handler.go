@@ -0,0 +1,195 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/saga"
+	"errors"
+	"fmt"
+	"github.com/Chronicle20/atlas-constants/field"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// OperationHandler handles an operation type. Every handler is either a LocalOperationHandler or a
+// StepOperationHandler.
+type OperationHandler interface {
+	// Descriptor describes the operation type and the params it accepts
+	Descriptor() OperationDescriptor
+}
+
+// LocalOperationHandler executes an operation within this service
+type LocalOperationHandler interface {
+	OperationHandler
+
+	// Execute executes the operation for a character with its resolved params
+	Execute(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error
+}
+
+// StepOperationHandler executes an operation as a step of a saga sent to the saga orchestrator
+type StepOperationHandler interface {
+	OperationHandler
+
+	// Action returns the action of the saga step
+	Action() saga.Action
+
+	// CreatePayload creates the payload of the saga step for a character with its resolved params
+	CreatePayload(f field.Model, characterId uint32, params OperationParams) (any, error)
+
+	// CompensationAction returns the action undoing the saga step, or empty if the step cannot be undone
+	CompensationAction() saga.Action
+
+	// CreateCompensation creates the compensation undoing the saga step with the payload, or nil if the step cannot be
+	// undone
+	CreateCompensation(payload any) *saga.Compensation
+
+	// RegisterPayload registers the payload type of the saga step, so the step can be unmarshalled
+	RegisterPayload()
+}
+
+// localOperationHandler is a LocalOperationHandler backed by a function
+type localOperationHandler struct {
+	descriptor OperationDescriptor
+	execute    func(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error
+}
+
+// NewLocalOperationHandler creates a handler executing the operation with the function
+func NewLocalOperationHandler(descriptor OperationDescriptor, execute func(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error) LocalOperationHandler {
+	return localOperationHandler{descriptor: descriptor, execute: execute}
+}
+
+func (h localOperationHandler) Descriptor() OperationDescriptor {
+	return h.descriptor
+}
+
+func (h localOperationHandler) Execute(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error {
+	return h.execute(l, f, characterId, params)
+}
+
+// stepOperationHandler is a StepOperationHandler backed by a function creating payloads of type P
+type stepOperationHandler[P any] struct {
+	descriptor   OperationDescriptor
+	action       saga.Action
+	create       func(f field.Model, characterId uint32, params OperationParams) (P, error)
+	compensation saga.Action
+	compensate   func(payload P) any
+}
+
+// NewStepOperationHandler creates a handler producing saga steps for the action, with payloads created by the function
+func NewStepOperationHandler[P any](descriptor OperationDescriptor, action saga.Action, create func(f field.Model, characterId uint32, params OperationParams) (P, error)) StepOperationHandler {
+	return stepOperationHandler[P]{descriptor: descriptor, action: action, create: create}
+}
+
+// NewCompensatedStepOperationHandler creates a handler like NewStepOperationHandler whose steps are undone by the
+// compensation action, with the payload of the compensation created from the payload of the step
+func NewCompensatedStepOperationHandler[P any](descriptor OperationDescriptor, action saga.Action, create func(f field.Model, characterId uint32, params OperationParams) (P, error), compensation saga.Action, compensate func(payload P) any) StepOperationHandler {
+	return stepOperationHandler[P]{descriptor: descriptor, action: action, create: create, compensation: compensation, compensate: compensate}
+}
+
+func (h stepOperationHandler[P]) Descriptor() OperationDescriptor {
+	return h.descriptor
+}
+
+func (h stepOperationHandler[P]) Action() saga.Action {
+	return h.action
+}
+
+func (h stepOperationHandler[P]) CreatePayload(f field.Model, characterId uint32, params OperationParams) (any, error) {
+	return h.create(f, characterId, params)
+}
+
+func (h stepOperationHandler[P]) CompensationAction() saga.Action {
+	return h.compensation
+}
+
+func (h stepOperationHandler[P]) CreateCompensation(payload any) *saga.Compensation {
+	p, ok := payload.(P)
+	if h.compensate == nil || !ok {
+		return nil
+	}
+	return &saga.Compensation{Action: h.compensation, Payload: h.compensate(p)}
+}
+
+func (h stepOperationHandler[P]) RegisterPayload() {
+	saga.RegisterPayload[P](h.action)
+}
+
+// OperationHandlerRegistry holds the handler of every supported operation type
+type OperationHandlerRegistry struct {
+	lock     sync.RWMutex
+	handlers map[string]OperationHandler
+	order    []string
+}
+
+var operationHandlerOnce sync.Once
+var operationHandlerRegistry *OperationHandlerRegistry
+
+// GetOperationHandlerRegistry returns the operation handler registry, holding the built-in handlers
+func GetOperationHandlerRegistry() *OperationHandlerRegistry {
+	operationHandlerOnce.Do(func() {
+		operationHandlerRegistry = initOperationHandlerRegistry()
+	})
+	return operationHandlerRegistry
+}
+
+func initOperationHandlerRegistry() *OperationHandlerRegistry {
+	r := &OperationHandlerRegistry{
+		handlers: make(map[string]OperationHandler),
+		order:    make([]string, 0),
+	}
+	for _, h := range builtinOperationHandlers() {
+		if err := r.Register(h); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register registers the handler for its operation type. Step handlers also register their payload type.
+func (r *OperationHandlerRegistry) Register(h OperationHandler) error {
+	name := h.Descriptor().Name()
+	if name == "" {
+		return errors.New("operation type is required")
+	}
+
+	_, local := h.(LocalOperationHandler)
+	stepHandler, step := h.(StepOperationHandler)
+	if local == step {
+		return fmt.Errorf("handler for operation [%s] must either execute locally or produce a saga step", name)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.handlers[name]; ok {
+		return fmt.Errorf("handler for operation [%s] is already registered", name)
+	}
+	if step {
+		stepHandler.RegisterPayload()
+	}
+	r.handlers[name] = h
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Get returns the handler of the operation type
+func (r *OperationHandlerRegistry) Get(operationType string) (OperationHandler, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	h, ok := r.handlers[operationType]
+	return h, ok
+}
+
+// Handlers returns every registered handler, in registration order
+func (r *OperationHandlerRegistry) Handlers() []OperationHandler {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	handlers := make([]OperationHandler, 0, len(r.order))
+	for _, name := range r.order {
+		handlers = append(handlers, r.handlers[name])
+	}
+	return handlers
+}
+
+// isLocalOperationHandler returns true if the handler executes its operation locally
+func isLocalOperationHandler(h OperationHandler) bool {
+	_, ok := h.(LocalOperationHandler)
+	return ok
+}
@@ -0,0 +1,341 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/saga"
+	"atlas-npc-conversations/validation"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Chronicle20/atlas-constants/field"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationDescriptor_ResolveParams(t *testing.T) {
+	descriptor, ok := FindOperationDescriptor("award_mesos")
+	require.True(t, ok)
+
+	lookup := newExpressionResolver(func() (map[string]string, error) {
+		return map[string]string{"reward": "500"}, nil
+	}, nil)
+
+	params, err := descriptor.ResolveParams(map[string]string{"amount": "context.reward"}, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, 500, params.Int("amount"))
+	assert.Equal(t, 0, params.Int("actorId"), "optional integer params default")
+	assert.Equal(t, "NPC", params.String("actorType"), "optional string params default")
+
+	_, err = descriptor.ResolveParams(map[string]string{}, lookup)
+	assert.EqualError(t, err, "missing amount parameter for award_mesos operation")
+
+	_, err = descriptor.ResolveParams(map[string]string{"amount": "lots"}, lookup)
+	assert.Error(t, err)
+
+	_, err = descriptor.ResolveParams(map[string]string{"amount": "context.missing"}, lookup)
+	assert.Error(t, err)
+
+	params, err = descriptor.ResolveParams(map[string]string{"amount": "min(context.reward * 3, 1000)", "actorType": "=lower('NPC') + '-' + context.reward"}, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, params.Int("amount"))
+	assert.Equal(t, "npc-500", params.String("actorType"))
+
+	_, err = descriptor.ResolveParams(map[string]string{"amount": "character.level"}, lookup)
+	assert.Error(t, err, "character attributes are unavailable without a character processor")
+}
+
+// Test a param which may not reference the context does not stop the params after it from doing so
+func TestOperationDescriptor_ResolveParams_ConstantParam(t *testing.T) {
+	descriptor, ok := FindOperationDescriptor("award_exp")
+	require.True(t, ok)
+	param, ok := descriptor.FindParam("type")
+	require.True(t, ok)
+	assert.False(t, param.ContextAllowed())
+
+	lookup := newExpressionResolver(func() (map[string]string, error) {
+		return map[string]string{"reward": "500", "kind": "YELLOW"}, nil
+	}, nil)
+
+	params, err := descriptor.ResolveParams(map[string]string{"amount": "context.reward", "type": "WHITE", "attr1": "context.reward"}, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, 500, params.Int("amount"))
+	assert.Equal(t, "WHITE", params.String("type"))
+	assert.Equal(t, 500, params.Int("attr1"))
+
+	_, err = descriptor.ResolveParams(map[string]string{"amount": "1", "type": "context.kind"}, lookup)
+	assert.Error(t, err)
+	assert.Error(t, checkParamValue(param, "=context.kind"))
+	assert.NoError(t, checkParamValue(param, "YELLOW"))
+}
+
+// Test every registered operation can be turned into a saga step or executed locally
+func TestOperationDescriptors_Executable(t *testing.T) {
+	e := &OperationExecutorImpl{l: logrus.New(), ctx: context.Background(), t: createTestTenant()}
+
+	for _, h := range GetOperationHandlerRegistry().Handlers() {
+		descriptor := h.Descriptor()
+		t.Run(descriptor.Name(), func(t *testing.T) {
+			params := make(map[string]string)
+			for _, p := range descriptor.Params() {
+				if p.Required() {
+					params[p.Name()] = "1"
+				}
+			}
+			operation, err := NewOperationBuilder().SetType(descriptor.Name()).SetParams(params).Build()
+			require.NoError(t, err)
+
+			if isLocalOperationHandler(h) {
+				assert.NoError(t, e.executeLocalOperation(createTestField(), 12345, operation))
+				return
+			}
+			_, status, action, payload, _, err := e.createStepForOperation(createTestField(), 12345, operation)
+			require.NoError(t, err)
+			assert.Equal(t, saga.Pending, status)
+			assert.NotEmpty(t, action)
+			assert.NotNil(t, payload)
+		})
+	}
+
+	operation, err := NewOperationBuilder().SetType("award_pet").SetParams(map[string]string{}).Build()
+	require.NoError(t, err)
+	_, _, _, _, _, err = e.createStepForOperation(createTestField(), 12345, operation)
+	assert.Error(t, err)
+}
+
+func TestTransformOperationHandler(t *testing.T) {
+	h, ok := GetOperationHandlerRegistry().Get("create_skill")
+	require.True(t, ok)
+
+	rm, err := TransformOperationHandler(h)
+	require.NoError(t, err)
+	assert.Equal(t, "create_skill", rm.GetID())
+	assert.False(t, rm.Local)
+	assert.Empty(t, rm.Compensation)
+	assert.Equal(t, []RestParamDescriptorModel{
+		{Name: "skillId", Type: "integer", Required: true, ContextAllowed: true},
+		{Name: "level", Type: "integer", Default: "1", ContextAllowed: true},
+		{Name: "masterLevel", Type: "integer", Default: "1", ContextAllowed: true},
+	}, rm.Params)
+}
+
+// fakeSagaProcessor records the sagas it is asked to create
+type fakeSagaProcessor struct {
+	sagas []saga.Saga
+}
+
+func (p *fakeSagaProcessor) Create(s saga.Saga) error {
+	p.sagas = append(p.sagas, s)
+	return nil
+}
+
+// testTokenPayload is the payload of the award_tokens test operation
+type testTokenPayload struct {
+	CharacterId uint32 `json:"characterId"`
+	Tokens      uint32 `json:"tokens"`
+}
+
+const testTokenAction saga.Action = "award_tokens"
+
+// Helper function to register the award_tokens test operation
+func registerTestTokenHandler(t *testing.T) {
+	if _, ok := GetOperationHandlerRegistry().Get("test:award_tokens"); ok {
+		return
+	}
+	h := NewStepOperationHandler(
+		NewOperationDescriptor("test:award_tokens", "Award event tokens", RequiredParam("tokens", IntegerParam)),
+		testTokenAction,
+		func(f field.Model, characterId uint32, params OperationParams) (testTokenPayload, error) {
+			return testTokenPayload{CharacterId: characterId, Tokens: uint32(params.Int("tokens"))}, nil
+		})
+	require.NoError(t, GetOperationHandlerRegistry().Register(h))
+}
+
+func TestOperationHandlerRegistry_Register(t *testing.T) {
+	r := initOperationHandlerRegistry()
+	count := len(r.Handlers())
+
+	local := NewLocalOperationHandler(NewOperationDescriptor("test:noop", "Do nothing"), func(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error {
+		return nil
+	})
+	require.NoError(t, r.Register(local))
+	assert.Len(t, r.Handlers(), count+1)
+	assert.Equal(t, "test:noop", r.Handlers()[count].Descriptor().Name(), "handlers are listed in registration order")
+
+	assert.Error(t, r.Register(local), "operation types may only be registered once")
+	assert.Error(t, r.Register(NewLocalOperationHandler(NewOperationDescriptor("", "Unnamed"), nil)))
+	assert.Error(t, r.Register(descriptorOnlyHandler{}), "handlers must either execute locally or produce a saga step")
+}
+
+// descriptorOnlyHandler neither executes locally nor produces a saga step
+type descriptorOnlyHandler struct{}
+
+func (h descriptorOnlyHandler) Descriptor() OperationDescriptor {
+	return NewOperationDescriptor("test:invalid", "Invalid")
+}
+
+// Test a handler can be exercised alone, without the executor
+func TestStepOperationHandler_CreatePayload(t *testing.T) {
+	h, ok := GetOperationHandlerRegistry().Get("award_mesos")
+	require.True(t, ok)
+	sh, ok := h.(StepOperationHandler)
+	require.True(t, ok)
+
+	params, err := h.Descriptor().ResolveParams(map[string]string{"amount": "-100"}, nil)
+	require.NoError(t, err)
+	payload, err := sh.CreatePayload(createTestField(), 12345, params)
+	require.NoError(t, err)
+
+	assert.Equal(t, saga.AwardMesos, sh.Action())
+	assert.Equal(t, int32(-100), payload.(saga.AwardMesosPayload).Amount)
+	assert.Equal(t, "NPC", payload.(saga.AwardMesosPayload).ActorType)
+}
+
+// Test an operation registered outside the built-ins is executed through a saga whose step payload can be unmarshalled
+func TestOperationExecutor_RegisteredStepHandler(t *testing.T) {
+	registerTestTokenHandler(t)
+
+	sagaP := &fakeSagaProcessor{}
+	e := &OperationExecutorImpl{l: logrus.New(), ctx: context.Background(), t: createTestTenant(), sagaP: sagaP}
+	operation, err := NewOperationBuilder().SetType("test:award_tokens").SetParams(map[string]string{"tokens": "5"}).Build()
+	require.NoError(t, err)
+
+	require.NoError(t, e.ExecuteOperation(createTestField(), 12345, operation))
+	require.Len(t, sagaP.sagas, 1)
+	require.Len(t, sagaP.sagas[0].Steps, 1)
+	assert.Equal(t, testTokenAction, sagaP.sagas[0].Steps[0].Action)
+
+	data, err := json.Marshal(sagaP.sagas[0])
+	require.NoError(t, err)
+	var s saga.Saga
+	require.NoError(t, json.Unmarshal(data, &s))
+	assert.Equal(t, testTokenPayload{CharacterId: 12345, Tokens: 5}, s.Steps[0].Payload)
+}
+
+// Test the built-in operations which can be undone declare their compensating action
+func TestStepOperationHandler_CreateCompensation(t *testing.T) {
+	tests := []struct {
+		operationType string
+		params        map[string]string
+		expected      *saga.Compensation
+	}{
+		{
+			operationType: "award_mesos",
+			params:        map[string]string{"amount": "-1000000"},
+			expected: &saga.Compensation{Action: saga.AwardMesos, Payload: saga.AwardMesosPayload{
+				CharacterId: 12345, WorldId: 1, ChannelId: 1, ActorType: "NPC", Amount: 1000000,
+			}},
+		},
+		{
+			operationType: "award_item",
+			params:        map[string]string{"itemId": "2000000", "quantity": "5"},
+			expected:      &saga.Compensation{Action: saga.DestroyAsset, Payload: saga.DestroyAssetPayload{CharacterId: 12345, TemplateId: 2000000, Quantity: 5}},
+		},
+		{
+			operationType: "destroy_item",
+			params:        map[string]string{"itemId": "4001126", "quantity": "10"},
+			expected: &saga.Compensation{Action: saga.AwardInventory, Payload: saga.AwardItemActionPayload{
+				CharacterId: 12345, Item: saga.ItemPayload{TemplateId: 4001126, Quantity: 10},
+			}},
+		},
+		{
+			operationType: "warp_to_map",
+			params:        map[string]string{"mapId": "100000000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operationType, func(t *testing.T) {
+			h, ok := GetOperationHandlerRegistry().Get(tt.operationType)
+			require.True(t, ok)
+			sh, ok := h.(StepOperationHandler)
+			require.True(t, ok)
+
+			params, err := h.Descriptor().ResolveParams(tt.params, nil)
+			require.NoError(t, err)
+			payload, err := sh.CreatePayload(createTestField(), 12345, params)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, sh.CreateCompensation(payload))
+			if tt.expected == nil {
+				assert.Empty(t, sh.CompensationAction())
+			} else {
+				assert.Equal(t, tt.expected.Action, sh.CompensationAction())
+			}
+		})
+	}
+}
+
+// Test the saga of a generic action carries the compensation of each step, so the orchestrator can roll it back
+func TestOperationExecutor_ExecuteSaga_Compensations(t *testing.T) {
+	sagaP := &fakeSagaProcessor{}
+	e := &OperationExecutorImpl{l: logrus.New(), ctx: context.Background(), t: createTestTenant(), sagaP: sagaP}
+	pay, err := NewOperationBuilder().SetType("award_mesos").AddParamValue("amount", "-1000000").Build()
+	require.NoError(t, err)
+	warp, err := NewOperationBuilder().SetType("warp_to_map").AddParamValue("mapId", "100000000").Build()
+	require.NoError(t, err)
+
+	_, err = e.ExecuteSaga(createTestField(), 12345, []OperationModel{pay, warp})
+	require.NoError(t, err)
+	require.Len(t, sagaP.sagas, 1)
+
+	data, err := json.Marshal(sagaP.sagas[0])
+	require.NoError(t, err)
+	var s saga.Saga
+	require.NoError(t, json.Unmarshal(data, &s))
+	require.Len(t, s.Steps, 2)
+	require.NotNil(t, s.Steps[0].Compensation)
+	assert.Equal(t, saga.AwardMesos, s.Steps[0].Compensation.Action)
+	assert.Equal(t, int32(1000000), s.Steps[0].Compensation.Payload.(saga.AwardMesosPayload).Amount)
+	assert.Nil(t, s.Steps[1].Compensation)
+
+	// Paying completed but the warp failed, so the payment is refunded
+	s.SetStepStatus(0, saga.Completed)
+	s.SetStepStatus(1, saga.Failed)
+	plan := s.RollbackPlan()
+	require.Len(t, plan, 1)
+	assert.Equal(t, saga.AwardMesos, plan[0].Action)
+	assert.Equal(t, int32(1000000), plan[0].Payload.(saga.AwardMesosPayload).Amount)
+}
+
+// Test a guarded saga validates the conditions in its leading step, evaluating their values against the context
+func TestOperationExecutor_ExecuteGuardedSaga(t *testing.T) {
+	characterId := uint32(12345)
+	tenant := createTestTenant()
+	require.NoError(t, GetRegistry().SetContext(tenant, characterId, ConversationContext{characterId: characterId, context: map[string]string{"quantity": "10"}}))
+	defer GetRegistry().ClearContext(tenant, characterId)
+
+	sagaP := &fakeSagaProcessor{}
+	e := &OperationExecutorImpl{l: logrus.New(), ctx: context.Background(), t: tenant, sagaP: sagaP}
+	condition, err := NewConditionBuilder().SetType("item").SetOperator(">=").SetValue("context.quantity").SetItemId("4001126").Build()
+	require.NoError(t, err)
+	destroy, err := NewOperationBuilder().SetType("destroy_item").AddParamValue("itemId", "4001126").AddParamValue("quantity", "context.quantity").Build()
+	require.NoError(t, err)
+
+	transactionId, err := e.ExecuteGuardedSaga(createTestField(), characterId, uuid.Nil, []ConditionModel{condition}, []OperationModel{destroy})
+	require.NoError(t, err)
+	require.Len(t, sagaP.sagas, 1)
+	assert.Equal(t, sagaP.sagas[0].TransactionId, transactionId)
+
+	data, err := json.Marshal(sagaP.sagas[0])
+	require.NoError(t, err)
+	var s saga.Saga
+	require.NoError(t, json.Unmarshal(data, &s))
+	require.Len(t, s.Steps, 2)
+	assert.Equal(t, saga.ValidateCharacterState, s.Steps[0].Action)
+	assert.Equal(t, saga.ValidateCharacterStatePayload{
+		CharacterId: characterId,
+		Conditions:  []validation.ConditionInput{{Type: "item", Operator: ">=", Value: 10, ItemId: "4001126"}},
+	}, s.Steps[0].Payload)
+	assert.Equal(t, saga.DestroyAsset, s.Steps[1].Action)
+
+	// A conversation parked before the saga is emitted chooses its transaction ID
+	parked := uuid.New()
+	transactionId, err = e.ExecuteGuardedSaga(createTestField(), characterId, parked, nil, []OperationModel{destroy})
+	require.NoError(t, err)
+	assert.Equal(t, parked, transactionId)
+	require.Len(t, sagaP.sagas, 2)
+	assert.Equal(t, parked, sagaP.sagas[1].TransactionId)
+}
@@ -0,0 +1,193 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/saga"
+	"github.com/Chronicle20/atlas-constants/field"
+	"github.com/Chronicle20/atlas-constants/job"
+	_map "github.com/Chronicle20/atlas-constants/map"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// builtinOperationHandlers returns the handlers of the operation types supported out of the box, in the order they
+// are documented
+func builtinOperationHandlers() []OperationHandler {
+	return []OperationHandler{
+		NewCompensatedStepOperationHandler(
+			NewOperationDescriptor("award_item", "Award an item to the character",
+				RequiredParam("itemId", IntegerParam), RequiredParam("quantity", IntegerParam)),
+			saga.AwardInventory,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.AwardItemActionPayload, error) {
+				return saga.AwardItemActionPayload{
+					CharacterId: characterId,
+					Item: saga.ItemPayload{
+						TemplateId: uint32(params.Int("itemId")),
+						Quantity:   uint32(params.Int("quantity")),
+					},
+				}, nil
+			},
+			saga.DestroyAsset,
+			func(p saga.AwardItemActionPayload) any {
+				return saga.DestroyAssetPayload{
+					CharacterId: p.CharacterId,
+					TemplateId:  p.Item.TemplateId,
+					Quantity:    p.Item.Quantity,
+				}
+			}),
+		NewCompensatedStepOperationHandler(
+			NewOperationDescriptor("award_mesos", "Award mesos to the character",
+				RequiredParam("amount", IntegerParam), OptionalParam("actorId", IntegerParam, "0"), OptionalParam("actorType", StringParam, "NPC")),
+			saga.AwardMesos,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.AwardMesosPayload, error) {
+				return saga.AwardMesosPayload{
+					CharacterId: characterId,
+					WorldId:     f.WorldId(),
+					ChannelId:   f.ChannelId(),
+					ActorId:     uint32(params.Int("actorId")),
+					ActorType:   params.String("actorType"),
+					Amount:      int32(params.Int("amount")),
+				}, nil
+			},
+			saga.AwardMesos,
+			func(p saga.AwardMesosPayload) any {
+				p.Amount = -p.Amount
+				return p
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("award_exp", "Award experience points to the character",
+				RequiredParam("amount", IntegerParam), ConstantParam("type", StringParam, "WHITE"), OptionalParam("attr1", IntegerParam, "0")),
+			saga.AwardExperience,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.AwardExperiencePayload, error) {
+				return saga.AwardExperiencePayload{
+					CharacterId: characterId,
+					WorldId:     f.WorldId(),
+					ChannelId:   f.ChannelId(),
+					Distributions: []saga.ExperienceDistributions{
+						{
+							ExperienceType: params.String("type"),
+							Amount:         uint32(params.Int("amount")),
+							Attr1:          uint32(params.Int("attr1")),
+						},
+					},
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("award_level", "Award levels to the character",
+				RequiredParam("amount", IntegerParam)),
+			saga.AwardLevel,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.AwardLevelPayload, error) {
+				return saga.AwardLevelPayload{
+					CharacterId: characterId,
+					WorldId:     f.WorldId(),
+					ChannelId:   f.ChannelId(),
+					Amount:      byte(params.Int("amount")),
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("warp_to_map", "Warp the character to a portal of a map",
+				OptionalParam("mapId", IntegerParam, "0"), OptionalParam("portalId", IntegerParam, "0")),
+			saga.WarpToPortal,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.WarpToPortalPayload, error) {
+				return saga.WarpToPortalPayload{
+					CharacterId: characterId,
+					FieldId:     field.NewBuilder(f.WorldId(), f.ChannelId(), _map.Id(params.Int("mapId"))).Build().Id(),
+					PortalId:    uint32(params.Int("portalId")),
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("warp_to_random_portal", "Warp the character to a random portal of a map",
+				OptionalParam("mapId", IntegerParam, "0")),
+			saga.WarpToRandomPortal,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.WarpToRandomPortalPayload, error) {
+				return saga.WarpToRandomPortalPayload{
+					CharacterId: characterId,
+					FieldId:     field.NewBuilder(f.WorldId(), f.ChannelId(), _map.Id(params.Int("mapId"))).Build().Id(),
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("change_job", "Change the character's job",
+				RequiredParam("jobId", IntegerParam)),
+			saga.ChangeJob,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.ChangeJobPayload, error) {
+				return saga.ChangeJobPayload{
+					CharacterId: characterId,
+					WorldId:     f.WorldId(),
+					ChannelId:   f.ChannelId(),
+					JobId:       job.Id(uint16(params.Int("jobId"))),
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("create_skill", "Create a skill for the character",
+				RequiredParam("skillId", IntegerParam), OptionalParam("level", IntegerParam, "1"), OptionalParam("masterLevel", IntegerParam, "1")),
+			saga.CreateSkill,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.CreateSkillPayload, error) {
+				return saga.CreateSkillPayload{
+					CharacterId: characterId,
+					SkillId:     uint32(params.Int("skillId")),
+					Level:       byte(params.Int("level")),
+					MasterLevel: byte(params.Int("masterLevel")),
+					Expiration:  time.Now().Add(365 * 24 * time.Hour), // Default to 1 year from now
+				}, nil
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("update_skill", "Update a skill of the character",
+				RequiredParam("skillId", IntegerParam), OptionalParam("level", IntegerParam, "1"), OptionalParam("masterLevel", IntegerParam, "1")),
+			saga.UpdateSkill,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.UpdateSkillPayload, error) {
+				return saga.UpdateSkillPayload{
+					CharacterId: characterId,
+					SkillId:     uint32(params.Int("skillId")),
+					Level:       byte(params.Int("level")),
+					MasterLevel: byte(params.Int("masterLevel")),
+					Expiration:  time.Now().Add(365 * 24 * time.Hour), // Default to 1 year from now
+				}, nil
+			}),
+		NewCompensatedStepOperationHandler(
+			NewOperationDescriptor("destroy_item", "Remove items from the character's inventory",
+				RequiredParam("itemId", IntegerParam), RequiredParam("quantity", IntegerParam)),
+			saga.DestroyAsset,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.DestroyAssetPayload, error) {
+				return saga.DestroyAssetPayload{
+					CharacterId: characterId,
+					TemplateId:  uint32(params.Int("itemId")),
+					Quantity:    uint32(params.Int("quantity")),
+				}, nil
+			},
+			saga.AwardInventory,
+			func(p saga.DestroyAssetPayload) any {
+				return saga.AwardItemActionPayload{
+					CharacterId: p.CharacterId,
+					Item: saga.ItemPayload{
+						TemplateId: p.TemplateId,
+						Quantity:   p.Quantity,
+					},
+				}
+			}),
+		NewStepOperationHandler(
+			NewOperationDescriptor("change_style", "Change the character's hair, face or skin",
+				RequiredParam("styleId", IntegerParam)),
+			saga.ChangeStyle,
+			func(f field.Model, characterId uint32, params OperationParams) (saga.ChangeStylePayload, error) {
+				return saga.ChangeStylePayload{
+					CharacterId: characterId,
+					WorldId:     f.WorldId(),
+					ChannelId:   f.ChannelId(),
+					StyleId:     uint32(params.Int("styleId")),
+				}, nil
+			}),
+		NewLocalOperationHandler(
+			NewOperationDescriptor("local:log", "Log a message at info level",
+				RequiredParam("message", StringParam)),
+			func(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error {
+				l.Infof("NPC Log for character [%d]: %s", characterId, params.String("message"))
+				return nil
+			}),
+		NewLocalOperationHandler(
+			NewOperationDescriptor("local:debug", "Log a message at debug level",
+				RequiredParam("message", StringParam)),
+			func(l logrus.FieldLogger, f field.Model, characterId uint32, params OperationParams) error {
+				l.Debugf("NPC Debug for character [%d]: %s", characterId, params.String("message"))
+				return nil
+			}),
+	}
+}
@@ -1,6 +1,11 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/character"
+	"atlas-npc-conversations/conversation/expression"
+	npc2 "atlas-npc-conversations/kafka/message/npc"
+	"atlas-npc-conversations/kafka/producer"
+	"atlas-npc-conversations/localization"
 	"atlas-npc-conversations/message"
 	"atlas-npc-conversations/npc"
 	"context"
@@ -12,6 +17,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"math/rand"
+	"strconv"
 	"time"
 )
 
@@ -20,11 +27,14 @@ type Processor interface {
 	Start(field field.Model, npcId uint32, characterId uint32) error
 
 	// Continue continues a conversation with an NPC
-	Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32) error
+	Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32, text string) error
 
 	// End ends a conversation
 	End(characterId uint32) error
 
+	// ResumeSaga continues the conversation parked on the saga once the saga completed or failed
+	ResumeSaga(transactionId uuid.UUID, succeeded bool, reason string) error
+
 	// Create creates a new conversation
 	Create(model Model) (Model, error)
 
@@ -48,12 +58,15 @@ type Processor interface {
 }
 
 type ProcessorImpl struct {
-	l         logrus.FieldLogger
-	ctx       context.Context
-	t         tenant.Model
-	db        *gorm.DB
-	evaluator Evaluator
-	executor  OperationExecutor
+	l          logrus.FieldLogger
+	ctx        context.Context
+	t          tenant.Model
+	db         *gorm.DB
+	evaluator  Evaluator
+	executor   OperationExecutor
+	characterP character.Processor
+	rng        *rand.Rand
+	producer   producer.Provider
 }
 
 func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
@@ -62,12 +75,15 @@ func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Proces
 	executor := NewOperationExecutor(l, ctx)
 
 	return &ProcessorImpl{
-		l:         l,
-		ctx:       ctx,
-		t:         t,
-		db:        db,
-		evaluator: evaluator,
-		executor:  executor,
+		l:          l,
+		ctx:        ctx,
+		t:          t,
+		db:         db,
+		evaluator:  evaluator,
+		executor:   executor,
+		characterP: character.NewProcessor(l, ctx),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		producer:   producer.ProviderImpl(l)(ctx),
 	}
 }
 
@@ -141,6 +157,7 @@ func (p *ProcessorImpl) Update(id uuid.UUID, m Model) (Model, error) {
 	result = p.db.Model(&Entity{}).Where("tenant_id = ? AND id = ?", p.t.Id(), id).Updates(map[string]interface{}{
 		"npc_id":     entity.NpcID,
 		"data":       entity.Data,
+		"version":    gorm.Expr("version + 1"),
 		"updated_at": time.Now(),
 	})
 	if result.Error != nil {
@@ -176,12 +193,27 @@ func (p *ProcessorImpl) Delete(id uuid.UUID) error {
 func (p *ProcessorImpl) Start(field field.Model, npcId uint32, characterId uint32) error {
 	p.l.Debugf("Starting conversation with NPC [%d] with character [%d] in map [%d].", npcId, characterId, field.MapId())
 
+	err := retryOnConflict(func() error {
+		return p.begin(field, npcId, characterId)
+	})
+	if err != nil {
+		return err
+	}
+	return p.drive(characterId, npcId)
+}
+
+// begin stores the context of a new conversation with the NPC, unless the character is already in a conversation
+func (p *ProcessorImpl) begin(field field.Model, npcId uint32, characterId uint32) error {
 	// Check if there's already a conversation in progress
 	_, err := GetRegistry().GetPreviousContext(p.t, characterId)
 	if err == nil {
 		p.l.Debugf("Previous conversation for character [%d] exists, avoiding starting new conversation with NPC [%d].", characterId, npcId)
 		return errors.New("another conversation exists")
 	}
+	if !errors.Is(err, ErrContextNotFound) {
+		p.l.WithError(err).Errorf("Unable to retrieve conversation context for [%d].", characterId)
+		return err
+	}
 
 	// Get the conversation for this NPC
 	conversation, err := p.ByNpcIdProvider(npcId)()
@@ -206,32 +238,51 @@ func (p *ProcessorImpl) Start(field field.Model, npcId uint32, characterId uint3
 		return err
 	}
 
-	// Store the context
-	GetRegistry().SetContext(p.t, ctx.CharacterId(), ctx)
-
-	cont := true
-	for cont {
-		ctx, err = GetRegistry().GetPreviousContext(p.t, characterId)
-		if err != nil {
-			p.l.WithError(err).Errorf("Unable to retrieve conversation context for [%d].", characterId)
-			return errors.New("conversation context not found")
-		}
+	// Store the context, unless another conversation was started meanwhile
+	err = GetRegistry().CompareAndSetContext(p.t, ctx.CharacterId(), ctx)
+	if err != nil && !errors.Is(err, ErrRevisionConflict) {
+		p.l.WithError(err).Errorf("Failed to store conversation context for character [%d].", ctx.CharacterId())
+	}
+	return err
+}
 
-		cont, err = p.ProcessState(ctx)
-		if err != nil {
-			p.l.WithError(err).Errorf("Failed to process state [%s] for character [%d] and NPC [%d]", startStateId, characterId, npcId)
-			return err
-		}
+func (p *ProcessorImpl) Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32, text string) error {
+	// The state the response answers, so a retry never applies it to a state the player has not seen
+	stateId := ""
+	var cont bool
+	err := retryOnConflict(func() error {
+		var err error
+		cont, err = p.advance(characterId, &stateId, action, lastMessageType, selection, text)
+		return err
+	})
+	if err != nil || !cont {
+		return err
 	}
-	return nil
+	return p.drive(characterId, npcId)
 }
 
-func (p *ProcessorImpl) Continue(npcId uint32, characterId uint32, action byte, lastMessageType byte, selection int32) error {
+// advance applies the player's response to the current state of the character's conversation and stores the context
+// at the next state. The state read first is recorded in stateId; when advance is retried after a conflict, the
+// response is dropped unless the conversation is still at that state. Returns false if the response ended the
+// conversation or was dropped.
+func (p *ProcessorImpl) advance(characterId uint32, stateId *string, action byte, lastMessageType byte, selection int32, text string) (bool, error) {
 	// Get the previous context
 	ctx, err := GetRegistry().GetPreviousContext(p.t, characterId)
 	if err != nil {
 		p.l.WithError(err).Errorf("Unable to retrieve conversation context for [%d].", characterId)
-		return errors.New("conversation context not found")
+		return false, errors.New("conversation context not found")
+	}
+
+	if *stateId == "" {
+		*stateId = ctx.CurrentState()
+	} else if ctx.CurrentState() != *stateId {
+		p.l.Debugf("Dropping response of character [%d] to state [%s], as the conversation moved on to state [%s].", characterId, *stateId, ctx.CurrentState())
+		return false, nil
+	}
+
+	if ctx.AwaitingSaga() != uuid.Nil {
+		p.l.Debugf("Ignoring response of character [%d] while conversation awaits saga [%s].", characterId, ctx.AwaitingSaga())
+		return false, nil
 	}
 
 	p.l.Debugf("Continuing conversation with NPC [%d] with character [%d] in map [%d].", ctx.NpcId(), characterId, ctx.Field().MapId())
@@ -245,96 +296,209 @@ func (p *ProcessorImpl) Continue(npcId uint32, characterId uint32, action byte,
 	state, err := conversation.FindState(currentStateId)
 	if err != nil {
 		p.l.WithError(err).Errorf("Failed to find state [%s] for character [%d]", currentStateId, characterId)
-		return err
+		return false, err
 	}
 
 	// Process the player's selection based on the state type
 	var nextStateId string
 	var choiceContext map[string]string
+	var restored *ConversationContext
 
 	switch state.Type() {
 	case DialogueStateType:
 		// For dialogue states, the action is the index of the choice
 		dialogue := state.Dialogue()
 		if dialogue == nil {
-			return errors.New("dialogue is nil")
+			return false, errors.New("dialogue is nil")
 		}
 
-		choice, _ := dialogue.ChoiceFromAction(action)
-		nextStateId = choice.NextState()
+		// Return to the previously visited dialogue state when the player pages back
+		if previous, ok := ctx.Previous(); ok && isPreviousAction(*dialogue, action, lastMessageType) {
+			p.l.Debugf("Returning character [%d] from state [%s] to previous state [%s].", characterId, currentStateId, previous.CurrentState())
+			nextStateId = previous.CurrentState()
+			restored = &previous
+			break
+		}
 
-		// Store the choice context for later use
-		choiceContext = choice.Context()
+		// Menu selections must refer to a choice which was visible to the character
+		if dialogue.DialogueType() == SendSimple && action == 1 {
+			_, visible, err := p.selectChoice(characterId, dialogue.Choices(), action, selection)
+			if err != nil {
+				p.l.WithError(err).Errorf("Failed to evaluate choice visibility for state [%s] for character [%d]", currentStateId, characterId)
+				GetRegistry().ClearContext(p.t, characterId)
+				return false, err
+			}
+			if !visible {
+				nextStateId = currentStateId
+				break
+			}
+		}
+
+		// Resolve the transition and store the choice context or answer for later use
+		nextStateId, choiceContext = dialogue.TransitionFromResponse(state.Id(), action, selection, text)
 	case ListSelectionType:
 		// For list selection states, the selection is the index of the option
 		listSelection := state.ListSelection()
 		if listSelection == nil {
-			return errors.New("listSelection is nil")
+			return false, errors.New("listSelection is nil")
+		}
+
+		choices, err := listSelection.ResolveChoices(ctx.Context(), ctx.Conversation().OptionSets())
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to resolve choices for state [%s] for character [%d]", currentStateId, characterId)
+			GetRegistry().ClearContext(p.t, characterId)
+			return false, err
 		}
 
-		choice, _ := listSelection.ChoiceFromSelection(action, selection)
+		choice, visible, err := p.selectChoice(characterId, choices, action, selection)
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to evaluate choice visibility for state [%s] for character [%d]", currentStateId, characterId)
+			GetRegistry().ClearContext(p.t, characterId)
+			return false, err
+		}
+		if !visible {
+			// The selected choice was hidden from the character, show the list again
+			nextStateId = currentStateId
+			break
+		}
 		nextStateId = choice.NextState()
 
 		// Store the choice context for later use
 		choiceContext = choice.Context()
 
+	case StyleSelectionType:
+		// For style selection states, the selection is the index of the offered style
+		styleSelection := state.StyleSelection()
+		if styleSelection == nil {
+			return false, errors.New("styleSelection is nil")
+		}
+
+		if action != 1 {
+			nextStateId = styleSelection.CancelState()
+			break
+		}
+
+		styles, err := styleSelection.ResolveStyles(ctx.Context())
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to resolve styles for state [%s] for character [%d]", currentStateId, characterId)
+			GetRegistry().ClearContext(p.t, characterId)
+			return false, err
+		}
+		if selection < 0 || selection >= int32(len(styles)) {
+			p.l.Warnf("Character [%d] selected invalid style index [%d] in state [%s].", characterId, selection, currentStateId)
+			nextStateId = currentStateId
+			break
+		}
+
+		// Store the chosen style for use by a follow-up change_style operation
+		nextStateId = styleSelection.NextState()
+		choiceContext = map[string]string{styleSelection.ContextKey(): strconv.FormatUint(uint64(styles[selection]), 10)}
+
 	default:
 		// For other state types, we shouldn't be here (they should have been processed already)
-		return fmt.Errorf("unexpected state type for Continue: %s", state.Type())
+		return false, fmt.Errorf("unexpected state type for Continue: %s", state.Type())
 	}
 
 	// If there's a next state, process it
 	if nextStateId == "" {
 		// No next state, end the conversation
 		GetRegistry().ClearContext(p.t, characterId)
-		return nil
+		return false, nil
 	}
 
-	// Update the context with the next state
-	builder := NewConversationContextBuilder().
-		SetField(ctx.Field()).
-		SetCharacterId(ctx.CharacterId()).
-		SetNpcId(ctx.NpcId()).
-		SetCurrentState(nextStateId).
-		SetConversation(ctx.Conversation())
+	if restored != nil {
+		// The restored context already holds the previous state and the context values present when it was shown
+		ctx = *restored
+	} else {
+		// Update the context with the next state
+		builder := NewConversationContextBuilder().
+			SetField(ctx.Field()).
+			SetCharacterId(ctx.CharacterId()).
+			SetNpcId(ctx.NpcId()).
+			SetCurrentState(nextStateId).
+			SetConversation(ctx.Conversation()).
+			SetHistory(ctx.History()).
+			SetRevision(ctx.Revision())
+
+		// Preserve existing context and add new context from the choice
+		existingContext := ctx.Context()
+		for k, v := range existingContext {
+			builder.AddContextValue(k, v)
+		}
 
-	// Preserve existing context and add new context from the choice
-	existingContext := ctx.Context()
-	for k, v := range existingContext {
-		builder.AddContextValue(k, v)
-	}
+		// Remember the dialogue being left so the player can page back to it
+		if state.Type() == DialogueStateType && nextStateId != currentStateId {
+			builder.PushHistory(currentStateId, existingContext)
+		}
 
-	// Add new context from the choice (will overwrite existing values with the same keys)
-	for k, v := range choiceContext {
-		builder.AddContextValue(k, v)
+		// Add new context from the choice (will overwrite existing values with the same keys)
+		for k, v := range choiceContext {
+			builder.AddContextValue(k, v)
+		}
+
+		ctx, err = builder.Build()
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to update conversation context for character [%d] and NPC [%d]", ctx.CharacterId(), ctx.NpcId())
+			return false, err
+		}
 	}
 
-	ctx, err = builder.Build()
+	// Store the context, unless the conversation was updated since it was read
+	err = GetRegistry().CompareAndSetContext(p.t, ctx.CharacterId(), ctx)
 	if err != nil {
-		p.l.WithError(err).Errorf("Failed to update conversation context for character [%d] and NPC [%d]", ctx.CharacterId(), ctx.NpcId())
-		return err
+		if !errors.Is(err, ErrRevisionConflict) {
+			p.l.WithError(err).Errorf("Failed to store conversation context for character [%d].", ctx.CharacterId())
+		}
+		return false, err
 	}
+	return true, nil
+}
 
-	// Store the context
-	GetRegistry().SetContext(p.t, ctx.CharacterId(), ctx)
-
+// drive processes states until the conversation waits for the player or ends. A turn may process at most
+// MaxActionSteps states and may not return to a state with an unchanged context; otherwise the conversation is ended
+// and the client disposed, so a misconfigured conversation cannot spin forever.
+func (p *ProcessorImpl) drive(characterId uint32, npcId uint32) error {
+	guard := newActionStepGuard()
 	cont := true
 	for cont {
-		ctx, err = GetRegistry().GetPreviousContext(p.t, characterId)
+		ctx, err := GetRegistry().GetPreviousContext(p.t, characterId)
 		if err != nil {
 			p.l.WithError(err).Errorf("Unable to retrieve conversation context for [%d].", characterId)
 			return errors.New("conversation context not found")
 		}
 
+		err = guard.Visit(ctx)
+		if err != nil {
+			p.l.WithError(err).Errorf("Ending conversation with NPC [%d] for character [%d].", npcId, characterId)
+			GetRegistry().ClearContext(p.t, characterId)
+			npc.NewProcessor(p.l, p.ctx).Dispose(ctx.Field().WorldId(), ctx.Field().ChannelId(), characterId)
+			if eerr := p.producer(npc2.EnvEventTopicConversationStatus)(errorEventProvider(ctx, err.Error())); eerr != nil {
+				p.l.WithError(eerr).Errorf("Failed to emit error event for character [%d].", characterId)
+			}
+			return err
+		}
+
 		cont, err = p.ProcessState(ctx)
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to process state [%s] for character [%d] and NPC [%d]", nextStateId, characterId, npcId)
+			p.l.WithError(err).Errorf("Failed to process state [%s] for character [%d] and NPC [%d]", ctx.CurrentState(), characterId, npcId)
 			return err
 		}
 	}
 	return nil
 }
 
+const (
+	// lastMessageTypeSay is the client message type reported for sendNext, sendNextPrev and sendOk dialogues
+	lastMessageTypeSay byte = 0
+	// actionPrevious is the action reported when the player presses Previous on a sendNextPrev dialogue
+	actionPrevious byte = 0
+)
+
+// isPreviousAction returns true if the player's response pages back from a sendNextPrev dialogue
+func isPreviousAction(dialogue DialogueModel, action byte, lastMessageType byte) bool {
+	return dialogue.DialogueType() == SendNextPrev && lastMessageType == lastMessageTypeSay && action == actionPrevious
+}
+
 func (p *ProcessorImpl) ProcessState(ctx ConversationContext) (bool, error) {
 	stateId := ctx.CurrentState()
 	state, err := ctx.Conversation().FindState(stateId)
@@ -343,6 +507,11 @@ func (p *ProcessorImpl) ProcessState(ctx ConversationContext) (bool, error) {
 		return false, err
 	}
 
+	// Park the conversation until the saga of the operations completes or fails
+	if genericAction := state.GenericAction(); genericAction != nil && genericAction.AwaitsSaga() {
+		return p.awaitSaga(ctx, state)
+	}
+
 	// Process the state
 	nextStateId, err := p.processState(ctx, state)
 	if err != nil {
@@ -352,35 +521,88 @@ func (p *ProcessorImpl) ProcessState(ctx ConversationContext) (bool, error) {
 
 	// If there's a next state, update the context and store it
 	if nextStateId != "" {
-		// Update the context with the next state
+		stored, err := p.transition(ctx, nextStateId)
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to store conversation context for character [%d].", ctx.CharacterId())
+			return false, err
+		}
+		if !stored {
+			p.l.Debugf("Conversation of character [%d] left state [%s] while it was processed. Keeping the latest context.", ctx.CharacterId(), stateId)
+			return false, nil
+		}
+
+		return state.stateType == GenericActionType || state.stateType == CraftActionType, nil
+	} else {
+		// No next state, end the conversation
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return false, nil
+	}
+}
+
+// MaxConflictRetries is the number of times an update of a conversation is retried after another update, such as one
+// processed by another replica, stored the context first
+const MaxConflictRetries = 10
+
+// retryOnConflict runs the update until it does not fail with ErrRevisionConflict, at most MaxConflictRetries more
+// times
+func retryOnConflict(update func() error) error {
+	err := update()
+	for retry := 0; retry < MaxConflictRetries && errors.Is(err, ErrRevisionConflict); retry++ {
+		err = update()
+	}
+	return err
+}
+
+// transition stores the context at the next state, preserving its context values and applying the decorators. When another update stored the
+// context first, the transition is applied again to the latest context as long as it is still at the state it was
+// moving from. Returns false if the conversation left that state or ended meanwhile, so the other update is kept.
+func (p *ProcessorImpl) transition(ctx ConversationContext, nextStateId string, decorators ...model.Decorator[*ConversationContextBuilder]) (bool, error) {
+	stateId := ctx.CurrentState()
+	stored := false
+	err := retryOnConflict(func() error {
 		builder := NewConversationContextBuilder().
 			SetField(ctx.Field()).
 			SetCharacterId(ctx.CharacterId()).
 			SetNpcId(ctx.NpcId()).
 			SetCurrentState(nextStateId).
-			SetConversation(ctx.Conversation())
+			SetConversation(ctx.Conversation()).
+			SetHistory(ctx.History()).
+			SetRevision(ctx.Revision())
 
 		// Preserve existing context
-		existingContext := ctx.Context()
-		for k, v := range existingContext {
+		for k, v := range ctx.Context() {
 			builder.AddContextValue(k, v)
 		}
+		for _, decorator := range decorators {
+			builder = decorator(builder)
+		}
 
-		ctx, err = builder.Build()
+		next, err := builder.Build()
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to update conversation context for character [%d] and NPC [%d]", ctx.CharacterId(), ctx.NpcId())
-			return false, err
+			return err
 		}
 
-		// Store the context
-		GetRegistry().SetContext(p.t, ctx.CharacterId(), ctx)
+		err = GetRegistry().CompareAndSetContext(p.t, next.CharacterId(), next)
+		if !errors.Is(err, ErrRevisionConflict) {
+			stored = err == nil
+			return err
+		}
 
-		return state.stateType == GenericActionType, nil
-	} else {
-		// No next state, end the conversation
-		GetRegistry().ClearContext(p.t, ctx.CharacterId())
-		return false, nil
-	}
+		// Apply the transition to the latest context, unless the other update moved the conversation on
+		latest, rerr := GetRegistry().GetPreviousContext(p.t, ctx.CharacterId())
+		if errors.Is(rerr, ErrContextNotFound) {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+		if latest.CurrentState() != stateId {
+			return nil
+		}
+		ctx = latest
+		return err
+	})
+	return stored, err
 }
 
 // processState processes a conversation state and returns the next state ID
@@ -401,6 +623,9 @@ func (p *ProcessorImpl) processState(ctx ConversationContext, state StateModel)
 	case ListSelectionType:
 		// Process list selection state
 		return p.processListSelectionState(ctx, state)
+	case StyleSelectionType:
+		// Process style selection state
+		return p.processStyleSelectionState(ctx, state)
 	default:
 		return "", errors.New("unknown state type")
 	}
@@ -413,25 +638,51 @@ func (p *ProcessorImpl) processDialogueState(ctx ConversationContext, state Stat
 		return "", errors.New("dialogue is nil")
 	}
 
+	locales, lookup := p.textLocales(ctx)
+	r := p.textResolver(ctx)
+	text, err := newTextRenderer(locales, lookup, r)(dialogue.Text())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to render text for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
 	// TODO: Send the dialogue to the client
 	if dialogue.dialogueType == SendNext {
-		npc.NewProcessor(p.l, p.ctx).SendNext(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(dialogue.Text())
+		npc.NewProcessor(p.l, p.ctx).SendNext(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(text)
 	} else if dialogue.dialogueType == SendOk {
-		npc.NewProcessor(p.l, p.ctx).SendOk(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(dialogue.Text())
+		npc.NewProcessor(p.l, p.ctx).SendOk(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(text)
 	} else if dialogue.dialogueType == SendYesNo {
-		npc.NewProcessor(p.l, p.ctx).SendYesNo(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(dialogue.Text())
+		npc.NewProcessor(p.l, p.ctx).SendYesNo(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(text)
+	} else if dialogue.dialogueType == SendSimple {
+		menu, err := p.renderMenu(ctx.CharacterId(), newChoiceRenderer(locales, lookup, r), text, dialogue.Choices())
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to render choices for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+			GetRegistry().ClearContext(p.t, ctx.CharacterId())
+			return "", err
+		}
+		npc.NewProcessor(p.l, p.ctx).SendSimple(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(menu)
+	} else if dialogue.dialogueType == SendNextPrev {
+		npc.NewProcessor(p.l, p.ctx).SendNextPrevious(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(text)
+	} else if dialogue.dialogueType == SendAcceptDecline {
+		npc.NewProcessor(p.l, p.ctx).SendAcceptDecline(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(text)
+	} else if dialogue.dialogueType == GetNumber {
+		input := dialogue.NumberInput()
+		npc.NewProcessor(p.l, p.ctx).SendGetNumber(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId(), input.DefaultValue(), input.MinValue(), input.MaxValue())(text)
+	} else if dialogue.dialogueType == GetText {
+		input := dialogue.TextInput()
+		npc.NewProcessor(p.l, p.ctx).SendGetText(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId(), input.DefaultValue(), input.MinLength(), input.MaxLength())(text)
 	} else {
 		p.l.Warnf("Unhandled dialog type [%s].", dialogue.dialogueType)
 	}
 
-	// If the dialogue has choices, wait for the player's selection
-	if len(dialogue.Choices()) > 0 {
+	// If the dialogue has transitions, wait for the player's response
+	if dialogue.AwaitsInput() {
 		// Return the current state ID to indicate that we're waiting for input
 		return state.Id(), nil
 	}
 
-	// Otherwise, return the next state ID (for dialogues without choices)
-	// For now, just return an empty string to end the conversation
+	// Otherwise, the dialogue is terminal, so end the conversation
 	return "", nil
 }
 
@@ -451,33 +702,102 @@ func (p *ProcessorImpl) processGenericActionState(ctx ConversationContext, state
 	}()
 
 	// Execute operations with error recovery
-	for _, operation := range genericAction.Operations() {
-		err := p.executor.ExecuteOperation(ctx.Field(), ctx.CharacterId(), operation)
+	_, err := p.executeGenericAction(ctx, *genericAction, uuid.Nil)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to execute operations of state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		// Clean up conversation context before returning error
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	return p.evaluateOutcomes(ctx, genericAction.Outcomes())
+}
+
+// executeGenericAction executes the operations of a generic action. The remote operations are executed as a single
+// saga, with the local operations executed before or after it, unless the action is fireAndForget, which executes each
+// operation on its own in the order written. When the conversation awaits the saga, local operations ordered last
+// are executed once it completes. The saga is created with the transaction ID, or a new one when it is uuid.Nil.
+// Returns the transaction ID of the saga, or uuid.Nil if there is none.
+func (p *ProcessorImpl) executeGenericAction(ctx ConversationContext, genericAction GenericActionModel, transactionId uuid.UUID) (uuid.UUID, error) {
+	if genericAction.FireAndForget() {
+		for _, operation := range genericAction.Operations() {
+			err := p.executor.ExecuteOperation(ctx.Field(), ctx.CharacterId(), operation)
+			if err != nil {
+				p.l.WithError(err).Errorf("Failed to execute operation [%s] for character [%d].", operation.Type(), ctx.CharacterId())
+				return uuid.Nil, err
+			}
+		}
+		return uuid.Nil, nil
+	}
+
+	localOperations, remoteOperations, err := partitionOperations(genericAction.Operations())
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if genericAction.LocalOperations() == LocalOperationsFirst {
+		err = p.executeLocalOperations(ctx, localOperations)
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to execute operation [%s] for character [%d]. Cleaning up conversation context.", operation.Type(), ctx.CharacterId())
-			// Clean up conversation context before returning error
-			GetRegistry().ClearContext(p.t, ctx.CharacterId())
-			return "", err
+			return uuid.Nil, err
 		}
 	}
 
+	if len(remoteOperations) > 0 {
+		// Validate the conditions of the outcomes leading here within the saga
+		if guard := ctx.Conversation().Guard(ctx.CurrentState()); len(guard) > 0 || transactionId != uuid.Nil {
+			transactionId, err = p.executor.ExecuteGuardedSaga(ctx.Field(), ctx.CharacterId(), transactionId, guard, remoteOperations)
+		} else {
+			transactionId, err = p.executor.ExecuteSaga(ctx.Field(), ctx.CharacterId(), remoteOperations)
+		}
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	if genericAction.LocalOperations() == LocalOperationsLast && (!genericAction.AwaitsSaga() || transactionId == uuid.Nil) {
+		err = p.executeLocalOperations(ctx, localOperations)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return transactionId, nil
+}
+
+// executeGenericActionLocalOperations executes the operations of a generic action handled within the service
+func (p *ProcessorImpl) executeGenericActionLocalOperations(ctx ConversationContext, genericAction GenericActionModel) error {
+	localOperations, _, err := partitionOperations(genericAction.Operations())
+	if err != nil {
+		return err
+	}
+	return p.executeLocalOperations(ctx, localOperations)
+}
+
+// executeLocalOperations executes the operations handled within the service, if any
+func (p *ProcessorImpl) executeLocalOperations(ctx ConversationContext, operations []OperationModel) error {
+	if len(operations) == 0 {
+		return nil
+	}
+	return p.executor.ExecuteOperations(ctx.Field(), ctx.CharacterId(), operations)
+}
+
+// evaluateOutcomes returns the next state of the first outcome whose conditions pass, or empty to end the conversation
+func (p *ProcessorImpl) evaluateOutcomes(ctx ConversationContext, outcomes []OutcomeModel) (string, error) {
 	// Evaluate outcomes with error recovery
-	for _, outcome := range genericAction.Outcomes() {
+	for _, outcome := range outcomes {
 		if len(outcome.Conditions()) == 0 {
 			return outcome.NextState(), nil
 		}
 
-		// Evaluate the condition
-		// TODO
-		passed, err := p.evaluator.EvaluateCondition(ctx.CharacterId(), outcome.Conditions()[0])
+		// Evaluate all conditions of the outcome in a single validation request
+		passed, err := p.evaluator.EvaluateConditions(ctx.CharacterId(), outcome.Conditions())
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to evaluate condition [%+v] for character [%d]. Cleaning up conversation context.", outcome.Conditions()[0], ctx.CharacterId())
+			p.l.WithError(err).Errorf("Failed to evaluate conditions [%+v] for character [%d]. Cleaning up conversation context.", outcome.Conditions(), ctx.CharacterId())
 			// Clean up conversation context before returning error
 			GetRegistry().ClearContext(p.t, ctx.CharacterId())
 			return "", err
 		}
 
-		// If the condition passed, return the next state
+		// If the conditions passed, return the next state
 		if passed {
 			return outcome.NextState(), nil
 		}
@@ -487,6 +807,128 @@ func (p *ProcessorImpl) processGenericActionState(ctx ConversationContext, state
 	return "", nil
 }
 
+// SagaFailureReasonContextKey is the context key holding the reason the saga of a generic action failed, so the
+// onFailure state may explain it to the character
+const SagaFailureReasonContextKey = "sagaFailureReason"
+
+// awaitSaga executes the operations of a generic action as a single saga and parks the conversation on it. The
+// conversation continues with ResumeSaga once the saga completes or fails. It is parked before the saga is emitted,
+// so a status event arriving straight away finds it. When every operation is executed locally, there is no saga to
+// wait for and the conversation continues as if it completed.
+func (p *ProcessorImpl) awaitSaga(ctx ConversationContext, state StateModel) (bool, error) {
+	genericAction := state.GenericAction()
+	_, remoteOperations, err := partitionOperations(genericAction.Operations())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to execute operations of state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return false, err
+	}
+	if len(remoteOperations) == 0 {
+		_, err = p.executeGenericAction(ctx, *genericAction, uuid.Nil)
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to execute operations of state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+			GetRegistry().ClearContext(p.t, ctx.CharacterId())
+			return false, err
+		}
+		return p.resume(ctx, *genericAction, true, "", false)
+	}
+
+	transactionId := uuid.New()
+	p.l.Debugf("Conversation of character [%d] in state [%s] is awaiting saga [%s].", ctx.CharacterId(), state.Id(), transactionId)
+	stored, err := p.transition(ctx, state.Id(), func(b *ConversationContextBuilder) *ConversationContextBuilder {
+		return b.SetAwaitingSaga(transactionId)
+	})
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to store conversation context for character [%d].", ctx.CharacterId())
+		return false, err
+	}
+	if !stored {
+		// The conversation moved on or ended meanwhile, so the operations are not executed
+		return false, nil
+	}
+
+	_, err = p.executeGenericAction(ctx, *genericAction, transactionId)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to execute operations of state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return false, err
+	}
+	return false, nil
+}
+
+// ResumeSaga continues the conversation parked on the saga. A completed saga moves the conversation to onSuccess, or
+// the first outcome whose conditions pass; a failed saga moves it to onFailure with the reason in the context.
+// Sagas no conversation is parked on, such as those of other services, are ignored.
+func (p *ProcessorImpl) ResumeSaga(transactionId uuid.UUID, succeeded bool, reason string) error {
+	ctx, err := GetRegistry().GetAwaitingContext(p.t, transactionId)
+	if errors.Is(err, ErrContextNotFound) {
+		return nil
+	}
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to retrieve conversation context awaiting saga [%s].", transactionId)
+		return err
+	}
+
+	p.l.Debugf("Saga [%s] awaited by character [%d] finished. Succeeded [%t].", transactionId, ctx.CharacterId(), succeeded)
+	state, err := ctx.Conversation().FindState(ctx.CurrentState())
+	if err != nil || state.GenericAction() == nil {
+		p.l.Errorf("Conversation of character [%d] awaits saga [%s] in state [%s], which is not a generic action. Cleaning up conversation context.", ctx.CharacterId(), transactionId, ctx.CurrentState())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		npc.NewProcessor(p.l, p.ctx).Dispose(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId())
+		return fmt.Errorf("state [%s] does not await a saga", ctx.CurrentState())
+	}
+
+	cont, err := p.resume(ctx, *state.GenericAction(), succeeded, reason, true)
+	if err != nil || !cont {
+		return err
+	}
+	return p.drive(ctx.CharacterId(), ctx.NpcId())
+}
+
+// resume moves the conversation on from a generic action once its saga completed or failed, first executing the local
+// operations ordered last if they are still pending. Returns true if the conversation continues at the next state.
+func (p *ProcessorImpl) resume(ctx ConversationContext, genericAction GenericActionModel, succeeded bool, reason string, pendingLocal bool) (bool, error) {
+	if succeeded && pendingLocal && genericAction.LocalOperations() == LocalOperationsLast {
+		err := p.executeGenericActionLocalOperations(ctx, genericAction)
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to execute local operations for character [%d]. Cleaning up conversation context.", ctx.CharacterId())
+			GetRegistry().ClearContext(p.t, ctx.CharacterId())
+			npc.NewProcessor(p.l, p.ctx).Dispose(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId())
+			return false, err
+		}
+	}
+
+	nextStateId := genericAction.OnFailure()
+	decorators := []model.Decorator[*ConversationContextBuilder]{func(b *ConversationContextBuilder) *ConversationContextBuilder {
+		return b.AddContextValue(SagaFailureReasonContextKey, reason)
+	}}
+	if succeeded {
+		decorators = nil
+		nextStateId = genericAction.OnSuccess()
+		if nextStateId == "" {
+			var err error
+			nextStateId, err = p.evaluateOutcomes(ctx, genericAction.Outcomes())
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if nextStateId == "" {
+		// No next state, end the conversation
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		npc.NewProcessor(p.l, p.ctx).Dispose(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId())
+		return false, nil
+	}
+
+	stored, err := p.transition(ctx, nextStateId, decorators...)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to store conversation context for character [%d].", ctx.CharacterId())
+		return false, err
+	}
+	return stored, nil
+}
+
 // processCraftActionState processes a craft action state
 func (p *ProcessorImpl) processCraftActionState(ctx ConversationContext, state StateModel) (string, error) {
 	craftAction := state.CraftAction()
@@ -494,11 +936,159 @@ func (p *ProcessorImpl) processCraftActionState(ctx ConversationContext, state S
 		return "", errors.New("craftAction is nil")
 	}
 
-	// TODO: Implement proper craft action processing logic
-	// This could involve checking materials, costs, and determining success/failure
-	// For now, return empty string to end conversation (simplified approach)
-	// Future implementation should use outcome-based state transitions
-	return "", nil
+	// Take the recipe from the chosen option when the craft action refers to an option set
+	craftAction, err := resolveCraftAction(ctx, *craftAction)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to resolve recipe for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	// Verify the character holds the materials, stimulator and mesos required in a single validation request
+	passed, err := p.evaluator.EvaluateConditions(ctx.CharacterId(), craftRequirements(*craftAction))
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to evaluate craft requirements for item [%s] for character [%d]. Cleaning up conversation context.", craftAction.ItemId(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+	if !passed {
+		p.l.Debugf("Character [%d] does not meet the craft requirements for item [%s].", ctx.CharacterId(), craftAction.ItemId())
+		return craftAction.MissingMaterialsState(), nil
+	}
+
+	// Resolve the stimulator outcome before anything is consumed
+	succeeded := true
+	if craftAction.StimulatorId() != 0 && craftAction.StimulatorFailChance() > 0 {
+		succeeded = p.rng.Float64() >= craftAction.StimulatorFailChance()
+	}
+
+	operations, err := craftOperations(*craftAction, ctx.NpcId(), succeeded)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to build craft operations for item [%s] for character [%d]. Cleaning up conversation context.", craftAction.ItemId(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	// Consume materials and mesos and award the item as a single saga
+	err = p.executor.ExecuteOperations(ctx.Field(), ctx.CharacterId(), operations)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to execute craft of item [%s] for character [%d]. Cleaning up conversation context.", craftAction.ItemId(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	if !succeeded {
+		p.l.Debugf("Stimulator failed while crafting item [%s] for character [%d].", craftAction.ItemId(), ctx.CharacterId())
+		return craftAction.FailureState(), nil
+	}
+	return craftAction.SuccessState(), nil
+}
+
+// resolveCraftAction returns the craft action with its recipe taken from the option chosen earlier in the conversation
+func resolveCraftAction(ctx ConversationContext, craftAction CraftActionModel) (*CraftActionModel, error) {
+	if craftAction.OptionSetId() == "" {
+		return &craftAction, nil
+	}
+
+	optionSet, err := ctx.Conversation().FindOptionSet(craftAction.OptionSetId())
+	if err != nil {
+		return nil, err
+	}
+	value, exists := ctx.Context()[craftAction.OptionContextKey()]
+	if !exists {
+		return nil, fmt.Errorf("context key [%s] not found", craftAction.OptionContextKey())
+	}
+	optionId, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid option ID [%s]: %w", value, err)
+	}
+	option, err := optionSet.FindOption(uint32(optionId))
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := craftAction.ForOption(option)
+	return &resolved, nil
+}
+
+// craftRequirements produces the conditions a character must satisfy to perform a craft
+func craftRequirements(c CraftActionModel) []ConditionModel {
+	conditions := make([]ConditionModel, 0, len(c.Materials())+2)
+	for i, material := range c.Materials() {
+		conditions = append(conditions, ConditionModel{
+			conditionType: "item",
+			operator:      ">=",
+			value:         strconv.FormatUint(uint64(c.Quantities()[i]), 10),
+			itemId:        strconv.FormatUint(uint64(material), 10),
+		})
+	}
+	if c.StimulatorId() != 0 {
+		conditions = append(conditions, ConditionModel{
+			conditionType: "item",
+			operator:      ">=",
+			value:         "1",
+			itemId:        strconv.FormatUint(uint64(c.StimulatorId()), 10),
+		})
+	}
+	if c.MesoCost() > 0 {
+		conditions = append(conditions, ConditionModel{
+			conditionType: "meso",
+			operator:      ">=",
+			value:         strconv.FormatUint(uint64(c.MesoCost()), 10),
+		})
+	}
+	return conditions
+}
+
+// craftOperations produces the operations which consume the craft cost and, when successful, award the crafted item
+func craftOperations(c CraftActionModel, npcId uint32, succeeded bool) ([]OperationModel, error) {
+	operations := make([]OperationModel, 0, len(c.Materials())+3)
+	for i, material := range c.Materials() {
+		operation, err := NewOperationBuilder().
+			SetType("destroy_item").
+			AddParamValue("itemId", strconv.FormatUint(uint64(material), 10)).
+			AddParamValue("quantity", strconv.FormatUint(uint64(c.Quantities()[i]), 10)).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	if c.StimulatorId() != 0 {
+		operation, err := NewOperationBuilder().
+			SetType("destroy_item").
+			AddParamValue("itemId", strconv.FormatUint(uint64(c.StimulatorId()), 10)).
+			AddParamValue("quantity", "1").
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	if c.MesoCost() > 0 {
+		operation, err := NewOperationBuilder().
+			SetType("award_mesos").
+			AddParamValue("amount", strconv.FormatInt(-int64(c.MesoCost()), 10)).
+			AddParamValue("actorId", strconv.FormatUint(uint64(npcId), 10)).
+			AddParamValue("actorType", "NPC").
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	if succeeded {
+		operation, err := NewOperationBuilder().
+			SetType("award_item").
+			AddParamValue("itemId", c.ItemId()).
+			AddParamValue("quantity", "1").
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
 }
 
 // processListSelectionState processes a list selection state
@@ -508,18 +1098,140 @@ func (p *ProcessorImpl) processListSelectionState(ctx ConversationContext, state
 		return "", errors.New("listSelection is nil")
 	}
 
-	mb := message.NewBuilder().AddText(listSelection.Title()).NewLine()
-	for i, choice := range listSelection.Choices() {
+	choices, err := listSelection.ResolveChoices(ctx.Context(), ctx.Conversation().OptionSets())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to resolve choices for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	locales, lookup := p.textLocales(ctx)
+	r := p.textResolver(ctx)
+	title, err := newTextRenderer(locales, lookup, r)(listSelection.Title())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to render title for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	menu, err := p.renderMenu(ctx.CharacterId(), newChoiceRenderer(locales, lookup, r), title, choices)
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to render choices for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	npc.NewProcessor(p.l, p.ctx).SendSimple(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(menu)
+	return state.Id(), nil
+}
+
+// selectChoice returns the choice the player selected and whether it is visible to the character. Hidden choices
+// cannot be selected, even though their index is valid.
+func (p *ProcessorImpl) selectChoice(characterId uint32, choices []ChoiceModel, action byte, selection int32) (ChoiceModel, bool, error) {
+	choice, err := choiceFromSelection(choices, action, selection)
+	if err != nil {
+		p.l.Debugf("Character [%d] made invalid selection [%d].", characterId, selection)
+		return ChoiceModel{}, true, nil
+	}
+	if action != 1 || len(choice.Conditions()) == 0 {
+		return choice, true, nil
+	}
+
+	visible, err := p.evaluator.EvaluateConditions(characterId, choice.Conditions())
+	if err != nil {
+		return ChoiceModel{}, false, err
+	}
+	if !visible {
+		p.l.Warnf("Character [%d] selected hidden choice [%d].", characterId, selection)
+	}
+	return choice, visible, nil
+}
+
+// renderMenu builds a sendSimple menu of the choices visible to the character. Each item is numbered by the
+// choice's index, so the client's selection maps directly back to the choice. The title is sent as given, while
+// choice text is rendered with the renderer.
+func (p *ProcessorImpl) renderMenu(characterId uint32, render choiceRenderer, title string, choices []ChoiceModel) (string, error) {
+	mb := message.NewBuilder().AddText(title).NewLine()
+	for i, choice := range choices {
 		if choice.NextState() == "" {
 			continue
 		}
-		mb.OpenItem(i).BlueText().AddText(choice.Text()).CloseItem().NewLine()
+		if len(choice.Conditions()) > 0 {
+			visible, err := p.evaluator.EvaluateConditions(characterId, choice.Conditions())
+			if err != nil {
+				return "", err
+			}
+			if !visible {
+				continue
+			}
+		}
+		text, err := render(choice)
+		if err != nil {
+			return "", err
+		}
+		mb.OpenItem(i).BlueText().AddText(text).CloseItem().NewLine()
+	}
+	return mb.String(), nil
+}
+
+// processStyleSelectionState processes a style selection state
+func (p *ProcessorImpl) processStyleSelectionState(ctx ConversationContext, state StateModel) (string, error) {
+	styleSelection := state.StyleSelection()
+	if styleSelection == nil {
+		return "", errors.New("styleSelection is nil")
+	}
+
+	styles, err := styleSelection.ResolveStyles(ctx.Context())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to resolve styles for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
+	}
+
+	text, err := p.textRenderer(ctx)(styleSelection.Text())
+	if err != nil {
+		p.l.WithError(err).Errorf("Failed to render text for state [%s] for character [%d]. Cleaning up conversation context.", state.Id(), ctx.CharacterId())
+		GetRegistry().ClearContext(p.t, ctx.CharacterId())
+		return "", err
 	}
 
-	npc.NewProcessor(p.l, p.ctx).SendSimple(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId())(mb.String())
+	npc.NewProcessor(p.l, p.ctx).SendStyle(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId(), ctx.NpcId(), styles)(text)
 	return state.Id(), nil
 }
 
+// textResolver creates a resolver for templates shown to the character, over the conversation context and the
+// attributes of the character
+func (p *ProcessorImpl) textResolver(ctx ConversationContext) expression.Resolver {
+	fetchContext := func() (map[string]string, error) {
+		return ctx.Context(), nil
+	}
+	var fetchCharacter func() (character.Model, error)
+	if p.characterP != nil {
+		fetchCharacter = func() (character.Model, error) {
+			return p.characterP.GetById(ctx.CharacterId())
+		}
+	}
+	return newExpressionResolver(fetchContext, fetchCharacter)
+}
+
+// textRenderer creates a renderer for text shown to the character, translated into the locale chosen by the character,
+// the tenant's locale or the default locale. The tenant's string table is read at most once per renderer.
+func (p *ProcessorImpl) textRenderer(ctx ConversationContext) textRenderer {
+	locales, lookup := p.textLocales(ctx)
+	return newTextRenderer(locales, lookup, p.textResolver(ctx))
+}
+
+// textLocales returns the locales text shown to the character is translated into, in order of preference, and the
+// lookup into the tenant's string table
+func (p *ProcessorImpl) textLocales(ctx ConversationContext) ([]string, localization.Lookup) {
+	locales := localization.Locales(ctx.Context()[LocaleContextKey], p.t)
+	var lookup localization.Lookup
+	if p.db != nil {
+		lookup = localization.NewProcessor(p.l, p.ctx, p.db).Lookup()
+	}
+	return locales, lookup
+}
+
 func (p *ProcessorImpl) End(characterId uint32) error {
 	p.l.Debugf("Ending conversation with character [%d].", characterId)
 	GetRegistry().ClearContext(p.t, characterId)
@@ -3,13 +3,21 @@ package conversation
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
+	"atlas-npc-conversations/localization"
+	"atlas-npc-conversations/saga"
+
 	"github.com/Chronicle20/atlas-constants/field"
 	"github.com/Chronicle20/atlas-constants/world"
+	"github.com/Chronicle20/atlas-kafka/producer"
+	"github.com/Chronicle20/atlas-model/model"
 	"github.com/Chronicle20/atlas-tenant"
 	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -31,6 +39,16 @@ func (m *MockOperationExecutor) ExecuteOperations(field field.Model, characterId
 	return args.Error(0)
 }
 
+func (m *MockOperationExecutor) ExecuteSaga(field field.Model, characterId uint32, operations []OperationModel) (uuid.UUID, error) {
+	args := m.Called(field, characterId, operations)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockOperationExecutor) ExecuteGuardedSaga(field field.Model, characterId uint32, transactionId uuid.UUID, guard []ConditionModel, operations []OperationModel) (uuid.UUID, error) {
+	args := m.Called(field, characterId, transactionId, guard, operations)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
 // MockEvaluator is a mock implementation of the Evaluator interface
 type MockEvaluator struct {
 	mock.Mock
@@ -41,6 +59,11 @@ func (m *MockEvaluator) EvaluateCondition(characterId uint32, condition Conditio
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockEvaluator) EvaluateConditions(characterId uint32, conditions []ConditionModel) (bool, error) {
+	args := m.Called(characterId, conditions)
+	return args.Bool(0), args.Error(1)
+}
+
 // Helper function to create a test field
 func createTestField() field.Model {
 	return field.NewBuilder(world.Id(1), 1, 100000).Build()
@@ -123,6 +146,15 @@ func createTestProcessor(t *testing.T, executor OperationExecutor, evaluator Eva
 		db:        nil, // Not needed for these tests
 		evaluator: evaluator,
 		executor:  executor,
+		rng:       rand.New(rand.NewSource(1)),
+		producer:  discardProducer,
+	}
+}
+
+// discardProducer drops every message produced, so tests do not need a Kafka broker
+func discardProducer(string) producer.MessageProducer {
+	return func(model.Provider[[]kafka.Message]) error {
+		return nil
 	}
 }
 
@@ -174,6 +206,11 @@ func TestProcessGenericActionState_OperationExecutionFailure(t *testing.T) {
 			operations := state.GenericAction().Operations()
 			require.Len(t, operations, 2)
 			
+			// Execute the operations one at a time, so the failing operation stops those after it
+			genericAction := *state.GenericAction()
+			genericAction.fireAndForget = true
+			state.genericAction = &genericAction
+
 			// Mock operation execution - first operations succeed, then one fails
 			for i, op := range operations {
 				if i == tt.failingOpIndex {
@@ -198,7 +235,7 @@ func TestProcessGenericActionState_OperationExecutionFailure(t *testing.T) {
 			// Verify that the conversation context was cleared from registry
 			_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "unable to previous context")
+			assert.ErrorIs(t, err, ErrContextNotFound)
 			
 			// Verify all expected calls were made
 			mockExecutor.AssertExpectations(t)
@@ -268,7 +305,7 @@ func TestProcessGenericActionState_OperationExecutionFailure_WithContextReferenc
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operation execution failure
-	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, operation).Return(errors.New("context operation failed"))
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, []OperationModel{operation}).Return(uuid.Nil, errors.New("context operation failed"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -284,7 +321,7 @@ func TestProcessGenericActionState_OperationExecutionFailure_WithContextReferenc
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -355,8 +392,7 @@ func TestProcessGenericActionState_SagaOperationExecutionFailure(t *testing.T) {
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock saga execution failure (e.g., saga orchestrator is down)
-	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, operation1).Return(nil)
-	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, operation2).Return(errors.New("saga orchestrator communication failed"))
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, []OperationModel{operation1, operation2}).Return(uuid.Nil, errors.New("saga orchestrator communication failed"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -372,7 +408,7 @@ func TestProcessGenericActionState_SagaOperationExecutionFailure(t *testing.T) {
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -403,7 +439,7 @@ func TestProcessGenericActionState_OperationExecutionTimeout(t *testing.T) {
 	require.Len(t, operations, 2)
 	
 	// Mock operation execution timeout
-	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, operations[0]).Return(errors.New("operation timeout: context deadline exceeded"))
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.Nil, errors.New("operation timeout: context deadline exceeded"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -419,7 +455,7 @@ func TestProcessGenericActionState_OperationExecutionTimeout(t *testing.T) {
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -462,9 +498,11 @@ func TestProcessGenericActionState_MultipleOperationExecutionFailures(t *testing
 		conditions: []ConditionModel{},
 	}
 
+	// Execute the operations one at a time, so the failing operation stops those after it
 	genericAction := GenericActionModel{
-		operations: operations,
-		outcomes:   []OutcomeModel{outcome},
+		operations:    operations,
+		outcomes:      []OutcomeModel{outcome},
+		fireAndForget: true,
 	}
 
 	state := StateModel{
@@ -514,7 +552,7 @@ func TestProcessGenericActionState_MultipleOperationExecutionFailures(t *testing
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -545,9 +583,9 @@ func TestProcessGenericActionState_PanicRecovery(t *testing.T) {
 	require.Len(t, operations, 2)
 	
 	// Mock operation execution panic
-	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, operations[0]).Run(func(args mock.Arguments) {
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Run(func(args mock.Arguments) {
 		panic("unexpected panic during operation execution")
-	}).Return(nil)
+	}).Return(uuid.Nil, nil)
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -563,7 +601,7 @@ func TestProcessGenericActionState_PanicRecovery(t *testing.T) {
 	// Verify that the conversation context was cleared from registry due to panic recovery
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify the expected call was made
 	mockExecutor.AssertExpectations(t)
@@ -704,13 +742,11 @@ func TestProcessGenericActionState_ConditionEvaluationFailure(t *testing.T) {
 			
 			// Mock operations to succeed if present
 			if tt.setupOperations {
-				for _, op := range operations {
-					mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-				}
+				mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 			}
 			
 			// Mock condition evaluation to fail
-			mockEvaluator.On("EvaluateCondition", characterId, condition).Return(false, errors.New(tt.expectedError))
+			mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New(tt.expectedError))
 			
 			// Create processor
 			processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -726,7 +762,7 @@ func TestProcessGenericActionState_ConditionEvaluationFailure(t *testing.T) {
 			// Verify that the conversation context was cleared from registry
 			_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "unable to previous context")
+			assert.ErrorIs(t, err, ErrContextNotFound)
 			
 			// Verify all expected calls were made
 			mockExecutor.AssertExpectations(t)
@@ -810,12 +846,10 @@ func TestProcessGenericActionState_MultipleConditionEvaluationFailure(t *testing
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operations to succeed
-	for _, op := range operations {
-		mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-	}
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 	
-	// Mock first condition evaluation to fail (only first condition is evaluated based on code)
-	mockEvaluator.On("EvaluateCondition", characterId, condition1).Return(false, errors.New("character level too low"))
+	// Mock evaluation of all conditions together to fail
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition1, condition2}).Return(false, errors.New("character level too low"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -831,7 +865,7 @@ func TestProcessGenericActionState_MultipleConditionEvaluationFailure(t *testing
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -904,12 +938,10 @@ func TestProcessGenericActionState_ConditionEvaluationTimeout(t *testing.T) {
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operations to succeed
-	for _, op := range operations {
-		mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-	}
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 	
 	// Mock condition evaluation to timeout
-	mockEvaluator.On("EvaluateCondition", characterId, condition).Return(false, errors.New("condition evaluation timeout: context deadline exceeded"))
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New("condition evaluation timeout: context deadline exceeded"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -925,7 +957,7 @@ func TestProcessGenericActionState_ConditionEvaluationTimeout(t *testing.T) {
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -999,12 +1031,10 @@ func TestProcessGenericActionState_ConditionEvaluationExternalServiceError(t *te
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operations to succeed
-	for _, op := range operations {
-		mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-	}
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 	
 	// Mock condition evaluation to fail with external service error
-	mockEvaluator.On("EvaluateCondition", characterId, condition).Return(false, errors.New("quest service unavailable"))
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New("quest service unavailable"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -1020,7 +1050,7 @@ func TestProcessGenericActionState_ConditionEvaluationExternalServiceError(t *te
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -1093,12 +1123,10 @@ func TestProcessGenericActionState_ConditionEvaluationInvalidParameters(t *testi
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operations to succeed
-	for _, op := range operations {
-		mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-	}
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 	
 	// Mock condition evaluation to fail with invalid parameter error
-	mockEvaluator.On("EvaluateCondition", characterId, condition).Return(false, errors.New("invalid condition parameters: operator 'invalid_operator' not supported"))
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New("invalid condition parameters: operator 'invalid_operator' not supported"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -1114,7 +1142,7 @@ func TestProcessGenericActionState_ConditionEvaluationInvalidParameters(t *testi
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -1190,12 +1218,10 @@ func TestProcessGenericActionState_ConditionEvaluationContextParameterFailure(t
 	GetRegistry().SetContext(tenant, characterId, ctx)
 	
 	// Mock operations to succeed
-	for _, op := range operations {
-		mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, op).Return(nil)
-	}
+	mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, operations).Return(uuid.New(), nil)
 	
 	// Mock condition evaluation to fail with context resolution error
-	mockEvaluator.On("EvaluateCondition", characterId, condition).Return(false, errors.New("failed to resolve context parameter 'requiredQuantity'"))
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New("failed to resolve context parameter 'requiredQuantity'"))
 	
 	// Create processor
 	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
@@ -1211,7 +1237,7 @@ func TestProcessGenericActionState_ConditionEvaluationContextParameterFailure(t
 	// Verify that the conversation context was cleared from registry
 	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "unable to previous context")
+	assert.ErrorIs(t, err, ErrContextNotFound)
 	
 	// Verify all expected calls were made
 	mockExecutor.AssertExpectations(t)
@@ -1309,4 +1335,1116 @@ func TestConditionModel_StringItemIdValidation(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// Helper function to create a craft action state
+func createTestCraftState(stimulatorId uint32, stimulatorFailChance float64) StateModel {
+	craftAction, _ := NewCraftActionBuilder().
+		SetItemId("1302000").
+		SetMaterials([]uint32{4011000, 4003000}).
+		SetQuantities([]uint32{3, 10}).
+		SetMesoCost(5000).
+		SetStimulatorId(stimulatorId).
+		SetStimulatorFailChance(stimulatorFailChance).
+		SetSuccessState("craft_success").
+		SetFailureState("craft_failure").
+		SetMissingMaterialsState("missing_materials").
+		Build()
+
+	return StateModel{
+		id:          "craft_state",
+		stateType:   CraftActionType,
+		craftAction: craftAction,
+	}
+}
+
+// Test craft action transitions to the missing materials state when a requirement fails
+func TestProcessCraftActionState_MissingMaterials(t *testing.T) {
+	mockExecutor := new(MockOperationExecutor)
+	mockEvaluator := new(MockEvaluator)
+
+	characterId := uint32(12345)
+	npcId := uint32(9001)
+	ctx := createTestConversationContext(characterId, npcId, "craft_state")
+	tenant := createTestTenant()
+	GetRegistry().SetContext(tenant, characterId, ctx)
+
+	state := createTestCraftState(0, 0)
+	requirements := craftRequirements(*state.CraftAction())
+	require.Len(t, requirements, 3)
+
+	mockEvaluator.On("EvaluateConditions", characterId, requirements).Return(false, nil)
+
+	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
+	nextState, err := processor.processCraftActionState(ctx, state)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "missing_materials", nextState)
+	mockEvaluator.AssertExpectations(t)
+	mockExecutor.AssertNotCalled(t, "ExecuteOperations", mock.Anything, mock.Anything, mock.Anything)
+
+	GetRegistry().ClearContext(tenant, characterId)
+}
+
+// Test craft action consumes materials and mesos and awards the item in one batch
+func TestProcessCraftActionState_Success(t *testing.T) {
+	mockExecutor := new(MockOperationExecutor)
+	mockEvaluator := new(MockEvaluator)
+
+	characterId := uint32(12345)
+	npcId := uint32(9001)
+	ctx := createTestConversationContext(characterId, npcId, "craft_state")
+	tenant := createTestTenant()
+	GetRegistry().SetContext(tenant, characterId, ctx)
+
+	state := createTestCraftState(0, 0)
+	mockEvaluator.On("EvaluateConditions", characterId, craftRequirements(*state.CraftAction())).Return(true, nil)
+
+	var executed []OperationModel
+	mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, mock.Anything).Run(func(args mock.Arguments) {
+		executed = args.Get(2).([]OperationModel)
+	}).Return(nil)
+
+	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
+	nextState, err := processor.processCraftActionState(ctx, state)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "craft_success", nextState)
+	require.Len(t, executed, 4)
+	assert.Equal(t, "destroy_item", executed[0].Type())
+	assert.Equal(t, "4011000", executed[0].Params()["itemId"])
+	assert.Equal(t, "3", executed[0].Params()["quantity"])
+	assert.Equal(t, "destroy_item", executed[1].Type())
+	assert.Equal(t, "award_mesos", executed[2].Type())
+	assert.Equal(t, "-5000", executed[2].Params()["amount"])
+	assert.Equal(t, "award_item", executed[3].Type())
+	assert.Equal(t, "1302000", executed[3].Params()["itemId"])
+	mockEvaluator.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+
+	GetRegistry().ClearContext(tenant, characterId)
+}
+
+// Test stimulator failure is resolved with the injected random source
+func TestProcessCraftActionState_StimulatorFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		seed          int64
+		failChance    float64
+		expectedState string
+	}{
+		{name: "Stimulator always fails", seed: 1, failChance: 1.0, expectedState: "craft_failure"},
+		{name: "Stimulator never fails", seed: 1, failChance: 0.0, expectedState: "craft_success"},
+		{name: "Seeded stimulator roll", seed: 42, failChance: 0.5, expectedState: func() string {
+			if rand.New(rand.NewSource(42)).Float64() < 0.5 {
+				return "craft_failure"
+			}
+			return "craft_success"
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := new(MockOperationExecutor)
+			mockEvaluator := new(MockEvaluator)
+
+			characterId := uint32(12345)
+			npcId := uint32(9001)
+			ctx := createTestConversationContext(characterId, npcId, "craft_state")
+			tenant := createTestTenant()
+			GetRegistry().SetContext(tenant, characterId, ctx)
+
+			state := createTestCraftState(4130000, tt.failChance)
+			mockEvaluator.On("EvaluateConditions", characterId, craftRequirements(*state.CraftAction())).Return(true, nil)
+
+			var executed []OperationModel
+			mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, mock.Anything).Run(func(args mock.Arguments) {
+				executed = args.Get(2).([]OperationModel)
+			}).Return(nil)
+
+			processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
+			processor.rng = rand.New(rand.NewSource(tt.seed))
+			nextState, err := processor.processCraftActionState(ctx, state)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedState, nextState)
+
+			awarded := false
+			stimulatorConsumed := false
+			for _, op := range executed {
+				if op.Type() == "award_item" {
+					awarded = true
+				}
+				if op.Type() == "destroy_item" && op.Params()["itemId"] == "4130000" {
+					stimulatorConsumed = true
+				}
+			}
+			assert.True(t, stimulatorConsumed)
+			assert.Equal(t, tt.expectedState == "craft_success", awarded)
+
+			GetRegistry().ClearContext(tenant, characterId)
+		})
+	}
+}
+
+// Test craft action cleans up the conversation when the saga cannot be emitted
+func TestProcessCraftActionState_ExecutionFailure(t *testing.T) {
+	mockExecutor := new(MockOperationExecutor)
+	mockEvaluator := new(MockEvaluator)
+
+	characterId := uint32(12345)
+	npcId := uint32(9001)
+	ctx := createTestConversationContext(characterId, npcId, "craft_state")
+	tenant := createTestTenant()
+	GetRegistry().SetContext(tenant, characterId, ctx)
+
+	state := createTestCraftState(0, 0)
+	mockEvaluator.On("EvaluateConditions", characterId, craftRequirements(*state.CraftAction())).Return(true, nil)
+	mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, mock.Anything).Return(errors.New("saga orchestrator communication failed"))
+
+	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
+	nextState, err := processor.processCraftActionState(ctx, state)
+
+	assert.Error(t, err)
+	assert.Empty(t, nextState)
+	_, err = GetRegistry().GetPreviousContext(tenant, characterId)
+	assert.Error(t, err)
+}
+
+// Test craft actions stored before craft outcomes existed still load and end the conversation once crafted
+func TestExtractCraftAction_OutcomeStates(t *testing.T) {
+	stored := RestCraftActionModel{
+		ItemId:                "1302000",
+		Materials:             []uint32{4011000},
+		Quantities:            []uint32{3},
+		MesoCost:              5000,
+		MissingMaterialsState: "missing_materials",
+	}
+	craftAction, err := ExtractCraftAction(stored)
+	require.NoError(t, err)
+	assert.Empty(t, craftAction.SuccessState())
+	assert.Empty(t, craftAction.FailureState())
+
+	// A stimulator which cannot fail the craft needs nowhere to go on failure
+	stored.StimulatorId = 4130000
+	_, err = ExtractCraftAction(stored)
+	assert.NoError(t, err)
+
+	// A stimulator may fail the craft, so it needs somewhere to go
+	stored.StimulatorFailChance = 0.1
+	_, err = ExtractCraftAction(stored)
+	assert.Error(t, err)
+	stored.FailureState = "craft_failure"
+	_, err = ExtractCraftAction(stored)
+	assert.NoError(t, err)
+}
+
+// Test dialogue transitions resolve explicit transitions before falling back to legacy text matched choices
+func TestDialogueModel_TransitionFromAction(t *testing.T) {
+	exitChoice, err := NewChoiceBuilder().SetText("Exit").SetNextState("").Build()
+	require.NoError(t, err)
+	yesChoice, err := NewChoiceBuilder().SetText("Yes").SetNextState("legacy_yes").SetContext(map[string]string{"answer": "yes"}).Build()
+	require.NoError(t, err)
+	noChoice, err := NewChoiceBuilder().SetText("No").SetNextState("legacy_no").Build()
+	require.NoError(t, err)
+
+	next, err := NewDialogueBuilder().SetDialogueType(SendNext).SetText("Hello").SetNextState("second").Build()
+	require.NoError(t, err)
+	yesNo, err := NewDialogueBuilder().SetDialogueType(SendYesNo).SetText("Well?").SetOnYes("accepted").SetOnNo("declined").SetOnExit("closed").Build()
+	require.NoError(t, err)
+	legacy, err := NewDialogueBuilder().SetDialogueType(SendYesNo).SetText("Well?").AddChoice(yesChoice).AddChoice(noChoice).AddChoice(exitChoice).Build()
+	require.NoError(t, err)
+	terminal, err := NewDialogueBuilder().SetDialogueType(SendOk).SetText("Bye").Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		dialogue        *DialogueModel
+		action          byte
+		expectedState   string
+		expectedContext map[string]string
+	}{
+		{name: "sendNext advances to nextState", dialogue: next, action: 1, expectedState: "second"},
+		{name: "sendNext exit without onExit ends", dialogue: next, action: 255, expectedState: ""},
+		{name: "sendYesNo yes", dialogue: yesNo, action: 1, expectedState: "accepted"},
+		{name: "sendYesNo no", dialogue: yesNo, action: 0, expectedState: "declined"},
+		{name: "sendYesNo exit", dialogue: yesNo, action: 255, expectedState: "closed"},
+		{name: "legacy yes choice", dialogue: legacy, action: 1, expectedState: "legacy_yes", expectedContext: map[string]string{"answer": "yes"}},
+		{name: "legacy no choice", dialogue: legacy, action: 0, expectedState: "legacy_no"},
+		{name: "terminal sendOk ends", dialogue: terminal, action: 1, expectedState: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextState, context := tt.dialogue.TransitionFromAction(tt.action)
+			assert.Equal(t, tt.expectedState, nextState)
+			if tt.expectedContext != nil {
+				assert.Equal(t, tt.expectedContext, context)
+			}
+		})
+	}
+
+	assert.True(t, next.AwaitsInput())
+	assert.True(t, legacy.AwaitsInput())
+	assert.False(t, terminal.AwaitsInput())
+}
+
+// Test explicit transitions are only accepted for the dialogue types they apply to
+func TestDialogueBuilder_TransitionValidation(t *testing.T) {
+	_, err := NewDialogueBuilder().SetDialogueType(SendYesNo).SetText("Well?").SetNextState("next").Build()
+	assert.Error(t, err)
+
+	_, err = NewDialogueBuilder().SetDialogueType(SendNext).SetText("Hello").SetOnYes("yes").Build()
+	assert.Error(t, err)
+
+	_, err = NewDialogueBuilder().SetDialogueType(SendSimple).SetText("Pick").Build()
+	assert.Error(t, err)
+}
+
+// Test input dialogue answers are stored under the configured context key
+func TestDialogueModel_TransitionFromResponse_Inputs(t *testing.T) {
+	numberInput, err := NewNumberInputBuilder().SetContextKey("quantity").SetDefaultValue(1).SetMinValue(1).SetMaxValue(100).Build()
+	require.NoError(t, err)
+	getNumber, err := NewDialogueBuilder().SetDialogueType(GetNumber).SetText("How many?").SetNumberInput(numberInput).SetNextState("confirm").SetOnExit("cancelled").Build()
+	require.NoError(t, err)
+
+	textInput, err := NewTextInputBuilder().SetContextKey("guildName").SetMinLength(3).SetMaxLength(12).Build()
+	require.NoError(t, err)
+	getText, err := NewDialogueBuilder().SetDialogueType(GetText).SetText("Name?").SetTextInput(textInput).SetNextState("create").Build()
+	require.NoError(t, err)
+
+	acceptDecline, err := NewDialogueBuilder().SetDialogueType(SendAcceptDecline).SetText("Accept the quest?").SetOnYes("accepted").SetOnNo("declined").Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		dialogue        *DialogueModel
+		action          byte
+		selection       int32
+		text            string
+		expectedState   string
+		expectedContext map[string]string
+	}{
+		{name: "number answer stored", dialogue: getNumber, action: 1, selection: 25, expectedState: "confirm", expectedContext: map[string]string{"quantity": "25"}},
+		{name: "number out of range asks again", dialogue: getNumber, action: 1, selection: 101, expectedState: "ask"},
+		{name: "number cancelled", dialogue: getNumber, action: 0, expectedState: "cancelled"},
+		{name: "text answer stored", dialogue: getText, action: 1, text: "Heroes", expectedState: "create", expectedContext: map[string]string{"guildName": "Heroes"}},
+		{name: "text too short asks again", dialogue: getText, action: 1, text: "Hi", expectedState: "ask"},
+		{name: "text cancelled ends", dialogue: getText, action: 255, expectedState: ""},
+		{name: "accept", dialogue: acceptDecline, action: 1, expectedState: "accepted"},
+		{name: "decline", dialogue: acceptDecline, action: 0, expectedState: "declined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextState, context := tt.dialogue.TransitionFromResponse("ask", tt.action, tt.selection, tt.text)
+			assert.Equal(t, tt.expectedState, nextState)
+			if tt.expectedContext != nil {
+				assert.Equal(t, tt.expectedContext, context)
+			} else {
+				assert.Empty(t, context)
+			}
+		})
+	}
+}
+
+// Test input dialogues require a matching input configuration
+func TestDialogueBuilder_InputValidation(t *testing.T) {
+	_, err := NewDialogueBuilder().SetDialogueType(GetNumber).SetText("How many?").Build()
+	assert.Error(t, err)
+
+	textInput, err := NewTextInputBuilder().SetContextKey("name").SetMaxLength(12).Build()
+	require.NoError(t, err)
+	_, err = NewDialogueBuilder().SetDialogueType(GetNumber).SetText("How many?").SetTextInput(textInput).Build()
+	assert.Error(t, err)
+
+	_, err = NewNumberInputBuilder().SetContextKey("quantity").SetDefaultValue(0).SetMinValue(1).SetMaxValue(10).Build()
+	assert.Error(t, err)
+
+	_, err = NewTextInputBuilder().SetContextKey("name").SetMinLength(5).SetMaxLength(4).Build()
+	assert.Error(t, err)
+}
+
+// Test paging back restores the previous dialogue state and the context values present when it was shown
+func TestConversationContext_Previous(t *testing.T) {
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(12345).
+		SetNpcId(9001).
+		SetCurrentState("page_three").
+		PushHistory("page_one", map[string]string{"a": "1"}).
+		PushHistory("page_two", map[string]string{"a": "1", "b": "2"}).
+		AddContextValue("a", "1").
+		AddContextValue("b", "2").
+		AddContextValue("c", "3").
+		Build()
+	require.NoError(t, err)
+
+	previous, ok := ctx.Previous()
+	require.True(t, ok)
+	assert.Equal(t, "page_two", previous.CurrentState())
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, previous.Context())
+	assert.Len(t, previous.History(), 1)
+
+	first, ok := previous.Previous()
+	require.True(t, ok)
+	assert.Equal(t, "page_one", first.CurrentState())
+	assert.Equal(t, map[string]string{"a": "1"}, first.Context())
+
+	_, ok = first.Previous()
+	assert.False(t, ok)
+}
+
+// Test the history stack is bounded and snapshots are not affected by later context changes
+func TestConversationContextBuilder_PushHistory(t *testing.T) {
+	builder := NewConversationContextBuilder().SetCharacterId(12345).SetNpcId(9001).SetCurrentState("last")
+	for i := 0; i < MaxHistoryDepth+5; i++ {
+		builder.PushHistory(fmt.Sprintf("page_%d", i), map[string]string{})
+	}
+	ctx, err := builder.Build()
+	require.NoError(t, err)
+	assert.Len(t, ctx.History(), MaxHistoryDepth)
+	assert.Equal(t, "page_5", ctx.History()[0].StateId())
+
+	values := map[string]string{"a": "1"}
+	ctx, err = NewConversationContextBuilder().SetCharacterId(12345).SetNpcId(9001).SetCurrentState("last").PushHistory("first", values).Build()
+	require.NoError(t, err)
+	values["a"] = "2"
+	assert.Equal(t, "1", ctx.History()[0].Context()["a"])
+}
+
+// Test only Previous on a sendNextPrev dialogue pages back
+func TestIsPreviousAction(t *testing.T) {
+	nextPrev, err := NewDialogueBuilder().SetDialogueType(SendNextPrev).SetText("Page").SetNextState("next").Build()
+	require.NoError(t, err)
+	next, err := NewDialogueBuilder().SetDialogueType(SendNext).SetText("Page").SetNextState("next").Build()
+	require.NoError(t, err)
+
+	assert.True(t, isPreviousAction(*nextPrev, actionPrevious, lastMessageTypeSay))
+	assert.False(t, isPreviousAction(*nextPrev, 1, lastMessageTypeSay))
+	assert.False(t, isPreviousAction(*next, actionPrevious, lastMessageTypeSay))
+}
+
+// Test style selections offer literal styles or styles computed from the conversation context
+func TestStyleSelectionModel_ResolveStyles(t *testing.T) {
+	literal, err := NewStyleSelectionBuilder().SetText("Pick a hair").AddStyle(30000).AddStyle(30010).SetContextKey("hair").SetNextState("apply").Build()
+	require.NoError(t, err)
+	styles, err := literal.ResolveStyles(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{30000, 30010}, styles)
+
+	computed, err := NewStyleSelectionBuilder().SetText("Pick a face").SetStylesFrom("faces").SetContextKey("face").SetNextState("apply").Build()
+	require.NoError(t, err)
+	styles, err = computed.ResolveStyles(map[string]string{"faces": "20000, 20001,20002"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{20000, 20001, 20002}, styles)
+
+	_, err = computed.ResolveStyles(map[string]string{})
+	assert.Error(t, err)
+	_, err = computed.ResolveStyles(map[string]string{"faces": "20000,abc"})
+	assert.Error(t, err)
+
+	_, err = NewStyleSelectionBuilder().SetText("Pick").SetContextKey("hair").SetNextState("apply").Build()
+	assert.Error(t, err)
+	_, err = NewStyleSelectionBuilder().SetText("Pick").AddStyle(30000).SetStylesFrom("hairs").SetContextKey("hair").SetNextState("apply").Build()
+	assert.Error(t, err)
+}
+
+// Test the change_style operation applies the chosen style from context through a saga step
+func TestCreateStepForOperation_ChangeStyle(t *testing.T) {
+	characterId := uint32(34567)
+	tenant := createTestTenant()
+	GetRegistry().SetContext(tenant, characterId, ConversationContext{characterId: characterId, context: map[string]string{"hair": "30010"}})
+	defer GetRegistry().ClearContext(tenant, characterId)
+
+	e := &OperationExecutorImpl{l: logrus.New(), ctx: context.Background(), t: tenant}
+	operation, err := NewOperationBuilder().SetType("change_style").SetParams(map[string]string{"styleId": "context.hair"}).Build()
+	require.NoError(t, err)
+
+	_, _, action, payload, _, err := e.createStepForOperation(createTestField(), characterId, operation)
+	require.NoError(t, err)
+	assert.Equal(t, saga.ChangeStyle, action)
+	assert.Equal(t, uint32(30010), payload.(saga.ChangeStylePayload).StyleId)
+}
+
+// Test choices generated from a context array carry the value and bind it to their text and visibility conditions
+func TestListSelectionModel_ResolveChoices(t *testing.T) {
+	condition, err := NewConditionBuilder().SetType("item").SetOperator(">=").SetValue("1").SetItemId("option.value").Build()
+	require.NoError(t, err)
+	template, err := NewChoiceTemplateBuilder().SetFrom("context.tickets").SetText("Use ${itemName(option.value)}").SetContextKey("ticket").SetNextState("travel").AddCondition(condition).Build()
+	require.NoError(t, err)
+	exit, err := NewChoiceBuilder().SetText("Exit").Build()
+	require.NoError(t, err)
+	listSelection, err := NewListSelectionBuilder().SetTitle("Where to?").AddChoice(exit).SetChoiceTemplate(template).Build()
+	require.NoError(t, err)
+
+	choices, err := listSelection.ResolveChoices(map[string]string{"tickets": "4031045, 4031046"}, nil)
+	require.NoError(t, err)
+	require.Len(t, choices, 3)
+	assert.Equal(t, "Exit", choices[0].Text().Default())
+	text, err := newChoiceRenderer(nil, nil, nil)(choices[2])
+	require.NoError(t, err)
+	assert.Equal(t, "Use #t4031046#", text)
+	assert.Equal(t, "travel", choices[2].NextState())
+	assert.Equal(t, map[string]string{"ticket": "4031046"}, choices[2].Context())
+	assert.Equal(t, "4031046", choices[2].Conditions()[0].ItemId())
+	assert.Equal(t, map[string]string{OptionValue: "4031046", OptionName: "4031046"}, choices[2].Conditions()[0].Option())
+	assert.Equal(t, "option.value", template.Conditions()[0].ItemId(), "template conditions must not be modified")
+
+	_, err = listSelection.ResolveChoices(map[string]string{}, nil)
+	assert.Error(t, err)
+
+	_, err = NewChoiceTemplateBuilder().SetFrom("tickets").SetText("Use").SetContextKey("ticket").SetNextState("travel").Build()
+	assert.Error(t, err)
+}
+
+// Test option values are shown as written, rather than parsed as part of the choice text or conditions
+func TestListSelectionModel_ResolveChoices_OptionNotParsed(t *testing.T) {
+	condition, err := NewConditionBuilder().SetType("meso").SetOperator(">=").SetValue("option.value").Build()
+	require.NoError(t, err)
+	template, err := NewChoiceTemplateBuilder().SetFrom("context.towns").SetText("Go to ${option.value}").SetContextKey("town").SetNextState("travel").AddCondition(condition).Build()
+	require.NoError(t, err)
+	listSelection, err := NewListSelectionBuilder().SetTitle("Where to?").SetChoiceTemplate(template).Build()
+	require.NoError(t, err)
+
+	choices, err := listSelection.ResolveChoices(map[string]string{"towns": "${context.secret} #b"}, nil)
+	require.NoError(t, err)
+	require.Len(t, choices, 1)
+
+	fetchContext := func() (map[string]string, error) {
+		return map[string]string{"secret": "hidden"}, nil
+	}
+	text, err := newChoiceRenderer(nil, nil, newExpressionResolver(fetchContext, nil))(choices[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Go to ${context.secret} #b", text)
+	assert.Equal(t, "option.value", choices[0].Conditions()[0].Value())
+
+	_, err = evaluateInteger(choices[0].Conditions()[0].Value(), withOption(nil, choices[0].Conditions()[0].Option()))
+	assert.Error(t, err, "a value which is not an integer must not be evaluated as an expression")
+}
+
+// Test menus only show visible choices and number them by their original index
+func TestRenderMenu_VisibilityConditions(t *testing.T) {
+	mockEvaluator := new(MockEvaluator)
+	characterId := uint32(12345)
+
+	hidden, err := NewConditionBuilder().SetType("level").SetOperator(">=").SetValue("70").Build()
+	require.NoError(t, err)
+	shown, err := NewConditionBuilder().SetType("level").SetOperator(">=").SetValue("30").Build()
+	require.NoError(t, err)
+
+	choices := []ChoiceModel{
+		{text: localization.NewText("Always"), nextState: "always"},
+		{text: localization.NewText("Third job"), nextState: "third", conditions: []ConditionModel{hidden}},
+		{text: localization.NewText("Second job"), nextState: "second", conditions: []ConditionModel{shown}},
+		{text: localization.NewText("Exit")},
+	}
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{hidden}).Return(false, nil)
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{shown}).Return(true, nil)
+
+	processor := createTestProcessor(t, new(MockOperationExecutor), mockEvaluator, createTestTenant())
+	menu, err := processor.renderMenu(characterId, newChoiceRenderer(nil, nil, nil), "Choose", choices)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Choose\r\n#L0##bAlways#l\r\n#L2##bSecond job#l\r\n", menu)
+	mockEvaluator.AssertExpectations(t)
+}
+
+// Test menu choice text is rendered as a template
+func TestRenderMenu_Templates(t *testing.T) {
+	fetchContext := func() (map[string]string, error) {
+		return map[string]string{"itemId": "4000000", "price": "100"}, nil
+	}
+	r := newExpressionResolver(fetchContext, nil)
+
+	choices := []ChoiceModel{
+		{text: localization.NewText("Buy ${itemName(context.itemId)} for ${context.price * 10} mesos"), nextState: "buy"},
+		{text: localization.NewText("Exit")},
+	}
+
+	processor := createTestProcessor(t, new(MockOperationExecutor), new(MockEvaluator), createTestTenant())
+	menu, err := processor.renderMenu(12345, newChoiceRenderer(nil, nil, r), "Shop", choices)
+	require.NoError(t, err)
+	assert.Equal(t, "Shop\r\n#L0##bBuy #t4000000# for 1000 mesos#l\r\n", menu)
+
+	_, err = processor.renderMenu(12345, newChoiceRenderer(nil, nil, r), "Shop", []ChoiceModel{{text: localization.NewText("${context.missing}"), nextState: "buy"}})
+	assert.Error(t, err)
+}
+
+// Test sendSimple dialogues map the selection to the chosen choice
+func TestDialogueModel_SendSimpleSelection(t *testing.T) {
+	first, err := NewChoiceBuilder().SetText("First").SetNextState("first").Build()
+	require.NoError(t, err)
+	second, err := NewChoiceBuilder().SetText("Second").SetNextState("second").AddContextValue("picked", "2").Build()
+	require.NoError(t, err)
+	exit, err := NewChoiceBuilder().SetText("Exit").Build()
+	require.NoError(t, err)
+	dialogue, err := NewDialogueBuilder().SetDialogueType(SendSimple).SetText("Pick").AddChoice(first).AddChoice(second).AddChoice(exit).Build()
+	require.NoError(t, err)
+
+	nextState, context := dialogue.TransitionFromResponse("pick", 1, 1, "")
+	assert.Equal(t, "second", nextState)
+	assert.Equal(t, map[string]string{"picked": "2"}, context)
+
+	nextState, _ = dialogue.TransitionFromResponse("pick", 0, 0, "")
+	assert.Equal(t, "", nextState)
+}
+
+// Test hidden choices cannot be selected even though their index is valid
+func TestSelectChoice_VisibilityConditions(t *testing.T) {
+	mockEvaluator := new(MockEvaluator)
+	characterId := uint32(12345)
+
+	condition, err := NewConditionBuilder().SetType("level").SetOperator(">=").SetValue("70").Build()
+	require.NoError(t, err)
+	_, err = NewChoiceBuilder().SetText("Broken").AddCondition(ConditionModel{conditionType: NotConditionType}).Build()
+	assert.Error(t, err)
+	guarded, err := NewChoiceBuilder().SetText("Third job").SetNextState("third").AddCondition(condition).Build()
+	require.NoError(t, err)
+	exit, err := NewChoiceBuilder().SetText("Exit").Build()
+	require.NoError(t, err)
+	choices := []ChoiceModel{guarded, exit}
+
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, nil).Once()
+	processor := createTestProcessor(t, new(MockOperationExecutor), mockEvaluator, createTestTenant())
+
+	_, visible, err := processor.selectChoice(characterId, choices, 1, 0)
+	require.NoError(t, err)
+	assert.False(t, visible)
+
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(true, nil).Once()
+	choice, visible, err := processor.selectChoice(characterId, choices, 1, 0)
+	require.NoError(t, err)
+	assert.True(t, visible)
+	assert.Equal(t, "third", choice.NextState())
+
+	// Closing the menu does not evaluate any conditions
+	choice, visible, err = processor.selectChoice(characterId, choices, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, visible)
+	assert.Equal(t, "Exit", choice.Text().Default())
+
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{condition}).Return(false, errors.New("validation service unavailable")).Once()
+	_, _, err = processor.selectChoice(characterId, choices, 1, 0)
+	assert.Error(t, err)
+	mockEvaluator.AssertExpectations(t)
+}
+
+// Helper function to create the refining option set used by option set tests
+func createTestRefiningOptionSet(t *testing.T) OptionSetModel {
+	bronze, err := NewOptionBuilder().SetId(4011000).SetName("Bronze Plate").SetMaterials([]uint32{4010000}).SetQuantities([]uint32{10}).SetMeso(300).Build()
+	require.NoError(t, err)
+	steel, err := NewOptionBuilder().SetId(4011001).SetName("Steel Plate").SetMaterials([]uint32{4010001}).SetQuantities([]uint32{10}).SetMeso(300).Build()
+	require.NoError(t, err)
+	optionSet, err := NewOptionSetBuilder().SetId("refining").AddOption(bronze).AddOption(steel).Build()
+	require.NoError(t, err)
+	return optionSet
+}
+
+// Test list selections generate one choice per option of an option set
+func TestListSelectionModel_ResolveChoices_OptionSet(t *testing.T) {
+	optionSet := createTestRefiningOptionSet(t)
+	template, err := NewChoiceTemplateBuilder().SetFrom("optionSet.refining").SetText("${itemIcon(option.value)} ${option.name}").SetContextKey("recipe").SetNextState("refine").Build()
+	require.NoError(t, err)
+	assert.Equal(t, "refining", template.OptionSetId())
+	listSelection, err := NewListSelectionBuilder().SetTitle("What would you like to refine?").SetChoiceTemplate(template).Build()
+	require.NoError(t, err)
+
+	choices, err := listSelection.ResolveChoices(map[string]string{}, []OptionSetModel{optionSet})
+	require.NoError(t, err)
+	require.Len(t, choices, 2)
+	text, err := newChoiceRenderer(nil, nil, nil)(choices[0])
+	require.NoError(t, err)
+	assert.Equal(t, "#i4011000# Bronze Plate", text)
+	assert.Equal(t, map[string]string{"recipe": "4011001"}, choices[1].Context())
+
+	_, err = listSelection.ResolveChoices(map[string]string{}, nil)
+	assert.Error(t, err)
+	_, err = NewChoiceTemplateBuilder().SetFrom("optionSet.").SetText("${option.name}").SetContextKey("recipe").SetNextState("refine").Build()
+	assert.Error(t, err)
+}
+
+// Test conversations reject references to undeclared or duplicate option sets
+func TestBuilder_OptionSetReferences(t *testing.T) {
+	optionSet := createTestRefiningOptionSet(t)
+	craftAction, err := NewCraftActionBuilder().
+		SetOptionSetId("refining").
+		SetOptionContextKey("recipe").
+		SetSuccessState("done").
+		SetFailureState("done").
+		SetMissingMaterialsState("done").
+		Build()
+	require.NoError(t, err)
+	state := StateModel{id: "refine", stateType: CraftActionType, craftAction: craftAction}
+
+	_, err = NewBuilder().SetNpcId(2040016).SetStartState("refine").AddState(state).Build()
+	assert.Error(t, err)
+
+	_, err = NewBuilder().SetNpcId(2040016).SetStartState("refine").AddState(state).AddOptionSet(optionSet).AddOptionSet(optionSet).Build()
+	assert.Error(t, err)
+
+	conversation, err := NewBuilder().SetNpcId(2040016).SetStartState("refine").AddState(state).AddOptionSet(optionSet).Build()
+	require.NoError(t, err)
+	found, err := conversation.FindOptionSet("refining")
+	require.NoError(t, err)
+	assert.Len(t, found.Options(), 2)
+
+	_, err = NewCraftActionBuilder().SetOptionSetId("refining").SetSuccessState("done").SetFailureState("done").SetMissingMaterialsState("done").Build()
+	assert.Error(t, err)
+}
+
+// Test craft actions take their recipe from the chosen option
+func TestProcessCraftActionState_OptionSetRecipe(t *testing.T) {
+	mockExecutor := new(MockOperationExecutor)
+	mockEvaluator := new(MockEvaluator)
+
+	characterId := uint32(12345)
+	npcId := uint32(2040016)
+	craftAction, err := NewCraftActionBuilder().
+		SetOptionSetId("refining").
+		SetOptionContextKey("recipe").
+		SetSuccessState("craft_success").
+		SetFailureState("craft_failure").
+		SetMissingMaterialsState("missing_materials").
+		Build()
+	require.NoError(t, err)
+	state := StateModel{id: "refine", stateType: CraftActionType, craftAction: craftAction}
+	conversation, err := NewBuilder().SetNpcId(npcId).SetStartState("refine").AddState(state).AddOptionSet(createTestRefiningOptionSet(t)).Build()
+	require.NoError(t, err)
+
+	ctx := createTestConversationContext(characterId, npcId, "refine")
+	ctx.conversation = conversation
+	ctx.context["recipe"] = "4011001"
+	tenant := createTestTenant()
+	GetRegistry().SetContext(tenant, characterId, ctx)
+
+	resolved, err := resolveCraftAction(ctx, *craftAction)
+	require.NoError(t, err)
+	assert.Equal(t, "4011001", resolved.ItemId())
+	assert.Equal(t, []uint32{4010001}, resolved.Materials())
+	assert.Equal(t, uint32(300), resolved.MesoCost())
+	mockEvaluator.On("EvaluateConditions", characterId, craftRequirements(*resolved)).Return(true, nil)
+
+	var executed []OperationModel
+	mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, mock.Anything).Run(func(args mock.Arguments) {
+		executed = args.Get(2).([]OperationModel)
+	}).Return(nil)
+
+	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tenant)
+	nextState, err := processor.processCraftActionState(ctx, state)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "craft_success", nextState)
+	require.Len(t, executed, 3)
+	assert.Equal(t, "4010001", executed[0].Params()["itemId"])
+	assert.Equal(t, "4011001", executed[2].Params()["itemId"])
+	mockEvaluator.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+
+	// An unknown option ends the conversation
+	ctx.context["recipe"] = "4011099"
+	_, err = resolveCraftAction(ctx, *craftAction)
+	assert.Error(t, err)
+
+	GetRegistry().ClearContext(tenant, characterId)
+}
+
+// Helper function to create a conversation whose generic action awaits the saga of its operation
+func createTestAwaitingConversation(t *testing.T, npcId uint32) Model {
+	operation, err := NewOperationBuilder().SetType("award_mesos").AddParamValue("amount", "1000").Build()
+	require.NoError(t, err)
+	action, err := NewGenericActionBuilder().AddOperation(operation).SetOnSuccess("thanks").SetOnFailure("sorry").Build()
+	require.NoError(t, err)
+	reward, err := NewStateBuilder().SetId("reward").SetGenericAction(action).Build()
+	require.NoError(t, err)
+
+	builder := NewBuilder().SetId(uuid.New()).SetNpcId(npcId).SetStartState("reward").AddState(reward)
+	for _, id := range []string{"thanks", "sorry"} {
+		dialogue, err := NewDialogueBuilder().SetDialogueType(SendNext).SetText(id).SetNextState(id).Build()
+		require.NoError(t, err)
+		state, err := NewStateBuilder().SetId(id).SetDialogue(dialogue).Build()
+		require.NoError(t, err)
+		builder.AddState(state)
+	}
+	conversation, err := builder.Build()
+	require.NoError(t, err)
+	return conversation
+}
+
+// Helper function to expect the saga emitted once the conversation is parked on it, capturing its transaction ID
+func expectAwaitedSaga(executor *MockOperationExecutor, field field.Model, characterId uint32, operations []OperationModel, transactionId *uuid.UUID) *mock.Call {
+	call := executor.On("ExecuteGuardedSaga", field, characterId, mock.Anything, []ConditionModel(nil), operations)
+	return call.Run(func(args mock.Arguments) {
+		*transactionId = args.Get(2).(uuid.UUID)
+		call.ReturnArguments = mock.Arguments{*transactionId, nil}
+	})
+}
+
+// Test a generic action with onSuccess or onFailure parks the conversation until its saga completes or fails
+func TestProcessor_AwaitSaga(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	conversation := createTestAwaitingConversation(t, npcId)
+	operations := conversation.States()[0].GenericAction().Operations()
+
+	tests := []struct {
+		name          string
+		succeeded     bool
+		reason        string
+		expectedState string
+	}{
+		{name: "Saga completes", succeeded: true, expectedState: "thanks"},
+		{name: "Saga fails", succeeded: false, reason: "INVENTORY_FULL", expectedState: "sorry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+			require.NoError(t, err)
+			ctx, err := NewConversationContextBuilder().
+				SetField(createTestField()).
+				SetCharacterId(characterId).
+				SetNpcId(npcId).
+				SetCurrentState("reward").
+				SetConversation(conversation).
+				Build()
+			require.NoError(t, err)
+			require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+			var transactionId uuid.UUID
+			mockExecutor := new(MockOperationExecutor)
+			expectAwaitedSaga(mockExecutor, ctx.Field(), characterId, operations, &transactionId).Once()
+			processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), tm)
+
+			require.NoError(t, processor.drive(characterId, npcId))
+			parked, err := GetRegistry().GetPreviousContext(tm, characterId)
+			require.NoError(t, err)
+			assert.Equal(t, "reward", parked.CurrentState())
+			assert.Equal(t, transactionId, parked.AwaitingSaga())
+
+			// Responses and the sagas of others do not move a parked conversation
+			require.NoError(t, processor.Continue(npcId, characterId, 1, 0, 0, ""))
+			require.NoError(t, processor.ResumeSaga(uuid.New(), true, ""))
+			parked, err = GetRegistry().GetPreviousContext(tm, characterId)
+			require.NoError(t, err)
+			assert.Equal(t, transactionId, parked.AwaitingSaga())
+
+			require.NoError(t, processor.ResumeSaga(transactionId, tt.succeeded, tt.reason))
+			resumed, err := GetRegistry().GetPreviousContext(tm, characterId)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedState, resumed.CurrentState())
+			assert.Equal(t, uuid.Nil, resumed.AwaitingSaga())
+			reason, ok := resumed.Context()[SagaFailureReasonContextKey]
+			assert.Equal(t, !tt.succeeded, ok)
+			assert.Equal(t, tt.reason, reason)
+			mockExecutor.AssertExpectations(t)
+		})
+	}
+}
+
+// Test a saga status event arriving before the saga is reported as emitted still resumes the conversation
+func TestProcessor_AwaitSaga_EarlyStatusEvent(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	conversation := createTestAwaitingConversation(t, npcId)
+	operations := conversation.States()[0].GenericAction().Operations()
+
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("reward").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+	mockExecutor := new(MockOperationExecutor)
+	processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), tm)
+	// The orchestrator completes the saga as soon as it is emitted, before awaitSaga returns
+	mockExecutor.On("ExecuteGuardedSaga", ctx.Field(), characterId, mock.Anything, []ConditionModel(nil), operations).Run(func(args mock.Arguments) {
+		require.NoError(t, processor.ResumeSaga(args.Get(2).(uuid.UUID), true, ""))
+	}).Return(uuid.Nil, nil).Once()
+
+	require.NoError(t, processor.drive(characterId, npcId))
+	resumed, err := GetRegistry().GetPreviousContext(tm, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "thanks", resumed.CurrentState())
+	assert.Equal(t, uuid.Nil, resumed.AwaitingSaga())
+	mockExecutor.AssertExpectations(t)
+}
+
+// Test the conversation parked on a saga which cannot be emitted ends
+func TestProcessor_AwaitSaga_EmitFailure(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	conversation := createTestAwaitingConversation(t, npcId)
+	operations := conversation.States()[0].GenericAction().Operations()
+
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("reward").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+	mockExecutor := new(MockOperationExecutor)
+	mockExecutor.On("ExecuteGuardedSaga", ctx.Field(), characterId, mock.Anything, []ConditionModel(nil), operations).Return(uuid.Nil, errors.New("saga orchestrator communication failed")).Once()
+	processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), tm)
+
+	assert.Error(t, processor.drive(characterId, npcId))
+	_, err = GetRegistry().GetPreviousContext(tm, characterId)
+	assert.ErrorIs(t, err, ErrContextNotFound)
+}
+
+// Test a generic action whose operations are all executed locally continues without waiting
+func TestProcessor_AwaitSaga_NoRemoteOperations(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	operation, err := NewOperationBuilder().SetType("local:log").AddParamValue("message", "rewarded").Build()
+	require.NoError(t, err)
+	action, err := NewGenericActionBuilder().AddOperation(operation).SetOnSuccess("thanks").SetOnFailure("sorry").Build()
+	require.NoError(t, err)
+	conversation := createTestAwaitingConversation(t, npcId)
+	conversation.states[0].genericAction = action
+
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("reward").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+	mockExecutor := new(MockOperationExecutor)
+	mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, []OperationModel{operation}).Return(nil).Once()
+	processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), tm)
+
+	require.NoError(t, processor.drive(characterId, npcId))
+	stored, err := GetRegistry().GetPreviousContext(tm, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "thanks", stored.CurrentState())
+	assert.Equal(t, uuid.Nil, stored.AwaitingSaga())
+	mockExecutor.AssertExpectations(t)
+}
+
+// Helper function to create the operations of a generic action executed both locally and by the saga orchestrator
+func createTestMixedOperations(t *testing.T) ([]OperationModel, []OperationModel, []OperationModel) {
+	logOperation, err := NewOperationBuilder().SetType("local:log").AddParamValue("message", "before").Build()
+	require.NoError(t, err)
+	mesosOperation, err := NewOperationBuilder().SetType("award_mesos").AddParamValue("amount", "1000").Build()
+	require.NoError(t, err)
+	itemOperation, err := NewOperationBuilder().SetType("award_item").AddParamValue("itemId", "4001126").AddParamValue("quantity", "1").Build()
+	require.NoError(t, err)
+	debugOperation, err := NewOperationBuilder().SetType("local:debug").AddParamValue("message", "after").Build()
+	require.NoError(t, err)
+
+	operations := []OperationModel{logOperation, mesosOperation, itemOperation, debugOperation}
+	return operations, []OperationModel{logOperation, debugOperation}, []OperationModel{mesosOperation, itemOperation}
+}
+
+// Test a generic action executes its remote operations as a single saga, with its local operations before or after it
+func TestProcessGenericActionState_LocalOperationOrder(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9001)
+	operations, local, remote := createTestMixedOperations(t)
+
+	tests := []struct {
+		name          string
+		order         LocalOperationOrder
+		expectedOrder []string
+	}{
+		{name: "Default", expectedOrder: []string{"ExecuteOperations", "ExecuteSaga"}},
+		{name: "First", order: LocalOperationsFirst, expectedOrder: []string{"ExecuteOperations", "ExecuteSaga"}},
+		{name: "Last", order: LocalOperationsLast, expectedOrder: []string{"ExecuteSaga", "ExecuteOperations"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := NewGenericActionBuilder().SetOperations(operations).SetLocalOperations(tt.order)
+			builder.AddOutcome(OutcomeModel{nextState: "success_state"})
+			genericAction, err := builder.Build()
+			require.NoError(t, err)
+			state, err := NewStateBuilder().SetId("test_state").SetGenericAction(genericAction).Build()
+			require.NoError(t, err)
+			ctx := createTestConversationContext(characterId, npcId, "test_state")
+
+			executed := make([]string, 0)
+			mockExecutor := new(MockOperationExecutor)
+			mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, local).Run(func(args mock.Arguments) {
+				executed = append(executed, "ExecuteOperations")
+			}).Return(nil).Once()
+			mockExecutor.On("ExecuteSaga", ctx.Field(), characterId, remote).Run(func(args mock.Arguments) {
+				executed = append(executed, "ExecuteSaga")
+			}).Return(uuid.New(), nil).Once()
+			processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), createTestTenant())
+
+			nextState, err := processor.processGenericActionState(ctx, state)
+			require.NoError(t, err)
+			assert.Equal(t, "success_state", nextState)
+			assert.Equal(t, tt.expectedOrder, executed)
+			mockExecutor.AssertExpectations(t)
+		})
+	}
+}
+
+// Test a fireAndForget generic action executes each operation on its own, in the order written
+func TestProcessGenericActionState_FireAndForget(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9001)
+	operations, _, _ := createTestMixedOperations(t)
+
+	builder := NewGenericActionBuilder().SetOperations(operations).SetFireAndForget(true)
+	builder.AddOutcome(OutcomeModel{nextState: "success_state"})
+	genericAction, err := builder.Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId("test_state").SetGenericAction(genericAction).Build()
+	require.NoError(t, err)
+	ctx := createTestConversationContext(characterId, npcId, "test_state")
+
+	executed := make([]OperationModel, 0)
+	mockExecutor := new(MockOperationExecutor)
+	mockExecutor.On("ExecuteOperation", ctx.Field(), characterId, mock.Anything).Run(func(args mock.Arguments) {
+		executed = append(executed, args.Get(2).(OperationModel))
+	}).Return(nil)
+	processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), createTestTenant())
+
+	nextState, err := processor.processGenericActionState(ctx, state)
+	require.NoError(t, err)
+	assert.Equal(t, "success_state", nextState)
+	assert.Equal(t, operations, executed)
+	mockExecutor.AssertNotCalled(t, "ExecuteSaga", mock.Anything, mock.Anything, mock.Anything)
+	mockExecutor.AssertNotCalled(t, "ExecuteOperations", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test local operations ordered last run once the awaited saga completes, and not when it fails
+func TestProcessor_AwaitSaga_LocalOperationsLast(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	operations, local, remote := createTestMixedOperations(t)
+
+	for _, succeeded := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Succeeded %t", succeeded), func(t *testing.T) {
+			action, err := NewGenericActionBuilder().
+				SetOperations(operations).
+				SetLocalOperations(LocalOperationsLast).
+				SetOnSuccess("thanks").
+				SetOnFailure("sorry").
+				Build()
+			require.NoError(t, err)
+			conversation := createTestAwaitingConversation(t, npcId)
+			conversation.states[0].genericAction = action
+
+			tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+			require.NoError(t, err)
+			ctx, err := NewConversationContextBuilder().
+				SetField(createTestField()).
+				SetCharacterId(characterId).
+				SetNpcId(npcId).
+				SetCurrentState("reward").
+				SetConversation(conversation).
+				Build()
+			require.NoError(t, err)
+			require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+			var transactionId uuid.UUID
+			mockExecutor := new(MockOperationExecutor)
+			expectAwaitedSaga(mockExecutor, ctx.Field(), characterId, remote, &transactionId).Once()
+			processor := createTestProcessor(t, mockExecutor, new(MockEvaluator), tm)
+
+			require.NoError(t, processor.drive(characterId, npcId))
+			mockExecutor.AssertNotCalled(t, "ExecuteOperations", mock.Anything, mock.Anything, mock.Anything)
+
+			if succeeded {
+				mockExecutor.On("ExecuteOperations", ctx.Field(), characterId, local).Return(nil).Once()
+			}
+			require.NoError(t, processor.ResumeSaga(transactionId, succeeded, ""))
+			mockExecutor.AssertExpectations(t)
+			if !succeeded {
+				mockExecutor.AssertNotCalled(t, "ExecuteOperations", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+// Test the builder rejects combinations of execution options which do not apply together
+func TestGenericActionBuilder_ExecutionValidation(t *testing.T) {
+	operation, err := NewOperationBuilder().SetType("award_mesos").AddParamValue("amount", "1000").Build()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		builder *GenericActionBuilder
+		wantErr bool
+	}{
+		{name: "Local operations last", builder: NewGenericActionBuilder().AddOperation(operation).SetLocalOperations(LocalOperationsLast)},
+		{name: "Fire and forget", builder: NewGenericActionBuilder().AddOperation(operation).SetFireAndForget(true)},
+		{name: "Unknown local operation order", builder: NewGenericActionBuilder().AddOperation(operation).SetLocalOperations("middle"), wantErr: true},
+		{name: "Fire and forget with local operation order", builder: NewGenericActionBuilder().AddOperation(operation).SetFireAndForget(true).SetLocalOperations(LocalOperationsFirst), wantErr: true},
+		{name: "Fire and forget awaiting saga", builder: NewGenericActionBuilder().AddOperation(operation).SetFireAndForget(true).SetOnSuccess("thanks"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// Test the operations reached through a conditional outcome are executed as a saga validating the outcome's conditions
+func TestProcessor_GuardedSaga(t *testing.T) {
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	items := createTestCondition(t, "item", "10", "4001126")
+	outcome, err := NewOutcomeBuilder().SetNextState("exchange").AddCondition(items).Build()
+	require.NoError(t, err)
+	exchange := createTestExchangeState(t)
+	conversation := createTestCycleConversation(t,
+		createTestActionState(t, "check", outcome, createTestOutcome(t, "lacking", false)),
+		exchange,
+		createTestDialogueState(t, "lacking", ""),
+		createTestDialogueState(t, "done", "lacking"))
+
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("check").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+	defer GetRegistry().ClearContext(tm, characterId)
+
+	mockEvaluator := new(MockEvaluator)
+	mockEvaluator.On("EvaluateConditions", characterId, []ConditionModel{items}).Return(true, nil).Once()
+	mockExecutor := new(MockOperationExecutor)
+	mockExecutor.On("ExecuteGuardedSaga", ctx.Field(), characterId, uuid.Nil, []ConditionModel{items}, exchange.GenericAction().Operations()).Return(uuid.New(), nil).Once()
+	processor := createTestProcessor(t, mockExecutor, mockEvaluator, tm)
+
+	require.NoError(t, processor.drive(characterId, npcId))
+	stored, err := GetRegistry().GetPreviousContext(tm, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "done", stored.CurrentState())
+	mockEvaluator.AssertExpectations(t)
+	mockExecutor.AssertExpectations(t)
+	mockExecutor.AssertNotCalled(t, "ExecuteSaga", mock.Anything, mock.Anything, mock.Anything)
+}
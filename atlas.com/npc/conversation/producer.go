@@ -0,0 +1,43 @@
+package conversation
+
+import (
+	npc2 "atlas-npc-conversations/kafka/message/npc"
+	"github.com/Chronicle20/atlas-kafka/producer"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+func timedOutEventProvider(ctx ConversationContext, idle time.Duration) model.Provider[[]kafka.Message] {
+	key := producer.CreateKey(int(ctx.CharacterId()))
+	value := &npc2.ConversationStatusEvent[npc2.ConversationStatusEventTimedOutBody]{
+		WorldId:     byte(ctx.Field().WorldId()),
+		ChannelId:   byte(ctx.Field().ChannelId()),
+		CharacterId: ctx.CharacterId(),
+		NpcId:       ctx.NpcId(),
+		Type:        npc2.ConversationStatusEventTypeTimedOut,
+		Body: npc2.ConversationStatusEventTimedOutBody{
+			ConversationId: ctx.Conversation().Id().String(),
+			StateId:        ctx.CurrentState(),
+			IdleSeconds:    uint32(idle.Seconds()),
+		},
+	}
+	return producer.SingleMessageProvider(key, value)
+}
+
+func errorEventProvider(ctx ConversationContext, reason string) model.Provider[[]kafka.Message] {
+	key := producer.CreateKey(int(ctx.CharacterId()))
+	value := &npc2.ConversationStatusEvent[npc2.ConversationStatusEventErrorBody]{
+		WorldId:     byte(ctx.Field().WorldId()),
+		ChannelId:   byte(ctx.Field().ChannelId()),
+		CharacterId: ctx.CharacterId(),
+		NpcId:       ctx.NpcId(),
+		Type:        npc2.ConversationStatusEventTypeError,
+		Body: npc2.ConversationStatusEventErrorBody{
+			ConversationId: ctx.Conversation().Id().String(),
+			StateId:        ctx.CurrentState(),
+			Reason:         reason,
+		},
+	}
+	return producer.SingleMessageProvider(key, value)
+}
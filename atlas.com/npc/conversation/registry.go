@@ -1,11 +1,13 @@
 package conversation
 
 import (
-	"errors"
 	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
 	"sync"
 )
 
+// Registry is a SessionStore holding conversation contexts in memory. Contexts are lost when the service restarts, and
+// are not shared between replicas.
 type Registry struct {
 	lock       sync.RWMutex
 	registry   map[tenant.Model]map[uint32]ConversationContext
@@ -15,7 +17,8 @@ type Registry struct {
 var once sync.Once
 var registry *Registry
 
-func GetRegistry() *Registry {
+// GetMemoryRegistry returns the in-memory session store
+func GetMemoryRegistry() *Registry {
 	once.Do(func() {
 		registry = initRegistry()
 	})
@@ -46,10 +49,10 @@ func (s *Registry) GetPreviousContext(t tenant.Model, characterId uint32) (Conve
 		return val, nil
 	}
 	tl.RUnlock()
-	return ConversationContext{}, errors.New("unable to previous context")
+	return ConversationContext{}, ErrContextNotFound
 }
 
-func (s *Registry) SetContext(t tenant.Model, characterId uint32, ctx ConversationContext) {
+func (s *Registry) SetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error {
 	s.lock.Lock()
 	if _, ok := s.registry[t]; !ok {
 		s.registry[t] = make(map[uint32]ConversationContext)
@@ -59,11 +62,32 @@ func (s *Registry) SetContext(t tenant.Model, characterId uint32, ctx Conversati
 	s.lock.Unlock()
 
 	tl.Lock()
+	ctx.revision = s.registry[t][characterId].revision + 1
 	s.registry[t][characterId] = ctx
 	tl.Unlock()
+	return nil
 }
 
-func (s *Registry) ClearContext(t tenant.Model, characterId uint32) {
+func (s *Registry) CompareAndSetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error {
+	s.lock.Lock()
+	if _, ok := s.registry[t]; !ok {
+		s.registry[t] = make(map[uint32]ConversationContext)
+		s.tenantLock[t] = &sync.RWMutex{}
+	}
+	tl := s.tenantLock[t]
+	s.lock.Unlock()
+
+	tl.Lock()
+	defer tl.Unlock()
+	if s.registry[t][characterId].revision != ctx.revision {
+		return ErrRevisionConflict
+	}
+	ctx.revision++
+	s.registry[t][characterId] = ctx
+	return nil
+}
+
+func (s *Registry) ClearContext(t tenant.Model, characterId uint32) error {
 	s.lock.Lock()
 	if _, ok := s.registry[t]; !ok {
 		s.registry[t] = make(map[uint32]ConversationContext)
@@ -75,4 +99,59 @@ func (s *Registry) ClearContext(t tenant.Model, characterId uint32) {
 	tl.Lock()
 	delete(s.registry[t], characterId)
 	tl.Unlock()
+	return nil
+}
+
+func (s *Registry) CompareAndClearContext(t tenant.Model, characterId uint32, revision uint64) error {
+	s.lock.Lock()
+	if _, ok := s.registry[t]; !ok {
+		s.registry[t] = make(map[uint32]ConversationContext)
+		s.tenantLock[t] = &sync.RWMutex{}
+	}
+	tl := s.tenantLock[t]
+	s.lock.Unlock()
+
+	tl.Lock()
+	defer tl.Unlock()
+	stored, ok := s.registry[t][characterId]
+	if !ok || stored.revision != revision {
+		return ErrRevisionConflict
+	}
+	delete(s.registry[t], characterId)
+	return nil
+}
+
+func (s *Registry) GetContexts() (map[tenant.Model][]ConversationContext, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	contexts := make(map[tenant.Model][]ConversationContext)
+	for t, characters := range s.registry {
+		tl := s.tenantLock[t]
+		tl.RLock()
+		for _, ctx := range characters {
+			contexts[t] = append(contexts[t], ctx)
+		}
+		tl.RUnlock()
+	}
+	return contexts, nil
+}
+
+func (s *Registry) GetAwaitingContext(t tenant.Model, transactionId uuid.UUID) (ConversationContext, error) {
+	s.lock.RLock()
+	characters, ok := s.registry[t]
+	tl := s.tenantLock[t]
+	s.lock.RUnlock()
+	if !ok || transactionId == uuid.Nil {
+		return ConversationContext{}, ErrContextNotFound
+	}
+
+	tl.RLock()
+	defer tl.RUnlock()
+	for _, ctx := range characters {
+		if ctx.AwaitingSaga() == transactionId {
+			return ctx, nil
+		}
+	}
+	return ConversationContext{}, ErrContextNotFound
 }
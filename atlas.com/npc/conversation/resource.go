@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/localization"
 	"atlas-npc-conversations/rest"
 	"errors"
 	"github.com/Chronicle20/atlas-model/model"
@@ -11,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"net/http"
+	"strings"
 )
 
 func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
@@ -21,9 +23,12 @@ func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteIn
 
 			// Register handlers
 			router.HandleFunc("/npcs/conversations", registerHandler("get_all_conversations", GetAllConversationsHandler)).Methods(http.MethodGet)
+			router.HandleFunc("/npcs/conversations/operations", registerHandler("get_operations", GetOperationsHandler)).Methods(http.MethodGet)
 			router.HandleFunc("/npcs/conversations/{conversationId}", registerHandler("get_conversation", GetConversationHandler)).Methods(http.MethodGet)
+			router.HandleFunc("/npcs/conversations/{conversationId}/untranslated", registerHandler("get_conversation_untranslated", GetUntranslatedHandler)).Methods(http.MethodGet)
 			router.HandleFunc("/npcs/{npcId}/conversations", registerHandler("get_conversations_by_npc", GetConversationsByNpcHandler)).Methods(http.MethodGet)
 			router.HandleFunc("/npcs/conversations", registerInputHandler("create_conversation", CreateConversationHandler)).Methods(http.MethodPost)
+			router.HandleFunc("/npcs/conversations/validate", registerInputHandler("validate_conversation", ValidateConversationHandler)).Methods(http.MethodPost)
 			router.HandleFunc("/npcs/conversations/{conversationId}", registerInputHandler("update_conversation", UpdateConversationHandler)).Methods(http.MethodPatch)
 			router.HandleFunc("/npcs/conversations/{conversationId}", registerHandler("delete_conversation", DeleteConversationHandler)).Methods(http.MethodDelete)
 		}
@@ -34,7 +39,7 @@ func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteIn
 func GetAllConversationsHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mp := NewProcessor(d.Logger(), d.Context(), d.DB()).AllProvider()
-		rm, err := model.SliceMap(Transform)(mp)(model.ParallelMap())()
+		rm, err := model.SliceMap(TransformWithPreviews)(mp)(model.ParallelMap())()
 		if err != nil {
 			d.Logger().WithError(err).Errorf("Creating REST model.")
 			w.WriteHeader(http.StatusInternalServerError)
@@ -47,6 +52,27 @@ func GetAllConversationsHandler(d *rest.HandlerDependency, c *rest.HandlerContex
 	}
 }
 
+// GetOperationsHandler handles GET /npcs/conversations/operations, listing the operation types a conversation may use
+func GetOperationsHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handlers := GetOperationHandlerRegistry().Handlers()
+		rm := make([]RestOperationDescriptorModel, 0, len(handlers))
+		for _, h := range handlers {
+			drm, err := TransformOperationHandler(h)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Creating REST model.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			rm = append(rm, drm)
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]RestOperationDescriptorModel](d.Logger())(w)(c.ServerInformation())(queryParams)(rm)
+	}
+}
+
 // GetConversationHandler handles GET /conversations/{conversationId}
 func GetConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return rest.ParseConversationId(d.Logger(), func(conversationId uuid.UUID) http.HandlerFunc {
@@ -62,7 +88,7 @@ func GetConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext) h
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			rm, err := model.Map(Transform)(model.FixedProvider(m))()
+			rm, err := model.Map(TransformWithPreviews)(model.FixedProvider(m))()
 			if err != nil {
 				d.Logger().WithError(err).Errorf("Creating REST model.")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -76,9 +102,63 @@ func GetConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext) h
 	})
 }
 
+// GetUntranslatedHandler handles GET /npcs/conversations/{conversationId}/untranslated, reporting the localized text
+// of a conversation with no translation for a locale. The locale query parameter holds a comma separated list of the
+// locales checked; by default every locale of the string table and the conversation is checked.
+func GetUntranslatedHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseConversationId(d.Logger(), func(conversationId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			m, err := NewProcessor(d.Logger(), d.Context(), d.DB()).ByIdProvider(conversationId)()
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				d.Logger().WithError(err).Errorf("Conversation not found.")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Retrieving conversation.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			lp := localization.NewProcessor(d.Logger(), d.Context(), d.DB())
+			var locales []string
+			for _, locale := range strings.Split(r.URL.Query().Get("locale"), ",") {
+				if locale = strings.TrimSpace(locale); locale != "" {
+					locales = append(locales, locale)
+				}
+			}
+			if len(locales) == 0 {
+				tableLocales, err := lp.Locales()
+				if err != nil {
+					d.Logger().WithError(err).Errorf("Retrieving string table locales.")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				locales = TranslationLocales(m, tableLocales)
+			}
+			rm := TransformTranslation(m, locales, lp.Lookup())
+
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[RestTranslationModel](d.Logger())(w)(c.ServerInformation())(queryParams)(rm)
+		}
+	})
+}
+
 // CreateConversationHandler handles POST /conversations
 func CreateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext, rm RestModel) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Reject conversations which are invalid, using the same rules as the validate endpoint
+		errs, warnings := ValidateDocument(rm)
+		if len(errs) > 0 {
+			d.Logger().Errorf("Validating conversation found [%d] errors.", len(errs))
+			rest.WriteErrors(d.Logger(), w, http.StatusBadRequest, errs)
+			return
+		}
+		if len(warnings) > 0 {
+			d.Logger().Warnf("Validating conversation found [%d] warnings.", len(warnings))
+		}
+
 		// Extract domain model from REST model
 		m, err := Extract(rm)
 		if err != nil {
@@ -96,18 +176,28 @@ func CreateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext
 		}
 
 		// Transform back to REST model
-		createdRm, err := Transform(createdModel)
+		createdRm, err := TransformWithPreviews(createdModel)
 		if err != nil {
 			d.Logger().WithError(err).Errorf("Transforming domain model to REST model.")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		// Return created conversation
+		// Return created conversation, with the warnings found validating it
+		writeConversation(d, c, w, r, http.StatusCreated, createdRm, warnings)
+	}
+}
+
+// ValidateConversationHandler handles POST /npcs/conversations/validate, reporting the errors and warnings of a
+// conversation document without saving it
+func ValidateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext, rm RestModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vrm := TransformValidation(rm)
+		d.Logger().Debugf("Validating conversation found [%d] errors and [%d] warnings.", len(vrm.Errors), len(vrm.Warnings))
+
 		query := r.URL.Query()
 		queryParams := jsonapi.ParseQueryFields(&query)
-		w.WriteHeader(http.StatusCreated)
-		server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(createdRm)
+		server.MarshalResponse[RestValidationModel](d.Logger())(w)(c.ServerInformation())(queryParams)(vrm)
 	}
 }
 
@@ -115,6 +205,17 @@ func CreateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext
 func UpdateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext, rm RestModel) http.HandlerFunc {
 	return rest.ParseConversationId(d.Logger(), func(conversationId uuid.UUID) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
+			// Reject conversations which are invalid, using the same rules as the validate endpoint
+			errs, warnings := ValidateDocument(rm)
+			if len(errs) > 0 {
+				d.Logger().Errorf("Validating conversation found [%d] errors.", len(errs))
+				rest.WriteErrors(d.Logger(), w, http.StatusBadRequest, errs)
+				return
+			}
+			if len(warnings) > 0 {
+				d.Logger().Warnf("Validating conversation found [%d] warnings.", len(warnings))
+			}
+
 			// Extract domain model from REST model
 			m, err := Extract(rm)
 			if err != nil {
@@ -132,17 +233,15 @@ func UpdateConversationHandler(d *rest.HandlerDependency, c *rest.HandlerContext
 			}
 
 			// Transform back to REST model
-			updatedRm, err := Transform(updatedModel)
+			updatedRm, err := TransformWithPreviews(updatedModel)
 			if err != nil {
 				d.Logger().WithError(err).Errorf("Transforming domain model to REST model.")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			// Return updated conversation
-			query := r.URL.Query()
-			queryParams := jsonapi.ParseQueryFields(&query)
-			server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(updatedRm)
+			// Return updated conversation, with the warnings found validating it
+			writeConversation(d, c, w, r, http.StatusOK, updatedRm, warnings)
 		}
 	})
 }
@@ -170,7 +269,7 @@ func GetConversationsByNpcHandler(d *rest.HandlerDependency, c *rest.HandlerCont
 	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			mp := NewProcessor(d.Logger(), d.Context(), d.DB()).AllByNpcIdProvider(npcId)
-			rm, err := model.SliceMap(Transform)(mp)(model.ParallelMap())()
+			rm, err := model.SliceMap(TransformWithPreviews)(mp)(model.ParallelMap())()
 			if err != nil {
 				d.Logger().WithError(err).Errorf("Creating REST model.")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -183,3 +282,20 @@ func GetConversationsByNpcHandler(d *rest.HandlerDependency, c *rest.HandlerCont
 		}
 	})
 }
+
+// writeConversation writes the conversation with the given status. Warnings found validating it are returned in the
+// top-level meta of the document, so a saved conversation with problems the validate endpoint would report is not
+// silently accepted.
+func writeConversation(d *rest.HandlerDependency, c *rest.HandlerContext, w http.ResponseWriter, r *http.Request, status int, rm RestModel, warnings []jsonapi.Error) {
+	if len(warnings) > 0 {
+		rest.WriteWithMeta(d.Logger(), w, c.ServerInformation(), status, rm, map[string]interface{}{"warnings": warnings})
+		return
+	}
+
+	query := r.URL.Query()
+	queryParams := jsonapi.ParseQueryFields(&query)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(rm)
+}
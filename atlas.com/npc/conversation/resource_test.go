@@ -0,0 +1,70 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/localization"
+	"atlas-npc-conversations/rest"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type testServerInformation struct{}
+
+func (testServerInformation) GetBaseURL() string {
+	return "http://localhost"
+}
+
+func (testServerInformation) GetPrefix() string {
+	return "api"
+}
+
+// Helper function to open a database which builds statements without executing them
+func createDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestCreateConversationHandler_Warnings(t *testing.T) {
+	rm := createTestActionDocument(nil, nil)
+	rm.States[1].Dialogue.Text = localization.RestText{Default: "Done #x"}
+	_, warnings := ValidateDocument(rm)
+	require.NotEmpty(t, warnings)
+
+	body, err := jsonapi.Marshal(rm)
+	require.NoError(t, err)
+
+	handler := rest.RegisterInputHandler[RestModel](logrus.New())(createDryRunDB(t))(testServerInformation{})("create_conversation", CreateConversationHandler)
+	req := httptest.NewRequest(http.MethodPost, "/npcs/conversations", bytes.NewReader(body))
+	req.Header.Set("TENANT_ID", uuid.New().String())
+	req.Header.Set("REGION", "GMS")
+	req.Header.Set("MAJOR_VERSION", "83")
+	req.Header.Set("MINOR_VERSION", "1")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var doc struct {
+		Data struct {
+			Attributes struct {
+				NpcId uint32 `json:"npcId"`
+			} `json:"attributes"`
+		} `json:"data"`
+		Meta struct {
+			Warnings []jsonapi.Error `json:"warnings"`
+		} `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, uint32(9010000), doc.Data.Attributes.NpcId)
+	assert.Equal(t, summarizeErrors(warnings), summarizeErrors(doc.Meta.Warnings))
+}
@@ -1,21 +1,28 @@
 package conversation
 
 import (
+	"atlas-npc-conversations/localization"
+	"atlas-npc-conversations/message"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jtumidanski/api2go/jsonapi"
 )
 
 const (
-	Resource = "conversations"
+	Resource            = "conversations"
+	ValidationResource  = "conversation-validations"
+	OperationResource   = "operations"
+	TranslationResource = "conversation-translations"
 )
 
 // RestModel represents the REST model for NPC conversations
 type RestModel struct {
-	Id         uuid.UUID        `json:"-"`          // Conversation ID
-	NpcId      uint32           `json:"npcId"`      // NPC ID
-	StartState string           `json:"startState"` // Start state ID
-	States     []RestStateModel `json:"states"`     // Conversation states
+	Id          uuid.UUID            `json:"-"`                     // Conversation ID
+	NpcId       uint32               `json:"npcId"`                 // NPC ID
+	StartState  string               `json:"startState"`            // Start state ID
+	States      []RestStateModel     `json:"states"`                // Conversation states
+	OptionSets  []RestOptionSetModel `json:"optionSets,omitempty"`  // Option sets referenced by list selections and craft actions
+	IdleTimeout uint32               `json:"idleTimeout,omitempty"` // Seconds a character may leave the conversation unanswered before it is ended
 }
 
 // GetName returns the resource name
@@ -68,14 +75,165 @@ func (r *RestModel) SetReferencedStructs(references map[string]map[string]jsonap
 	return nil
 }
 
+// RestValidationModel represents the REST model for the result of validating a conversation document
+type RestValidationModel struct {
+	Id       uuid.UUID       `json:"-"`        // ID of the validated conversation, if any
+	Valid    bool            `json:"valid"`    // Whether the conversation may be saved
+	Errors   []jsonapi.Error `json:"errors"`   // Problems which prevent the conversation from being saved
+	Warnings []jsonapi.Error `json:"warnings"` // Problems which do not prevent the conversation from being saved
+}
+
+// GetName returns the resource name
+func (r RestValidationModel) GetName() string {
+	return ValidationResource
+}
+
+// GetID returns the resource ID
+func (r RestValidationModel) GetID() string {
+	return r.Id.String()
+}
+
+// SetID sets the resource ID
+func (r *RestValidationModel) SetID(idStr string) error {
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return fmt.Errorf("invalid conversation ID: %w", err)
+	}
+	r.Id = id
+	return nil
+}
+
+// TransformValidation converts the result of validating a conversation document to a REST model
+func TransformValidation(r RestModel) RestValidationModel {
+	errs, warnings := ValidateDocument(r)
+	return RestValidationModel{
+		Id:       r.Id,
+		Valid:    len(errs) == 0,
+		Errors:   errs,
+		Warnings: warnings,
+	}
+}
+
+// RestTranslationModel represents the REST model for the localized text of a conversation which is not translated
+type RestTranslationModel struct {
+	Id            uuid.UUID                   `json:"-"`             // Conversation ID
+	DefaultLocale string                      `json:"defaultLocale"` // Locale shown when no other locale is translated
+	Locales       []string                    `json:"locales"`       // Locales checked for translations
+	Untranslated  []RestUntranslatedTextModel `json:"untranslated"`  // Text with no translation for a locale
+}
+
+// RestUntranslatedTextModel represents the REST model for localized text with no translation for a locale
+type RestUntranslatedTextModel struct {
+	Locale  string `json:"locale"`        // Locale the text is not translated into
+	Key     string `json:"key,omitempty"` // Key of the text in the string table, if any
+	Pointer string `json:"pointer"`       // JSON pointer to the text in the conversation document
+}
+
+// GetName returns the resource name
+func (r RestTranslationModel) GetName() string {
+	return TranslationResource
+}
+
+// GetID returns the resource ID
+func (r RestTranslationModel) GetID() string {
+	return r.Id.String()
+}
+
+// SetID sets the resource ID
+func (r *RestTranslationModel) SetID(idStr string) error {
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return fmt.Errorf("invalid conversation ID: %w", err)
+	}
+	r.Id = id
+	return nil
+}
+
+// TransformTranslation converts the localized text of a conversation which is not translated into the locales to a
+// REST model
+func TransformTranslation(m Model, locales []string, lookup localization.Lookup) RestTranslationModel {
+	untranslated := Untranslated(m, locales, lookup)
+	rm := RestTranslationModel{
+		Id:            m.Id(),
+		DefaultLocale: localization.GetDefaultLocale(),
+		Locales:       locales,
+		Untranslated:  make([]RestUntranslatedTextModel, 0, len(untranslated)),
+	}
+	for _, u := range untranslated {
+		rm.Untranslated = append(rm.Untranslated, RestUntranslatedTextModel{Locale: u.Locale, Key: u.Key, Pointer: u.Pointer})
+	}
+	return rm
+}
+
+// RestOperationDescriptorModel represents the REST model for the descriptor of an operation type
+type RestOperationDescriptorModel struct {
+	Name         string                     `json:"-"`                      // Operation type
+	Description  string                     `json:"description"`            // What the operation does
+	Local        bool                       `json:"local"`                  // Whether the operation is executed locally rather than through a saga
+	Compensation string                     `json:"compensation,omitempty"` // Saga action undoing the operation when a later step fails
+	Params       []RestParamDescriptorModel `json:"params"`                 // Params accepted by the operation
+}
+
+// RestParamDescriptorModel represents the REST model for the descriptor of an operation param
+type RestParamDescriptorModel struct {
+	Name           string `json:"name"`              // Param name
+	Type           string `json:"type"`              // Param type (integer or string)
+	Required       bool   `json:"required"`          // Whether the param must be given
+	Default        string `json:"default,omitempty"` // Value used when an optional param is not given
+	ContextAllowed bool   `json:"contextAllowed"`    // Whether the value may reference the conversation context
+}
+
+// GetName returns the resource name
+func (r RestOperationDescriptorModel) GetName() string {
+	return OperationResource
+}
+
+// GetID returns the resource ID
+func (r RestOperationDescriptorModel) GetID() string {
+	return r.Name
+}
+
+// SetID sets the resource ID
+func (r *RestOperationDescriptorModel) SetID(idStr string) error {
+	r.Name = idStr
+	return nil
+}
+
+// TransformOperationHandler converts the descriptor of an operation handler to a REST model
+func TransformOperationHandler(h OperationHandler) (RestOperationDescriptorModel, error) {
+	d := h.Descriptor()
+	params := make([]RestParamDescriptorModel, 0, len(d.Params()))
+	for _, p := range d.Params() {
+		params = append(params, RestParamDescriptorModel{
+			Name:           p.Name(),
+			Type:           string(p.Type()),
+			Required:       p.Required(),
+			Default:        p.DefaultValue(),
+			ContextAllowed: p.ContextAllowed(),
+		})
+	}
+	compensation := ""
+	if sh, ok := h.(StepOperationHandler); ok {
+		compensation = string(sh.CompensationAction())
+	}
+	return RestOperationDescriptorModel{
+		Name:         d.Name(),
+		Description:  d.Description(),
+		Local:        isLocalOperationHandler(h),
+		Compensation: compensation,
+		Params:       params,
+	}, nil
+}
+
 // RestStateModel represents the REST model for conversation states
 type RestStateModel struct {
-	Id            string                  `json:"id"`                      // State ID
-	StateType     string                  `json:"type"`                    // State type
-	Dialogue      *RestDialogueModel      `json:"dialogue,omitempty"`      // Dialogue model (if type is dialogue)
-	GenericAction *RestGenericActionModel `json:"genericAction,omitempty"` // Generic action model (if type is genericAction)
-	CraftAction   *RestCraftActionModel   `json:"craftAction,omitempty"`   // Craft action model (if type is craftAction)
-	ListSelection *RestListSelectionModel `json:"listSelection,omitempty"` // List selection model (if type is listSelection)
+	Id             string                   `json:"id"`                       // State ID
+	StateType      string                   `json:"type"`                     // State type
+	Dialogue       *RestDialogueModel       `json:"dialogue,omitempty"`       // Dialogue model (if type is dialogue)
+	GenericAction  *RestGenericActionModel  `json:"genericAction,omitempty"`  // Generic action model (if type is genericAction)
+	CraftAction    *RestCraftActionModel    `json:"craftAction,omitempty"`    // Craft action model (if type is craftAction)
+	ListSelection  *RestListSelectionModel  `json:"listSelection,omitempty"`  // List selection model (if type is listSelection)
+	StyleSelection *RestStyleSelectionModel `json:"styleSelection,omitempty"` // Style selection model (if type is styleSelection)
 }
 
 // GetID returns the resource ID
@@ -126,22 +284,51 @@ func (r *RestStateModel) SetReferencedStructs(references map[string]map[string]j
 
 // RestDialogueModel represents the REST model for dialogue states
 type RestDialogueModel struct {
-	DialogueType string            `json:"dialogueType"`      // Dialogue type
-	Text         string            `json:"text"`              // Dialogue text
-	Choices      []RestChoiceModel `json:"choices,omitempty"` // Dialogue choices
+	DialogueType string                `json:"dialogueType"`          // Dialogue type
+	Text         localization.RestText `json:"text"`                  // Dialogue text
+	Choices      []RestChoiceModel     `json:"choices,omitempty"`     // Dialogue choices
+	NextState    string                `json:"nextState,omitempty"`   // Next state ID for sendNext, sendNextPrev, sendOk and input dialogues
+	OnYes        string                `json:"onYes,omitempty"`       // Next state ID when sendYesNo or sendAcceptDecline is accepted
+	OnNo         string                `json:"onNo,omitempty"`        // Next state ID when sendYesNo or sendAcceptDecline is declined
+	OnExit       string                `json:"onExit,omitempty"`      // Next state ID when the dialogue is closed
+	NumberInput  *RestNumberInputModel `json:"numberInput,omitempty"` // Number input (if dialogueType is getNumber)
+	TextInput    *RestTextInputModel   `json:"textInput,omitempty"`   // Text input (if dialogueType is getText)
+	Preview      string                `json:"preview,omitempty"`     // Plain-text preview of the text (read-only)
+}
+
+// RestNumberInputModel represents the REST model for getNumber dialogue input
+type RestNumberInputModel struct {
+	ContextKey   string `json:"contextKey"`   // Context key the answer is stored under
+	DefaultValue int32  `json:"defaultValue"` // Value initially shown
+	MinValue     int32  `json:"minValue"`     // Minimum accepted value
+	MaxValue     int32  `json:"maxValue"`     // Maximum accepted value
+}
+
+// RestTextInputModel represents the REST model for getText dialogue input
+type RestTextInputModel struct {
+	ContextKey   string `json:"contextKey"`             // Context key the answer is stored under
+	DefaultValue string `json:"defaultValue,omitempty"` // Text initially shown
+	MinLength    uint16 `json:"minLength"`              // Minimum accepted text length
+	MaxLength    uint16 `json:"maxLength"`              // Maximum accepted text length
 }
 
 // RestChoiceModel represents the REST model for dialogue choices
 type RestChoiceModel struct {
-	Text      string            `json:"text"`              // Choice text
-	NextState string            `json:"nextState"`         // Next state ID
-	Context   map[string]string `json:"context,omitempty"` // Context data
+	Text       localization.RestText `json:"text"`                 // Choice text
+	NextState  string                `json:"nextState"`            // Next state ID
+	Context    map[string]string     `json:"context,omitempty"`    // Context data
+	Conditions []RestConditionModel  `json:"conditions,omitempty"` // Conditions which must pass for the choice to be shown
+	Preview    string                `json:"preview,omitempty"`    // Plain-text preview of the text (read-only)
 }
 
 // RestGenericActionModel represents the REST model for generic action states
 type RestGenericActionModel struct {
-	Operations []RestOperationModel `json:"operations,omitempty"` // Operations
-	Outcomes   []RestOutcomeModel   `json:"outcomes,omitempty"`   // Outcomes
+	Operations      []RestOperationModel `json:"operations,omitempty"`      // Operations
+	Outcomes        []RestOutcomeModel   `json:"outcomes,omitempty"`        // Outcomes
+	OnSuccess       string               `json:"onSuccess,omitempty"`       // State once the saga of the operations completes
+	OnFailure       string               `json:"onFailure,omitempty"`       // State when the saga of the operations fails
+	FireAndForget   bool                 `json:"fireAndForget,omitempty"`   // Execute each operation on its own rather than as a single saga
+	LocalOperations string               `json:"localOperations,omitempty"` // When local operations run relative to the saga (first or last)
 }
 
 // RestOperationModel represents the REST model for operations
@@ -152,10 +339,11 @@ type RestOperationModel struct {
 
 // RestConditionModel represents the REST model for conditions
 type RestConditionModel struct {
-	Type     string `json:"type"`     // Condition type
-	Operator string `json:"operator"` // Operator
-	Value    string `json:"value"`    // Value
-	ItemId   string `json:"itemId,omitempty"`
+	Type       string               `json:"type"`                 // Condition type, or a combinator ("all", "any", "not")
+	Operator   string               `json:"operator,omitempty"`   // Operator
+	Value      string               `json:"value,omitempty"`      // Value
+	ItemId     string               `json:"itemId,omitempty"`     // Item ID (item conditions only)
+	Conditions []RestConditionModel `json:"conditions,omitempty"` // Nested conditions (combinators only)
 }
 
 // RestOutcomeModel represents the REST model for outcomes
@@ -166,19 +354,45 @@ type RestOutcomeModel struct {
 
 // RestCraftActionModel represents the REST model for craft action states
 type RestCraftActionModel struct {
-	ItemId                string   `json:"itemId"`                         // Item ID
+	ItemId                string   `json:"itemId,omitempty"`               // Item ID
 	Materials             []uint32 `json:"materials"`                      // Material item IDs
 	Quantities            []uint32 `json:"quantities"`                     // Material quantities
 	MesoCost              uint32   `json:"mesoCost"`                       // Meso cost
+	OptionSetId           string   `json:"optionSetId,omitempty"`          // Option set the recipe is taken from
+	OptionContextKey      string   `json:"optionContextKey,omitempty"`     // Context key holding the chosen option ID
 	StimulatorId          uint32   `json:"stimulatorId,omitempty"`         // Stimulator item ID
 	StimulatorFailChance  float64  `json:"stimulatorFailChance,omitempty"` // Stimulator failure chance
+	SuccessState          string   `json:"successState,omitempty"`         // Success state ID
+	FailureState          string   `json:"failureState,omitempty"`         // Failure state ID
 	MissingMaterialsState string   `json:"missingMaterialsState"`          // Missing materials state ID
 }
 
 // RestListSelectionModel represents the REST model for list selection states
 type RestListSelectionModel struct {
-	Title   string            `json:"title"`             // List selection title
-	Choices []RestChoiceModel `json:"choices,omitempty"` // Dialogue choices
+	Title          localization.RestText    `json:"title"`                    // List selection title
+	Choices        []RestChoiceModel        `json:"choices,omitempty"`        // Dialogue choices
+	ChoiceTemplate *RestChoiceTemplateModel `json:"choiceTemplate,omitempty"` // Template generating choices at runtime
+	Preview        string                   `json:"preview,omitempty"`        // Plain-text preview of the title (read-only)
+}
+
+// RestChoiceTemplateModel represents the REST model for choices generated at runtime
+type RestChoiceTemplateModel struct {
+	From       string                `json:"from"`                 // Source of the option values (context.{key} or optionSet.{id})
+	Text       localization.RestText `json:"text"`                 // Choice text template
+	ContextKey string                `json:"contextKey"`           // Context key the selected value is stored under
+	NextState  string                `json:"nextState"`            // Next state ID once a generated choice is selected
+	Conditions []RestConditionModel  `json:"conditions,omitempty"` // Visibility conditions applied to each generated choice
+}
+
+// RestStyleSelectionModel represents the REST model for style selection states
+type RestStyleSelectionModel struct {
+	Text        localization.RestText `json:"text"`                  // Text shown alongside the styles
+	Styles      []uint32              `json:"styles,omitempty"`      // Literal style IDs
+	StylesFrom  string                `json:"stylesFrom,omitempty"`  // Context key holding comma separated style IDs
+	ContextKey  string                `json:"contextKey"`            // Context key the chosen style ID is stored under
+	NextState   string                `json:"nextState"`             // Next state ID once a style is chosen
+	CancelState string                `json:"cancelState,omitempty"` // Next state ID when the player cancels
+	Preview     string                `json:"preview,omitempty"`     // Plain-text preview of the text (read-only)
 }
 
 // RestOptionSetModel represents the REST model for option sets
@@ -254,14 +468,56 @@ func Transform(m Model) (RestModel, error) {
 		restStates = append(restStates, restState)
 	}
 
+	// Transform option sets
+	var restOptionSets []RestOptionSetModel
+	for _, optionSet := range m.OptionSets() {
+		restOptionSet, err := TransformOptionSet(optionSet)
+		if err != nil {
+			return RestModel{}, err
+		}
+		restOptionSets = append(restOptionSets, restOptionSet)
+	}
+
 	return RestModel{
-		Id:         m.Id(),
-		NpcId:      m.NpcId(),
-		StartState: m.StartState(),
-		States:     restStates,
+		Id:          m.Id(),
+		NpcId:       m.NpcId(),
+		StartState:  m.StartState(),
+		States:      restStates,
+		OptionSets:  restOptionSets,
+		IdleTimeout: m.IdleTimeout(),
 	}, nil
 }
 
+// TransformWithPreviews converts a Model to a RestModel with plain-text previews of the text shown to the character.
+// Previews are only returned by the REST API, and are ignored when a conversation is created or updated.
+func TransformWithPreviews(m Model) (RestModel, error) {
+	rm, err := Transform(m)
+	if err != nil {
+		return RestModel{}, err
+	}
+	for _, state := range rm.States {
+		if state.Dialogue != nil {
+			state.Dialogue.Preview = message.Preview(state.Dialogue.Text.Default)
+			addChoicePreviews(state.Dialogue.Choices)
+		}
+		if state.ListSelection != nil {
+			state.ListSelection.Preview = message.Preview(state.ListSelection.Title.Default)
+			addChoicePreviews(state.ListSelection.Choices)
+		}
+		if state.StyleSelection != nil {
+			state.StyleSelection.Preview = message.Preview(state.StyleSelection.Text.Default)
+		}
+	}
+	return rm, nil
+}
+
+// addChoicePreviews sets the plain-text preview of each choice
+func addChoicePreviews(choices []RestChoiceModel) {
+	for i := range choices {
+		choices[i].Preview = message.Preview(choices[i].Text.Default)
+	}
+}
+
 // TransformState converts a StateModel to a RestStateModel
 func TransformState(m StateModel) (RestStateModel, error) {
 	restState := RestStateModel{
@@ -306,6 +562,15 @@ func TransformState(m StateModel) (RestStateModel, error) {
 			}
 			restState.ListSelection = &restListSelection
 		}
+	case StyleSelectionType:
+		styleSelection := m.StyleSelection()
+		if styleSelection != nil {
+			restStyleSelection, err := TransformStyleSelection(*styleSelection)
+			if err != nil {
+				return RestStateModel{}, err
+			}
+			restState.StyleSelection = &restStyleSelection
+		}
 	}
 
 	return restState, nil
@@ -315,18 +580,51 @@ func TransformState(m StateModel) (RestStateModel, error) {
 func TransformDialogue(m DialogueModel) (RestDialogueModel, error) {
 	restChoices := make([]RestChoiceModel, 0, len(m.Choices()))
 	for _, choice := range m.Choices() {
-		restChoices = append(restChoices, RestChoiceModel{
-			Text:      choice.Text(),
-			NextState: choice.NextState(),
-			Context:   choice.Context(),
-		})
+		restChoices = append(restChoices, TransformChoice(choice))
 	}
 
-	return RestDialogueModel{
+	restDialogue := RestDialogueModel{
 		DialogueType: string(m.DialogueType()),
-		Text:         m.Text(),
+		Text:         localization.TransformText(m.Text()),
 		Choices:      restChoices,
-	}, nil
+		NextState:    m.NextState(),
+		OnYes:        m.OnYes(),
+		OnNo:         m.OnNo(),
+		OnExit:       m.OnExit(),
+	}
+
+	if numberInput := m.NumberInput(); numberInput != nil {
+		restDialogue.NumberInput = &RestNumberInputModel{
+			ContextKey:   numberInput.ContextKey(),
+			DefaultValue: numberInput.DefaultValue(),
+			MinValue:     numberInput.MinValue(),
+			MaxValue:     numberInput.MaxValue(),
+		}
+	}
+
+	if textInput := m.TextInput(); textInput != nil {
+		restDialogue.TextInput = &RestTextInputModel{
+			ContextKey:   textInput.ContextKey(),
+			DefaultValue: textInput.DefaultValue(),
+			MinLength:    textInput.MinLength(),
+			MaxLength:    textInput.MaxLength(),
+		}
+	}
+
+	return restDialogue, nil
+}
+
+// TransformChoice converts a ChoiceModel to a RestChoiceModel
+func TransformChoice(m ChoiceModel) RestChoiceModel {
+	restChoice := RestChoiceModel{
+		Text:      localization.TransformText(m.Text()),
+		NextState: m.NextState(),
+		Context:   m.Context(),
+	}
+	for _, condition := range m.Conditions() {
+		restChoice.Conditions = append(restChoice.Conditions, TransformCondition(condition))
+	}
+	return restChoice
 }
 
 // TransformGenericAction converts a GenericActionModel to a RestGenericActionModel
@@ -344,12 +642,7 @@ func TransformGenericAction(m GenericActionModel) (RestGenericActionModel, error
 		// Convert ConditionModel to RestConditionModel
 		restConditions := make([]RestConditionModel, 0, len(outcome.Conditions()))
 		for _, condition := range outcome.Conditions() {
-			restConditions = append(restConditions, RestConditionModel{
-				Type:     condition.Type(),
-				Operator: condition.Operator(),
-				Value:    condition.Value(),
-				ItemId:   condition.ItemId(),
-			})
+			restConditions = append(restConditions, TransformCondition(condition))
 		}
 
 		restOutcomes = append(restOutcomes, RestOutcomeModel{
@@ -359,11 +652,29 @@ func TransformGenericAction(m GenericActionModel) (RestGenericActionModel, error
 	}
 
 	return RestGenericActionModel{
-		Operations: restOperations,
-		Outcomes:   restOutcomes,
+		Operations:      restOperations,
+		Outcomes:        restOutcomes,
+		OnSuccess:       m.OnSuccess(),
+		OnFailure:       m.OnFailure(),
+		FireAndForget:   m.FireAndForget(),
+		LocalOperations: string(m.localOperations),
 	}, nil
 }
 
+// TransformCondition converts a ConditionModel to a RestConditionModel
+func TransformCondition(m ConditionModel) RestConditionModel {
+	rc := RestConditionModel{
+		Type:     m.Type(),
+		Operator: m.Operator(),
+		Value:    m.Value(),
+		ItemId:   m.ItemId(),
+	}
+	for _, nested := range m.Conditions() {
+		rc.Conditions = append(rc.Conditions, TransformCondition(nested))
+	}
+	return rc
+}
+
 // TransformCraftAction converts a CraftActionModel to a RestCraftActionModel
 func TransformCraftAction(m CraftActionModel) (RestCraftActionModel, error) {
 	return RestCraftActionModel{
@@ -371,8 +682,12 @@ func TransformCraftAction(m CraftActionModel) (RestCraftActionModel, error) {
 		Materials:             m.Materials(),
 		Quantities:            m.Quantities(),
 		MesoCost:              m.MesoCost(),
+		OptionSetId:           m.OptionSetId(),
+		OptionContextKey:      m.OptionContextKey(),
 		StimulatorId:          m.StimulatorId(),
 		StimulatorFailChance:  m.StimulatorFailChance(),
+		SuccessState:          m.SuccessState(),
+		FailureState:          m.FailureState(),
 		MissingMaterialsState: m.MissingMaterialsState(),
 	}, nil
 }
@@ -381,16 +696,40 @@ func TransformCraftAction(m CraftActionModel) (RestCraftActionModel, error) {
 func TransformListSelection(m ListSelectionModel) (RestListSelectionModel, error) {
 	restChoices := make([]RestChoiceModel, 0, len(m.Choices()))
 	for _, choice := range m.Choices() {
-		restChoices = append(restChoices, RestChoiceModel{
-			Text:      choice.Text(),
-			NextState: choice.NextState(),
-			Context:   choice.Context(),
-		})
+		restChoices = append(restChoices, TransformChoice(choice))
 	}
 
-	return RestListSelectionModel{
-		Title:   m.Title(),
+	restListSelection := RestListSelectionModel{
+		Title:   localization.TransformText(m.Title()),
 		Choices: restChoices,
+	}
+
+	if choiceTemplate := m.ChoiceTemplate(); choiceTemplate != nil {
+		restConditions := make([]RestConditionModel, 0, len(choiceTemplate.Conditions()))
+		for _, condition := range choiceTemplate.Conditions() {
+			restConditions = append(restConditions, TransformCondition(condition))
+		}
+		restListSelection.ChoiceTemplate = &RestChoiceTemplateModel{
+			From:       choiceTemplate.From(),
+			Text:       localization.TransformText(choiceTemplate.Text()),
+			ContextKey: choiceTemplate.ContextKey(),
+			NextState:  choiceTemplate.NextState(),
+			Conditions: restConditions,
+		}
+	}
+
+	return restListSelection, nil
+}
+
+// TransformStyleSelection converts a StyleSelectionModel to a RestStyleSelectionModel
+func TransformStyleSelection(m StyleSelectionModel) (RestStyleSelectionModel, error) {
+	return RestStyleSelectionModel{
+		Text:        localization.TransformText(m.Text()),
+		Styles:      m.Styles(),
+		StylesFrom:  m.StylesFrom(),
+		ContextKey:  m.ContextKey(),
+		NextState:   m.NextState(),
+		CancelState: m.CancelState(),
 	}, nil
 }
 
@@ -435,7 +774,8 @@ func Extract(r RestModel) (Model, error) {
 	}
 
 	builder.SetNpcId(r.NpcId).
-		SetStartState(r.StartState)
+		SetStartState(r.StartState).
+		SetIdleTimeout(r.IdleTimeout)
 
 	// Extract states
 	for _, restState := range r.States {
@@ -446,6 +786,15 @@ func Extract(r RestModel) (Model, error) {
 		builder.AddState(state)
 	}
 
+	// Extract option sets
+	for _, restOptionSet := range r.OptionSets {
+		optionSet, err := ExtractOptionSet(restOptionSet)
+		if err != nil {
+			return Model{}, err
+		}
+		builder.AddOptionSet(optionSet)
+	}
+
 	return builder.Build()
 }
 
@@ -490,6 +839,15 @@ func ExtractState(r RestStateModel) (StateModel, error) {
 			return StateModel{}, err
 		}
 		stateBuilder.SetListSelection(listSelection)
+	case StyleSelectionType:
+		if r.StyleSelection == nil {
+			return StateModel{}, fmt.Errorf("styleSelection is required for styleSelection state")
+		}
+		styleSelection, err := ExtractStyleSelection(*r.StyleSelection)
+		if err != nil {
+			return StateModel{}, err
+		}
+		stateBuilder.SetStyleSelection(styleSelection)
 	default:
 		return StateModel{}, fmt.Errorf("invalid state type: %s", r.StateType)
 	}
@@ -501,7 +859,11 @@ func ExtractState(r RestStateModel) (StateModel, error) {
 func ExtractDialogue(r RestDialogueModel) (*DialogueModel, error) {
 	dialogueBuilder := NewDialogueBuilder().
 		SetDialogueType(DialogueType(r.DialogueType)).
-		SetText(r.Text)
+		SetLocalizedText(localization.ExtractText(r.Text)).
+		SetNextState(r.NextState).
+		SetOnYes(r.OnYes).
+		SetOnNo(r.OnNo).
+		SetOnExit(r.OnExit)
 
 	for _, restChoice := range r.Choices {
 		choice, err := ExtractChoice(restChoice)
@@ -511,19 +873,53 @@ func ExtractDialogue(r RestDialogueModel) (*DialogueModel, error) {
 		dialogueBuilder.AddChoice(choice)
 	}
 
+	if r.NumberInput != nil {
+		numberInput, err := NewNumberInputBuilder().
+			SetContextKey(r.NumberInput.ContextKey).
+			SetDefaultValue(r.NumberInput.DefaultValue).
+			SetMinValue(r.NumberInput.MinValue).
+			SetMaxValue(r.NumberInput.MaxValue).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		dialogueBuilder.SetNumberInput(numberInput)
+	}
+
+	if r.TextInput != nil {
+		textInput, err := NewTextInputBuilder().
+			SetContextKey(r.TextInput.ContextKey).
+			SetDefaultValue(r.TextInput.DefaultValue).
+			SetMinLength(r.TextInput.MinLength).
+			SetMaxLength(r.TextInput.MaxLength).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		dialogueBuilder.SetTextInput(textInput)
+	}
+
 	return dialogueBuilder.Build()
 }
 
 // ExtractChoice converts a RestChoiceModel to a ChoiceModel
 func ExtractChoice(r RestChoiceModel) (ChoiceModel, error) {
 	builder := NewChoiceBuilder().
-		SetText(r.Text).
+		SetLocalizedText(localization.ExtractText(r.Text)).
 		SetNextState(r.NextState)
 
 	if r.Context != nil {
 		builder.SetContext(r.Context)
 	}
 
+	for _, restCondition := range r.Conditions {
+		condition, err := ExtractCondition(restCondition)
+		if err != nil {
+			return ChoiceModel{}, err
+		}
+		builder.AddCondition(condition)
+	}
+
 	return builder.Build()
 }
 
@@ -547,6 +943,10 @@ func ExtractGenericAction(r RestGenericActionModel) (*GenericActionModel, error)
 		genericActionBuilder.AddOutcome(outcome)
 	}
 
+	genericActionBuilder.SetOnSuccess(r.OnSuccess).
+		SetOnFailure(r.OnFailure).
+		SetFireAndForget(r.FireAndForget).
+		SetLocalOperations(LocalOperationOrder(r.LocalOperations))
 	return genericActionBuilder.Build()
 }
 
@@ -563,13 +963,7 @@ func ExtractOutcome(r RestOutcomeModel) (OutcomeModel, error) {
 	outcomeBuilder := NewOutcomeBuilder()
 
 	for _, c := range r.Conditions {
-		condition, err := NewConditionBuilder().
-			SetType(c.Type).
-			SetOperator(c.Operator).
-			SetValue(c.Value).
-			SetItemId(c.ItemId).
-			Build()
-
+		condition, err := ExtractCondition(c)
 		if err != nil {
 			return OutcomeModel{}, err
 		}
@@ -584,6 +978,25 @@ func ExtractOutcome(r RestOutcomeModel) (OutcomeModel, error) {
 	return outcomeBuilder.Build()
 }
 
+// ExtractCondition converts a RestConditionModel to a ConditionModel
+func ExtractCondition(r RestConditionModel) (ConditionModel, error) {
+	builder := NewConditionBuilder().
+		SetType(r.Type).
+		SetOperator(r.Operator).
+		SetValue(r.Value).
+		SetItemId(r.ItemId)
+
+	for _, c := range r.Conditions {
+		nested, err := ExtractCondition(c)
+		if err != nil {
+			return ConditionModel{}, err
+		}
+		builder.AddCondition(nested)
+	}
+
+	return builder.Build()
+}
+
 // ExtractCraftAction converts a RestCraftActionModel to a CraftActionModel
 func ExtractCraftAction(r RestCraftActionModel) (*CraftActionModel, error) {
 	craftActionBuilder := NewCraftActionBuilder().
@@ -591,8 +1004,12 @@ func ExtractCraftAction(r RestCraftActionModel) (*CraftActionModel, error) {
 		SetMaterials(r.Materials).
 		SetQuantities(r.Quantities).
 		SetMesoCost(r.MesoCost).
+		SetOptionSetId(r.OptionSetId).
+		SetOptionContextKey(r.OptionContextKey).
 		SetStimulatorId(r.StimulatorId).
 		SetStimulatorFailChance(r.StimulatorFailChance).
+		SetSuccessState(r.SuccessState).
+		SetFailureState(r.FailureState).
 		SetMissingMaterialsState(r.MissingMaterialsState)
 
 	return craftActionBuilder.Build()
@@ -601,7 +1018,7 @@ func ExtractCraftAction(r RestCraftActionModel) (*CraftActionModel, error) {
 // ExtractListSelection converts a RestListSelectionModel to a ListSelectionModel
 func ExtractListSelection(r RestListSelectionModel) (*ListSelectionModel, error) {
 	b := NewListSelectionBuilder().
-		SetTitle(r.Title)
+		SetLocalizedTitle(localization.ExtractText(r.Title))
 
 	for _, restChoice := range r.Choices {
 		choice, err := ExtractChoice(restChoice)
@@ -611,6 +1028,44 @@ func ExtractListSelection(r RestListSelectionModel) (*ListSelectionModel, error)
 		b.AddChoice(choice)
 	}
 
+	if r.ChoiceTemplate != nil {
+		tb := NewChoiceTemplateBuilder().
+			SetFrom(r.ChoiceTemplate.From).
+			SetLocalizedText(localization.ExtractText(r.ChoiceTemplate.Text)).
+			SetContextKey(r.ChoiceTemplate.ContextKey).
+			SetNextState(r.ChoiceTemplate.NextState)
+
+		for _, restCondition := range r.ChoiceTemplate.Conditions {
+			condition, err := ExtractCondition(restCondition)
+			if err != nil {
+				return nil, err
+			}
+			tb.AddCondition(condition)
+		}
+
+		choiceTemplate, err := tb.Build()
+		if err != nil {
+			return nil, err
+		}
+		b.SetChoiceTemplate(choiceTemplate)
+	}
+
+	return b.Build()
+}
+
+// ExtractStyleSelection converts a RestStyleSelectionModel to a StyleSelectionModel
+func ExtractStyleSelection(r RestStyleSelectionModel) (*StyleSelectionModel, error) {
+	b := NewStyleSelectionBuilder().
+		SetLocalizedText(localization.ExtractText(r.Text)).
+		SetStylesFrom(r.StylesFrom).
+		SetContextKey(r.ContextKey).
+		SetNextState(r.NextState).
+		SetCancelState(r.CancelState)
+
+	for _, styleId := range r.Styles {
+		b.AddStyle(styleId)
+	}
+
 	return b.Build()
 }
 
@@ -0,0 +1,82 @@
+package conversation
+
+import (
+	"errors"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+)
+
+const (
+	// SessionStoreEnv names the environment variable selecting where conversation contexts are stored
+	SessionStoreEnv = "SESSION_STORE"
+	// SessionStoreMemory stores conversation contexts in memory, the default
+	SessionStoreMemory = "memory"
+	// SessionStorePostgres stores conversation contexts in the database, so they survive restarts and are shared
+	// between replicas
+	SessionStorePostgres = "postgres"
+)
+
+// ErrContextNotFound is returned when a character has no conversation in progress
+var ErrContextNotFound = errors.New("conversation context not found")
+
+// ErrRevisionConflict is returned when a context is stored over a context which was updated since it was read
+var ErrRevisionConflict = errors.New("conversation context was updated concurrently")
+
+// SessionStore holds the context of each conversation in progress, by tenant and character. Each stored context has a
+// revision, incremented whenever it is stored, so concurrent updates of a conversation by several replicas are detected
+// rather than overwriting each other.
+type SessionStore interface {
+	// GetPreviousContext returns the context of the character's conversation, or ErrContextNotFound
+	GetPreviousContext(t tenant.Model, characterId uint32) (ConversationContext, error)
+
+	// SetContext stores the context of the character's conversation, replacing any previous context
+	SetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error
+
+	// CompareAndSetContext stores the context of the character's conversation only if the stored context is still at
+	// the revision of the context, or no context is stored and the revision is zero. Returns ErrRevisionConflict
+	// otherwise.
+	CompareAndSetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error
+
+	// ClearContext removes the context of the character's conversation, ending it
+	ClearContext(t tenant.Model, characterId uint32) error
+
+	// CompareAndClearContext removes the context of the character's conversation only if the stored context is still
+	// at the revision. Returns ErrRevisionConflict otherwise, including when no context is stored.
+	CompareAndClearContext(t tenant.Model, characterId uint32, revision uint64) error
+
+	// GetContexts returns the contexts of every conversation in progress, by tenant
+	GetContexts() (map[tenant.Model][]ConversationContext, error)
+
+	// GetAwaitingContext returns the context of the conversation parked on the saga, or ErrContextNotFound
+	GetAwaitingContext(t tenant.Model, transactionId uuid.UUID) (ConversationContext, error)
+}
+
+var sessionStore SessionStore
+
+// InitSessionStore selects the session store named by SessionStoreEnv. It must be called before conversations are
+// started or continued.
+func InitSessionStore(l logrus.FieldLogger, db *gorm.DB) {
+	switch name := strings.ToLower(os.Getenv(SessionStoreEnv)); name {
+	case SessionStorePostgres:
+		l.Infof("Storing conversation contexts in the database.")
+		sessionStore = NewPostgresSessionStore(l, db)
+	case "", SessionStoreMemory:
+		l.Infof("Storing conversation contexts in memory.")
+		sessionStore = GetMemoryRegistry()
+	default:
+		l.Fatalf("Unknown session store [%s]. Expected [%s] or [%s].", name, SessionStoreMemory, SessionStorePostgres)
+	}
+}
+
+// GetRegistry returns the session store holding conversation contexts, in memory unless another store was selected
+// with InitSessionStore
+func GetRegistry() SessionStore {
+	if sessionStore == nil {
+		return GetMemoryRegistry()
+	}
+	return sessionStore
+}
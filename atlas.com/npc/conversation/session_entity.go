@@ -0,0 +1,351 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Chronicle20/atlas-constants/channel"
+	"github.com/Chronicle20/atlas-constants/field"
+	_map "github.com/Chronicle20/atlas-constants/map"
+	"github.com/Chronicle20/atlas-constants/world"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// SessionEntity represents the context of a conversation in progress stored in the database. The conversation itself
+// is referenced by ID and version rather than stored, and is read again when the context is.
+type SessionEntity struct {
+	TenantID            uuid.UUID `gorm:"primaryKey;column:tenant_id;type:uuid"`
+	Region              string    `gorm:"column:region;not null;default:''"`
+	MajorVersion        uint16    `gorm:"column:major_version;not null;default:0"`
+	MinorVersion        uint16    `gorm:"column:minor_version;not null;default:0"`
+	CharacterID         uint32    `gorm:"primaryKey;column:character_id;autoIncrement:false"`
+	NpcID               uint32    `gorm:"column:npc_id;not null"`
+	WorldID             byte      `gorm:"column:world_id;not null"`
+	ChannelID           byte      `gorm:"column:channel_id;not null"`
+	MapID               uint32    `gorm:"column:map_id;not null"`
+	ConversationID      uuid.UUID `gorm:"column:conversation_id;type:uuid;not null"`
+	ConversationVersion uint32    `gorm:"column:conversation_version;not null"`
+	CurrentState        string    `gorm:"column:current_state;not null"`
+	Context             string    `gorm:"column:context;type:jsonb;not null"`
+	History             string    `gorm:"column:history;type:jsonb;not null"`
+	LastActivity        time.Time `gorm:"column:last_activity;not null;default:CURRENT_TIMESTAMP"`
+	Revision            uint64    `gorm:"column:revision;not null;default:0"`
+	AwaitingSaga        uuid.UUID `gorm:"column:awaiting_saga;type:uuid;index"`
+	CreatedAt           time.Time `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt           time.Time `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// TableName returns the table name for the entity
+func (SessionEntity) TableName() string {
+	return "conversation_sessions"
+}
+
+// sessionHistoryEntry is the stored form of a HistoryEntry
+type sessionHistoryEntry struct {
+	StateId string            `json:"stateId"`
+	Context map[string]string `json:"context"`
+}
+
+// ToSessionEntity converts a conversation context of the tenant to a SessionEntity
+func ToSessionEntity(ctx ConversationContext, t tenant.Model) (SessionEntity, error) {
+	if ctx.Conversation().Id() == uuid.Nil {
+		return SessionEntity{}, errors.New("conversation has no ID")
+	}
+	contextData, err := json.Marshal(ctx.Context())
+	if err != nil {
+		return SessionEntity{}, err
+	}
+	history := make([]sessionHistoryEntry, 0, len(ctx.History()))
+	for _, entry := range ctx.History() {
+		history = append(history, sessionHistoryEntry{StateId: entry.StateId(), Context: entry.Context()})
+	}
+	historyData, err := json.Marshal(history)
+	if err != nil {
+		return SessionEntity{}, err
+	}
+
+	return SessionEntity{
+		TenantID:            t.Id(),
+		Region:              t.Region(),
+		MajorVersion:        t.MajorVersion(),
+		MinorVersion:        t.MinorVersion(),
+		CharacterID:         ctx.CharacterId(),
+		NpcID:               ctx.NpcId(),
+		WorldID:             byte(ctx.Field().WorldId()),
+		ChannelID:           byte(ctx.Field().ChannelId()),
+		MapID:               uint32(ctx.Field().MapId()),
+		ConversationID:      ctx.Conversation().Id(),
+		ConversationVersion: ctx.Conversation().Version(),
+		CurrentState:        ctx.CurrentState(),
+		Context:             string(contextData),
+		History:             string(historyData),
+		LastActivity:        ctx.LastActivity(),
+		Revision:            ctx.Revision(),
+		AwaitingSaga:        ctx.AwaitingSaga(),
+	}, nil
+}
+
+// MakeSession converts a SessionEntity to a conversation context over the conversation it references
+func MakeSession(e SessionEntity, conversation Model) (ConversationContext, error) {
+	context := make(map[string]string)
+	if err := json.Unmarshal([]byte(e.Context), &context); err != nil {
+		return ConversationContext{}, err
+	}
+	var stored []sessionHistoryEntry
+	if err := json.Unmarshal([]byte(e.History), &stored); err != nil {
+		return ConversationContext{}, err
+	}
+	history := make([]HistoryEntry, 0, len(stored))
+	for _, entry := range stored {
+		history = append(history, HistoryEntry{stateId: entry.StateId, context: entry.Context})
+	}
+
+	return NewConversationContextBuilder().
+		SetField(field.NewBuilder(world.Id(e.WorldID), channel.Id(e.ChannelID), _map.Id(e.MapID)).Build()).
+		SetCharacterId(e.CharacterID).
+		SetNpcId(e.NpcID).
+		SetCurrentState(e.CurrentState).
+		SetConversation(conversation).
+		SetContext(context).
+		SetHistory(history).
+		SetLastActivity(e.LastActivity).
+		SetRevision(e.Revision).
+		SetAwaitingSaga(e.AwaitingSaga).
+		Build()
+}
+
+// tenantOf returns the tenant a SessionEntity belongs to
+func tenantOf(e SessionEntity) (tenant.Model, error) {
+	return tenant.Create(e.TenantID, e.Region, e.MajorVersion, e.MinorVersion)
+}
+
+// GetSessionProvider returns a provider for retrieving the context of a character's conversation
+func GetSessionProvider(tenantId uuid.UUID) func(characterId uint32) func(db *gorm.DB) func() (SessionEntity, error) {
+	return func(characterId uint32) func(db *gorm.DB) func() (SessionEntity, error) {
+		return func(db *gorm.DB) func() (SessionEntity, error) {
+			return func() (SessionEntity, error) {
+				var entity SessionEntity
+				result := db.Where("tenant_id = ? AND character_id = ?", tenantId, characterId).First(&entity)
+				return entity, result.Error
+			}
+		}
+	}
+}
+
+// GetAwaitingSessionProvider returns a provider for retrieving the context of the conversation parked on a saga
+func GetAwaitingSessionProvider(tenantId uuid.UUID) func(transactionId uuid.UUID) func(db *gorm.DB) func() (SessionEntity, error) {
+	return func(transactionId uuid.UUID) func(db *gorm.DB) func() (SessionEntity, error) {
+		return func(db *gorm.DB) func() (SessionEntity, error) {
+			return func() (SessionEntity, error) {
+				var entity SessionEntity
+				result := db.Where("tenant_id = ? AND awaiting_saga = ?", tenantId, transactionId).First(&entity)
+				return entity, result.Error
+			}
+		}
+	}
+}
+
+// GetAllSessionsProvider returns a provider for retrieving the contexts of every conversation in progress, of every
+// tenant
+func GetAllSessionsProvider(db *gorm.DB) func() ([]SessionEntity, error) {
+	return func() ([]SessionEntity, error) {
+		var entities []SessionEntity
+		result := db.Find(&entities)
+		return entities, result.Error
+	}
+}
+
+// MigrateSessionTable creates or updates the conversation_sessions table
+func MigrateSessionTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SessionEntity{})
+}
+
+// PostgresSessionStore is a SessionStore holding conversation contexts in the database, so conversations survive
+// restarts and may be continued by any replica
+type PostgresSessionStore struct {
+	l  logrus.FieldLogger
+	db *gorm.DB
+}
+
+// NewPostgresSessionStore creates a session store over the database
+func NewPostgresSessionStore(l logrus.FieldLogger, db *gorm.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{l: l, db: db}
+}
+
+// GetPreviousContext returns the context of the character's conversation. The conversation is read at its latest
+// version; when it was updated since the conversation started, the context is kept only if its state still exists.
+// Contexts of conversations which were deleted, or no longer have the state, are cleared.
+func (s *PostgresSessionStore) GetPreviousContext(t tenant.Model, characterId uint32) (ConversationContext, error) {
+	e, err := GetSessionProvider(t.Id())(characterId)(s.db)()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ConversationContext{}, ErrContextNotFound
+	}
+	if err != nil {
+		return ConversationContext{}, err
+	}
+
+	conversation, err := model.Map[Entity, Model](Make)(GetByIdProvider(t.Id())(e.ConversationID)(s.db))()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.l.Warnf("Conversation [%s] was deleted while character [%d] was in it. Clearing conversation context.", e.ConversationID, characterId)
+		return ConversationContext{}, s.clearStale(t, characterId)
+	}
+	if err != nil {
+		return ConversationContext{}, fmt.Errorf("unable to read conversation [%s] of character [%d]: %w", e.ConversationID, characterId, err)
+	}
+	if conversation.Version() != e.ConversationVersion {
+		if _, err = conversation.FindState(e.CurrentState); err != nil {
+			s.l.Warnf("Conversation [%s] was updated from version [%d] to [%d] and no longer has state [%s] of character [%d]. Clearing conversation context.", e.ConversationID, e.ConversationVersion, conversation.Version(), e.CurrentState, characterId)
+			return ConversationContext{}, s.clearStale(t, characterId)
+		}
+		s.l.Warnf("Conversation [%s] was updated from version [%d] to [%d] while character [%d] was in it. Continuing with the latest version.", e.ConversationID, e.ConversationVersion, conversation.Version(), characterId)
+	}
+	return MakeSession(e, conversation)
+}
+
+// clearStale clears a context which can no longer be continued, reporting it as not found
+func (s *PostgresSessionStore) clearStale(t tenant.Model, characterId uint32) error {
+	if err := s.ClearContext(t, characterId); err != nil {
+		return err
+	}
+	return ErrContextNotFound
+}
+
+// sessionColumns are the columns of a SessionEntity replaced when a context is stored
+var sessionColumns = []string{
+	"region", "major_version", "minor_version", "npc_id", "world_id", "channel_id", "map_id", "conversation_id", "conversation_version", "current_state", "context", "history", "last_activity", "awaiting_saga", "updated_at",
+}
+
+// SetContext stores the context of the character's conversation, replacing any previous context
+func (s *PostgresSessionStore) SetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error {
+	e, err := ToSessionEntity(ctx, t)
+	if err != nil {
+		return err
+	}
+	e.CharacterID = characterId
+	e.Revision = 1
+	e.UpdatedAt = time.Now()
+
+	updates := clause.AssignmentColumns(sessionColumns)
+	updates = append(updates, clause.Assignment{Column: clause.Column{Name: "revision"}, Value: gorm.Expr("conversation_sessions.revision + 1")})
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "character_id"}},
+		DoUpdates: updates,
+	}).Create(&e)
+	if result.Error != nil {
+		s.l.WithError(result.Error).Errorf("Failed to store conversation context for character [%d].", characterId)
+	}
+	return result.Error
+}
+
+// CompareAndSetContext stores the context of the character's conversation only if the stored context is still at the
+// revision of the context. A context with revision zero is only stored if the character has no conversation.
+func (s *PostgresSessionStore) CompareAndSetContext(t tenant.Model, characterId uint32, ctx ConversationContext) error {
+	e, err := ToSessionEntity(ctx, t)
+	if err != nil {
+		return err
+	}
+	e.CharacterID = characterId
+	e.Revision = ctx.Revision() + 1
+	e.UpdatedAt = time.Now()
+
+	var result *gorm.DB
+	if ctx.Revision() == 0 {
+		result = s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&e)
+	} else {
+		result = s.db.Model(&SessionEntity{}).
+			Where("tenant_id = ? AND character_id = ? AND revision = ?", t.Id(), characterId, ctx.Revision()).
+			Select(append(sessionColumns, "revision")).
+			Updates(&e)
+	}
+	if result.Error != nil {
+		s.l.WithError(result.Error).Errorf("Failed to store conversation context for character [%d].", characterId)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
+// GetContexts returns the contexts of every conversation in progress, by tenant. Conversations are read at their
+// latest version; the context of a deleted conversation references a conversation with only its ID. A context which
+// cannot be read is logged and skipped, so it does not stop the others from being swept.
+func (s *PostgresSessionStore) GetContexts() (map[tenant.Model][]ConversationContext, error) {
+	entities, err := GetAllSessionsProvider(s.db)()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := make(map[uuid.UUID]Model)
+	contexts := make(map[tenant.Model][]ConversationContext)
+	for _, e := range entities {
+		t, err := tenantOf(e)
+		if err != nil {
+			s.l.WithError(err).Errorf("Unable to read tenant [%s] of character [%d].", e.TenantID, e.CharacterID)
+			continue
+		}
+		conversation, ok := conversations[e.ConversationID]
+		if !ok {
+			conversation, err = model.Map[Entity, Model](Make)(GetByIdProvider(t.Id())(e.ConversationID)(s.db))()
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				conversation, err = Model{id: e.ConversationID}, nil
+			}
+			if err != nil {
+				s.l.WithError(err).Errorf("Unable to read conversation [%s] of character [%d].", e.ConversationID, e.CharacterID)
+				continue
+			}
+			conversations[e.ConversationID] = conversation
+		}
+		ctx, err := MakeSession(e, conversation)
+		if err != nil {
+			s.l.WithError(err).Errorf("Unable to read conversation context of character [%d].", e.CharacterID)
+			continue
+		}
+		contexts[t] = append(contexts[t], ctx)
+	}
+	return contexts, nil
+}
+
+// GetAwaitingContext returns the context of the conversation parked on the saga
+func (s *PostgresSessionStore) GetAwaitingContext(t tenant.Model, transactionId uuid.UUID) (ConversationContext, error) {
+	if transactionId == uuid.Nil {
+		return ConversationContext{}, ErrContextNotFound
+	}
+	e, err := GetAwaitingSessionProvider(t.Id())(transactionId)(s.db)()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ConversationContext{}, ErrContextNotFound
+	}
+	if err != nil {
+		return ConversationContext{}, err
+	}
+	return s.GetPreviousContext(t, e.CharacterID)
+}
+
+// CompareAndClearContext removes the context of the character's conversation only if the stored context is still at
+// the revision, so exactly one of several replicas clearing the same context removes it
+func (s *PostgresSessionStore) CompareAndClearContext(t tenant.Model, characterId uint32, revision uint64) error {
+	result := s.db.Where("tenant_id = ? AND character_id = ? AND revision = ?", t.Id(), characterId, revision).Delete(&SessionEntity{})
+	if result.Error != nil {
+		s.l.WithError(result.Error).Errorf("Failed to clear conversation context for character [%d].", characterId)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
+// ClearContext removes the context of the character's conversation
+func (s *PostgresSessionStore) ClearContext(t tenant.Model, characterId uint32) error {
+	result := s.db.Where("tenant_id = ? AND character_id = ?", t.Id(), characterId).Delete(&SessionEntity{})
+	if result.Error != nil {
+		s.l.WithError(result.Error).Errorf("Failed to clear conversation context for character [%d].", characterId)
+	}
+	return result.Error
+}
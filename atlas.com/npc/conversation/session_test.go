@@ -0,0 +1,393 @@
+package conversation
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Helper function to create a conversation context at a state of a stored conversation
+func createTestSessionContext(t *testing.T, characterId uint32, stateId string) ConversationContext {
+	state, err := NewStateBuilder().SetId(stateId).SetDialogue(&DialogueModel{dialogueType: SendOk}).Build()
+	require.NoError(t, err)
+	conversation, err := NewBuilder().SetId(uuid.New()).SetNpcId(9010000).SetStartState(stateId).AddState(state).Build()
+	require.NoError(t, err)
+	conversation.version = 3
+
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(9010000).
+		SetCurrentState(stateId).
+		SetConversation(conversation).
+		AddContextValue("itemId", "4000000").
+		PushHistory("greet", map[string]string{"visited": "true"}).
+		Build()
+	require.NoError(t, err)
+	return ctx
+}
+
+// testSessionStore checks the behavior every SessionStore must provide. Conversations of the contexts are stored
+// with save, which returns the conversation as the store reads it back.
+func testSessionStore(t *testing.T, store SessionStore, save func(t *testing.T, tm tenant.Model, m Model) Model) {
+	first, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	second, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	characterId := uint32(12345)
+	newContext := func(tm tenant.Model, characterId uint32, stateId string) ConversationContext {
+		ctx := createTestSessionContext(t, characterId, stateId)
+		ctx.conversation = save(t, tm, ctx.conversation)
+		return ctx
+	}
+
+	_, err = store.GetPreviousContext(first, characterId)
+	assert.ErrorIs(t, err, ErrContextNotFound)
+
+	ctx := newContext(first, characterId, "start")
+	require.NoError(t, store.SetContext(first, characterId, ctx))
+	stored, err := store.GetPreviousContext(first, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stored.Revision(), "storing a context increments its revision")
+	ctx.revision = stored.Revision()
+	assert.Equal(t, ctx, stored)
+
+	_, err = store.GetPreviousContext(second, characterId)
+	assert.ErrorIs(t, err, ErrContextNotFound, "contexts are stored per tenant")
+
+	replaced := newContext(first, characterId, "next")
+	require.NoError(t, store.SetContext(first, characterId, replaced))
+	stored, err = store.GetPreviousContext(first, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "next", stored.CurrentState())
+	assert.Equal(t, uint64(2), stored.Revision())
+
+	stale := newContext(first, characterId, "stale")
+	stale.revision = 1
+	assert.ErrorIs(t, store.CompareAndSetContext(first, characterId, stale), ErrRevisionConflict, "contexts read before the latest update are not stored")
+	stale.revision = 0
+	assert.ErrorIs(t, store.CompareAndSetContext(first, characterId, stale), ErrRevisionConflict, "new contexts are not stored over a conversation in progress")
+	stale.revision = stored.Revision()
+	require.NoError(t, store.CompareAndSetContext(first, characterId, stale))
+	stored, err = store.GetPreviousContext(first, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "stale", stored.CurrentState())
+	assert.Equal(t, uint64(3), stored.Revision())
+
+	other := newContext(second, characterId+1, "start")
+	require.NoError(t, store.SetContext(second, characterId+1, other))
+	contexts, err := store.GetContexts()
+	require.NoError(t, err)
+	require.Len(t, contexts[first], 1)
+	assert.Equal(t, "stale", contexts[first][0].CurrentState())
+	require.Len(t, contexts[second], 1)
+	assert.Equal(t, characterId+1, contexts[second][0].CharacterId())
+
+	transactionId := uuid.New()
+	parked, err := NewConversationContextBuilder().
+		SetField(stored.Field()).
+		SetCharacterId(characterId).
+		SetNpcId(stored.NpcId()).
+		SetCurrentState(stored.CurrentState()).
+		SetConversation(stored.Conversation()).
+		SetAwaitingSaga(transactionId).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, store.SetContext(first, characterId, parked))
+	awaiting, err := store.GetAwaitingContext(first, transactionId)
+	require.NoError(t, err)
+	assert.Equal(t, characterId, awaiting.CharacterId())
+	assert.Equal(t, transactionId, awaiting.AwaitingSaga())
+	_, err = store.GetAwaitingContext(second, transactionId)
+	assert.ErrorIs(t, err, ErrContextNotFound, "sagas are awaited per tenant")
+	_, err = store.GetAwaitingContext(first, uuid.New())
+	assert.ErrorIs(t, err, ErrContextNotFound)
+
+	require.NoError(t, store.ClearContext(first, characterId))
+	_, err = store.GetPreviousContext(first, characterId)
+	assert.ErrorIs(t, err, ErrContextNotFound)
+	assert.NoError(t, store.ClearContext(first, characterId), "clearing a missing context is not an error")
+
+	started := newContext(first, characterId, "start")
+	require.NoError(t, store.CompareAndSetContext(first, characterId, started), "new contexts are stored when no conversation is in progress")
+	stored, err = store.GetPreviousContext(first, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stored.Revision())
+}
+
+func TestRegistry_SessionStore(t *testing.T) {
+	testSessionStore(t, initRegistry(), func(_ *testing.T, _ tenant.Model, m Model) Model { return m })
+}
+
+// sessionStoreTestDSNEnv names the environment variable holding the DSN of a Postgres database to run the session
+// store tests against. The tests are skipped when it is not set.
+const sessionStoreTestDSNEnv = "SESSION_STORE_TEST_DSN"
+
+// createTestPostgresDB connects to the database of sessionStoreTestDSNEnv and migrates the conversation and session
+// tables, skipping the test when no database is configured
+func createTestPostgresDB(t *testing.T) *gorm.DB {
+	dsn, ok := os.LookupEnv(sessionStoreTestDSNEnv)
+	if !ok || dsn == "" {
+		t.Skipf("%s is not set", sessionStoreTestDSNEnv)
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, MigrateTable(db))
+	require.NoError(t, MigrateSessionTable(db))
+	return db
+}
+
+// saveTestConversation stores the conversation for the tenant and returns it as read back from the database
+func saveTestConversation(db *gorm.DB) func(t *testing.T, tm tenant.Model, m Model) Model {
+	return func(t *testing.T, tm tenant.Model, m Model) Model {
+		e, err := ToEntity(m, tm.Id())
+		require.NoError(t, err)
+		require.NoError(t, db.Create(&e).Error)
+		stored, err := model.Map[Entity, Model](Make)(GetByIdProvider(tm.Id())(e.ID)(db))()
+		require.NoError(t, err)
+		return stored
+	}
+}
+
+func TestPostgresSessionStore_SessionStore(t *testing.T) {
+	db := createTestPostgresDB(t)
+	testSessionStore(t, NewPostgresSessionStore(logrus.New(), db), saveTestConversation(db))
+}
+
+func TestPostgresSessionStore_GetContexts_SkipsUnreadableConversations(t *testing.T) {
+	db := createTestPostgresDB(t)
+	store := NewPostgresSessionStore(logrus.New(), db)
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+
+	readable := createTestSessionContext(t, 12345, "start")
+	readable.conversation = saveTestConversation(db)(t, tm, readable.conversation)
+	require.NoError(t, store.SetContext(tm, 12345, readable))
+
+	unreadable := createTestSessionContext(t, 12346, "start")
+	e, err := ToEntity(unreadable.conversation, tm.Id())
+	require.NoError(t, err)
+	e.Data = "[]"
+	require.NoError(t, db.Create(&e).Error)
+	require.NoError(t, store.SetContext(tm, 12346, unreadable))
+	t.Cleanup(func() {
+		_ = store.ClearContext(tm, 12345)
+		_ = store.ClearContext(tm, 12346)
+	})
+
+	contexts, err := store.GetContexts()
+	require.NoError(t, err, "an unreadable conversation does not stop the sweep")
+	require.Len(t, contexts[tm], 1)
+	assert.Equal(t, uint32(12345), contexts[tm][0].CharacterId())
+}
+
+// slowStore is a session store which pauses after reading a context, so concurrent updates of one conversation
+// interleave between reading and storing the context
+type slowStore struct {
+	*Registry
+}
+
+func (s *slowStore) GetPreviousContext(t tenant.Model, characterId uint32) (ConversationContext, error) {
+	ctx, err := s.Registry.GetPreviousContext(t, characterId)
+	time.Sleep(time.Millisecond)
+	return ctx, err
+}
+
+// Test concurrent responses of one character, such as ones processed by several replicas, are all kept
+func TestProcessor_ConcurrentContinue(t *testing.T) {
+	defer func() { sessionStore = nil }()
+	sessionStore = &slowStore{Registry: initRegistry()}
+
+	const responses = 4
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+
+	builder := NewDialogueBuilder().SetDialogueType(SendSimple).SetText("Pick")
+	for i := 0; i < responses; i++ {
+		choice, err := NewChoiceBuilder().SetText(fmt.Sprintf("Choice %d", i)).SetNextState("menu").AddContextValue(fmt.Sprintf("picked%d", i), "true").Build()
+		require.NoError(t, err)
+		builder.AddChoice(choice)
+	}
+	dialogue, err := builder.Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId("menu").SetDialogue(dialogue).Build()
+	require.NoError(t, err)
+	conversation, err := NewBuilder().SetId(uuid.New()).SetNpcId(npcId).SetStartState("menu").AddState(state).Build()
+	require.NoError(t, err)
+
+	for round := 0; round < 5; round++ {
+		tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+		require.NoError(t, err)
+		ctx, err := NewConversationContextBuilder().
+			SetField(createTestField()).
+			SetCharacterId(characterId).
+			SetNpcId(npcId).
+			SetCurrentState("menu").
+			SetConversation(conversation).
+			Build()
+		require.NoError(t, err)
+		require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+		processor := createTestProcessor(t, new(MockOperationExecutor), new(MockEvaluator), tm)
+		start := make(chan struct{})
+		errs := make(chan error, responses)
+		var wg sync.WaitGroup
+		for i := 0; i < responses; i++ {
+			wg.Add(1)
+			go func(selection int32) {
+				defer wg.Done()
+				<-start
+				errs <- processor.Continue(npcId, characterId, 1, 4, selection, "")
+			}(int32(i))
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		stored, err := GetRegistry().GetPreviousContext(tm, characterId)
+		require.NoError(t, err)
+		assert.Equal(t, "menu", stored.CurrentState())
+		for i := 0; i < responses; i++ {
+			assert.Equal(t, "true", stored.Context()[fmt.Sprintf("picked%d", i)], "response [%d] of round [%d] was lost", i, round)
+		}
+		// Each response stores the context once when applied, and once when the menu is shown again
+		assert.Equal(t, uint64(1+2*responses), stored.Revision())
+		require.NoError(t, GetRegistry().ClearContext(tm, characterId))
+	}
+}
+
+// barrierStore is a session store whose first reads wait for each other, so concurrent updates of one conversation
+// all read it before any of them stores it
+type barrierStore struct {
+	*Registry
+	lock    sync.Mutex
+	readers int
+	arrived *sync.WaitGroup
+}
+
+func newBarrierStore(readers int) *barrierStore {
+	arrived := &sync.WaitGroup{}
+	arrived.Add(readers)
+	return &barrierStore{Registry: initRegistry(), readers: readers, arrived: arrived}
+}
+
+func (s *barrierStore) GetPreviousContext(t tenant.Model, characterId uint32) (ConversationContext, error) {
+	ctx, err := s.Registry.GetPreviousContext(t, characterId)
+	s.lock.Lock()
+	waiting := s.readers > 0
+	s.readers--
+	s.lock.Unlock()
+	if waiting {
+		s.arrived.Done()
+		s.arrived.Wait()
+	}
+	return ctx, err
+}
+
+// Test a response raced by another response is dropped once the conversation moved on, rather than answering a
+// dialogue the player never saw
+func TestProcessor_ConcurrentContinue_MovedOn(t *testing.T) {
+	defer func() { sessionStore = nil }()
+	sessionStore = newBarrierStore(2)
+
+	characterId := uint32(12345)
+	npcId := uint32(9010000)
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+
+	builder := NewBuilder().SetId(uuid.New()).SetNpcId(npcId).SetStartState("a")
+	for _, ids := range [][2]string{{"a", "b"}, {"b", "c"}} {
+		dialogue, err := NewDialogueBuilder().SetDialogueType(SendNext).SetText(ids[0]).SetNextState(ids[1]).Build()
+		require.NoError(t, err)
+		state, err := NewStateBuilder().SetId(ids[0]).SetDialogue(dialogue).Build()
+		require.NoError(t, err)
+		builder.AddState(state)
+	}
+	dialogue, err := NewDialogueBuilder().SetDialogueType(SendOk).SetText("c").Build()
+	require.NoError(t, err)
+	state, err := NewStateBuilder().SetId("c").SetDialogue(dialogue).Build()
+	require.NoError(t, err)
+	conversation, err := builder.AddState(state).Build()
+	require.NoError(t, err)
+
+	ctx, err := NewConversationContextBuilder().
+		SetField(createTestField()).
+		SetCharacterId(characterId).
+		SetNpcId(npcId).
+		SetCurrentState("a").
+		SetConversation(conversation).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, GetRegistry().SetContext(tm, characterId, ctx))
+
+	processor := createTestProcessor(t, new(MockOperationExecutor), new(MockEvaluator), tm)
+	errs := make(chan error, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- processor.Continue(npcId, characterId, 1, 0, 0, "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	stored, err := GetRegistry().GetPreviousContext(tm, characterId)
+	require.NoError(t, err)
+	assert.Equal(t, "b", stored.CurrentState(), "the second response answered state a, so it must not advance past state b")
+}
+
+func TestSessionEntity_RoundTrip(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx := createTestSessionContext(t, 12345, "start")
+	ctx.revision = 7
+
+	e, err := ToSessionEntity(ctx, tm)
+	require.NoError(t, err)
+	assert.Equal(t, tm.Id(), e.TenantID)
+	assert.Equal(t, uint64(7), e.Revision)
+	restoredTenant, err := tenantOf(e)
+	require.NoError(t, err)
+	assert.Equal(t, tm, restoredTenant)
+	assert.Equal(t, ctx.Conversation().Id(), e.ConversationID)
+	assert.Equal(t, uint32(3), e.ConversationVersion)
+
+	restored, err := MakeSession(e, ctx.Conversation())
+	require.NoError(t, err)
+	assert.Equal(t, ctx, restored)
+
+	_, err = ToSessionEntity(ConversationContext{characterId: 12345}, tm)
+	assert.Error(t, err, "contexts must reference a stored conversation")
+}
+
+func TestInitSessionStore(t *testing.T) {
+	defer func() { sessionStore = nil }()
+	l := logrus.New()
+
+	t.Setenv(SessionStoreEnv, "")
+	InitSessionStore(l, nil)
+	assert.IsType(t, &Registry{}, GetRegistry())
+
+	t.Setenv(SessionStoreEnv, "Postgres")
+	InitSessionStore(l, nil)
+	assert.IsType(t, &PostgresSessionStore{}, GetRegistry())
+}
@@ -0,0 +1,173 @@
+package conversation
+
+import (
+	npc2 "atlas-npc-conversations/kafka/message/npc"
+	"atlas-npc-conversations/kafka/producer"
+	"atlas-npc-conversations/npc"
+	"context"
+	"errors"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// IdleTimeoutEnv names the environment variable holding the seconds a character may leave a conversation
+	// unanswered before it is ended, unless the conversation sets its own idle timeout. Zero disables the timeout.
+	IdleTimeoutEnv = "CONVERSATION_IDLE_TIMEOUT"
+	// DefaultIdleTimeout is used when IdleTimeoutEnv is not set
+	DefaultIdleTimeout = 5 * time.Minute
+	// SagaTimeoutEnv names the environment variable holding the seconds a conversation may await a saga before it is
+	// ended, in case the saga's status event is lost. Zero disables the timeout.
+	SagaTimeoutEnv = "CONVERSATION_SAGA_TIMEOUT"
+	// DefaultSagaTimeout is used when SagaTimeoutEnv is not set
+	DefaultSagaTimeout = 15 * time.Minute
+	// SweepIntervalEnv names the environment variable holding the seconds between sweeps for idle conversations
+	SweepIntervalEnv = "CONVERSATION_SWEEP_INTERVAL"
+	// DefaultSweepInterval is used when SweepIntervalEnv is not set
+	DefaultSweepInterval = 30 * time.Second
+)
+
+// TimeoutHandler is notified of each conversation ended for being idle, after its context is cleared
+type TimeoutHandler func(t tenant.Model, ctx ConversationContext, idle time.Duration)
+
+// Sweeper ends conversations left unanswered for longer than their idle timeout, so an abandoned dialogue does not
+// hold the character's conversation context forever. Conversations awaiting a saga are ended after the longer saga
+// timeout instead, so one whose saga status event is lost is not parked forever.
+type Sweeper struct {
+	l           logrus.FieldLogger
+	store       SessionStore
+	timeout     time.Duration
+	sagaTimeout time.Duration
+	onTimeout   TimeoutHandler
+}
+
+// NewSweeper creates a sweeper over the store. The timeout applies to conversations which do not set their own, and
+// the saga timeout to conversations awaiting a saga.
+func NewSweeper(l logrus.FieldLogger, store SessionStore, timeout time.Duration, sagaTimeout time.Duration, onTimeout TimeoutHandler) *Sweeper {
+	return &Sweeper{
+		l:           l,
+		store:       store,
+		timeout:     timeout,
+		sagaTimeout: sagaTimeout,
+		onTimeout:   onTimeout,
+	}
+}
+
+// IdleTimeout returns how long the conversation may be left unanswered, or await its saga, or zero if it never times
+// out
+func (s *Sweeper) IdleTimeout(ctx ConversationContext) time.Duration {
+	if ctx.AwaitingSaga() != uuid.Nil {
+		return s.sagaTimeout
+	}
+	if seconds := ctx.Conversation().IdleTimeout(); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return s.timeout
+}
+
+// expired returns true if the conversation has been idle for longer than its idle timeout at the given time
+func (s *Sweeper) expired(ctx ConversationContext, now time.Time) bool {
+	timeout := s.IdleTimeout(ctx)
+	return timeout > 0 && now.Sub(ctx.LastActivity()) > timeout
+}
+
+// Sweep ends every conversation idle for longer than its idle timeout at the given time, returning how many were
+// ended. A context is only cleared if it is still at the revision read, so a conversation which advanced during the
+// sweep is kept, and of several replicas sweeping the same store only the one clearing a context notifies its end.
+// Conversations awaiting a saga are kept until the saga resumes them or the saga timeout passes.
+func (s *Sweeper) Sweep(now time.Time) (int, error) {
+	contexts, err := s.store.GetContexts()
+	if err != nil {
+		return 0, err
+	}
+
+	ended := 0
+	for t, tcs := range contexts {
+		for _, ctx := range tcs {
+			if !s.expired(ctx, now) {
+				continue
+			}
+			err = s.store.CompareAndClearContext(t, ctx.CharacterId(), ctx.Revision())
+			if errors.Is(err, ErrRevisionConflict) {
+				s.l.Debugf("Conversation of character [%d] changed while it was swept. Keeping it.", ctx.CharacterId())
+				continue
+			}
+			if err != nil {
+				s.l.WithError(err).Errorf("Failed to clear idle conversation context for character [%d].", ctx.CharacterId())
+				continue
+			}
+			ended++
+			idle := now.Sub(ctx.LastActivity())
+			s.l.Debugf("Ended conversation with NPC [%d] for character [%d] after [%s] idle.", ctx.NpcId(), ctx.CharacterId(), idle)
+			if s.onTimeout != nil {
+				s.onTimeout(t, ctx, idle)
+			}
+		}
+	}
+	return ended, nil
+}
+
+// Run sweeps at the interval until the context is cancelled
+func (s *Sweeper) Run(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if _, err := s.Sweep(now); err != nil {
+					s.l.WithError(err).Errorf("Failed to sweep idle conversations.")
+				}
+			}
+		}
+	}()
+}
+
+// disposeTimedOut disposes the client of a character whose conversation timed out and emits a timed out event
+func disposeTimedOut(l logrus.FieldLogger) TimeoutHandler {
+	return func(t tenant.Model, ctx ConversationContext, idle time.Duration) {
+		tctx := tenant.WithContext(context.Background(), t)
+		npc.NewProcessor(l, tctx).Dispose(ctx.Field().WorldId(), ctx.Field().ChannelId(), ctx.CharacterId())
+		err := producer.ProviderImpl(l)(tctx)(npc2.EnvEventTopicConversationStatus)(timedOutEventProvider(ctx, idle))
+		if err != nil {
+			l.WithError(err).Errorf("Failed to emit timed out event for character [%d].", ctx.CharacterId())
+		}
+	}
+}
+
+// durationFromEnv reads a number of seconds from the environment variable, or returns the default if it is not set
+// or invalid
+func durationFromEnv(l logrus.FieldLogger, name string, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		l.WithError(err).Warnf("Invalid [%s] value [%s]. Using [%s].", name, value, def)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// InitSweeper starts sweeping the session store for idle conversations until the context is cancelled. The idle
+// timeout, saga timeout and sweep interval are read from IdleTimeoutEnv, SagaTimeoutEnv and SweepIntervalEnv.
+func InitSweeper(l logrus.FieldLogger, ctx context.Context, wg *sync.WaitGroup) {
+	timeout := durationFromEnv(l, IdleTimeoutEnv, DefaultIdleTimeout)
+	sagaTimeout := durationFromEnv(l, SagaTimeoutEnv, DefaultSagaTimeout)
+	interval := durationFromEnv(l, SweepIntervalEnv, DefaultSweepInterval)
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	l.Infof("Ending conversations idle for longer than [%s], or awaiting a saga for longer than [%s], sweeping every [%s].", timeout, sagaTimeout, interval)
+	NewSweeper(l, GetRegistry(), timeout, sagaTimeout, disposeTimedOut(l)).Run(ctx, wg, interval)
+}
@@ -0,0 +1,218 @@
+package conversation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a conversation context last advanced at the given time
+func createIdleContext(t *testing.T, characterId uint32, idleTimeout uint32, lastActivity time.Time) ConversationContext {
+	ctx := createTestSessionContext(t, characterId, "start")
+	conversation := ctx.Conversation()
+	conversation.idleTimeout = idleTimeout
+
+	idle, err := NewConversationContextBuilder().
+		SetField(ctx.Field()).
+		SetCharacterId(characterId).
+		SetNpcId(ctx.NpcId()).
+		SetCurrentState(ctx.CurrentState()).
+		SetConversation(conversation).
+		SetLastActivity(lastActivity).
+		Build()
+	require.NoError(t, err)
+	return idle
+}
+
+// Helper function to create a conversation context parked on a saga at the given time
+func createAwaitingIdleContext(t *testing.T, characterId uint32, lastActivity time.Time) ConversationContext {
+	idle := createIdleContext(t, characterId, 0, lastActivity)
+	awaiting, err := NewConversationContextBuilder().
+		SetField(idle.Field()).
+		SetCharacterId(idle.CharacterId()).
+		SetNpcId(idle.NpcId()).
+		SetCurrentState(idle.CurrentState()).
+		SetConversation(idle.Conversation()).
+		SetLastActivity(idle.LastActivity()).
+		SetAwaitingSaga(uuid.New()).
+		Build()
+	require.NoError(t, err)
+	return awaiting
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	store := initRegistry()
+	now := time.Now()
+
+	// Idle past the global timeout
+	require.NoError(t, store.SetContext(tm, 1, createIdleContext(t, 1, 0, now.Add(-10*time.Minute))))
+	// Idle, but within the global timeout
+	require.NoError(t, store.SetContext(tm, 2, createIdleContext(t, 2, 0, now.Add(-time.Minute))))
+	// Within the global timeout, but past the conversation's own timeout
+	require.NoError(t, store.SetContext(tm, 3, createIdleContext(t, 3, 30, now.Add(-time.Minute))))
+	// Past the global timeout, but within the conversation's own timeout
+	require.NoError(t, store.SetContext(tm, 4, createIdleContext(t, 4, 3600, now.Add(-10*time.Minute))))
+
+	timedOut := make(map[uint32]time.Duration)
+	sweeper := NewSweeper(logrus.New(), store, 5*time.Minute, time.Hour, func(et tenant.Model, ctx ConversationContext, idle time.Duration) {
+		assert.Equal(t, tm, et)
+		timedOut[ctx.CharacterId()] = idle
+	})
+
+	ended, err := sweeper.Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ended)
+	assert.Equal(t, map[uint32]time.Duration{1: 10 * time.Minute, 3: time.Minute}, timedOut)
+
+	for _, characterId := range []uint32{1, 3} {
+		_, err = store.GetPreviousContext(tm, characterId)
+		assert.ErrorIs(t, err, ErrContextNotFound)
+	}
+	for _, characterId := range []uint32{2, 4} {
+		_, err = store.GetPreviousContext(tm, characterId)
+		assert.NoError(t, err)
+	}
+}
+
+func TestSweeper_NoGlobalTimeout(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	store := initRegistry()
+	now := time.Now()
+
+	require.NoError(t, store.SetContext(tm, 1, createIdleContext(t, 1, 0, now.Add(-24*time.Hour))))
+	require.NoError(t, store.SetContext(tm, 2, createIdleContext(t, 2, 60, now.Add(-2*time.Minute))))
+
+	ended, err := NewSweeper(logrus.New(), store, 0, time.Hour, nil).Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ended, "only conversations with their own timeout end when there is no global timeout")
+	_, err = store.GetPreviousContext(tm, 1)
+	assert.NoError(t, err)
+}
+
+// advancingStore is a session store whose conversation advances between the sweeper listing and clearing it
+type advancingStore struct {
+	*Registry
+	t        tenant.Model
+	advanced ConversationContext
+}
+
+func (s *advancingStore) GetContexts() (map[tenant.Model][]ConversationContext, error) {
+	contexts, err := s.Registry.GetContexts()
+	if err != nil {
+		return nil, err
+	}
+	return contexts, s.Registry.SetContext(s.t, s.advanced.CharacterId(), s.advanced)
+}
+
+func TestSweeper_KeepsAdvancedConversation(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	now := time.Now()
+	// The advanced conversation is still idle for long enough, so only its revision keeps it
+	store := &advancingStore{Registry: initRegistry(), t: tm, advanced: createIdleContext(t, 1, 0, now.Add(-time.Hour))}
+	require.NoError(t, store.SetContext(tm, 1, createIdleContext(t, 1, 0, now.Add(-time.Hour))))
+
+	timedOut := 0
+	ended, err := NewSweeper(logrus.New(), store, 5*time.Minute, time.Hour, func(tenant.Model, ConversationContext, time.Duration) {
+		timedOut++
+	}).Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ended)
+	assert.Equal(t, 0, timedOut)
+	_, err = store.Registry.GetPreviousContext(tm, 1)
+	assert.NoError(t, err)
+}
+
+// snapshotStore is a session store listing the contexts stored when it was created, as a replica which listed the
+// store before another replica swept it
+type snapshotStore struct {
+	*Registry
+	contexts map[tenant.Model][]ConversationContext
+}
+
+func (s *snapshotStore) GetContexts() (map[tenant.Model][]ConversationContext, error) {
+	return s.contexts, nil
+}
+
+func TestSweeper_EndsOnceAcrossReplicas(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	now := time.Now()
+	registry := initRegistry()
+	require.NoError(t, registry.SetContext(tm, 1, createIdleContext(t, 1, 0, now.Add(-time.Hour))))
+	contexts, err := registry.GetContexts()
+	require.NoError(t, err)
+
+	timedOut := 0
+	onTimeout := func(tenant.Model, ConversationContext, time.Duration) {
+		timedOut++
+	}
+	ended, err := NewSweeper(logrus.New(), registry, 5*time.Minute, time.Hour, onTimeout).Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ended)
+
+	ended, err = NewSweeper(logrus.New(), &snapshotStore{Registry: registry, contexts: contexts}, 5*time.Minute, time.Hour, onTimeout).Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ended, "a conversation another replica already ended is not ended again")
+	assert.Equal(t, 1, timedOut)
+}
+
+func TestSweeper_ConversationAwaitingSaga(t *testing.T) {
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	now := time.Now()
+	store := initRegistry()
+	// Parked past the idle timeout, but within the saga timeout
+	require.NoError(t, store.SetContext(tm, 1, createAwaitingIdleContext(t, 1, now.Add(-10*time.Minute))))
+	// Parked past the saga timeout, as when its status event was lost
+	require.NoError(t, store.SetContext(tm, 2, createAwaitingIdleContext(t, 2, now.Add(-2*time.Hour))))
+
+	timedOut := make(map[uint32]time.Duration)
+	ended, err := NewSweeper(logrus.New(), store, 5*time.Minute, time.Hour, func(et tenant.Model, ctx ConversationContext, idle time.Duration) {
+		timedOut[ctx.CharacterId()] = idle
+	}).Sweep(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ended)
+	assert.Equal(t, map[uint32]time.Duration{2: 2 * time.Hour}, timedOut)
+	_, err = store.GetPreviousContext(tm, 1)
+	assert.NoError(t, err)
+	_, err = store.GetPreviousContext(tm, 2)
+	assert.ErrorIs(t, err, ErrContextNotFound)
+
+	ended, err = NewSweeper(logrus.New(), store, 5*time.Minute, 0, nil).Sweep(now.Add(24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, ended, "conversations awaiting a saga are kept when there is no saga timeout")
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	l := logrus.New()
+
+	t.Setenv(IdleTimeoutEnv, "")
+	assert.Equal(t, DefaultIdleTimeout, durationFromEnv(l, IdleTimeoutEnv, DefaultIdleTimeout))
+
+	t.Setenv(IdleTimeoutEnv, "90")
+	assert.Equal(t, 90*time.Second, durationFromEnv(l, IdleTimeoutEnv, DefaultIdleTimeout))
+
+	t.Setenv(IdleTimeoutEnv, "0")
+	assert.Equal(t, time.Duration(0), durationFromEnv(l, IdleTimeoutEnv, DefaultIdleTimeout))
+
+	t.Setenv(IdleTimeoutEnv, "soon")
+	assert.Equal(t, DefaultIdleTimeout, durationFromEnv(l, IdleTimeoutEnv, DefaultIdleTimeout))
+}
+
+func TestTimedOutEventProvider(t *testing.T) {
+	ctx := createIdleContext(t, 12345, 0, time.Now())
+
+	messages, err := timedOutEventProvider(ctx, 90*time.Second)()
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.JSONEq(t, `{"worldId":1,"channelId":1,"characterId":12345,"npcId":9010000,"type":"TIMED_OUT","body":{"conversationId":"`+ctx.Conversation().Id().String()+`","stateId":"start","idleSeconds":90}}`, string(messages[0].Value))
+}
@@ -0,0 +1,102 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/expression"
+	"atlas-npc-conversations/message"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// templateFunctions are the helpers templates may call in addition to the built-in expression functions. Each emits
+// the client's message codes, so the client renders the name, image or style.
+var templateFunctions = map[string]expression.Function{
+	"itemName":    idCode(func(id uint32) string { return message.NewBuilder().ShowItemName1(id).String() }),
+	"itemImage":   idCode(func(id uint32) string { return message.NewBuilder().ShowItemImage1(id).String() }),
+	"itemIcon":    idCode(func(id uint32) string { return message.NewBuilder().ShowItemImage2(id).String() }),
+	"itemCount":   idCode(func(id uint32) string { return message.NewBuilder().ShowItemCount(id).String() }),
+	"mapName":     idCode(func(id uint32) string { return message.NewBuilder().ShowMap(id).String() }),
+	"npcName":     idCode(func(id uint32) string { return message.NewBuilder().ShowNPC(id).String() }),
+	"monsterName": idCode(func(id uint32) string { return message.NewBuilder().ShowMonsterName(id).String() }),
+	"skillImage":  idCode(func(id uint32) string { return message.NewBuilder().ShowSkillImage(id).String() }),
+	"progressBar": idCode(func(amount uint32) string { return message.NewBuilder().ShowProgressBar(amount).String() }),
+	"playerName": expression.NewFunction(0, 0, func(_ []expression.Value) (expression.Value, error) {
+		return expression.String(message.NewBuilder().ShowCharacterName().String()), nil
+	}),
+	"blue":   styledText(func(text string) string { return message.NewBuilder().BlueText().AddText(text).BlackText().String() }),
+	"red":    styledText(func(text string) string { return message.NewBuilder().RedText().AddText(text).BlackText().String() }),
+	"green":  styledText(func(text string) string { return message.NewBuilder().GreenText().AddText(text).BlackText().String() }),
+	"purple": styledText(func(text string) string { return message.NewBuilder().PurpleText().AddText(text).BlackText().String() }),
+	"bold":   styledText(func(text string) string { return message.NewBuilder().BoldText().AddText(text).NormalText().String() }),
+}
+
+// idCode creates a template function emitting the message code of an ID
+func idCode(code func(id uint32) string) expression.Function {
+	return expression.NewFunction(1, 1, func(args []expression.Value) (expression.Value, error) {
+		i, err := args[0].AsInt()
+		if err != nil {
+			return expression.Value{}, err
+		}
+		if i < 0 || i > math.MaxUint32 {
+			return expression.Value{}, fmt.Errorf("ID [%d] is out of range", i)
+		}
+		return expression.String(code(uint32(i))), nil
+	})
+}
+
+// styledText creates a template function wrapping text in message style codes
+func styledText(style func(text string) string) expression.Function {
+	return expression.NewFunction(1, 1, func(args []expression.Value) (expression.Value, error) {
+		return expression.String(style(args[0].String())), nil
+	})
+}
+
+// ParseTemplate parses text with embedded ${expression} placeholders and checks every reference names the
+// conversation context or a known character attribute
+func ParseTemplate(source string) (expression.Template, error) {
+	t, err := expression.ParseTemplate(source, templateFunctions)
+	if err != nil {
+		return expression.Template{}, err
+	}
+	for _, ref := range t.References() {
+		if err := checkReference(ref); err != nil {
+			return expression.Template{}, err
+		}
+	}
+	return t, nil
+}
+
+// checkTemplate parses a template. Placeholders without references are evaluated, so helpers given values of the
+// wrong type are caught before the text is shown.
+func checkTemplate(source string) (expression.Template, error) {
+	t, err := ParseTemplate(source)
+	if err != nil {
+		return expression.Template{}, err
+	}
+	for _, e := range t.Expressions() {
+		if len(e.References()) > 0 {
+			continue
+		}
+		if _, err := e.Evaluate(nil); err != nil {
+			return expression.Template{}, fmt.Errorf("placeholder [%s]: %w", e.Source(), err)
+		}
+	}
+	return t, nil
+}
+
+// renderTemplate renders text with embedded ${expression} placeholders. Text without placeholders is returned as
+// written without parsing.
+func renderTemplate(source string, r expression.Resolver) (string, error) {
+	if !strings.Contains(source, expression.PlaceholderOpen) {
+		return source, nil
+	}
+	t, err := ParseTemplate(source)
+	if err != nil {
+		return "", err
+	}
+	if r == nil && len(t.References()) > 0 {
+		return "", errors.New("template references cannot be resolved")
+	}
+	return t.Render(r)
+}
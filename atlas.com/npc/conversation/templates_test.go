@@ -0,0 +1,77 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/character"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	fetchContext := func() (map[string]string, error) {
+		return map[string]string{"quantity": "5", "itemId": "4000000", "mapId": "100000000"}, nil
+	}
+	fetchCharacter := func() (character.Model, error) {
+		return character.Model{}, errors.New("character should not be fetched")
+	}
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "Plain #bText#k", expected: "Plain #bText#k"},
+		{source: "You need ${context.quantity} more ${itemName(context.itemId)}", expected: "You need 5 more #t4000000#"},
+		{source: "${itemImage(4000000)} ${itemIcon(4000000)} x${itemCount(4000000)}", expected: "#v4000000# #i4000000# x#c4000000#"},
+		{source: "Welcome to ${mapName(context.mapId)}, ${playerName()}", expected: "Welcome to #m100000000#, #h #"},
+		{source: "${npcName(9010000)} ${monsterName(100100)} ${skillImage(1001)} ${progressBar(50)}", expected: "#p9010000# #o100100# #s1001# #B50#"},
+		{source: "${blue('Blue')} ${red('Red')} ${green('Green')} ${purple('Purple')} ${bold('Bold')}", expected: "#bBlue#k #rRed#k #gGreen#k #dPurple#k #eBold#n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			text, err := renderTemplate(tt.source, newExpressionResolver(fetchContext, fetchCharacter))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, text)
+		})
+	}
+}
+
+func TestRenderTemplate_Errors(t *testing.T) {
+	fetchContext := func() (map[string]string, error) {
+		return map[string]string{"name": "Maple"}, nil
+	}
+
+	_, err := renderTemplate("Level ${character.level}", newExpressionResolver(fetchContext, nil))
+	assert.Error(t, err, "character attributes are unavailable")
+	_, err = renderTemplate("Item ${itemName(context.name)}", newExpressionResolver(fetchContext, nil))
+	assert.Error(t, err, "item IDs must be integers")
+	_, err = renderTemplate("Missing ${context.missing}", newExpressionResolver(fetchContext, nil))
+	assert.Error(t, err)
+	_, err = renderTemplate("Hello ${context.name}", nil)
+	assert.Error(t, err)
+
+	text, err := renderTemplate("Constant ${1 + 1}", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Constant 2", text)
+}
+
+func TestCheckTemplate(t *testing.T) {
+	_, err := checkTemplate("Hello ${character.name}, bring ${context.quantity} ${itemName(context.itemId)}")
+	assert.NoError(t, err)
+	_, err = checkTemplate("Plain text with #bcodes#k")
+	assert.NoError(t, err)
+	_, err = checkTemplate("Hello ${character.nickname}")
+	assert.Error(t, err)
+	_, err = checkTemplate("Hello ${session.name}")
+	assert.Error(t, err)
+	_, err = checkTemplate("Hello ${unknown()}")
+	assert.Error(t, err)
+	_, err = checkTemplate("Hello ${context.name")
+	assert.Error(t, err)
+	_, err = checkTemplate("Item ${itemName('apple')}")
+	assert.Error(t, err)
+	_, err = checkTemplate("Item ${itemName(-1)}")
+	assert.Error(t, err)
+}
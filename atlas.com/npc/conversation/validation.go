@@ -0,0 +1,369 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/validator"
+	"atlas-npc-conversations/localization"
+	"atlas-npc-conversations/message"
+	"atlas-npc-conversations/validation"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jtumidanski/api2go/jsonapi"
+)
+
+// ValidateDocument validates a conversation document without persisting it. The document is checked attribute by
+// attribute, extracted through the builders and, once extracted, its graph is validated. Errors prevent the
+// conversation from being saved, warnings do not.
+func ValidateDocument(r RestModel) ([]jsonapi.Error, []jsonapi.Error) {
+	errs := make([]jsonapi.Error, 0)
+	warnings := make([]jsonapi.Error, 0)
+
+	if r.NpcId == 0 {
+		errs = append(errs, validator.NewError(validator.CodeRequired, "Missing attribute", "npcId is required", validator.AttributesPointer+"/npcId"))
+	}
+	if r.StartState == "" {
+		errs = append(errs, validator.NewError(validator.CodeRequired, "Missing attribute", "startState is required", validator.StartStatePointer))
+	}
+	if len(r.States) == 0 {
+		errs = append(errs, validator.NewError(validator.CodeRequired, "Missing attribute", "at least one state is required", validator.StatesPointer))
+	}
+
+	for i, restState := range r.States {
+		pointer := validator.StatePointer(i)
+		stateErrs, stateWarnings := validateRestState(pointer, restState)
+		warnings = append(warnings, stateWarnings...)
+		if len(stateErrs) > 0 {
+			errs = append(errs, stateErrs...)
+			continue
+		}
+		// Report what the builders reject, once the attributes themselves are sound
+		if _, err := ExtractState(restState); err != nil {
+			errs = append(errs, validator.NewError(validator.CodeInvalidState, "Invalid state", err.Error(), pointer))
+		}
+	}
+	for i, restOptionSet := range r.OptionSets {
+		if _, err := ExtractOptionSet(restOptionSet); err != nil {
+			errs = append(errs, validator.NewError(validator.CodeInvalidOptionSet, "Invalid option set", err.Error(), validator.AttributesPointer+"/optionSets/"+strconv.Itoa(i)))
+		}
+	}
+	if len(errs) > 0 {
+		return errs, warnings
+	}
+
+	m, err := Extract(r)
+	if err != nil {
+		return append(errs, validator.NewError(validator.CodeInvalidConversation, "Invalid conversation", err.Error(), validator.AttributesPointer)), warnings
+	}
+	return append(errs, Validate(m)...), warnings
+}
+
+// validateRestState checks the operations, conditions and text templates of a state
+func validateRestState(pointer string, r RestStateModel) ([]jsonapi.Error, []jsonapi.Error) {
+	errs := make([]jsonapi.Error, 0)
+	warnings := make([]jsonapi.Error, 0)
+	if r.GenericAction != nil {
+		for i, operation := range r.GenericAction.Operations {
+			operationErrs, operationWarnings := validateRestOperation(pointer+"/genericAction/operations/"+strconv.Itoa(i), operation)
+			errs = append(errs, operationErrs...)
+			warnings = append(warnings, operationWarnings...)
+		}
+		for i, outcome := range r.GenericAction.Outcomes {
+			errs = append(errs, validateRestConditions(pointer+"/genericAction/outcomes/"+strconv.Itoa(i)+"/conditions", outcome.Conditions, false)...)
+		}
+	}
+	if r.Dialogue != nil {
+		indices := make([]int, 0)
+		if r.Dialogue.DialogueType == string(SendSimple) {
+			indices = selectableIndices(r.Dialogue.Choices)
+		}
+		textErrs, textWarnings := validateRestText(pointer+"/dialogue/text", r.Dialogue.Text, false, indices)
+		errs = append(errs, textErrs...)
+		warnings = append(warnings, textWarnings...)
+		for i, choice := range r.Dialogue.Choices {
+			textErrs, textWarnings = validateRestText(pointer+"/dialogue/choices/"+strconv.Itoa(i)+"/text", choice.Text, false, []int{})
+			errs = append(errs, textErrs...)
+			warnings = append(warnings, textWarnings...)
+			errs = append(errs, validateRestConditions(pointer+"/dialogue/choices/"+strconv.Itoa(i)+"/conditions", choice.Conditions, false)...)
+		}
+	}
+	if r.ListSelection != nil {
+		// Generated choices are only known at runtime, so their indices cannot be checked
+		var indices []int
+		if r.ListSelection.ChoiceTemplate == nil {
+			indices = selectableIndices(r.ListSelection.Choices)
+		}
+		textErrs, textWarnings := validateRestText(pointer+"/listSelection/title", r.ListSelection.Title, false, indices)
+		errs = append(errs, textErrs...)
+		warnings = append(warnings, textWarnings...)
+		for i, choice := range r.ListSelection.Choices {
+			textErrs, textWarnings = validateRestText(pointer+"/listSelection/choices/"+strconv.Itoa(i)+"/text", choice.Text, false, []int{})
+			errs = append(errs, textErrs...)
+			warnings = append(warnings, textWarnings...)
+			errs = append(errs, validateRestConditions(pointer+"/listSelection/choices/"+strconv.Itoa(i)+"/conditions", choice.Conditions, false)...)
+		}
+		if r.ListSelection.ChoiceTemplate != nil {
+			textErrs, textWarnings = validateRestText(pointer+"/listSelection/choiceTemplate/text", r.ListSelection.ChoiceTemplate.Text, true, []int{})
+			errs = append(errs, textErrs...)
+			warnings = append(warnings, textWarnings...)
+			errs = append(errs, validateRestConditions(pointer+"/listSelection/choiceTemplate/conditions", r.ListSelection.ChoiceTemplate.Conditions, true)...)
+		}
+	}
+	if r.StyleSelection != nil {
+		textErrs, textWarnings := validateRestText(pointer+"/styleSelection/text", r.StyleSelection.Text, false, []int{})
+		errs = append(errs, textErrs...)
+		warnings = append(warnings, textWarnings...)
+	}
+	return errs, warnings
+}
+
+// validateRestText checks the default text and each translation of text shown to the character
+func validateRestText(pointer string, text localization.RestText, template bool, indices []int) ([]jsonapi.Error, []jsonapi.Error) {
+	if !text.Localized() {
+		return validateRestTextVariant(pointer, text.Default, template, indices)
+	}
+
+	errs := make([]jsonapi.Error, 0)
+	warnings := make([]jsonapi.Error, 0)
+	if text.Default != "" {
+		errs, warnings = validateRestTextVariant(pointer+"/default", text.Default, template, indices)
+	}
+	locales := make([]string, 0, len(text.Locales))
+	for locale := range text.Locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		localeErrs, localeWarnings := validateRestTextVariant(pointer+"/locales/"+locale, text.Locales[locale], template, indices)
+		errs = append(errs, localeErrs...)
+		warnings = append(warnings, localeWarnings...)
+	}
+	return errs, warnings
+}
+
+// validateRestTextVariant checks the placeholders of text shown to the character, then lints its message codes. List
+// items must match one of the indices, unless the indices are nil. Only choice template text may reference the option
+// namespace.
+func validateRestTextVariant(pointer string, text string, template bool, indices []int) ([]jsonapi.Error, []jsonapi.Error) {
+	t, err := checkTemplate(text)
+	if err == nil && !template {
+		err = checkOptionReferences(t.References())
+	}
+	if err != nil {
+		return []jsonapi.Error{validator.NewError(validator.CodeInvalidTemplate, "Invalid text template", err.Error(), pointer)}, nil
+	}
+
+	warnings := make([]jsonapi.Error, 0)
+	for _, issue := range message.Lint(t.Fill('0'), indices) {
+		warnings = append(warnings, validator.NewWarning(issue.Code(), "Text code problem", issue.Detail(), pointer))
+	}
+	return nil, warnings
+}
+
+// selectableIndices returns the indices of the choices which transition when selected
+func selectableIndices(choices []RestChoiceModel) []int {
+	indices := make([]int, 0)
+	for i, choice := range choices {
+		if choice.NextState != "" {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// validateRestOperation checks the operation type is known and its params match the operation descriptor
+func validateRestOperation(pointer string, r RestOperationModel) ([]jsonapi.Error, []jsonapi.Error) {
+	errs := make([]jsonapi.Error, 0)
+	warnings := make([]jsonapi.Error, 0)
+
+	descriptor, ok := FindOperationDescriptor(r.OperationType)
+	if !ok {
+		return append(errs, validator.NewError(validator.CodeUnknownOperation, "Unknown operation type", fmt.Sprintf("operation type [%s] is not supported", r.OperationType), pointer+"/type")), warnings
+	}
+
+	for _, param := range descriptor.Params() {
+		value, exists := r.Params[param.Name()]
+		if !exists {
+			if param.Required() {
+				errs = append(errs, validator.NewError(validator.CodeMissingParam, "Missing operation param", fmt.Sprintf("param [%s] is required for operation [%s]", param.Name(), r.OperationType), pointer+"/params"))
+			}
+			continue
+		}
+		if err := checkParamValue(param, value); err != nil {
+			errs = append(errs, validator.NewError(validator.CodeInvalidParam, "Invalid operation param", fmt.Sprintf("value [%s] for param [%s] is invalid: %s", value, param.Name(), err), pointer+"/params/"+param.Name()))
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range r.Params {
+		if _, ok := descriptor.FindParam(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		warnings = append(warnings, validator.NewWarning(validator.CodeUnknownParam, "Unknown operation param", fmt.Sprintf("param [%s] is ignored by operation [%s]", name, r.OperationType), pointer+"/params/"+name))
+	}
+	return errs, warnings
+}
+
+// validateRestConditions checks each condition of a tree is one the query aggregator can evaluate. Only choice
+// template conditions may reference the option namespace, or check the item of each value with OptionValueReference.
+func validateRestConditions(pointer string, conditions []RestConditionModel, template bool) []jsonapi.Error {
+	errs := make([]jsonapi.Error, 0)
+	for i, condition := range conditions {
+		conditionPointer := pointer + "/" + strconv.Itoa(i)
+		if isConditionCombinator(condition.Type) {
+			errs = append(errs, validateRestConditions(conditionPointer+"/conditions", condition.Conditions, template)...)
+			continue
+		}
+
+		// Reuse the query aggregator's rules for types, operators and item IDs
+		_, err := validation.NewConditionBuilder().
+			SetType(condition.Type).
+			SetOperator(condition.Operator).
+			FromInput(validation.ConditionInput{Type: condition.Type, Operator: condition.Operator, ItemId: condition.ItemId}).
+			Build()
+		if err != nil {
+			errs = append(errs, validator.NewError(validator.CodeInvalidCondition, "Invalid condition", err.Error(), conditionPointer))
+			continue
+		}
+		if !template && condition.ItemId == OptionValueReference {
+			errs = append(errs, validator.NewError(validator.CodeInvalidCondition, "Invalid condition", fmt.Sprintf("item ID [%s] may only be used by choice templates", condition.ItemId), conditionPointer+"/itemId"))
+		}
+		if err := checkConditionValue(condition.Value, template); err != nil {
+			errs = append(errs, validator.NewError(validator.CodeInvalidCondition, "Invalid condition", fmt.Sprintf("value [%s] is invalid: %s", condition.Value, err), conditionPointer+"/value"))
+		}
+	}
+	return errs
+}
+
+// checkConditionValue checks a condition value is an integer expression. Only choice template conditions may reference
+// the option namespace.
+func checkConditionValue(value string, template bool) error {
+	if err := checkIntegerExpression(value); err != nil {
+		return err
+	}
+	if template {
+		return nil
+	}
+	e, err := ParseExpression(value)
+	if err != nil {
+		return err
+	}
+	return checkOptionReferences(e.References())
+}
+
+// isContextReference returns true if the value references a key of the conversation context
+func isContextReference(value string) bool {
+	return strings.HasPrefix(value, contextSourcePrefix) && value != contextSourcePrefix
+}
+
+// Validate walks the conversation graph and returns a JSON:API error object for every duplicate state ID, dangling
+// reference, unreachable state, dead end and non-terminating action loop
+func Validate(m Model) []jsonapi.Error {
+	errs := validator.Validate(toGraph(m))
+
+	nonTerminating := make(map[string]bool)
+	for _, id := range NonTerminatingActionStates(m) {
+		nonTerminating[id] = true
+	}
+	for i, state := range m.States() {
+		if nonTerminating[state.Id()] {
+			errs = append(errs, validator.NewError(validator.CodeNonTerminatingLoop, "Non-terminating loop", fmt.Sprintf("action state [%s] can never reach a state waiting for the player or end the conversation", state.Id()), validator.StatePointer(i)))
+		}
+	}
+	return errs
+}
+
+// toGraph maps the conversation onto the graph walked by the validator
+func toGraph(m Model) validator.Graph {
+	states := make([]validator.State, 0, len(m.States()))
+	for _, state := range m.States() {
+		if terminalState(state) {
+			states = append(states, validator.NewTerminalState(state.Id(), stateTransitions(state)...))
+			continue
+		}
+		states = append(states, validator.NewState(state.Id(), stateTransitions(state)...))
+	}
+	return validator.NewGraph(m.StartState(), states)
+}
+
+// terminalState returns whether the state may end the conversation by design: a message the player answers with
+// buttons, such as a closing sendOk with the legacy Ok and Exit choices, an action which ends the conversation once
+// performed or a craft without a successState. A state asking the player to pick from a menu or list, whose every
+// choice ends the conversation, is a dead end.
+func terminalState(state StateModel) bool {
+	if dialogue := state.Dialogue(); dialogue != nil {
+		switch dialogue.DialogueType() {
+		case SendOk, SendNext, SendNextPrev, SendYesNo, SendAcceptDecline:
+			return true
+		}
+		return len(dialogue.Choices()) == 0 && dialogue.OnYes() == "" && dialogue.OnNo() == ""
+	}
+	return state.GenericAction() != nil || state.CraftAction() != nil
+}
+
+// stateTransitions returns every transition the state may take, with pointers relative to the state
+func stateTransitions(state StateModel) []validator.Transition {
+	transitions := make([]validator.Transition, 0)
+	if dialogue := state.Dialogue(); dialogue != nil {
+		for i, choice := range dialogue.Choices() {
+			transitions = append(transitions, validator.NewTransition("/dialogue/choices/"+strconv.Itoa(i)+"/nextState", choice.NextState()))
+		}
+		for _, transition := range []validator.Transition{
+			validator.NewTransition("/dialogue/nextState", dialogue.NextState()),
+			validator.NewTransition("/dialogue/onYes", dialogue.OnYes()),
+			validator.NewTransition("/dialogue/onNo", dialogue.OnNo()),
+		} {
+			if transition.Target() != "" {
+				transitions = append(transitions, transition)
+			}
+		}
+		// The player may always close a dialogue, which ends the conversation unless onExit is set
+		transitions = append(transitions, validator.NewTransition("/dialogue/onExit", dialogue.OnExit()))
+	}
+	if genericAction := state.GenericAction(); genericAction != nil {
+		if genericAction.OnSuccess() != "" {
+			transitions = append(transitions, validator.NewTransition("/genericAction/onSuccess", genericAction.OnSuccess()))
+		} else {
+			unconditional := false
+			for i, outcome := range genericAction.Outcomes() {
+				transitions = append(transitions, validator.NewTransition("/genericAction/outcomes/"+strconv.Itoa(i)+"/nextState", outcome.NextState()))
+				if len(outcome.Conditions()) == 0 {
+					unconditional = true
+					break
+				}
+			}
+			if !unconditional {
+				// No outcome may match, which ends the conversation
+				transitions = append(transitions, validator.NewTransition("/genericAction/outcomes", ""))
+			}
+		}
+		if genericAction.AwaitsSaga() {
+			// A failed saga ends the conversation unless onFailure is set
+			transitions = append(transitions, validator.NewTransition("/genericAction/onFailure", genericAction.OnFailure()))
+		}
+	}
+	if craftAction := state.CraftAction(); craftAction != nil {
+		transitions = append(transitions,
+			validator.NewTransition("/craftAction/successState", craftAction.SuccessState()),
+			validator.NewTransition("/craftAction/failureState", craftAction.FailureState()),
+			validator.NewTransition("/craftAction/missingMaterialsState", craftAction.MissingMaterialsState()))
+	}
+	if listSelection := state.ListSelection(); listSelection != nil {
+		for i, choice := range listSelection.Choices() {
+			transitions = append(transitions, validator.NewTransition("/listSelection/choices/"+strconv.Itoa(i)+"/nextState", choice.NextState()))
+		}
+		if choiceTemplate := listSelection.ChoiceTemplate(); choiceTemplate != nil {
+			transitions = append(transitions, validator.NewTransition("/listSelection/choiceTemplate/nextState", choiceTemplate.NextState()))
+		}
+	}
+	if styleSelection := state.StyleSelection(); styleSelection != nil {
+		transitions = append(transitions,
+			validator.NewTransition("/styleSelection/nextState", styleSelection.NextState()),
+			validator.NewTransition("/styleSelection/cancelState", styleSelection.CancelState()))
+	}
+	return transitions
+}
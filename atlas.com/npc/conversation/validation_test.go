@@ -0,0 +1,474 @@
+package conversation
+
+import (
+	"atlas-npc-conversations/conversation/validator"
+	"atlas-npc-conversations/localization"
+	"atlas-npc-conversations/message"
+	"testing"
+
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_ConversationGraph(t *testing.T) {
+	restModel := RestModel{
+		NpcId:      9010000,
+		StartState: "greeting",
+		States: []RestStateModel{
+			{
+				Id:        "greeting",
+				StateType: "dialogue",
+				Dialogue: &RestDialogueModel{
+					DialogueType: "sendYesNo",
+					Text:         localization.RestText{Default: "Would you like to refine?"},
+					OnYes:        "menu",
+					OnNo:         "farewell",
+				},
+			},
+			{
+				Id:            "menu",
+				StateType:     "listSelection",
+				ListSelection: &RestListSelectionModel{Title: localization.RestText{Default: "Pick one"}},
+			},
+			{
+				Id:        "refine",
+				StateType: "craftAction",
+				CraftAction: &RestCraftActionModel{
+					ItemId:                "4011000",
+					Materials:             []uint32{4010000},
+					Quantities:            []uint32{10},
+					SuccessState:          "greeting",
+					FailureState:          "greeting",
+					MissingMaterialsState: "noMaterials",
+				},
+			},
+		},
+	}
+
+	m, err := Extract(restModel)
+	require.NoError(t, err)
+
+	errs := Validate(m)
+	results := make([]string, 0, len(errs))
+	for _, err := range errs {
+		results = append(results, err.Code+" "+err.Source.Pointer)
+	}
+	assert.ElementsMatch(t, []string{
+		validator.CodeDanglingReference + " /data/attributes/states/0/dialogue/onNo",
+		validator.CodeDeadEnd + " /data/attributes/states/1",
+		validator.CodeDanglingReference + " /data/attributes/states/2/craftAction/missingMaterialsState",
+		validator.CodeUnreachableState + " /data/attributes/states/2",
+	}, results)
+}
+
+// Test states asking the player to choose are dead ends when every choice ends the conversation
+func TestValidate_DeadEnd(t *testing.T) {
+	restModel := RestModel{
+		NpcId:      9010000,
+		StartState: "greeting",
+		States: []RestStateModel{
+			{
+				Id:        "greeting",
+				StateType: "dialogue",
+				Dialogue: &RestDialogueModel{
+					DialogueType: "sendSimple",
+					Text:         localization.RestText{Default: "What brings you here?"},
+					Choices: []RestChoiceModel{
+						{Text: localization.RestText{Default: "Nothing"}, NextState: ""},
+						{Text: localization.RestText{Default: "Refining"}, NextState: "menu"},
+					},
+				},
+			},
+			{
+				Id:        "menu",
+				StateType: "listSelection",
+				ListSelection: &RestListSelectionModel{
+					Title: localization.RestText{Default: "Pick one"},
+					Choices: []RestChoiceModel{
+						{Text: localization.RestText{Default: "Never mind"}, NextState: ""},
+						{Text: localization.RestText{Default: "Leave"}, NextState: "farewell"},
+					},
+				},
+			},
+			{
+				Id:        "farewell",
+				StateType: "dialogue",
+				Dialogue:  &RestDialogueModel{DialogueType: "sendOk", Text: localization.RestText{Default: "Goodbye"}},
+			},
+		},
+	}
+	m, err := Extract(restModel)
+	require.NoError(t, err)
+	assert.Empty(t, Validate(m), "a closing message and a choice which ends the conversation are not dead ends")
+
+	restModel.States[1].ListSelection.Choices = restModel.States[1].ListSelection.Choices[:1]
+	m, err = Extract(restModel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		validator.CodeDeadEnd + " /data/attributes/states/1",
+		validator.CodeUnreachableState + " /data/attributes/states/2",
+	}, summarizeErrors(Validate(m)))
+}
+
+// Test a closing message in the legacy shape, such as a sendOk with Ok and Exit choices which both end the
+// conversation, is not a dead end
+func TestValidate_LegacyClosingDialogue(t *testing.T) {
+	tests := []struct {
+		dialogueType string
+		choices      []string
+	}{
+		{dialogueType: "sendOk", choices: []string{"Ok", "Exit"}},
+		{dialogueType: "sendNext", choices: []string{"Next", "Exit"}},
+		{dialogueType: "sendNextPrev", choices: []string{"Previous", "Next", "Exit"}},
+		{dialogueType: "sendYesNo", choices: []string{"Yes", "No", "Exit"}},
+		{dialogueType: "sendAcceptDecline", choices: []string{"Accept", "Decline", "Exit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialogueType, func(t *testing.T) {
+			choices := make([]RestChoiceModel, 0, len(tt.choices))
+			for _, text := range tt.choices {
+				choices = append(choices, RestChoiceModel{Text: localization.RestText{Default: text}, NextState: ""})
+			}
+			restModel := RestModel{
+				NpcId:      9010000,
+				StartState: "greeting",
+				States: []RestStateModel{
+					{
+						Id:        "greeting",
+						StateType: "dialogue",
+						Dialogue: &RestDialogueModel{
+							DialogueType: tt.dialogueType,
+							Text:         localization.RestText{Default: "Have a nice day."},
+							Choices:      choices,
+						},
+					},
+				},
+			}
+
+			m, err := Extract(restModel)
+			require.NoError(t, err)
+			assert.Empty(t, Validate(m))
+		})
+	}
+}
+
+// Helper function to create a conversation document whose only state runs the operations and takes the outcome
+func createTestActionDocument(operations []RestOperationModel, conditions []RestConditionModel) RestModel {
+	return RestModel{
+		NpcId:      9010000,
+		StartState: "reward",
+		States: []RestStateModel{
+			{
+				Id:        "reward",
+				StateType: "genericAction",
+				GenericAction: &RestGenericActionModel{
+					Operations: operations,
+					Outcomes: []RestOutcomeModel{
+						{Conditions: conditions, NextState: "done"},
+					},
+				},
+			},
+			{
+				Id:        "done",
+				StateType: "dialogue",
+				Dialogue:  &RestDialogueModel{DialogueType: "sendOk", Text: localization.RestText{Default: "Done"}},
+			},
+		},
+	}
+}
+
+// Test the states a generic action resumes at once its saga completes or fails are part of the conversation graph
+func TestValidate_AwaitedSaga(t *testing.T) {
+	restModel := createTestActionDocument([]RestOperationModel{{OperationType: "award_mesos", Params: map[string]string{"amount": "1000"}}}, nil)
+	restModel.States[0].GenericAction.Outcomes = nil
+	restModel.States[0].GenericAction.OnSuccess = "done"
+	restModel.States[0].GenericAction.OnFailure = "inventoryFull"
+
+	m, err := Extract(restModel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		validator.CodeDanglingReference + " /data/attributes/states/0/genericAction/onFailure",
+	}, summarizeErrors(Validate(m)))
+
+	restModel.States[0].GenericAction.Operations = nil
+	restModel.States[0].GenericAction.Outcomes = []RestOutcomeModel{{NextState: "done"}}
+	_, err = Extract(restModel)
+	assert.Error(t, err, "only operations may be awaited")
+}
+
+// Helper function to summarize errors as their code and pointer
+func summarizeErrors(errs []jsonapi.Error) []string {
+	results := make([]string, 0, len(errs))
+	for _, err := range errs {
+		results = append(results, err.Code+" "+err.Source.Pointer)
+	}
+	return results
+}
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []RestOperationModel
+		conditions []RestConditionModel
+		errors     []string
+		warnings   []string
+	}{
+		{
+			name:       "valid document",
+			operations: []RestOperationModel{{OperationType: "award_item", Params: map[string]string{"itemId": "2000000", "quantity": "context.quantity"}}},
+			conditions: []RestConditionModel{{Type: "meso", Operator: ">=", Value: "1000"}},
+			errors:     []string{},
+			warnings:   []string{},
+		},
+		{
+			name:       "unknown operation type",
+			operations: []RestOperationModel{{OperationType: "award_pet", Params: map[string]string{}}},
+			errors:     []string{validator.CodeUnknownOperation + " /data/attributes/states/0/genericAction/operations/0/type"},
+			warnings:   []string{},
+		},
+		{
+			name:       "missing award_item param",
+			operations: []RestOperationModel{{OperationType: "award_item", Params: map[string]string{"itemId": "2000000"}}},
+			errors:     []string{validator.CodeMissingParam + " /data/attributes/states/0/genericAction/operations/0/params"},
+			warnings:   []string{},
+		},
+		{
+			name:       "non-integer param",
+			operations: []RestOperationModel{{OperationType: "award_mesos", Params: map[string]string{"amount": "lots"}}},
+			errors:     []string{validator.CodeInvalidParam + " /data/attributes/states/0/genericAction/operations/0/params/amount"},
+			warnings:   []string{},
+		},
+		{
+			name: "expressions",
+			operations: []RestOperationModel{
+				{OperationType: "award_mesos", Params: map[string]string{"amount": "min(context.quantity * 1000, character.meso)", "actorType": "=upper(context.actor)"}},
+				{OperationType: "local:log", Params: map[string]string{"message": "Rewarded character.name"}},
+			},
+			conditions: []RestConditionModel{{Type: "meso", Operator: ">=", Value: "context.quantity * 1000"}},
+			errors:     []string{},
+			warnings:   []string{},
+		},
+		{
+			name: "unparseable expressions",
+			operations: []RestOperationModel{
+				{OperationType: "award_item", Params: map[string]string{"itemId": "context.item +", "quantity": "character.luckiness"}},
+				{OperationType: "local:log", Params: map[string]string{"message": "=concat(context.name"}},
+			},
+			errors: []string{
+				validator.CodeInvalidParam + " /data/attributes/states/0/genericAction/operations/0/params/itemId",
+				validator.CodeInvalidParam + " /data/attributes/states/0/genericAction/operations/0/params/quantity",
+				validator.CodeInvalidParam + " /data/attributes/states/0/genericAction/operations/1/params/message",
+			},
+			warnings: []string{},
+		},
+		{
+			name:       "constant of the wrong type",
+			operations: []RestOperationModel{{OperationType: "award_level", Params: map[string]string{"amount": "'one'"}}},
+			errors:     []string{validator.CodeInvalidParam + " /data/attributes/states/0/genericAction/operations/0/params/amount"},
+			warnings:   []string{},
+		},
+		{
+			name:       "unknown param",
+			operations: []RestOperationModel{{OperationType: "award_level", Params: map[string]string{"amount": "1", "reason": "quest"}}},
+			errors:     []string{},
+			warnings:   []string{validator.CodeUnknownParam + " /data/attributes/states/0/genericAction/operations/0/params/reason"},
+		},
+		{
+			name:       "unparseable condition value",
+			conditions: []RestConditionModel{{Type: "meso", Operator: ">=", Value: "a lot"}},
+			errors:     []string{validator.CodeInvalidCondition + " /data/attributes/states/0/genericAction/outcomes/0/conditions/0/value"},
+			warnings:   []string{},
+		},
+		{
+			name: "nested condition missing item ID",
+			conditions: []RestConditionModel{{Type: "not", Conditions: []RestConditionModel{
+				{Type: "item", Operator: ">=", Value: "1"},
+			}}},
+			errors:   []string{validator.CodeInvalidCondition + " /data/attributes/states/0/genericAction/outcomes/0/conditions/0/conditions/0"},
+			warnings: []string{},
+		},
+		{
+			name:       "unsupported condition operator",
+			conditions: []RestConditionModel{{Type: "jobId", Operator: "!=", Value: "100"}},
+			errors:     []string{validator.CodeInvalidCondition + " /data/attributes/states/0/genericAction/outcomes/0/conditions/0"},
+			warnings:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, warnings := ValidateDocument(createTestActionDocument(tt.operations, tt.conditions))
+			assert.Equal(t, tt.errors, summarizeErrors(errs))
+			assert.Equal(t, tt.warnings, summarizeErrors(warnings))
+		})
+	}
+}
+
+func TestValidateDocument_Graph(t *testing.T) {
+	restModel := createTestActionDocument(nil, nil)
+	restModel.StartState = "missing"
+
+	errs, _ := ValidateDocument(restModel)
+	assert.ElementsMatch(t, []string{
+		validator.CodeMissingStartState + " " + validator.StartStatePointer,
+	}, summarizeErrors(errs))
+}
+
+func TestValidateDocument_Templates(t *testing.T) {
+	restModel := createTestActionDocument(nil, nil)
+	restModel.States = append(restModel.States,
+		RestStateModel{
+			Id:        "menu",
+			StateType: "dialogue",
+			Dialogue: &RestDialogueModel{DialogueType: "sendSimple", Text: localization.RestText{Default: "Hello ${character.name}, you have ${context.quantity} ${itemName(4000000)}"}, Choices: []RestChoiceModel{
+				{Text: localization.RestText{Default: "Travel to ${mapName(context.mapId)}"}, NextState: "destinations"},
+				{Text: localization.RestText{Default: "Pay ${context.cost * 2"}, NextState: "done"},
+				{Text: localization.RestText{Default: "Exit"}},
+			}},
+		},
+		RestStateModel{
+			Id:        "destinations",
+			StateType: "listSelection",
+			ListSelection: &RestListSelectionModel{
+				Title:   localization.RestText{Default: "${character.nickname}, where to?"},
+				Choices: []RestChoiceModel{{Text: localization.RestText{Default: "${mapName('Henesys')}"}, NextState: "done"}},
+				ChoiceTemplate: &RestChoiceTemplateModel{
+					From:       "context.destinations",
+					Text:       localization.RestText{Default: "${mapName(option.value)}"},
+					ContextKey: "destination",
+					NextState:  "done",
+				},
+			},
+		},
+	)
+	restModel.States[0].GenericAction.Outcomes[0].NextState = "menu"
+
+	errs, _ := ValidateDocument(restModel)
+	assert.Equal(t, []string{
+		validator.CodeInvalidTemplate + " /data/attributes/states/2/dialogue/choices/1/text",
+		validator.CodeInvalidTemplate + " /data/attributes/states/3/listSelection/title",
+		validator.CodeInvalidTemplate + " /data/attributes/states/3/listSelection/choices/0/text",
+	}, summarizeErrors(errs))
+}
+
+// Test only choice templates may reference the option a choice was generated for
+func TestValidateDocument_OptionReferences(t *testing.T) {
+	restModel := createTestActionDocument(nil, []RestConditionModel{
+		{Type: "meso", Operator: ">=", Value: "option.value"},
+		{Type: "item", Operator: ">=", Value: "1", ItemId: "option.value"},
+	})
+	restModel.States[1].Dialogue.Text = localization.RestText{Default: "Done ${option.name}"}
+	restModel.States = append(restModel.States, RestStateModel{
+		Id:        "tickets",
+		StateType: "listSelection",
+		ListSelection: &RestListSelectionModel{
+			Title: localization.RestText{Default: "Which ticket?"},
+			ChoiceTemplate: &RestChoiceTemplateModel{
+				From:       "context.tickets",
+				Text:       localization.RestText{Default: "${itemName(option.value)} ${option.name}"},
+				ContextKey: "ticket",
+				NextState:  "done",
+				Conditions: []RestConditionModel{
+					{Type: "meso", Operator: ">=", Value: "option.value / 1000"},
+					{Type: "item", Operator: ">=", Value: "1", ItemId: "option.value"},
+				},
+			},
+		},
+	})
+	restModel.States[1].Dialogue.DialogueType = "sendNext"
+	restModel.States[1].Dialogue.NextState = "tickets"
+
+	errs, _ := ValidateDocument(restModel)
+	assert.Equal(t, []string{
+		validator.CodeInvalidCondition + " /data/attributes/states/0/genericAction/outcomes/0/conditions/0/value",
+		validator.CodeInvalidCondition + " /data/attributes/states/0/genericAction/outcomes/0/conditions/1/itemId",
+		validator.CodeInvalidTemplate + " /data/attributes/states/1/dialogue/text",
+	}, summarizeErrors(errs))
+}
+
+func TestValidateDocument_TextCodes(t *testing.T) {
+	restModel := createTestActionDocument(nil, nil)
+	restModel.States = append(restModel.States,
+		RestStateModel{
+			Id:        "menu",
+			StateType: "dialogue",
+			Dialogue: &RestDialogueModel{DialogueType: "sendSimple", Text: localization.RestText{Default: "#L0#Go#l #L2#Stay#l #L${context.index}#Maybe#l"}, Choices: []RestChoiceModel{
+				{Text: localization.RestText{Default: "Go"}, NextState: "done"},
+				{Text: localization.RestText{Default: "#bStay"}, NextState: "done"},
+				{Text: localization.RestText{Default: "Exit"}},
+			}},
+		},
+		RestStateModel{
+			Id:        "farewell",
+			StateType: "dialogue",
+			Dialogue:  &RestDialogueModel{DialogueType: "sendOk", Text: localization.RestText{Default: "Take #t4000000 and #xgo #L0#now"}},
+		},
+	)
+	restModel.States[0].GenericAction.Outcomes[0].NextState = "menu"
+	restModel.States[2].Dialogue.Choices[1].NextState = "farewell"
+
+	errs, warnings := ValidateDocument(restModel)
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{
+		message.IssueListIndexMismatch + " /data/attributes/states/2/dialogue/text",
+		message.IssueMalformedCode + " /data/attributes/states/3/dialogue/text",
+		message.IssueUnknownCode + " /data/attributes/states/3/dialogue/text",
+		message.IssueUnbalancedListItem + " /data/attributes/states/3/dialogue/text",
+		message.IssueListIndexMismatch + " /data/attributes/states/3/dialogue/text",
+	}, summarizeErrors(warnings))
+	for _, warning := range warnings {
+		assert.Equal(t, map[string]string{"severity": "warning"}, warning.Meta)
+	}
+}
+
+func TestValidateDocument_Localization(t *testing.T) {
+	restModel := createTestActionDocument(nil, nil)
+	restModel.States[1].Dialogue.Text = localization.RestText{
+		Default: "Done ${context.",
+		Locales: map[string]string{"ko-KR": "완료 #x", "ja-JP": "完了"},
+		Key:     "reward.done",
+	}
+
+	errs, warnings := ValidateDocument(restModel)
+	assert.Equal(t, []string{validator.CodeInvalidTemplate + " /data/attributes/states/1/dialogue/text/default"}, summarizeErrors(errs))
+	assert.Equal(t, []string{message.IssueUnknownCode + " /data/attributes/states/1/dialogue/text/locales/ko-KR"}, summarizeErrors(warnings))
+
+	restModel.States[1].Dialogue.Text = localization.RestText{Key: "reward.done"}
+	errs, _ = ValidateDocument(restModel)
+	assert.Empty(t, errs, "text may be given by key alone")
+}
+
+func TestTransformWithPreviews(t *testing.T) {
+	restModel := createTestActionDocument(nil, nil)
+	restModel.States[1].Dialogue.Text = localization.RestText{Default: "Here is #b#t4000000##k, #h #"}
+	m, err := Extract(restModel)
+	require.NoError(t, err)
+
+	rm, err := TransformWithPreviews(m)
+	require.NoError(t, err)
+	assert.Equal(t, "Here is [item 4000000], [character name]", rm.States[1].Dialogue.Preview)
+
+	stored, err := Transform(m)
+	require.NoError(t, err)
+	assert.Empty(t, stored.States[1].Dialogue.Preview)
+}
+
+func TestTransformValidation(t *testing.T) {
+	restModel := createTestActionDocument([]RestOperationModel{{OperationType: "award_item", Params: map[string]string{}}}, nil)
+
+	result := TransformValidation(restModel)
+	assert.False(t, result.Valid)
+	assert.Len(t, result.Errors, 2)
+	for _, err := range result.Errors {
+		assert.Equal(t, "400", err.Status)
+	}
+
+	restModel.States[0].GenericAction.Operations[0].Params = map[string]string{"itemId": "2000000", "quantity": "1", "slot": "2"}
+	result = TransformValidation(restModel)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Errors)
+	require.Len(t, result.Warnings, 1)
+	assert.Empty(t, result.Warnings[0].Status)
+}
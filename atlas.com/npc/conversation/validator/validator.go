@@ -0,0 +1,197 @@
+package validator
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jtumidanski/api2go/jsonapi"
+)
+
+const (
+	// AttributesPointer is the JSON pointer to the attributes of a conversation document
+	AttributesPointer = "/data/attributes"
+	// StatesPointer is the JSON pointer to the states of a conversation document
+	StatesPointer = AttributesPointer + "/states"
+	// StartStatePointer is the JSON pointer to the start state of a conversation document
+	StartStatePointer = AttributesPointer + "/startState"
+)
+
+const (
+	CodeMissingStartState   = "MISSING_START_STATE"
+	CodeDuplicateStateId    = "DUPLICATE_STATE_ID"
+	CodeDanglingReference   = "DANGLING_REFERENCE"
+	CodeUnreachableState    = "UNREACHABLE_STATE"
+	CodeDeadEnd             = "DEAD_END"
+	CodeNonTerminatingLoop  = "NON_TERMINATING_LOOP"
+	CodeRequired            = "REQUIRED"
+	CodeInvalidState        = "INVALID_STATE"
+	CodeInvalidOptionSet    = "INVALID_OPTION_SET"
+	CodeInvalidConversation = "INVALID_CONVERSATION"
+	CodeUnknownOperation    = "UNKNOWN_OPERATION"
+	CodeMissingParam        = "MISSING_PARAM"
+	CodeInvalidParam        = "INVALID_PARAM"
+	CodeUnknownParam        = "UNKNOWN_PARAM"
+	CodeInvalidCondition    = "INVALID_CONDITION"
+	CodeInvalidTemplate     = "INVALID_TEMPLATE"
+)
+
+// Transition is a reference from a state to another state. An empty target ends the conversation.
+type Transition struct {
+	pointer string
+	target  string
+}
+
+// NewTransition creates a transition declared at the pointer, relative to the state
+func NewTransition(pointer string, target string) Transition {
+	return Transition{pointer: pointer, target: target}
+}
+
+// Pointer returns the JSON pointer of the attribute declaring the transition, relative to the state
+func (t Transition) Pointer() string {
+	return t.pointer
+}
+
+// Target returns the ID of the state transitioned to
+func (t Transition) Target() string {
+	return t.target
+}
+
+// State is a node of the conversation graph
+type State struct {
+	id          string
+	terminal    bool
+	transitions []Transition
+}
+
+// NewState creates a state with the transitions it may take
+func NewState(id string, transitions ...Transition) State {
+	return State{id: id, transitions: transitions}
+}
+
+// NewTerminalState creates a state which may end the conversation without transitioning to another state, such as a
+// closing message
+func NewTerminalState(id string, transitions ...Transition) State {
+	return State{id: id, terminal: true, transitions: transitions}
+}
+
+// Id returns the state ID
+func (s State) Id() string {
+	return s.id
+}
+
+// Transitions returns the transitions the state may take
+func (s State) Transitions() []Transition {
+	return s.transitions
+}
+
+// Terminal returns whether the state may end the conversation without transitioning to another state
+func (s State) Terminal() bool {
+	return s.terminal
+}
+
+// continues returns whether the state may transition to another state
+func (s State) continues() bool {
+	for _, t := range s.transitions {
+		if t.Target() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Graph is the conversation graph, with states in document order
+type Graph struct {
+	startState string
+	states     []State
+}
+
+// NewGraph creates a graph of the states, in document order
+func NewGraph(startState string, states []State) Graph {
+	return Graph{startState: startState, states: states}
+}
+
+// StatePointer returns the JSON pointer to the state at the index of the document
+func StatePointer(index int) string {
+	return StatesPointer + "/" + strconv.Itoa(index)
+}
+
+// NewError creates a JSON:API error object for the pointer
+func NewError(code string, title string, detail string, pointer string) jsonapi.Error {
+	return jsonapi.Error{
+		Status: strconv.Itoa(http.StatusBadRequest),
+		Code:   code,
+		Title:  title,
+		Detail: detail,
+		Source: &jsonapi.ErrorSource{Pointer: pointer},
+	}
+}
+
+// NewWarning creates a JSON:API error object for a problem which does not prevent the conversation from being saved
+func NewWarning(code string, title string, detail string, pointer string) jsonapi.Error {
+	return jsonapi.Error{
+		Code:   code,
+		Title:  title,
+		Detail: detail,
+		Source: &jsonapi.ErrorSource{Pointer: pointer},
+		Meta:   map[string]string{"severity": "warning"},
+	}
+}
+
+// Validate walks the graph and reports every duplicate state ID, dangling reference, unreachable state and dead end. A
+// dead end is a state which is not terminal, yet cannot transition to another state.
+func Validate(g Graph) []jsonapi.Error {
+	errs := make([]jsonapi.Error, 0)
+
+	// Index states by ID, reporting any ID declared more than once
+	indexes := make(map[string]int)
+	for i, s := range g.states {
+		if first, ok := indexes[s.Id()]; ok {
+			errs = append(errs, NewError(CodeDuplicateStateId, "Duplicate state ID", fmt.Sprintf("state ID [%s] is already declared by state [%d]", s.Id(), first), StatePointer(i)+"/id"))
+			continue
+		}
+		indexes[s.Id()] = i
+	}
+
+	if _, ok := indexes[g.startState]; !ok {
+		errs = append(errs, NewError(CodeMissingStartState, "Missing start state", fmt.Sprintf("start state [%s] does not exist", g.startState), StartStatePointer))
+	}
+
+	for i, s := range g.states {
+		if !s.Terminal() && !s.continues() {
+			errs = append(errs, NewError(CodeDeadEnd, "Dead end", fmt.Sprintf("state [%s] is not terminal, yet cannot transition to another state", s.Id()), StatePointer(i)))
+		}
+		for _, t := range s.Transitions() {
+			if t.Target() == "" {
+				continue
+			}
+			if _, ok := indexes[t.Target()]; !ok {
+				errs = append(errs, NewError(CodeDanglingReference, "Dangling reference", fmt.Sprintf("state [%s] references unknown state [%s]", s.Id(), t.Target()), StatePointer(i)+t.Pointer()))
+			}
+		}
+	}
+
+	// Walk the graph from the start state, reporting states which are never visited
+	reachable := make(map[string]bool)
+	if _, ok := indexes[g.startState]; ok {
+		pending := []string{g.startState}
+		reachable[g.startState] = true
+		for len(pending) > 0 {
+			id := pending[0]
+			pending = pending[1:]
+			for _, t := range g.states[indexes[id]].Transitions() {
+				if _, ok := indexes[t.Target()]; ok && !reachable[t.Target()] {
+					reachable[t.Target()] = true
+					pending = append(pending, t.Target())
+				}
+			}
+		}
+		for i, s := range g.states {
+			if indexes[s.Id()] == i && !reachable[s.Id()] {
+				errs = append(errs, NewError(CodeUnreachableState, "Unreachable state", fmt.Sprintf("state [%s] cannot be reached from start state [%s]", s.Id(), g.startState), StatePointer(i)))
+			}
+		}
+	}
+
+	return errs
+}
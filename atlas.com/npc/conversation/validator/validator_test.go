@@ -0,0 +1,95 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// codes returns the code and pointer of each error
+func codes(errs []jsonapi.Error) []string {
+	results := make([]string, 0, len(errs))
+	for _, err := range errs {
+		results = append(results, err.Code+" "+err.Source.Pointer)
+	}
+	return results
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		graph    Graph
+		expected []string
+	}{
+		{
+			name: "valid graph",
+			graph: NewGraph("start", []State{
+				NewState("start", NewTransition("/dialogue/choices/0/nextState", "end"), NewTransition("/dialogue/onExit", "")),
+				NewTerminalState("end", NewTransition("/dialogue/onExit", "")),
+			}),
+			expected: []string{},
+		},
+		{
+			name: "missing start state",
+			graph: NewGraph("missing", []State{
+				NewTerminalState("start", NewTransition("/dialogue/onExit", "")),
+			}),
+			expected: []string{"MISSING_START_STATE /data/attributes/startState"},
+		},
+		{
+			name: "duplicate state id",
+			graph: NewGraph("start", []State{
+				NewTerminalState("start", NewTransition("/dialogue/onExit", "")),
+				NewTerminalState("start", NewTransition("/dialogue/onExit", "")),
+			}),
+			expected: []string{"DUPLICATE_STATE_ID /data/attributes/states/1/id"},
+		},
+		{
+			name: "dangling reference and unreachable state",
+			graph: NewGraph("start", []State{
+				NewState("start", NewTransition("/craftAction/missingMaterialsState", "nowhere")),
+				NewTerminalState("orphan", NewTransition("/dialogue/onExit", "")),
+			}),
+			expected: []string{
+				"DANGLING_REFERENCE /data/attributes/states/0/craftAction/missingMaterialsState",
+				"UNREACHABLE_STATE /data/attributes/states/1",
+			},
+		},
+		{
+			name: "dead end",
+			graph: NewGraph("start", []State{
+				NewState("start", NewTransition("/dialogue/nextState", "menu")),
+				NewState("menu"),
+			}),
+			expected: []string{"DEAD_END /data/attributes/states/1"},
+		},
+		{
+			name: "dead end whose every transition ends the conversation",
+			graph: NewGraph("start", []State{
+				NewState("start", NewTransition("/dialogue/nextState", "menu"), NewTransition("/dialogue/onExit", "")),
+				NewState("menu", NewTransition("/listSelection/choices/0/nextState", ""), NewTransition("/listSelection/choices/1/nextState", "")),
+			}),
+			expected: []string{"DEAD_END /data/attributes/states/1"},
+		},
+		{
+			name: "terminal state",
+			graph: NewGraph("start", []State{
+				NewState("start", NewTransition("/dialogue/nextState", "farewell"), NewTransition("/dialogue/onExit", "")),
+				NewTerminalState("farewell", NewTransition("/dialogue/onExit", "")),
+			}),
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(tt.graph)
+			assert.Equal(t, tt.expected, codes(errs))
+			for _, err := range errs {
+				assert.Equal(t, "400", err.Status)
+				assert.NotEmpty(t, err.Detail)
+			}
+		})
+	}
+}
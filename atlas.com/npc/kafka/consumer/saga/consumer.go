@@ -0,0 +1,50 @@
+package saga
+
+import (
+	"atlas-npc-conversations/conversation"
+	consumer2 "atlas-npc-conversations/kafka/consumer"
+	"atlas-npc-conversations/kafka/message/saga"
+	"context"
+	"github.com/Chronicle20/atlas-kafka/consumer"
+	"github.com/Chronicle20/atlas-kafka/handler"
+	"github.com/Chronicle20/atlas-kafka/message"
+	"github.com/Chronicle20/atlas-kafka/topic"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func InitConsumers(l logrus.FieldLogger) func(func(config consumer.Config, decorators ...model.Decorator[consumer.Config])) func(consumerGroupId string) {
+	return func(rf func(config consumer.Config, decorators ...model.Decorator[consumer.Config])) func(consumerGroupId string) {
+		return func(consumerGroupId string) {
+			rf(consumer2.NewConfig(l)("saga_status_event")(saga.EnvStatusEventTopic)(consumerGroupId), consumer.SetHeaderParsers(consumer.SpanHeaderParser, consumer.TenantHeaderParser))
+		}
+	}
+}
+
+func InitHandlers(l logrus.FieldLogger, db *gorm.DB) func(rf func(topic string, handler handler.Handler) (string, error)) {
+	return func(rf func(topic string, handler handler.Handler) (string, error)) {
+		var t string
+		t, _ = topic.EnvProvider(l)(saga.EnvStatusEventTopic)()
+		_, _ = rf(t, message.AdaptHandler(message.PersistentConfig(handleStatusEventCompleted(db))))
+		_, _ = rf(t, message.AdaptHandler(message.PersistentConfig(handleStatusEventFailed(db))))
+	}
+}
+
+func handleStatusEventCompleted(db *gorm.DB) message.Handler[saga.StatusEvent[saga.StatusEventCompletedBody]] {
+	return func(l logrus.FieldLogger, ctx context.Context, e saga.StatusEvent[saga.StatusEventCompletedBody]) {
+		if e.Type != saga.StatusEventTypeCompleted {
+			return
+		}
+		_ = conversation.NewProcessor(l, ctx, db).ResumeSaga(e.TransactionId, true, "")
+	}
+}
+
+func handleStatusEventFailed(db *gorm.DB) message.Handler[saga.StatusEvent[saga.StatusEventFailedBody]] {
+	return func(l logrus.FieldLogger, ctx context.Context, e saga.StatusEvent[saga.StatusEventFailedBody]) {
+		if e.Type != saga.StatusEventTypeFailed {
+			return
+		}
+		_ = conversation.NewProcessor(l, ctx, db).ResumeSaga(e.TransactionId, false, e.Body.Reason)
+	}
+}
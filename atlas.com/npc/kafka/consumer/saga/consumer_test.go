@@ -0,0 +1,120 @@
+package saga
+
+import (
+	"atlas-npc-conversations/conversation"
+	"atlas-npc-conversations/kafka/message/saga"
+	"context"
+	"testing"
+
+	"github.com/Chronicle20/atlas-constants/field"
+	"github.com/Chronicle20/atlas-constants/world"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to park a conversation of the character on the saga, returning the context of its tenant
+func createTestParkedConversation(t *testing.T, characterId uint32, transactionId uuid.UUID) (context.Context, tenant.Model) {
+	operation, err := conversation.NewOperationBuilder().SetType("award_mesos").AddParamValue("amount", "1000").Build()
+	require.NoError(t, err)
+	action, err := conversation.NewGenericActionBuilder().AddOperation(operation).SetOnSuccess("thanks").SetOnFailure("sorry").Build()
+	require.NoError(t, err)
+	reward, err := conversation.NewStateBuilder().SetId("reward").SetGenericAction(action).Build()
+	require.NoError(t, err)
+
+	builder := conversation.NewBuilder().SetId(uuid.New()).SetNpcId(9010000).SetStartState("reward").AddState(reward)
+	for _, id := range []string{"thanks", "sorry"} {
+		dialogue, err := conversation.NewDialogueBuilder().SetDialogueType(conversation.SendNext).SetText(id).SetNextState(id).Build()
+		require.NoError(t, err)
+		state, err := conversation.NewStateBuilder().SetId(id).SetDialogue(dialogue).Build()
+		require.NoError(t, err)
+		builder.AddState(state)
+	}
+	m, err := builder.Build()
+	require.NoError(t, err)
+
+	tm, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	ctx, err := conversation.NewConversationContextBuilder().
+		SetField(field.NewBuilder(world.Id(1), 1, 100000).Build()).
+		SetCharacterId(characterId).
+		SetNpcId(m.NpcId()).
+		SetCurrentState("reward").
+		SetConversation(m).
+		SetAwaitingSaga(transactionId).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, conversation.GetRegistry().SetContext(tm, characterId, ctx))
+	return tenant.WithContext(context.Background(), tm), tm
+}
+
+// TestHandleStatusEvents_ResumeSaga tests that status events move the conversation parked on the saga to the state of
+// its outcome
+func TestHandleStatusEvents_ResumeSaga(t *testing.T) {
+	l := logrus.New()
+	characterId := uint32(12345)
+
+	t.Run("completed", func(t *testing.T) {
+		transactionId := uuid.New()
+		ctx, tm := createTestParkedConversation(t, characterId, transactionId)
+
+		handleStatusEventCompleted(nil)(l, ctx, saga.StatusEvent[saga.StatusEventCompletedBody]{TransactionId: transactionId, Type: saga.StatusEventTypeCompleted})
+
+		resumed, err := conversation.GetRegistry().GetPreviousContext(tm, characterId)
+		require.NoError(t, err)
+		assert.Equal(t, "thanks", resumed.CurrentState())
+		assert.Equal(t, uuid.Nil, resumed.AwaitingSaga())
+		assert.NotContains(t, resumed.Context(), conversation.SagaFailureReasonContextKey)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		transactionId := uuid.New()
+		ctx, tm := createTestParkedConversation(t, characterId, transactionId)
+
+		handleStatusEventFailed(nil)(l, ctx, saga.StatusEvent[saga.StatusEventFailedBody]{TransactionId: transactionId, Type: saga.StatusEventTypeFailed, Body: saga.StatusEventFailedBody{Reason: "INVENTORY_FULL"}})
+
+		resumed, err := conversation.GetRegistry().GetPreviousContext(tm, characterId)
+		require.NoError(t, err)
+		assert.Equal(t, "sorry", resumed.CurrentState())
+		assert.Equal(t, uuid.Nil, resumed.AwaitingSaga())
+		assert.Equal(t, "INVENTORY_FULL", resumed.Context()[conversation.SagaFailureReasonContextKey])
+	})
+
+	t.Run("unknown saga", func(t *testing.T) {
+		transactionId := uuid.New()
+		ctx, tm := createTestParkedConversation(t, characterId, transactionId)
+
+		handleStatusEventCompleted(nil)(l, ctx, saga.StatusEvent[saga.StatusEventCompletedBody]{TransactionId: uuid.New(), Type: saga.StatusEventTypeCompleted})
+		handleStatusEventFailed(nil)(l, ctx, saga.StatusEvent[saga.StatusEventFailedBody]{TransactionId: uuid.New(), Type: saga.StatusEventTypeFailed})
+
+		parked, err := conversation.GetRegistry().GetPreviousContext(tm, characterId)
+		require.NoError(t, err)
+		assert.Equal(t, "reward", parked.CurrentState())
+		assert.Equal(t, transactionId, parked.AwaitingSaga())
+	})
+}
+
+// TestHandleStatusEventCompleted tests that completed events resume the conversation, which requires a tenant
+func TestHandleStatusEventCompleted(t *testing.T) {
+	l := logrus.New()
+	e := saga.StatusEvent[saga.StatusEventCompletedBody]{TransactionId: uuid.New(), Type: saga.StatusEventTypeCompleted}
+
+	assert.Panics(t, func() {
+		handleStatusEventCompleted(nil)(l, context.Background(), e)
+	}, "Expected panic when tenant context is missing")
+}
+
+// TestHandleStatusEventsIgnoreWrongEventType tests that each handler ignores events of the other type
+func TestHandleStatusEventsIgnoreWrongEventType(t *testing.T) {
+	l := logrus.New()
+	transactionId := uuid.New()
+
+	assert.NotPanics(t, func() {
+		handleStatusEventCompleted(nil)(l, context.Background(), saga.StatusEvent[saga.StatusEventCompletedBody]{TransactionId: transactionId, Type: saga.StatusEventTypeFailed})
+	})
+	assert.NotPanics(t, func() {
+		handleStatusEventFailed(nil)(l, context.Background(), saga.StatusEvent[saga.StatusEventFailedBody]{TransactionId: transactionId, Type: saga.StatusEventTypeCompleted})
+	})
+}
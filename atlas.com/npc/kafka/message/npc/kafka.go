@@ -27,9 +27,10 @@ type CommandConversationStartBody struct {
 }
 
 type CommandConversationContinueBody struct {
-	Action          byte  `json:"action"`
-	LastMessageType byte  `json:"lastMessageType"`
-	Selection       int32 `json:"selection"`
+	Action          byte   `json:"action"`
+	LastMessageType byte   `json:"lastMessageType"`
+	Selection       int32  `json:"selection"`
+	Text            string `json:"text,omitempty"`
 }
 
 type CommandConversationEndBody struct {
@@ -50,6 +51,22 @@ type CommandSimpleBody struct {
 	Type string `json:"type"`
 }
 
+type CommandNumberBody struct {
+	DefaultValue int32 `json:"defaultValue"`
+	MinValue     int32 `json:"minValue"`
+	MaxValue     int32 `json:"maxValue"`
+}
+
+type CommandStyleBody struct {
+	Styles []uint32 `json:"styles"`
+}
+
+type CommandTextBody struct {
+	DefaultValue string `json:"defaultValue"`
+	MinLength    uint16 `json:"minLength"`
+	MaxLength    uint16 `json:"maxLength"`
+}
+
 const (
 	EnvEventTopicCharacterStatus        = "EVENT_TOPIC_CHARACTER_STATUS"
 	EventCharacterStatusTypeStatChanged = "STAT_CHANGED"
@@ -67,3 +84,30 @@ type StatusEventStatChangedBody struct {
 	ChannelId       byte `json:"channelId"`
 	ExclRequestSent bool `json:"exclRequestSent"`
 }
+
+const (
+	EnvEventTopicConversationStatus     = "EVENT_TOPIC_NPC_CONVERSATION_STATUS"
+	ConversationStatusEventTypeTimedOut = "TIMED_OUT"
+	ConversationStatusEventTypeError    = "ERROR"
+)
+
+type ConversationStatusEvent[E any] struct {
+	WorldId     byte   `json:"worldId"`
+	ChannelId   byte   `json:"channelId"`
+	CharacterId uint32 `json:"characterId"`
+	NpcId       uint32 `json:"npcId"`
+	Type        string `json:"type"`
+	Body        E      `json:"body"`
+}
+
+type ConversationStatusEventTimedOutBody struct {
+	ConversationId string `json:"conversationId"`
+	StateId        string `json:"stateId"`
+	IdleSeconds    uint32 `json:"idleSeconds"`
+}
+
+type ConversationStatusEventErrorBody struct {
+	ConversationId string `json:"conversationId"`
+	StateId        string `json:"stateId"`
+	Reason         string `json:"reason"`
+}
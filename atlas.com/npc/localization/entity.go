@@ -0,0 +1,64 @@
+package localization
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Entity represents a translation of the tenant's string table stored in the database
+type Entity struct {
+	ID        uuid.UUID `gorm:"primaryKey;column:id;type:uuid"`
+	TenantID  uuid.UUID `gorm:"column:tenant_id;type:uuid;not null;uniqueIndex:idx_conversation_strings_key_locale"`
+	Key       string    `gorm:"column:key;not null;uniqueIndex:idx_conversation_strings_key_locale"`
+	Locale    string    `gorm:"column:locale;not null;uniqueIndex:idx_conversation_strings_key_locale"`
+	Text      string    `gorm:"column:text;not null"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null;default:CURRENT_TIMESTAMP"`
+}
+
+// TableName returns the table name for the entity
+func (Entity) TableName() string {
+	return "conversation_strings"
+}
+
+// Make converts an Entity to a Model
+func Make(e Entity) (Model, error) {
+	return Model{
+		id:        e.ID,
+		key:       e.Key,
+		locale:    e.Locale,
+		text:      e.Text,
+		createdAt: e.CreatedAt,
+		updatedAt: e.UpdatedAt,
+	}, nil
+}
+
+// GetAllProvider returns a provider for retrieving every translation of the tenant
+func GetAllProvider(tenantId uuid.UUID) func(db *gorm.DB) func() ([]Entity, error) {
+	return func(db *gorm.DB) func() ([]Entity, error) {
+		return func() ([]Entity, error) {
+			var entities []Entity
+			result := db.Where("tenant_id = ?", tenantId).Order("key, locale").Find(&entities)
+			return entities, result.Error
+		}
+	}
+}
+
+// GetByKeyProvider returns a provider for retrieving every translation of a key
+func GetByKeyProvider(tenantId uuid.UUID) func(key string) func(db *gorm.DB) func() ([]Entity, error) {
+	return func(key string) func(db *gorm.DB) func() ([]Entity, error) {
+		return func(db *gorm.DB) func() ([]Entity, error) {
+			return func() ([]Entity, error) {
+				var entities []Entity
+				result := db.Where("tenant_id = ? AND key = ?", tenantId, key).Order("locale").Find(&entities)
+				return entities, result.Error
+			}
+		}
+	}
+}
+
+// MigrateTable creates or updates the conversation_strings table
+func MigrateTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Entity{})
+}
@@ -0,0 +1,70 @@
+package localization
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	tenant "github.com/Chronicle20/atlas-tenant"
+)
+
+const (
+	// DefaultLocaleEnv names the environment variable holding the locale used when no other locale is translated
+	DefaultLocaleEnv = "DEFAULT_LOCALE"
+	// DefaultLocale is used when DefaultLocaleEnv is not set
+	DefaultLocale = "en-US"
+	// TenantLocaleEnvPrefix prefixes the environment variables overriding the locale of a region, such as LOCALE_GMS,
+	// or of a region and major version, such as LOCALE_GMS_83
+	TenantLocaleEnvPrefix = "LOCALE_"
+)
+
+// regionLocales maps tenant regions to the locale of their players
+var regionLocales = map[string]string{
+	"GMS":  "en-US",
+	"KMS":  "ko-KR",
+	"JMS":  "ja-JP",
+	"CMS":  "zh-CN",
+	"TMS":  "zh-TW",
+	"THMS": "th-TH",
+	"BMS":  "pt-BR",
+}
+
+// GetDefaultLocale returns the locale used when no other locale is translated
+func GetDefaultLocale() string {
+	if locale, ok := os.LookupEnv(DefaultLocaleEnv); ok && locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// TenantLocale returns the locale of the tenant's players, chosen by the tenant's region and major version, or empty if
+// the region is unknown
+func TenantLocale(t tenant.Model) string {
+	region := strings.ToUpper(t.Region())
+	if locale, ok := os.LookupEnv(TenantLocaleEnvPrefix + region + "_" + strconv.Itoa(int(t.MajorVersion()))); ok && locale != "" {
+		return locale
+	}
+	if locale, ok := os.LookupEnv(TenantLocaleEnvPrefix + region); ok && locale != "" {
+		return locale
+	}
+	return regionLocales[region]
+}
+
+// Locales returns the locales text is shown in, most preferred first: the preferred locale, such as one chosen by the
+// character, then the tenant's locale, then the default locale
+func Locales(preferred string, t tenant.Model) []string {
+	locales := make([]string, 0, 3)
+	for _, locale := range []string{preferred, TenantLocale(t), GetDefaultLocale()} {
+		if locale == "" {
+			continue
+		}
+		duplicate := false
+		for _, existing := range locales {
+			duplicate = duplicate || existing == locale
+		}
+		if !duplicate {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
@@ -0,0 +1,38 @@
+package localization
+
+import (
+	"testing"
+
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocales(t *testing.T) {
+	gms, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	kms, err := tenant.Create(uuid.New(), "KMS", 1, 2)
+	require.NoError(t, err)
+	unknown, err := tenant.Create(uuid.New(), "XMS", 1, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"en-US"}, Locales("", gms))
+	assert.Equal(t, []string{"ko-KR", "en-US"}, Locales("", kms))
+	assert.Equal(t, []string{"ja-JP", "ko-KR", "en-US"}, Locales("ja-JP", kms))
+	assert.Equal(t, []string{"en-US"}, Locales("", unknown))
+}
+
+func TestLocales_Environment(t *testing.T) {
+	gms83, err := tenant.Create(uuid.New(), "GMS", 83, 1)
+	require.NoError(t, err)
+	gms95, err := tenant.Create(uuid.New(), "GMS", 95, 1)
+	require.NoError(t, err)
+
+	t.Setenv(DefaultLocaleEnv, "en-GB")
+	t.Setenv(TenantLocaleEnvPrefix+"GMS", "en-CA")
+	t.Setenv(TenantLocaleEnvPrefix+"GMS_83", "fr-CA")
+
+	assert.Equal(t, []string{"fr-CA", "en-GB"}, Locales("", gms83), "the major version override wins")
+	assert.Equal(t, []string{"en-CA", "en-GB"}, Locales("", gms95))
+}
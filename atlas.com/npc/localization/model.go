@@ -0,0 +1,51 @@
+package localization
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Model is the translation of a key of the tenant's string table into a locale
+type Model struct {
+	id        uuid.UUID
+	key       string
+	locale    string
+	text      string
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// Id returns the ID of the translation
+func (m Model) Id() uuid.UUID {
+	return m.id
+}
+
+// Key returns the key conversation text refers to
+func (m Model) Key() string {
+	return m.key
+}
+
+// Locale returns the locale of the translation, such as en-US or ko
+func (m Model) Locale() string {
+	return m.locale
+}
+
+// Text returns the translated text
+func (m Model) Text() string {
+	return m.text
+}
+
+// CreatedAt returns when the translation was created
+func (m Model) CreatedAt() time.Time {
+	return m.createdAt
+}
+
+// UpdatedAt returns when the translation was last updated
+func (m Model) UpdatedAt() time.Time {
+	return m.updatedAt
+}
+
+// NewModel creates a translation of a key into a locale
+func NewModel(key string, locale string, text string) Model {
+	return Model{key: key, locale: locale, text: text}
+}
@@ -0,0 +1,139 @@
+package localization
+
+import (
+	"context"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Processor interface {
+	// AllProvider returns a provider for retrieving every translation of the tenant's string table
+	AllProvider() model.Provider[[]Model]
+
+	// ByKeyProvider returns a provider for retrieving every translation of a key
+	ByKeyProvider(key string) model.Provider[[]Model]
+
+	// Save creates the translation of a key into a locale, or replaces the existing one
+	Save(m Model) (Model, error)
+
+	// Delete deletes a translation
+	Delete(id uuid.UUID) error
+
+	// Locales returns the locales the string table holds translations for
+	Locales() ([]string, error)
+
+	// Lookup returns a lookup of the tenant's string table. The table is read once, on the first lookup.
+	Lookup() Lookup
+}
+
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+	t   tenant.Model
+	db  *gorm.DB
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+		t:   tenant.MustFromContext(ctx),
+		db:  db,
+	}
+}
+
+// AllProvider returns a provider for retrieving every translation of the tenant's string table
+func (p *ProcessorImpl) AllProvider() model.Provider[[]Model] {
+	return model.SliceMap[Entity, Model](Make)(GetAllProvider(p.t.Id())(p.db))(model.ParallelMap())
+}
+
+// ByKeyProvider returns a provider for retrieving every translation of a key
+func (p *ProcessorImpl) ByKeyProvider(key string) model.Provider[[]Model] {
+	return model.SliceMap[Entity, Model](Make)(GetByKeyProvider(p.t.Id())(key)(p.db))(model.ParallelMap())
+}
+
+// Save creates the translation of a key into a locale, or replaces the existing one
+func (p *ProcessorImpl) Save(m Model) (Model, error) {
+	p.l.Debugf("Saving translation of key [%s] for locale [%s].", m.Key(), m.Locale())
+
+	now := time.Now()
+	entity := Entity{
+		ID:        uuid.New(),
+		TenantID:  p.t.Id(),
+		Key:       m.Key(),
+		Locale:    m.Locale(),
+		Text:      m.Text(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	result := p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "key"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"text", "updated_at"}),
+	}).Create(&entity)
+	if result.Error != nil {
+		p.l.WithError(result.Error).Errorf("Failed to save translation of key [%s] for locale [%s]", m.Key(), m.Locale())
+		return Model{}, result.Error
+	}
+
+	// Retrieve the saved entity, as an existing translation keeps its ID
+	result = p.db.Where("tenant_id = ? AND key = ? AND locale = ?", p.t.Id(), m.Key(), m.Locale()).First(&entity)
+	if result.Error != nil {
+		p.l.WithError(result.Error).Errorf("Failed to retrieve saved translation of key [%s] for locale [%s]", m.Key(), m.Locale())
+		return Model{}, result.Error
+	}
+	return Make(entity)
+}
+
+// Delete deletes a translation
+func (p *ProcessorImpl) Delete(id uuid.UUID) error {
+	p.l.Debugf("Deleting translation [%s].", id)
+
+	result := p.db.Where("tenant_id = ? AND id = ?", p.t.Id(), id).Delete(&Entity{})
+	if result.Error != nil {
+		p.l.WithError(result.Error).Errorf("Failed to delete translation [%s]", id)
+		return result.Error
+	}
+	return nil
+}
+
+// Locales returns the locales the string table holds translations for
+func (p *ProcessorImpl) Locales() ([]string, error) {
+	var locales []string
+	result := p.db.Model(&Entity{}).Where("tenant_id = ?", p.t.Id()).Distinct().Pluck("locale", &locales)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	sort.Strings(locales)
+	return locales, nil
+}
+
+// Lookup returns a lookup of the tenant's string table. The table is read once, on the first lookup. A table which
+// cannot be read is logged and treated as empty, so text falls back to its default.
+func (p *ProcessorImpl) Lookup() Lookup {
+	var once sync.Once
+	translations := make(map[string]map[string]string)
+	return func(key string, locale string) (string, bool) {
+		once.Do(func() {
+			ms, err := p.AllProvider()()
+			if err != nil {
+				p.l.WithError(err).Errorf("Unable to read the string table.")
+				return
+			}
+			for _, m := range ms {
+				if _, ok := translations[m.Key()]; !ok {
+					translations[m.Key()] = make(map[string]string)
+				}
+				translations[m.Key()][m.Locale()] = m.Text()
+			}
+		})
+		s, ok := translations[key][locale]
+		return s, ok
+	}
+}
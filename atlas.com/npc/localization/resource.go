@@ -0,0 +1,96 @@
+package localization
+
+import (
+	"atlas-npc-conversations/rest"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/server"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
+	return func(db *gorm.DB) server.RouteInitializer {
+		return func(router *mux.Router, l logrus.FieldLogger) {
+			registerHandler := rest.RegisterHandler(l)(db)(si)
+			registerInputHandler := rest.RegisterInputHandler[RestModel](l)(db)(si)
+
+			// Register handlers
+			router.HandleFunc("/npcs/conversations/strings", registerHandler("get_conversation_strings", GetStringsHandler)).Methods(http.MethodGet)
+			router.HandleFunc("/npcs/conversations/strings", registerInputHandler("save_conversation_string", SaveStringHandler)).Methods(http.MethodPost)
+			router.HandleFunc("/npcs/conversations/strings/{stringId}", registerHandler("delete_conversation_string", DeleteStringHandler)).Methods(http.MethodDelete)
+		}
+	}
+}
+
+// GetStringsHandler handles GET /npcs/conversations/strings, listing the tenant's string table. The key query
+// parameter restricts the list to the translations of one key.
+func GetStringsHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := NewProcessor(d.Logger(), d.Context(), d.DB())
+		mp := p.AllProvider()
+		if key := r.URL.Query().Get("key"); key != "" {
+			mp = p.ByKeyProvider(key)
+		}
+		rm, err := model.SliceMap(Transform)(mp)(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST model.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(rm)
+	}
+}
+
+// SaveStringHandler handles POST /npcs/conversations/strings, creating the translation of a key into a locale or
+// replacing the existing one
+func SaveStringHandler(d *rest.HandlerDependency, c *rest.HandlerContext, rm RestModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, err := Extract(rm)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Extracting domain model from REST model.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sm, err := NewProcessor(d.Logger(), d.Context(), d.DB()).Save(m)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Saving translation.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		srm, err := Transform(sm)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Transforming domain model to REST model.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(srm)
+	}
+}
+
+// DeleteStringHandler handles DELETE /npcs/conversations/strings/{stringId}
+func DeleteStringHandler(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseStringId(d.Logger(), func(stringId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			err := NewProcessor(d.Logger(), d.Context(), d.DB()).Delete(stringId)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Deleting translation.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
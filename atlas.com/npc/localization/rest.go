@@ -0,0 +1,125 @@
+package localization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+const (
+	Resource = "conversation-strings"
+)
+
+// RestText represents the REST model for text shown to the character. Text which is not localized is written as a
+// plain string; localized text is written as an object.
+type RestText struct {
+	Default string            `json:"default,omitempty"` // Text shown when no translation exists for the locale
+	Locales map[string]string `json:"locales,omitempty"` // Translations by locale
+	Key     string            `json:"key,omitempty"`     // Key of the text in the tenant's string table
+}
+
+// MarshalJSON writes the text as a plain string, unless it is localized
+func (r RestText) MarshalJSON() ([]byte, error) {
+	if len(r.Locales) == 0 && r.Key == "" {
+		return json.Marshal(r.Default)
+	}
+	type restText RestText
+	return json.Marshal(restText(r))
+}
+
+// UnmarshalJSON reads the text from a plain string or an object
+func (r *RestText) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*r = RestText{}
+		return json.Unmarshal(data, &r.Default)
+	}
+	if bytes.Equal(data, []byte("null")) {
+		*r = RestText{}
+		return nil
+	}
+	type restText RestText
+	var t restText
+	if err := json.Unmarshal(data, &t); err != nil {
+		return fmt.Errorf("text must be a string or an object with default, locales and key: %w", err)
+	}
+	*r = RestText(t)
+	return nil
+}
+
+// Localized returns true if the text has translations or a key into the string table
+func (r RestText) Localized() bool {
+	return len(r.Locales) > 0 || r.Key != ""
+}
+
+// TransformText converts text to a REST model
+func TransformText(t Text) RestText {
+	return RestText{
+		Default: t.value,
+		Locales: t.locales,
+		Key:     t.key,
+	}
+}
+
+// ExtractText converts a REST model to text
+func ExtractText(r RestText) Text {
+	if !r.Localized() {
+		return NewText(r.Default)
+	}
+	return NewLocalizedText(r.Default, r.Locales, r.Key)
+}
+
+// RestModel represents the REST model for a translation of the tenant's string table
+type RestModel struct {
+	Id     uuid.UUID `json:"-"`      // Translation ID
+	Key    string    `json:"key"`    // Key conversation text refers to
+	Locale string    `json:"locale"` // Locale of the translation
+	Text   string    `json:"text"`   // Translated text
+}
+
+// GetName returns the resource name
+func (r RestModel) GetName() string {
+	return Resource
+}
+
+// GetID returns the resource ID
+func (r RestModel) GetID() string {
+	return r.Id.String()
+}
+
+// SetID sets the resource ID
+func (r *RestModel) SetID(idStr string) error {
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return fmt.Errorf("invalid string ID: %w", err)
+	}
+	r.Id = id
+	return nil
+}
+
+// Transform converts a translation to a REST model
+func Transform(m Model) (RestModel, error) {
+	return RestModel{
+		Id:     m.Id(),
+		Key:    m.Key(),
+		Locale: m.Locale(),
+		Text:   m.Text(),
+	}, nil
+}
+
+// Extract converts a REST model to a translation
+func Extract(r RestModel) (Model, error) {
+	if r.Key == "" {
+		return Model{}, fmt.Errorf("key is required")
+	}
+	if r.Locale == "" {
+		return Model{}, fmt.Errorf("locale is required")
+	}
+	return Model{
+		id:     r.Id,
+		key:    r.Key,
+		locale: r.Locale,
+		text:   r.Text,
+	}, nil
+}
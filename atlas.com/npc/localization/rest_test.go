@@ -0,0 +1,42 @@
+package localization
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestText_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		text RestText
+	}{
+		{name: "plain string", json: `"Hello"`, text: RestText{Default: "Hello"}},
+		{name: "inline locales", json: `{"default":"Hello","locales":{"ko-KR":"안녕"}}`, text: RestText{Default: "Hello", Locales: map[string]string{"ko-KR": "안녕"}}},
+		{name: "string table key", json: `{"key":"greeting"}`, text: RestText{Key: "greeting"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var text RestText
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &text))
+			assert.Equal(t, tt.text, text)
+
+			data, err := json.Marshal(tt.text)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.json, string(data))
+		})
+	}
+
+	var text RestText
+	assert.Error(t, json.Unmarshal([]byte(`42`), &text))
+}
+
+func TestTransformText(t *testing.T) {
+	text := NewLocalizedText("Hello", map[string]string{"ko-KR": "안녕"}, "greeting")
+	assert.Equal(t, text, ExtractText(TransformText(text)))
+	assert.False(t, ExtractText(RestText{Default: "Hello"}).Localized())
+}
@@ -0,0 +1,90 @@
+package localization
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lookup finds the translation of a key of the tenant's string table for a locale
+type Lookup func(key string, locale string) (string, bool)
+
+// Text is text shown to the character. It holds default text, translations by locale, a key into the tenant's string
+// table, or a combination of them.
+type Text struct {
+	value   string
+	locales map[string]string
+	key     string
+}
+
+// NewText creates text shown as written in every locale
+func NewText(value string) Text {
+	return Text{value: value}
+}
+
+// NewLocalizedText creates text translated by locale, or looked up by key in the tenant's string table. The value is
+// shown when no translation exists for the locale.
+func NewLocalizedText(value string, locales map[string]string, key string) Text {
+	return Text{value: value, locales: locales, key: key}
+}
+
+// Default returns the text shown when no translation exists for the locale
+func (t Text) Default() string {
+	return t.value
+}
+
+// Locales returns the translations of the text by locale
+func (t Text) Locales() map[string]string {
+	return t.locales
+}
+
+// Key returns the key of the text in the tenant's string table, or empty if the text is not in the string table
+func (t Text) Key() string {
+	return t.key
+}
+
+// Localized returns true if the text has translations or a key into the string table
+func (t Text) Localized() bool {
+	return len(t.locales) > 0 || t.key != ""
+}
+
+// Empty returns true if the text has neither default text, translations nor a key
+func (t Text) Empty() bool {
+	return t.value == "" && !t.Localized()
+}
+
+// Translation returns the translation of the text for the locale, from the text's own translations or the string
+// table. A locale with a region, such as ko-KR, falls back to its language, ko.
+func (t Text) Translation(locale string, lookup Lookup) (string, bool) {
+	for _, candidate := range withLanguage(locale) {
+		if s, ok := t.locales[candidate]; ok {
+			return s, true
+		}
+		if t.key != "" && lookup != nil {
+			if s, ok := lookup(t.key, candidate); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Resolve returns the translation of the text for the first of the locales translated, or the default text
+func (t Text) Resolve(locales []string, lookup Lookup) (string, error) {
+	for _, locale := range locales {
+		if s, ok := t.Translation(locale, lookup); ok {
+			return s, nil
+		}
+	}
+	if t.value == "" && t.key != "" {
+		return "", fmt.Errorf("key [%s] is not translated for locales %v", t.key, locales)
+	}
+	return t.Default(), nil
+}
+
+// withLanguage returns the locale followed by its language, when the locale has a region
+func withLanguage(locale string) []string {
+	if language, _, ok := strings.Cut(locale, "-"); ok && language != "" {
+		return []string{locale, language}
+	}
+	return []string{locale}
+}
@@ -0,0 +1,61 @@
+package localization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestLookup(table map[string]map[string]string) Lookup {
+	return func(key string, locale string) (string, bool) {
+		s, ok := table[key][locale]
+		return s, ok
+	}
+}
+
+func TestText_Resolve(t *testing.T) {
+	lookup := createTestLookup(map[string]map[string]string{
+		"greeting": {"ko": "안녕하세요", "ja-JP": "こんにちは"},
+	})
+
+	tests := []struct {
+		name     string
+		text     Text
+		locales  []string
+		expected string
+	}{
+		{name: "plain text", text: NewText("Hello"), locales: []string{"ko-KR"}, expected: "Hello"},
+		{name: "inline locale", text: NewLocalizedText("Hello", map[string]string{"ko-KR": "안녕"}, ""), locales: []string{"ko-KR"}, expected: "안녕"},
+		{name: "inline language of locale", text: NewLocalizedText("Hello", map[string]string{"ko": "안녕"}, ""), locales: []string{"ko-KR"}, expected: "안녕"},
+		{name: "string table", text: NewLocalizedText("Hello", nil, "greeting"), locales: []string{"ja-JP"}, expected: "こんにちは"},
+		{name: "string table language of locale", text: NewLocalizedText("Hello", nil, "greeting"), locales: []string{"ko-KR"}, expected: "안녕하세요"},
+		{name: "inline ahead of string table", text: NewLocalizedText("Hello", map[string]string{"ko-KR": "안녕"}, "greeting"), locales: []string{"ko-KR"}, expected: "안녕"},
+		{name: "first translated locale", text: NewLocalizedText("Hello", nil, "greeting"), locales: []string{"th-TH", "ja-JP", "ko-KR"}, expected: "こんにちは"},
+		{name: "default when untranslated", text: NewLocalizedText("Hello", map[string]string{"ko-KR": "안녕"}, "greeting"), locales: []string{"th-TH", "en-US"}, expected: "Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := tt.text.Resolve(tt.locales, lookup)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, text)
+		})
+	}
+}
+
+func TestText_Resolve_Errors(t *testing.T) {
+	_, err := NewLocalizedText("", nil, "missing").Resolve([]string{"en-US"}, createTestLookup(nil))
+	assert.Error(t, err, "keys with no translation and no default cannot be shown")
+
+	text, err := NewLocalizedText("Hello", nil, "greeting").Resolve([]string{"ko-KR"}, nil)
+	require.NoError(t, err, "a missing string table falls back to the default")
+	assert.Equal(t, "Hello", text)
+}
+
+func TestText_Empty(t *testing.T) {
+	assert.True(t, NewText("").Empty())
+	assert.False(t, NewText("Hello").Empty())
+	assert.False(t, NewLocalizedText("", nil, "greeting").Empty())
+	assert.False(t, NewLocalizedText("", map[string]string{"ko": "안녕"}, "").Empty())
+}
@@ -5,6 +5,8 @@ import (
 	"atlas-npc-conversations/database"
 	"atlas-npc-conversations/kafka/consumer/character"
 	"atlas-npc-conversations/kafka/consumer/npc"
+	"atlas-npc-conversations/kafka/consumer/saga"
+	"atlas-npc-conversations/localization"
 	"atlas-npc-conversations/logger"
 	"atlas-npc-conversations/service"
 	"atlas-npc-conversations/tracing"
@@ -47,20 +49,26 @@ func main() {
 		l.WithError(err).Fatal("Unable to initialize tracer.")
 	}
 
-	db := database.Connect(l, database.SetMigrations(conversation.MigrateTable))
+	db := database.Connect(l, database.SetMigrations(conversation.MigrateTable, conversation.MigrateSessionTable, localization.MigrateTable))
+
+	conversation.InitSessionStore(l, db)
+	conversation.InitSweeper(l, tdm.Context(), tdm.WaitGroup())
 
 	cmf := consumer.GetManager().AddConsumer(l, tdm.Context(), tdm.WaitGroup())
 	character.InitConsumers(l)(cmf)(consumerGroupId)
 	npc.InitConsumers(l)(cmf)(consumerGroupId)
+	saga.InitConsumers(l)(cmf)(consumerGroupId)
 
 	character.InitHandlers(l, db)(consumer.GetManager().RegisterHandler)
 	npc.InitHandlers(l, db)(consumer.GetManager().RegisterHandler)
+	saga.InitHandlers(l, db)(consumer.GetManager().RegisterHandler)
 
 	server.New(l).
 		WithContext(tdm.Context()).
 		WithWaitGroup(tdm.WaitGroup()).
 		SetBasePath(GetServer().GetPrefix()).
 		SetPort(os.Getenv("REST_PORT")).
+		AddRouteInitializer(localization.InitResource(GetServer())(db)).
 		AddRouteInitializer(conversation.InitResource(GetServer())(db)).
 		Run()
 
@@ -0,0 +1,324 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeKind is the kind of a node of parsed message text
+type NodeKind int
+
+const (
+	// TextNode is text shown as written
+	TextNode NodeKind = iota
+	// SpanNode holds nodes shown in a color or weight other than the default
+	SpanNode
+	// ListItemNode holds the nodes of a selectable list item
+	ListItemNode
+	// ItemNameNode shows the name of an item, #t or #z
+	ItemNameNode
+	// ItemImageNode shows the image of an item, #v or #i
+	ItemImageNode
+	// ItemCountNode shows how many of an item the character holds, #c
+	ItemCountNode
+	// MapNameNode shows the name of a map, #m
+	MapNameNode
+	// NpcNameNode shows the name of an NPC, #p
+	NpcNameNode
+	// MobNameNode shows the name of a monster, #o
+	MobNameNode
+	// SkillImageNode shows the image of a skill, #s
+	SkillImageNode
+	// ProgressBarNode shows a progress bar, #B
+	ProgressBarNode
+	// CharacterNameNode shows the character's name, #h #
+	CharacterNameNode
+	// OptionNode is a numbered dimensional mirror option
+	OptionNode
+	// UnknownNode is a code the client does not understand, kept as written
+	UnknownNode
+)
+
+// referenceKinds maps the codes taking an ID to the kind of node they produce
+var referenceKinds = map[byte]NodeKind{
+	't': ItemNameNode,
+	'z': ItemNameNode,
+	'v': ItemImageNode,
+	'i': ItemImageNode,
+	'c': ItemCountNode,
+	'm': MapNameNode,
+	'p': NpcNameNode,
+	'o': MobNameNode,
+	's': SkillImageNode,
+	'B': ProgressBarNode,
+}
+
+// Color is the color of text, named by its code
+type Color byte
+
+const (
+	Black  Color = 'k'
+	Blue   Color = 'b'
+	Red    Color = 'r'
+	Green  Color = 'g'
+	Purple Color = 'd'
+)
+
+// String returns the name of the color
+func (c Color) String() string {
+	switch c {
+	case Blue:
+		return "blue"
+	case Red:
+		return "red"
+	case Green:
+		return "green"
+	case Purple:
+		return "purple"
+	default:
+		return "black"
+	}
+}
+
+// Style is the color and weight of text
+type Style struct {
+	color Color
+	bold  bool
+}
+
+// Color returns the color of the text
+func (s Style) Color() Color {
+	return s.color
+}
+
+// Bold returns true if the text is bold
+func (s Style) Bold() bool {
+	return s.bold
+}
+
+// plain returns true if the style is the default black, normal weight text
+func (s Style) plain() bool {
+	return s.color == Black && !s.bold
+}
+
+// Node is a node of parsed message text
+type Node struct {
+	kind     NodeKind
+	code     byte
+	text     string
+	value    uint32
+	style    Style
+	children []Node
+	position int
+}
+
+// Kind returns the kind of the node
+func (n Node) Kind() NodeKind {
+	return n.kind
+}
+
+// Code returns the letter of the code the node was parsed from, or zero for text and spans
+func (n Node) Code() byte {
+	return n.code
+}
+
+// Text returns the text of a text node, or the code as written for unknown codes
+func (n Node) Text() string {
+	return n.text
+}
+
+// Value returns the ID of a reference, the index of a list item or option, or the amount of a progress bar
+func (n Node) Value() uint32 {
+	return n.value
+}
+
+// Style returns the style of a span
+func (n Node) Style() Style {
+	return n.style
+}
+
+// Children returns the nodes held by a span or list item
+func (n Node) Children() []Node {
+	return n.children
+}
+
+// Position returns the byte offset in the text the node starts at
+func (n Node) Position() int {
+	return n.position
+}
+
+// Document is parsed message text
+type Document struct {
+	nodes  []Node
+	issues []Issue
+}
+
+// Nodes returns the top level nodes of the text
+func (d Document) Nodes() []Node {
+	return d.nodes
+}
+
+// Issues returns the problems found while parsing the text
+func (d Document) Issues() []Issue {
+	return d.issues
+}
+
+// ListItems returns every list item of the text, in the order they are written
+func (d Document) ListItems() []Node {
+	return collectListItems(d.nodes)
+}
+
+func collectListItems(nodes []Node) []Node {
+	items := make([]Node, 0)
+	for _, n := range nodes {
+		if n.kind == ListItemNode {
+			items = append(items, n)
+		}
+		items = append(items, collectListItems(n.children)...)
+	}
+	return items
+}
+
+// container is a node being built which holds other nodes
+type container struct {
+	node Node
+	span *Node
+}
+
+// Parse parses message text into nodes. Text is parsed leniently: problems are reported as issues and the offending
+// codes are kept as written.
+func Parse(text string) Document {
+	issues := make([]Issue, 0)
+	style := Style{color: Black}
+	root := &container{}
+	var item *container
+
+	current := func() *container {
+		if item != nil {
+			return item
+		}
+		return root
+	}
+	// add places a node in the container, inside a span when the text is styled
+	add := func(n Node) {
+		c := current()
+		if style.plain() {
+			c.node.children = append(c.node.children, n)
+			return
+		}
+		if c.span == nil {
+			c.span = &Node{kind: SpanNode, style: style, position: n.position}
+		}
+		c.span.children = append(c.span.children, n)
+	}
+	// closeSpan ends the span of the container, so the next node starts a new span
+	closeSpan := func(c *container) {
+		if c.span != nil {
+			c.node.children = append(c.node.children, *c.span)
+			c.span = nil
+		}
+	}
+	// closeItem ends the list item, which is always placed at the top level
+	closeItem := func() {
+		closeSpan(item)
+		root.node.children = append(root.node.children, item.node)
+		item = nil
+	}
+
+	for _, t := range Tokenize(text) {
+		switch t.Kind() {
+		case TextToken:
+			add(Node{kind: TextNode, text: t.Text(), position: t.Position()})
+		case StyleToken:
+			closeSpan(current())
+			switch t.Code() {
+			case 'e':
+				style.bold = true
+			case 'n':
+				style.bold = false
+			default:
+				style.color = Color(t.Code())
+			}
+		case OpenListItemToken:
+			if item != nil {
+				issues = append(issues, NewIssue(IssueUnbalancedListItem, fmt.Sprintf("list item [%d] opened at position [%d] is not closed before the next list item", item.node.value, item.node.position), item.node.position))
+				closeItem()
+			}
+			closeSpan(root)
+			item = &container{node: Node{kind: ListItemNode, code: t.Code(), value: t.Value(), position: t.Position()}}
+		case CloseListItemToken:
+			if item == nil {
+				issues = append(issues, NewIssue(IssueUnbalancedListItem, fmt.Sprintf("[#l] at position [%d] closes no list item", t.Position()), t.Position()))
+				continue
+			}
+			closeItem()
+		case ReferenceToken:
+			add(Node{kind: referenceKinds[t.Code()], code: t.Code(), value: t.Value(), position: t.Position()})
+		case CharacterNameToken:
+			add(Node{kind: CharacterNameNode, code: t.Code(), position: t.Position()})
+		case OptionToken:
+			add(Node{kind: OptionNode, value: t.Value(), position: t.Position()})
+		case UnknownToken:
+			issues = append(issues, NewIssue(IssueUnknownCode, fmt.Sprintf("code [%s] at position [%d] is unknown", t.Text(), t.Position()), t.Position()))
+			add(Node{kind: UnknownNode, code: t.Code(), text: t.Text(), position: t.Position()})
+		case MalformedToken:
+			issues = append(issues, NewIssue(IssueMalformedCode, fmt.Sprintf("code [%s] at position [%d] is missing its value or closing [#]", t.Text(), t.Position()), t.Position()))
+			add(Node{kind: UnknownNode, code: t.Code(), text: t.Text(), position: t.Position()})
+		}
+	}
+	if item != nil {
+		issues = append(issues, NewIssue(IssueUnbalancedListItem, fmt.Sprintf("list item [%d] opened at position [%d] is never closed", item.node.value, item.node.position), item.node.position))
+		closeItem()
+	}
+	closeSpan(root)
+	return Document{nodes: root.node.children, issues: issues}
+}
+
+// Preview renders the text as plain text, as a reader would see it. Styles are dropped, and codes the client replaces
+// are shown as bracketed descriptions.
+func (d Document) Preview() string {
+	var sb strings.Builder
+	writePreview(&sb, d.nodes)
+	return sb.String()
+}
+
+func writePreview(sb *strings.Builder, nodes []Node) {
+	for _, n := range nodes {
+		switch n.kind {
+		case TextNode:
+			sb.WriteString(strings.ReplaceAll(n.text, "\r\n", "\n"))
+		case SpanNode:
+			writePreview(sb, n.children)
+		case ListItemNode:
+			sb.WriteString(fmt.Sprintf("[%d] ", n.value))
+			writePreview(sb, n.children)
+		case ItemNameNode:
+			sb.WriteString(fmt.Sprintf("[item %d]", n.value))
+		case ItemImageNode:
+			sb.WriteString(fmt.Sprintf("[item image %d]", n.value))
+		case ItemCountNode:
+			sb.WriteString(fmt.Sprintf("[count of item %d]", n.value))
+		case MapNameNode:
+			sb.WriteString(fmt.Sprintf("[map %d]", n.value))
+		case NpcNameNode:
+			sb.WriteString(fmt.Sprintf("[npc %d]", n.value))
+		case MobNameNode:
+			sb.WriteString(fmt.Sprintf("[monster %d]", n.value))
+		case SkillImageNode:
+			sb.WriteString(fmt.Sprintf("[skill image %d]", n.value))
+		case ProgressBarNode:
+			sb.WriteString(fmt.Sprintf("[progress %d]", n.value))
+		case CharacterNameNode:
+			sb.WriteString("[character name]")
+		case OptionNode:
+			sb.WriteString(fmt.Sprintf("[%d]", n.value))
+		case UnknownNode:
+			sb.WriteString(n.text)
+		}
+	}
+}
+
+// Preview parses message text and renders it as plain text
+func Preview(text string) string {
+	return Parse(text).Preview()
+}
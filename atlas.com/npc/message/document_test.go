@@ -0,0 +1,93 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to summarize issues as their code
+func summarizeIssues(issues []Issue) []string {
+	results := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		results = append(results, issue.Code())
+	}
+	return results
+}
+
+func TestParse(t *testing.T) {
+	d := Parse("Pick one:\r\n#L0##bRed potion#l\r\n#L1##e#t2000001##n#l done")
+	require.Empty(t, d.Issues())
+
+	nodes := d.Nodes()
+	require.Len(t, nodes, 5)
+	assert.Equal(t, TextNode, nodes[0].Kind())
+	assert.Equal(t, "Pick one:\r\n", nodes[0].Text())
+
+	assert.Equal(t, ListItemNode, nodes[1].Kind())
+	assert.Equal(t, uint32(0), nodes[1].Value())
+	require.Len(t, nodes[1].Children(), 1)
+	span := nodes[1].Children()[0]
+	assert.Equal(t, SpanNode, span.Kind())
+	assert.Equal(t, Blue, span.Style().Color())
+	assert.False(t, span.Style().Bold())
+	assert.Equal(t, "Red potion", span.Children()[0].Text())
+
+	// The color persists after the list item, so the line break is blue
+	assert.Equal(t, SpanNode, nodes[2].Kind())
+
+	assert.Equal(t, ListItemNode, nodes[3].Kind())
+	bold := nodes[3].Children()[0]
+	assert.True(t, bold.Style().Bold())
+	assert.Equal(t, Blue, bold.Style().Color())
+	assert.Equal(t, ItemNameNode, bold.Children()[0].Kind())
+	assert.Equal(t, uint32(2000001), bold.Children()[0].Value())
+
+	assert.Len(t, d.ListItems(), 2)
+}
+
+func TestParse_Issues(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "balanced", text: "#L0#One#l#L1#Two#l", expected: []string{}},
+		{name: "unclosed list item", text: "#L0#One", expected: []string{IssueUnbalancedListItem}},
+		{name: "nested list item", text: "#L0#One#L1#Two#l", expected: []string{IssueUnbalancedListItem}},
+		{name: "stray close", text: "One#l", expected: []string{IssueUnbalancedListItem}},
+		{name: "unknown code", text: "#xOne", expected: []string{IssueUnknownCode}},
+		{name: "malformed code", text: "#tapple#", expected: []string{IssueMalformedCode, IssueMalformedCode}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, summarizeIssues(Parse(tt.text).Issues()))
+		})
+	}
+}
+
+func TestLint_ListIndices(t *testing.T) {
+	text := "#L0#One#l#L2#Three#l"
+	assert.Empty(t, Lint(text, nil))
+	assert.Empty(t, Lint(text, []int{0, 1, 2}))
+	assert.Equal(t, []string{IssueListIndexMismatch}, summarizeIssues(Lint(text, []int{0, 1})))
+	assert.Equal(t, []string{IssueListIndexMismatch, IssueListIndexMismatch}, summarizeIssues(Lint(text, []int{})))
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "Hello #h #, bring #b#c4000000##k of #t4000000##v4000000#", expected: "Hello [character name], bring [count of item 4000000] of [item 4000000][item image 4000000]"},
+		{text: "Where to?\r\n#L0##m100000000##l\r\n#L1##p9010000##l", expected: "Where to?\n[0] [map 100000000]\n[1] [npc 9010000]"},
+		{text: "Hunt #o100100# #s1001# #B50# #0# Mirror", expected: "Hunt [monster 100100] [skill image 1001] [progress 50] [0] Mirror"},
+		{text: "Keep #x and ${context.name}", expected: "Keep #x and ${context.name}"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Preview(tt.text))
+	}
+}
@@ -0,0 +1,60 @@
+package message
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// IssueUnknownCode is reported for a code the client does not understand
+	IssueUnknownCode = "UNKNOWN_TEXT_CODE"
+	// IssueMalformedCode is reported for a code missing its value or closing marker
+	IssueMalformedCode = "MALFORMED_TEXT_CODE"
+	// IssueUnbalancedListItem is reported for a #L without a #l, or a #l without a #L
+	IssueUnbalancedListItem = "UNBALANCED_LIST_ITEM"
+	// IssueListIndexMismatch is reported for a list item whose index is not a choice which can be selected
+	IssueListIndexMismatch = "LIST_INDEX_MISMATCH"
+)
+
+// Issue is a problem found in message text. Issues do not prevent the text from being sent.
+type Issue struct {
+	code     string
+	detail   string
+	position int
+}
+
+// NewIssue creates an issue found at the byte offset in the text
+func NewIssue(code string, detail string, position int) Issue {
+	return Issue{code: code, detail: detail, position: position}
+}
+
+// Code returns the kind of problem
+func (i Issue) Code() string {
+	return i.code
+}
+
+// Detail returns a description of the problem
+func (i Issue) Detail() string {
+	return i.detail
+}
+
+// Position returns the byte offset in the text of the problem
+func (i Issue) Position() int {
+	return i.position
+}
+
+// Lint parses message text and returns its issues, along with a list index mismatch for each list item whose index is
+// not one of the selectable indices. Nil indices skip the list index check.
+func Lint(text string, indices []int) []Issue {
+	d := Parse(text)
+	issues := d.Issues()
+	if indices == nil {
+		return issues
+	}
+	for _, item := range d.ListItems() {
+		if !slices.Contains(indices, int(item.Value())) {
+			issues = append(issues, NewIssue(IssueListIndexMismatch, fmt.Sprintf("list item [%d] at position [%d] does not match a choice which can be selected", item.Value(), item.Position()), item.Position()))
+		}
+	}
+	return issues
+}
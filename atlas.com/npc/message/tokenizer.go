@@ -0,0 +1,158 @@
+package message
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CodeMarker starts and ends every message code
+const CodeMarker = '#'
+
+// TokenKind is the kind of a token of message text
+type TokenKind int
+
+const (
+	// TextToken is text shown as written
+	TextToken TokenKind = iota
+	// StyleToken changes the color or weight of the text which follows, such as #b
+	StyleToken
+	// OpenListItemToken starts a selectable list item, such as #L0#
+	OpenListItemToken
+	// CloseListItemToken ends a selectable list item, #l
+	CloseListItemToken
+	// ReferenceToken is replaced by the client with the name or image of an ID, such as #t4000000#
+	ReferenceToken
+	// CharacterNameToken is replaced by the client with the character's name, #h #
+	CharacterNameToken
+	// OptionToken is a numbered dimensional mirror option, such as #0#
+	OptionToken
+	// UnknownToken is a code the client does not understand
+	UnknownToken
+	// MalformedToken is a code missing its value or closing marker
+	MalformedToken
+)
+
+// styleCodes are the codes changing the color or weight of text
+var styleCodes = map[byte]bool{'b': true, 'r': true, 'g': true, 'd': true, 'k': true, 'e': true, 'n': true}
+
+// referenceCodes are the codes taking an ID, closed by a marker
+var referenceCodes = map[byte]bool{'t': true, 'z': true, 'v': true, 'i': true, 'c': true, 'm': true, 'p': true, 'o': true, 's': true, 'B': true}
+
+// Token is a piece of message text
+type Token struct {
+	kind     TokenKind
+	code     byte
+	text     string
+	value    uint32
+	position int
+}
+
+// Kind returns the kind of the token
+func (t Token) Kind() TokenKind {
+	return t.kind
+}
+
+// Code returns the letter following the marker of a code, or zero for text
+func (t Token) Code() byte {
+	return t.code
+}
+
+// Text returns the token as written
+func (t Token) Text() string {
+	return t.text
+}
+
+// Value returns the ID, list index or amount of the code
+func (t Token) Value() uint32 {
+	return t.value
+}
+
+// Position returns the byte offset of the token in the text
+func (t Token) Position() int {
+	return t.position
+}
+
+// Tokenize splits message text into text and codes. Text which cannot be parsed as a code is returned as an unknown
+// or malformed token rather than an error, as text is typed in by hand.
+func Tokenize(text string) []Token {
+	tokens := make([]Token, 0)
+	var pending strings.Builder
+	pendingAt := 0
+	flush := func() {
+		if pending.Len() > 0 {
+			tokens = append(tokens, Token{kind: TextToken, text: pending.String(), position: pendingAt})
+			pending.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] != CodeMarker {
+			if pending.Len() == 0 {
+				pendingAt = i
+			}
+			pending.WriteByte(text[i])
+			i++
+			continue
+		}
+		flush()
+		t := readCode(text, i)
+		tokens = append(tokens, t)
+		i += len(t.text)
+	}
+	flush()
+	return tokens
+}
+
+// readCode reads the code starting at the marker at the position
+func readCode(text string, position int) Token {
+	if position+1 >= len(text) {
+		return Token{kind: MalformedToken, text: text[position:], position: position}
+	}
+	code := text[position+1]
+	switch {
+	case styleCodes[code]:
+		return Token{kind: StyleToken, code: code, text: text[position : position+2], position: position}
+	case code == 'l':
+		return Token{kind: CloseListItemToken, code: code, text: text[position : position+2], position: position}
+	case code == 'h':
+		if strings.HasPrefix(text[position+2:], " #") {
+			return Token{kind: CharacterNameToken, code: code, text: text[position : position+4], position: position}
+		}
+		return Token{kind: MalformedToken, code: code, text: text[position : position+2], position: position}
+	case code == 'L' || referenceCodes[code]:
+		kind := ReferenceToken
+		if code == 'L' {
+			kind = OpenListItemToken
+		}
+		value, end, ok := readValue(text, position+2)
+		if !ok {
+			return Token{kind: MalformedToken, code: code, text: text[position : position+2], position: position}
+		}
+		return Token{kind: kind, code: code, text: text[position:end], value: value, position: position}
+	case code >= '0' && code <= '9':
+		value, end, ok := readValue(text, position+1)
+		if !ok {
+			return Token{kind: MalformedToken, text: text[position : position+1], position: position}
+		}
+		return Token{kind: OptionToken, text: text[position:end], value: value, position: position}
+	default:
+		return Token{kind: UnknownToken, code: code, text: text[position : position+2], position: position}
+	}
+}
+
+// readValue reads the digits starting at the position and the marker closing them, returning the position after the
+// marker
+func readValue(text string, position int) (uint32, int, bool) {
+	end := position
+	for end < len(text) && text[end] >= '0' && text[end] <= '9' {
+		end++
+	}
+	if end == position || end >= len(text) || text[end] != CodeMarker {
+		return 0, 0, false
+	}
+	value, err := strconv.ParseUint(text[position:end], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint32(value), end + 1, true
+}
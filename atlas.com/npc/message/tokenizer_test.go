@@ -0,0 +1,77 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenKindNames names the token kinds in test expectations
+var tokenKindNames = map[TokenKind]string{
+	TextToken:          "text",
+	StyleToken:         "style",
+	OpenListItemToken:  "open",
+	CloseListItemToken: "close",
+	ReferenceToken:     "reference",
+	CharacterNameToken: "name",
+	OptionToken:        "option",
+	UnknownToken:       "unknown",
+	MalformedToken:     "malformed",
+}
+
+// Helper function to summarize tokens as their kind and text
+func summarizeTokens(tokens []Token) []string {
+	results := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		results = append(results, tokenKindNames[t.Kind()]+" "+t.Text())
+	}
+	return results
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "plain text", text: "Hello there", expected: []string{"text Hello there"}},
+		{name: "styles", text: "#bBlue#k and #eBold#n", expected: []string{"style #b", "text Blue", "style #k", "text  and ", "style #e", "text Bold", "style #n"}},
+		{name: "list item", text: "#L0#First#l", expected: []string{"open #L0#", "text First", "close #l"}},
+		{name: "references", text: "#t4000000##v4000000##m100000000##p9010000##o100100##B50#", expected: []string{"reference #t4000000#", "reference #v4000000#", "reference #m100000000#", "reference #p9010000#", "reference #o100100#", "reference #B50#"}},
+		{name: "character name", text: "Hi #h #!", expected: []string{"text Hi ", "name #h #", "text !"}},
+		{name: "mirror option", text: "#0# Henesys", expected: []string{"option #0#", "text  Henesys"}},
+		{name: "unknown code", text: "#xOops", expected: []string{"unknown #x", "text Oops"}},
+		{name: "missing value", text: "#t#", expected: []string{"malformed #t", "malformed #"}},
+		{name: "missing closing marker", text: "#t4000000 apples", expected: []string{"malformed #t", "text 4000000 apples"}},
+		{name: "trailing marker", text: "Price: 5#", expected: []string{"text Price: 5", "malformed #"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, summarizeTokens(Tokenize(tt.text)))
+		})
+	}
+}
+
+func TestTokenize_Values(t *testing.T) {
+	tokens := Tokenize("Bring #c4031013# of #z4031013#")
+	assert.Len(t, tokens, 4)
+	assert.Equal(t, byte('c'), tokens[1].Code())
+	assert.Equal(t, uint32(4031013), tokens[1].Value())
+	assert.Equal(t, 6, tokens[1].Position())
+	assert.Equal(t, byte('z'), tokens[3].Code())
+}
+
+func TestTokenize_Builder(t *testing.T) {
+	text := NewBuilder().AddText("Pick").NewLine().
+		OpenItem(0).BlueText().ShowItemName1(2000000).CloseItem().NewLine().
+		OpenItem(1).RedText().ShowMap(100000000).BlackText().CloseItem().
+		ShowCharacterName().ShowItemImage2(2000000).ShowItemCount(2000000).ShowNPC(9010000).ShowMonsterName(100100).
+		ShowSkillImage(1001).ShowProgressBar(10).ShowItemImage1(1).ShowItemName2(1).PurpleText().GreenText().BoldText().NormalText().
+		DimensionalMirrorOption(3, "Option").String()
+
+	for _, token := range Tokenize(text) {
+		assert.NotEqual(t, UnknownToken, token.Kind(), token.Text())
+		assert.NotEqual(t, MalformedToken, token.Kind(), token.Text())
+	}
+}
@@ -36,6 +36,10 @@ type Processor interface {
 	SendNextPrevious(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32) TalkFunc
 	SendOk(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32) TalkFunc
 	SendYesNo(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32) TalkFunc
+	SendAcceptDecline(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32) TalkFunc
+	SendGetNumber(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, defaultValue int32, minValue int32, maxValue int32) TalkFunc
+	SendGetText(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, defaultValue string, minLength uint16, maxLength uint16) TalkFunc
+	SendStyle(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, styles []uint32) TalkFunc
 	SendNPCTalk(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, config *TalkConfig) func(message string, configurations ...TalkConfigurator)
 }
 
@@ -92,6 +96,40 @@ func (p *ProcessorImpl) SendYesNo(worldId world.Id, channelId channel.Id, charac
 	return p.SendNPCTalk(worldId, channelId, characterId, npcId, &TalkConfig{messageType: MessageTypeYesNo, speaker: SpeakerNPCLeft})
 }
 
+func (p *ProcessorImpl) SendAcceptDecline(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32) TalkFunc {
+	return p.SendNPCTalk(worldId, channelId, characterId, npcId, &TalkConfig{messageType: MessageTypeAcceptDecline, speaker: SpeakerNPCLeft})
+}
+
+func (p *ProcessorImpl) SendGetNumber(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, defaultValue int32, minValue int32, maxValue int32) TalkFunc {
+	return func(message string, configurations ...TalkConfigurator) {
+		config := &TalkConfig{messageType: MessageTypeNum, speaker: SpeakerNPCLeft}
+		for _, configuration := range configurations {
+			configuration(config)
+		}
+		_ = producer.ProviderImpl(p.l)(p.ctx)(npc2.EnvConversationCommandTopic)(numberConversationProvider(worldId, channelId, characterId, npcId, message, config.Speaker(), defaultValue, minValue, maxValue))
+	}
+}
+
+func (p *ProcessorImpl) SendGetText(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, defaultValue string, minLength uint16, maxLength uint16) TalkFunc {
+	return func(message string, configurations ...TalkConfigurator) {
+		config := &TalkConfig{messageType: MessageTypeText, speaker: SpeakerNPCLeft}
+		for _, configuration := range configurations {
+			configuration(config)
+		}
+		_ = producer.ProviderImpl(p.l)(p.ctx)(npc2.EnvConversationCommandTopic)(textConversationProvider(worldId, channelId, characterId, npcId, message, config.Speaker(), defaultValue, minLength, maxLength))
+	}
+}
+
+func (p *ProcessorImpl) SendStyle(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, styles []uint32) TalkFunc {
+	return func(message string, configurations ...TalkConfigurator) {
+		config := &TalkConfig{messageType: MessageTypeStyle, speaker: SpeakerNPCLeft}
+		for _, configuration := range configurations {
+			configuration(config)
+		}
+		_ = producer.ProviderImpl(p.l)(p.ctx)(npc2.EnvConversationCommandTopic)(styleConversationProvider(worldId, channelId, characterId, npcId, message, config.Speaker(), styles))
+	}
+}
+
 func (p *ProcessorImpl) SendNPCTalk(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, config *TalkConfig) func(message string, configurations ...TalkConfigurator) {
 	return func(message string, configurations ...TalkConfigurator) {
 		for _, configuration := range configurations {
@@ -37,3 +37,56 @@ func simpleConversationProvider(worldId world.Id, channelId channel.Id, characte
 	}
 	return producer.SingleMessageProvider(key, value)
 }
+
+func numberConversationProvider(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, message string, speaker string, defaultValue int32, minValue int32, maxValue int32) model.Provider[[]kafka.Message] {
+	key := producer.CreateKey(int(characterId))
+	value := &npc2.ConversationCommand[npc2.CommandNumberBody]{
+		WorldId:     byte(worldId),
+		ChannelId:   byte(channelId),
+		CharacterId: characterId,
+		NpcId:       npcId,
+		Speaker:     speaker,
+		Message:     message,
+		Type:        npc2.CommandTypeNumber,
+		Body: npc2.CommandNumberBody{
+			DefaultValue: defaultValue,
+			MinValue:     minValue,
+			MaxValue:     maxValue,
+		},
+	}
+	return producer.SingleMessageProvider(key, value)
+}
+
+func styleConversationProvider(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, message string, speaker string, styles []uint32) model.Provider[[]kafka.Message] {
+	key := producer.CreateKey(int(characterId))
+	value := &npc2.ConversationCommand[npc2.CommandStyleBody]{
+		WorldId:     byte(worldId),
+		ChannelId:   byte(channelId),
+		CharacterId: characterId,
+		NpcId:       npcId,
+		Speaker:     speaker,
+		Message:     message,
+		Type:        npc2.CommandTypeStyle,
+		Body:        npc2.CommandStyleBody{Styles: styles},
+	}
+	return producer.SingleMessageProvider(key, value)
+}
+
+func textConversationProvider(worldId world.Id, channelId channel.Id, characterId uint32, npcId uint32, message string, speaker string, defaultValue string, minLength uint16, maxLength uint16) model.Provider[[]kafka.Message] {
+	key := producer.CreateKey(int(characterId))
+	value := &npc2.ConversationCommand[npc2.CommandTextBody]{
+		WorldId:     byte(worldId),
+		ChannelId:   byte(channelId),
+		CharacterId: characterId,
+		NpcId:       npcId,
+		Speaker:     speaker,
+		Message:     message,
+		Type:        npc2.CommandTypeText,
+		Body: npc2.CommandTextBody{
+			DefaultValue: defaultValue,
+			MinLength:    minLength,
+			MaxLength:    maxLength,
+		},
+	}
+	return producer.SingleMessageProvider(key, value)
+}
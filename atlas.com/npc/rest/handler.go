@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Chronicle20/atlas-rest/server"
 	"github.com/google/uuid"
@@ -124,3 +125,52 @@ func ParseNpcId(l logrus.FieldLogger, next NpcIdHandler) http.HandlerFunc {
 		next(npcId)(w, r)
 	}
 }
+
+type StringIdHandler func(stringId uuid.UUID) http.HandlerFunc
+
+func ParseStringId(l logrus.FieldLogger, next StringIdHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stringIdStr := mux.Vars(r)["stringId"]
+		stringId, err := uuid.Parse(stringIdStr)
+		if err != nil {
+			l.WithError(err).Errorf("Unable to properly parse stringId from path.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(stringId)(w, r)
+	}
+}
+
+// ErrorDocument is a JSON:API document holding error objects
+type ErrorDocument struct {
+	Errors []jsonapi.Error `json:"errors"`
+}
+
+// WriteWithMeta writes a JSON:API document of the resource with the given status, carrying the meta as its top-level
+// meta
+func WriteWithMeta(l logrus.FieldLogger, w http.ResponseWriter, si jsonapi.ServerInformation, status int, resource interface{}, meta map[string]interface{}) {
+	doc, err := jsonapi.MarshalToStruct(resource, si)
+	if err != nil {
+		l.WithError(err).Errorf("Marshalling resource.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	doc.Meta = meta
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(doc)
+	if err != nil {
+		l.WithError(err).Errorf("Writing document.")
+	}
+}
+
+// WriteErrors writes a JSON:API error document with the given status
+func WriteErrors(l logrus.FieldLogger, w http.ResponseWriter, status int, errs []jsonapi.Error) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(ErrorDocument{Errors: errs})
+	if err != nil {
+		l.WithError(err).Errorf("Writing error document.")
+	}
+}
@@ -41,14 +41,20 @@ func (b *Builder) SetInitiatedBy(initiatedBy string) *Builder {
 
 // AddStep adds a step to the saga
 func (b *Builder) AddStep(stepId string, status Status, action Action, payload any) *Builder {
+	return b.AddCompensatedStep(stepId, status, action, payload, nil)
+}
+
+// AddCompensatedStep adds a step to the saga with the compensation undoing it, or nil if it cannot be undone
+func (b *Builder) AddCompensatedStep(stepId string, status Status, action Action, payload any, compensation *Compensation) *Builder {
 	now := time.Now()
 	step := Step[any]{
-		StepId:    stepId,
-		Status:    status,
-		Action:    action,
-		Payload:   payload,
-		CreatedAt: now,
-		UpdatedAt: now,
+		StepId:       stepId,
+		Status:       status,
+		Action:       action,
+		Payload:      payload,
+		Compensation: compensation,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
 	b.steps = append(b.steps, step)
 	return b
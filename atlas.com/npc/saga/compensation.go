@@ -0,0 +1,64 @@
+package saga
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Compensation is the action undoing a completed step, with the payload the action requires
+type Compensation struct {
+	Action  Action `json:"action"`  // The Action undoing the step (e.g., destroy_asset undoing award_inventory)
+	Payload any    `json:"payload"` // Data required for the action (specific to the action type)
+}
+
+// UnmarshalJSON decodes the payload by the type registered for the action
+func (c *Compensation) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		Action  Action          `json:"action"`
+		Payload json.RawMessage `json:"payload"`
+	}{}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	payload, err := unmarshalPayload(aux.Action, aux.Payload)
+	if err != nil {
+		return err
+	}
+	c.Action = aux.Action
+	c.Payload = payload
+	return nil
+}
+
+// CompensationStepId returns the ID of the step compensating the step
+func CompensationStepId(stepId string) string {
+	return fmt.Sprintf("%s-compensation", stepId)
+}
+
+// RollbackPlan returns the pending steps undoing the completed steps of a failing saga, starting from the furthest
+// completed step and working back to the first. Completed steps without a compensation cannot be undone and are
+// skipped. Returns no steps when the saga is not failing.
+func (s *Saga) RollbackPlan() []Step[any] {
+	plan := make([]Step[any], 0)
+	if !s.Failing() {
+		return plan
+	}
+
+	now := time.Now()
+	for i := s.FindFurthestCompletedStepIndex(); i >= 0; i-- {
+		step := s.Steps[i]
+		if step.Status != Completed || step.Compensation == nil {
+			continue
+		}
+		plan = append(plan, Step[any]{
+			StepId:    CompensationStepId(step.StepId),
+			Status:    Pending,
+			Action:    step.Compensation.Action,
+			Payload:   step.Compensation.Payload,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	return plan
+}
@@ -0,0 +1,96 @@
+package saga
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to create a saga paying mesos, taking an item, then warping, with the given step statuses
+func createTestSaga(statuses ...Status) Saga {
+	payment := AwardMesosPayload{CharacterId: 1, Amount: -1000000}
+	refund := AwardMesosPayload{CharacterId: 1, Amount: 1000000}
+	destroy := DestroyAssetPayload{CharacterId: 1, TemplateId: 4001126, Quantity: 10}
+	award := AwardItemActionPayload{CharacterId: 1, Item: ItemPayload{TemplateId: 4001126, Quantity: 10}}
+
+	s := NewBuilder().
+		SetTransactionId(uuid.New()).
+		SetSagaType(InventoryTransaction).
+		SetInitiatedBy("test").
+		AddCompensatedStep("pay", Pending, AwardMesos, payment, &Compensation{Action: AwardMesos, Payload: refund}).
+		AddCompensatedStep("take", Pending, DestroyAsset, destroy, &Compensation{Action: AwardInventory, Payload: award}).
+		AddStep("level", Pending, AwardLevel, AwardLevelPayload{CharacterId: 1, Amount: 1}).
+		AddStep("warp", Pending, WarpToPortal, WarpToPortalPayload{CharacterId: 1, PortalId: 0}).
+		Build()
+	for i, status := range statuses {
+		s.SetStepStatus(i, status)
+	}
+	return s
+}
+
+func TestSaga_RollbackPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []Status
+		expected []Action
+	}{
+		{name: "Pending", statuses: []Status{Pending, Pending, Pending, Pending}, expected: []Action{}},
+		{name: "Completed", statuses: []Status{Completed, Completed, Completed, Completed}, expected: []Action{}},
+		{name: "First step fails", statuses: []Status{Failed, Pending, Pending, Pending}, expected: []Action{}},
+		{name: "Second step fails", statuses: []Status{Completed, Failed, Pending, Pending}, expected: []Action{AwardMesos}},
+		{name: "Last step fails", statuses: []Status{Completed, Completed, Completed, Failed}, expected: []Action{AwardInventory, AwardMesos}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := createTestSaga(tt.statuses...)
+			plan := s.RollbackPlan()
+
+			actions := make([]Action, 0, len(plan))
+			for _, step := range plan {
+				assert.Equal(t, Pending, step.Status)
+				actions = append(actions, step.Action)
+			}
+			assert.Equal(t, tt.expected, actions)
+		})
+	}
+}
+
+func TestSaga_RollbackPlan_Payloads(t *testing.T) {
+	s := createTestSaga(Completed, Completed, Failed, Pending)
+	plan := s.RollbackPlan()
+	require.Len(t, plan, 2)
+
+	assert.Equal(t, CompensationStepId("take"), plan[0].StepId)
+	assert.Equal(t, AwardItemActionPayload{CharacterId: 1, Item: ItemPayload{TemplateId: 4001126, Quantity: 10}}, plan[0].Payload)
+	assert.Equal(t, CompensationStepId("pay"), plan[1].StepId)
+	assert.Equal(t, AwardMesosPayload{CharacterId: 1, Amount: 1000000}, plan[1].Payload)
+}
+
+func TestStep_CompensationJSON(t *testing.T) {
+	s := createTestSaga()
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+
+	var decoded Saga
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Len(t, decoded.Steps, 4)
+
+	require.NotNil(t, decoded.Steps[0].Compensation)
+	assert.Equal(t, AwardMesos, decoded.Steps[0].Compensation.Action)
+	assert.Equal(t, AwardMesosPayload{CharacterId: 1, Amount: 1000000}, decoded.Steps[0].Compensation.Payload)
+	require.NotNil(t, decoded.Steps[1].Compensation)
+	assert.Equal(t, AwardItemActionPayload{CharacterId: 1, Item: ItemPayload{TemplateId: 4001126, Quantity: 10}}, decoded.Steps[1].Compensation.Payload)
+	assert.Nil(t, decoded.Steps[3].Compensation)
+
+	// Steps which cannot be undone are sent without a compensation
+	var raw struct {
+		Steps []map[string]json.RawMessage `json:"steps"`
+	}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Contains(t, raw.Steps[0], "compensation")
+	assert.NotContains(t, raw.Steps[3], "compensation")
+}
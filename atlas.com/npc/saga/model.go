@@ -3,7 +3,6 @@ package saga
 import (
 	"atlas-npc-conversations/validation"
 	"encoding/json"
-	"fmt"
 	"github.com/Chronicle20/atlas-constants/channel"
 	"github.com/Chronicle20/atlas-constants/field"
 	"github.com/Chronicle20/atlas-constants/job"
@@ -104,17 +103,19 @@ const (
 	ChangeJob              Action = "change_job"
 	CreateSkill            Action = "create_skill"
 	UpdateSkill            Action = "update_skill"
+	ChangeStyle            Action = "change_style"
 	ValidateCharacterState Action = "validate_character_state"
 )
 
 // Step represents a single step within a saga.
 type Step[T any] struct {
-	StepId    string    `json:"stepId"`    // Unique ID for the step
-	Status    Status    `json:"status"`    // Status of the step (e.g., pending, completed, failed)
-	Action    Action    `json:"action"`    // The Action to be taken (e.g., validate_inventory, deduct_inventory)
-	Payload   T         `json:"payload"`   // Data required for the action (specific to the action type)
-	CreatedAt time.Time `json:"createdAt"` // Timestamp of when the step was created
-	UpdatedAt time.Time `json:"updatedAt"` // Timestamp of the last update to the step
+	StepId       string        `json:"stepId"`                 // Unique ID for the step
+	Status       Status        `json:"status"`                 // Status of the step (e.g., pending, completed, failed)
+	Action       Action        `json:"action"`                 // The Action to be taken (e.g., validate_inventory, deduct_inventory)
+	Payload      T             `json:"payload"`                // Data required for the action (specific to the action type)
+	Compensation *Compensation `json:"compensation,omitempty"` // How to undo the step once completed, if it can be undone
+	CreatedAt    time.Time     `json:"createdAt"`              // Timestamp of when the step was created
+	UpdatedAt    time.Time     `json:"updatedAt"`              // Timestamp of the last update to the step
 }
 
 // AwardItemActionPayload represents the data needed to execute a specific action in a step.
@@ -201,6 +202,14 @@ type UpdateSkillPayload struct {
 	Expiration  time.Time `json:"expiration"`  // New skill expiration time
 }
 
+// ChangeStylePayload represents the payload required to change a character's hair, face or skin.
+type ChangeStylePayload struct {
+	CharacterId uint32     `json:"characterId"` // CharacterId associated with the action
+	WorldId     world.Id   `json:"worldId"`     // WorldId associated with the action
+	ChannelId   channel.Id `json:"channelId"`   // ChannelId associated with the action
+	StyleId     uint32     `json:"styleId"`     // StyleId of the hair, face or skin to apply
+}
+
 // ValidateCharacterStatePayload represents the payload required to validate a character's state.
 type ValidateCharacterStatePayload struct {
 	CharacterId uint32                      `json:"characterId"` // CharacterId associated with the action
@@ -228,71 +237,12 @@ func (s *Step[T]) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	// Now handle the Payload field based on the Action type (you can customize this)
-	switch s.Action {
-	case AwardInventory:
-		var payload AwardItemActionPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case AwardExperience:
-		var payload AwardExperiencePayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case AwardLevel:
-		var payload AwardLevelPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case AwardMesos:
-		var payload AwardMesosPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case WarpToRandomPortal:
-		var payload WarpToRandomPortalPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case WarpToPortal:
-		var payload WarpToPortalPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case DestroyAsset:
-		var payload DestroyAssetPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case ChangeJob:
-		var payload ChangeJobPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case CreateSkill:
-		var payload CreateSkillPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	case UpdateSkill:
-		var payload UpdateSkillPayload
-		if err := json.Unmarshal(aux.Payload, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal payload for action %s: %w", s.Action, err)
-		}
-		s.Payload = any(payload).(T)
-	default:
-		return fmt.Errorf("unknown action: %s", s.Action)
+	// Now handle the Payload field based on the payload type registered for the Action
+	payload, err := unmarshalPayload(s.Action, aux.Payload)
+	if err != nil {
+		return err
 	}
+	s.Payload = payload.(T)
 
 	return nil
 }
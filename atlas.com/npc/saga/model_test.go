@@ -0,0 +1,26 @@
+package saga
+
+import (
+	"atlas-npc-conversations/validation"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStep_UnmarshalJSON_ValidateCharacterState(t *testing.T) {
+	payload := ValidateCharacterStatePayload{
+		CharacterId: 12345,
+		Conditions:  []validation.ConditionInput{{Type: "item", Operator: ">=", Value: 10, ItemId: "4001126"}},
+	}
+	s := NewBuilder().AddStep("validate", Pending, ValidateCharacterState, payload).Build()
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var decoded Saga
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Len(t, decoded.Steps, 1)
+	assert.Equal(t, ValidateCharacterState, decoded.Steps[0].Action)
+	assert.Equal(t, payload, decoded.Steps[0].Payload)
+}
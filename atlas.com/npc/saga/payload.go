@@ -0,0 +1,61 @@
+package saga
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// payloadDecoder decodes the raw payload of a step
+type payloadDecoder func(data json.RawMessage) (any, error)
+
+var payloadLock sync.RWMutex
+
+// payloadDecoders maps each action to the decoder of the payload its steps carry
+var payloadDecoders = map[Action]payloadDecoder{
+	AwardInventory:         decodePayload[AwardItemActionPayload],
+	AwardExperience:        decodePayload[AwardExperiencePayload],
+	AwardLevel:             decodePayload[AwardLevelPayload],
+	AwardMesos:             decodePayload[AwardMesosPayload],
+	WarpToRandomPortal:     decodePayload[WarpToRandomPortalPayload],
+	WarpToPortal:           decodePayload[WarpToPortalPayload],
+	DestroyAsset:           decodePayload[DestroyAssetPayload],
+	ChangeJob:              decodePayload[ChangeJobPayload],
+	CreateSkill:            decodePayload[CreateSkillPayload],
+	UpdateSkill:            decodePayload[UpdateSkillPayload],
+	ChangeStyle:            decodePayload[ChangeStylePayload],
+	ValidateCharacterState: decodePayload[ValidateCharacterStatePayload],
+}
+
+// decodePayload decodes a raw payload into a P
+func decodePayload[P any](data json.RawMessage) (any, error) {
+	var payload P
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// RegisterPayload registers P as the payload type of steps taking the action, so the steps can be unmarshalled.
+// Registering an action again replaces its payload type.
+func RegisterPayload[P any](action Action) {
+	payloadLock.Lock()
+	defer payloadLock.Unlock()
+	payloadDecoders[action] = decodePayload[P]
+}
+
+// unmarshalPayload decodes the raw payload of a step taking the action
+func unmarshalPayload(action Action, data json.RawMessage) (any, error) {
+	payloadLock.RLock()
+	decoder, ok := payloadDecoders[action]
+	payloadLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown action: %s", action)
+	}
+
+	payload, err := decoder(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload for action %s: %w", action, err)
+	}
+	return payload, nil
+}